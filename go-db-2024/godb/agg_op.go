@@ -1,5 +1,11 @@
 package godb
 
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
 type Aggregator struct {
 	// Expressions that when applied to tuples from the child operators,
 	// respectively, return the value of the group by key tuple
@@ -10,6 +16,13 @@ type Aggregator struct {
 	newAggState []AggState
 
 	child Operator // the child operator for the inputs to aggregate
+
+	// if set, also compute subtotals for every prefix of groupByFields and a
+	// grand total, as in SQL's GROUP BY ROLLUP
+	rollup bool
+
+	// the largest number of groups the last iteration held in memory at once
+	peakGroups int
 }
 
 type AggType int
@@ -21,14 +34,33 @@ const (
 
 const DefaultGroup int = 0 // for handling the case of no group-by
 
+// Return the partition, of numPartitions (which must be positive), of the group
+// whose key is value, for a hash aggregation that spills its groups to disk in
+// partitions. Values with the same [DBValue.HashKey] share a partition, in every
+// run of the program, so that a group is spilled to a single partition and
+// found there when the partition is read back.
+func partitionKey(value DBValue, numPartitions int) int {
+	return int(stableHash(value.HashKey()) % uint64(numPartitions))
+}
+
 // NewGroupedAggregator Construct an aggregator with a group-by.
 func NewGroupedAggregator(emptyAggState []AggState, groupByFields []Expr, child Operator) *Aggregator {
-	return &Aggregator{groupByFields, emptyAggState, child}
+	return &Aggregator{groupByFields: groupByFields, newAggState: emptyAggState, child: child}
 }
 
 // NewAggregator Construct an aggregator with no group-by.
 func NewAggregator(emptyAggState []AggState, child Operator) *Aggregator {
-	return &Aggregator{nil, emptyAggState, child}
+	return &Aggregator{newAggState: emptyAggState, child: child}
+}
+
+// NewRollupAggregator Construct an aggregator computing GROUP BY
+// ROLLUP(groupByFields). Besides one result per group of all the
+// groupByFields, it returns a subtotal for every group of each prefix of
+// groupByFields, and a grand total. The rolled-up fields of subtotal and grand
+// total tuples are [NullField]s. Results are returned from the finest to the
+// coarsest grouping.
+func NewRollupAggregator(emptyAggState []AggState, groupByFields []Expr, child Operator) *Aggregator {
+	return &Aggregator{groupByFields: groupByFields, newAggState: emptyAggState, child: child, rollup: true}
 }
 
 // Descriptor Return a TupleDescriptor for this aggregation.
@@ -77,6 +109,11 @@ func (a *Aggregator) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 		return nil, GoDBError{MalformedDataError, "child iter unexpectedly nil"}
 	}
 
+	a.peakGroups = 0
+	if a.childSortedOnGroups() {
+		return a.streamingIterator(childIter), nil
+	}
+
 	// the map that stores the aggregation state of each group
 	aggState := make(map[any]*[]AggState)
 	if a.groupByFields == nil {
@@ -92,8 +129,9 @@ func (a *Aggregator) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 		aggState[DefaultGroup] = &newAggState
 	}
 
-	// the list of group key tuples
+	// the list of group key tuples, and their keys in aggState
 	var groupByList []*Tuple
+	var groupKeyList []any
 	// the iterator for iterating thru the finalized aggregation results for each group
 	var finalizedIter func() (*Tuple, error)
 
@@ -117,28 +155,29 @@ func (a *Aggregator) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 					return nil, err
 				}
 
-				key := keygenTup.tupleKey()
-				if aggState[key] == nil {
-					asNew := make([]AggState, len(a.newAggState))
-					aggState[key] = &asNew
-					groupByList = append(groupByList, keygenTup)
-				}
+				groups, keys := a.groupingSets(keygenTup)
+				for i, key := range keys {
+					if aggState[key] == nil {
+						asNew := make([]AggState, len(a.newAggState))
+						aggState[key] = &asNew
+						groupByList = append(groupByList, groups[i])
+						groupKeyList = append(groupKeyList, key)
+						a.peakGroups = max(a.peakGroups, len(groupByList))
+					}
 
-				addTupleToGrpAggState(a, t, aggState[key])
+					addTupleToGrpAggState(a, t, aggState[key])
+				}
 			}
 		}
 
 		if finalizedIter == nil { // builds the iterator for iterating thru the finalized aggregation results for each group
 			if a.groupByFields == nil {
-				var tup *Tuple
-				for i := 0; i < len(a.newAggState); i++ {
-					newTup := (*aggState[DefaultGroup])[i].Finalize()
-					tup = joinTuples(tup, newTup)
-				}
-				finalizedIter = func() (*Tuple, error) { return nil, nil }
-				return tup, nil
+				finalizedIter = sliceIterator(finalizeRows(nil, *aggState[DefaultGroup]))
 			} else {
-				finalizedIter = getFinalizedTuplesIterator(a, groupByList, aggState)
+				if a.rollup {
+					sortByRollupLevel(groupByList, groupKeyList)
+				}
+				finalizedIter = getFinalizedTuplesIterator(a, groupByList, groupKeyList, aggState)
 			}
 		}
 		return finalizedIter()
@@ -171,6 +210,161 @@ func extractGroupByKeyTuple(a *Aggregator, t *Tuple) (reply *Tuple, err error) {
 	return
 }
 
+// PeakGroups Return the largest number of groups the last iteration of the
+// aggregator held in memory at once.
+func (a *Aggregator) PeakGroups() int {
+	return a.peakGroups
+}
+
+// Report whether the child is an [OrderBy] sorting on the group-by fields (in
+// either direction), so that the tuples of every group come one after the
+// other.
+func (a *Aggregator) childSortedOnGroups() bool {
+	oby, ok := a.child.(*OrderBy)
+	if !ok || a.groupByFields == nil || a.rollup || len(oby.orderBy) < len(a.groupByFields) {
+		return false
+	}
+
+	for i, gby := range a.groupByFields {
+		if !sameExpr(gby, oby.orderBy[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Report whether two expressions are known to compute the same value.
+func sameExpr(e1, e2 Expr) bool {
+	f1, ok1 := e1.(*FieldExpr)
+	f2, ok2 := e2.(*FieldExpr)
+	if ok1 && ok2 {
+		return f1.selectField == f2.selectField
+	}
+	return e1 == e2
+}
+
+// Return an iterator aggregating input sorted on the group-by fields, one
+// group at a time. Only the group being aggregated is held in memory.
+func (a *Aggregator) streamingIterator(childIter func() (*Tuple, error)) func() (*Tuple, error) {
+	var (
+		curKey   any
+		curGroup *Tuple
+		curState []AggState
+		done     bool
+	)
+	var pending []*Tuple // the rows of the last group not returned yet
+	finalize := func() {
+		pending = finalizeRows(curGroup, curState)
+		curGroup, curState = nil, nil
+	}
+	next := func() *Tuple {
+		reply := pending[0]
+		pending = pending[1:]
+		return reply
+	}
+
+	return func() (*Tuple, error) {
+		if len(pending) > 0 {
+			return next(), nil
+		}
+		for !done {
+			t, err := childIter()
+			if err != nil {
+				return nil, err
+			}
+			if t == nil {
+				done = true
+				break
+			}
+
+			keygenTup, err := extractGroupByKeyTuple(a, t)
+			if err != nil {
+				return nil, err
+			}
+			key := keygenTup.tupleKey()
+
+			if curState != nil && key != curKey {
+				finalize()
+			}
+			if curState == nil {
+				curKey, curGroup = key, keygenTup
+				curState = make([]AggState, len(a.newAggState))
+				a.peakGroups = 1
+			}
+			addTupleToGrpAggState(a, t, &curState)
+
+			if len(pending) > 0 {
+				return next(), nil
+			}
+		}
+
+		if curState != nil {
+			finalize()
+		}
+		if len(pending) > 0 {
+			return next(), nil
+		}
+		return nil, nil
+	}
+}
+
+// Given the group-by key tuple of a child tuple, return the groups the child
+// tuple belongs to, along with their keys in the aggregation state map. Without
+// rollup this is just the key tuple itself. With rollup, the fields after each
+// prefix of the key tuple are replaced by NULL in turn, down to the grand total
+// group in which all fields are NULL.
+func (a *Aggregator) groupingSets(keygenTup *Tuple) (groups []*Tuple, keys []any) {
+	if !a.rollup {
+		return []*Tuple{keygenTup}, []any{keygenTup.tupleKey()}
+	}
+
+	n := len(keygenTup.Fields)
+	for k := n; k >= 0; k-- {
+		prefix := &Tuple{Desc: TupleDesc{keygenTup.Desc.Fields[:k]}, Fields: keygenTup.Fields[:k]}
+		group := &Tuple{
+			Desc:   keygenTup.Desc,
+			Fields: make([]DBValue, n),
+		}
+		copy(group.Fields, keygenTup.Fields[:k])
+		for i := k; i < n; i++ {
+			group.Fields[i] = NullField{}
+		}
+
+		groups = append(groups, group)
+		keys = append(keys, fmt.Sprintf("%d|%v", k, prefix.tupleKey()))
+	}
+	return
+}
+
+// Stably sort rollup groups (and their keys) from the finest grouping to the
+// grand total, i.e., by their number of NULL fields.
+func sortByRollupLevel(groupByList []*Tuple, groupKeyList []any) {
+	nulls := func(t *Tuple) (n int) {
+		for _, f := range t.Fields {
+			if _, ok := f.(NullField); ok {
+				n++
+			}
+		}
+		return
+	}
+
+	idx := make([]int, len(groupByList))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return nulls(groupByList[idx[i]]) < nulls(groupByList[idx[j]])
+	})
+
+	groups := make([]*Tuple, len(idx))
+	keys := make([]any, len(idx))
+	for i, from := range idx {
+		groups[i], keys[i] = groupByList[from], groupKeyList[from]
+	}
+	copy(groupByList, groups)
+	copy(groupKeyList, keys)
+}
+
 // Given a tuple t from child and (a pointer to) the array of partially computed
 // aggregates grpAggState, add t into all partial aggregations using
 // [AggState.AddTuple]. If any of the array elements is of grpAggState is null
@@ -197,24 +391,47 @@ func addTupleToGrpAggState(a *Aggregator, t *Tuple, grpAggState *[]AggState) {
 // HINT: you can call [aggState.Finalize] to get the field for each AggState.
 // Then, you should get the groupByTuple and merge it with each of the AggState
 // tuples using the joinTuples function in tuple.go you wrote in lab 1.
-func getFinalizedTuplesIterator(a *Aggregator, groupByList []*Tuple, aggState map[any]*[]AggState) func() (*Tuple, error) {
-	var index int
+func getFinalizedTuplesIterator(a *Aggregator, groupByList []*Tuple, groupKeyList []any, aggState map[any]*[]AggState) func() (*Tuple, error) {
+	var (
+		index   int
+		pending []*Tuple // the rows of the last group not returned yet
+	)
 	return func() (reply *Tuple, err error) {
-		if index >= len(groupByList) {
-			return
+		for len(pending) == 0 {
+			if index >= len(groupByList) {
+				return
+			}
+			pending = finalizeRows(groupByList[index], *aggState[groupKeyList[index]])
+			index++
 		}
 
-		curGroup := groupByList[index]
-		reply = &Tuple{
-			Desc:   curGroup.Desc,
-			Fields: curGroup.Fields,
-		}
+		reply, pending = pending[0], pending[1:]
+		return
+	}
+}
 
-		for _, state := range *aggState[curGroup.tupleKey()] {
-			reply = joinTuples(reply, state.Finalize())
+// Return the result rows of a group: the group-by key tuple group (nil without
+// group-by) joined with the results of the aggregation states of the group, a
+// row per combination of the rows of its [MultiRowAggState]s.
+func finalizeRows(group *Tuple, states []AggState) []*Tuple {
+	rows := []*Tuple{group}
+	for _, state := range states {
+		results := []*Tuple{state.Finalize()}
+		if multi, ok := state.(MultiRowAggState); ok {
+			results = multi.FinalizeRows()
 		}
-
-		index++
-		return
+		joined := make([]*Tuple, 0, len(rows)*len(results))
+		for _, row := range rows {
+			for _, result := range results {
+				if row == nil {
+					joined = append(joined, result)
+					continue
+				}
+				// joinTuples appends to the fields of row, which other rows share
+				joined = append(joined, joinTuples(&Tuple{Desc: row.Desc, Fields: slices.Clip(row.Fields)}, result))
+			}
+		}
+		rows = joined
 	}
+	return rows
 }
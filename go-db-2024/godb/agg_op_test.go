@@ -1,6 +1,9 @@
 package godb
 
 import (
+	"fmt"
+	"math/rand"
+	"os"
 	"testing"
 )
 
@@ -373,3 +376,477 @@ func TestAggRepeatedIteration(t *testing.T) {
 		t.Errorf("count changed on repeated iteration")
 	}
 }
+
+func TestAggGbyFilteredCount(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars(t)
+	t3 := Tuple{Desc: t1.Desc, Fields: []DBValue{StringField{"sam"}, IntField{40}}}
+	for _, tup := range []*Tuple{&t1, &t2, &t2, &t3, &t3} {
+		insertTupleForTest(t, hf, tup, tid)
+	}
+
+	gbyFields := []Expr{&FieldExpr{hf.Descriptor().Fields[0]}}
+	ageExpr := FieldExpr{t1.Desc.Fields[1]}
+	all := CountAggState{}
+	all.Init("count", &ageExpr)
+	filtered := NewFilteredAggState(&CountAggState{}, &ageExpr, OpGt, &ConstExpr{IntField{30}, IntType})
+	filtered.Init("old", &ageExpr)
+
+	agg := NewGroupedAggregator([]AggState{&all, filtered}, gbyFields, hf)
+	iter, err := agg.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	fields := []FieldType{
+		{"name", "", StringType},
+		{"count", "", IntType},
+		{"old", "", IntType},
+	}
+	outt1 := Tuple{TupleDesc{fields}, []DBValue{StringField{"sam"}, IntField{3}, IntField{2}}, nil}
+	outt2 := Tuple{TupleDesc{fields}, []DBValue{StringField{"george jones"}, IntField{2}, IntField{2}}, nil}
+	if err := CheckIfOutputMatchesUnordered(iter, []*Tuple{&outt1, &outt2}); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// a filter that rejects every tuple yields a count of zero
+	none := NewFilteredAggState(&CountAggState{}, &ageExpr, OpLt, &ConstExpr{IntField{0}, IntType})
+	none.Init("none", &ageExpr)
+	iter, err = NewAggregator([]AggState{none}, hf).Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tup, err := iter()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup.Fields[0].(IntField).Value != 0 {
+		t.Errorf("expected a filtered count of 0, got %v", tup.Fields[0])
+	}
+}
+
+func TestAggRollupCount(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars(t)
+	t3 := Tuple{Desc: t1.Desc, Fields: []DBValue{StringField{"sam"}, IntField{40}}}
+	for _, tup := range []*Tuple{&t1, &t2, &t2, &t3, &t3} {
+		insertTupleForTest(t, hf, tup, tid)
+	}
+
+	gbyFields := []Expr{&FieldExpr{hf.Descriptor().Fields[0]}, &FieldExpr{hf.Descriptor().Fields[1]}}
+	sa := CountAggState{}
+	expr := FieldExpr{t1.Desc.Fields[0]}
+	sa.Init("count", &expr)
+
+	agg := NewRollupAggregator([]AggState{&sa}, gbyFields, hf)
+	iter, err := agg.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	fields := []FieldType{
+		{"name", "", StringType},
+		{"age", "", IntType},
+		{"count", "", IntType},
+	}
+	out := func(vals ...DBValue) *Tuple {
+		return &Tuple{TupleDesc{fields}, vals, nil}
+	}
+	ts := []*Tuple{
+		out(StringField{"sam"}, IntField{25}, IntField{1}),
+		out(StringField{"george jones"}, IntField{999}, IntField{2}),
+		out(StringField{"sam"}, IntField{40}, IntField{2}),
+		out(StringField{"sam"}, NullField{}, IntField{3}),
+		out(StringField{"george jones"}, NullField{}, IntField{2}),
+		out(NullField{}, NullField{}, IntField{5}),
+	}
+	if err := CheckIfOutputMatches(iter, ts); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func TestAggGbySortedChildStreams(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars(t)
+	t3 := Tuple{Desc: t1.Desc, Fields: []DBValue{StringField{"ann"}, IntField{7}}}
+	for _, tup := range []*Tuple{&t1, &t2, &t3, &t1, &t2, &t1} {
+		insertTupleForTest(t, hf, tup, tid)
+	}
+
+	nameExpr := FieldExpr{t1.Desc.Fields[0]}
+	sa := SumAggState{}
+	sa.Init("sum", &FieldExpr{t1.Desc.Fields[1]})
+	fields := []FieldType{
+		{"name", "", StringType},
+		{"sum", "", IntType},
+	}
+	expected := []*Tuple{
+		{TupleDesc{fields}, []DBValue{StringField{"sam"}, IntField{75}}, nil},
+		{TupleDesc{fields}, []DBValue{StringField{"george jones"}, IntField{1998}}, nil},
+		{TupleDesc{fields}, []DBValue{StringField{"ann"}, IntField{7}}, nil},
+	}
+
+	sorted, err := NewOrderBy([]Expr{&nameExpr}, hf, []bool{false})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	agg := NewGroupedAggregator([]AggState{&sa}, []Expr{&FieldExpr{t1.Desc.Fields[0]}}, sorted)
+	iter, err := agg.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatches(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if agg.PeakGroups() != 1 {
+		t.Errorf("expected a sorted child to be aggregated one group at a time, held %d groups", agg.PeakGroups())
+	}
+
+	// an unsorted child falls back to hashing every group
+	agg = NewGroupedAggregator([]AggState{&sa}, []Expr{&nameExpr}, hf)
+	iter, err = agg.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatchesUnordered(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if agg.PeakGroups() != 3 {
+		t.Errorf("expected the hash aggregation to hold 3 groups, held %d", agg.PeakGroups())
+	}
+}
+
+func TestAggBoolAndOr(t *testing.T) {
+	td := TupleDesc{[]FieldType{{Fname: "valid", Ftype: IntType}}}
+	expr := FieldExpr{td.Fields[0]}
+	cases := []struct {
+		vals          []int64
+		andRes, orRes int64
+	}{
+		{[]int64{1, 1, 1}, 1, 1},
+		{[]int64{0, 0, 0}, 0, 0},
+		{[]int64{1, 0, 1}, 0, 1},
+	}
+	for _, c := range cases {
+		and, or := BoolAndAggState{}, BoolOrAggState{}
+		if err := and.Init("and", &expr); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := or.Init("or", &expr); err != nil {
+			t.Fatalf(err.Error())
+		}
+		for _, v := range c.vals[:len(c.vals)-1] {
+			and.AddTuple(&Tuple{td, []DBValue{IntField{v}}, nil})
+			or.AddTuple(&Tuple{td, []DBValue{IntField{v}}, nil})
+		}
+		// copies carry the running value along
+		and, or = *and.Copy().(*BoolAndAggState), *or.Copy().(*BoolOrAggState)
+		last := &Tuple{td, []DBValue{IntField{c.vals[len(c.vals)-1]}}, nil}
+		and.AddTuple(last)
+		or.AddTuple(last)
+		if got := and.Finalize().Fields[0].(IntField).Value; got != c.andRes {
+			t.Errorf("bool_and(%v): expected %d, got %d", c.vals, c.andRes, got)
+		}
+		if got := or.Finalize().Fields[0].(IntField).Value; got != c.orRes {
+			t.Errorf("bool_or(%v): expected %d, got %d", c.vals, c.orRes, got)
+		}
+	}
+
+	_, t1, _ := makeTupleTestVars()
+	if err := (&BoolAndAggState{}).Init("and", &FieldExpr{t1.Desc.Fields[0]}); err == nil {
+		t.Errorf("expected an error for a string expression")
+	}
+
+	// over a bool column, the results are bools
+	boolTd := TupleDesc{[]FieldType{{Fname: "valid", Ftype: BoolType}}}
+	boolExpr := FieldExpr{boolTd.Fields[0]}
+	boolCases := []struct {
+		vals          []bool
+		andRes, orRes bool
+	}{
+		{[]bool{true, true}, true, true},
+		{[]bool{false, false}, false, false},
+		{[]bool{true, false}, false, true},
+		{nil, true, false},
+	}
+	for _, c := range boolCases {
+		and, or := BoolAndAggState{}, BoolOrAggState{}
+		if err := and.Init("and", &boolExpr); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := or.Init("or", &boolExpr); err != nil {
+			t.Fatalf(err.Error())
+		}
+		for _, v := range c.vals {
+			and.AddTuple(&Tuple{boolTd, []DBValue{BoolField{v}}, nil})
+			or.AddTuple(&Tuple{boolTd, []DBValue{BoolField{v}}, nil})
+		}
+		if ftype := and.GetTupleDesc().Fields[0].Ftype; ftype != BoolType {
+			t.Errorf("bool_and of a bool column: expected a bool column, got %v", ftype)
+		}
+		if got := and.Copy().Finalize().Fields[0].(BoolField).Value; got != c.andRes {
+			t.Errorf("bool_and(%v): expected %t, got %t", c.vals, c.andRes, got)
+		}
+		if got := or.Copy().Finalize().Fields[0].(BoolField).Value; got != c.orRes {
+			t.Errorf("bool_or(%v): expected %t, got %t", c.vals, c.orRes, got)
+		}
+	}
+}
+
+func TestAggPercentileSpill(t *testing.T) {
+	td := TupleDesc{[]FieldType{{Fname: "n", Ftype: IntType}}}
+	expr := FieldExpr{td.Fields[0]}
+	const ntups, threshold = 5000, 64
+	vals := rand.New(rand.NewSource(1)).Perm(ntups)
+
+	for _, c := range []struct {
+		fraction float64
+		expected int64
+	}{{0.5, 2499}, {0.9, 4499}, {0, 0}, {1, ntups - 1}} {
+		p := NewPercentileAggState(c.fraction, threshold)
+		if err := p.Init("p", &expr); err != nil {
+			t.Fatalf(err.Error())
+		}
+		for _, v := range vals {
+			p.AddTuple(&Tuple{td, []DBValue{IntField{int64(v)}}, nil})
+			if len(p.values) >= threshold {
+				t.Fatalf("expected at most %d values in memory, got %d", threshold, len(p.values))
+			}
+		}
+		if len(p.runs) != ntups/threshold {
+			t.Fatalf("expected %d spilled runs, got %d", ntups/threshold, len(p.runs))
+		}
+		runs := p.runs
+		if got := p.Finalize().Fields[0].(IntField).Value; got != c.expected {
+			t.Errorf("percentile %v: expected %d, got %d", c.fraction, c.expected, got)
+		}
+		for _, name := range runs {
+			if _, err := os.Stat(name); !os.IsNotExist(err) {
+				t.Errorf("expected run %s to be removed", name)
+			}
+		}
+	}
+
+	p := NewPercentileAggState(1.5, threshold)
+	if err := p.Init("p", &expr); err == nil {
+		t.Errorf("expected an error for a fraction above 1")
+	}
+}
+
+func TestAggDefaultAlias(t *testing.T) {
+	td := TupleDesc{[]FieldType{{Fname: "total_ons", TableQualifier: "ridership", Ftype: IntType}}}
+	expr := &FieldExpr{td.Fields[0]}
+	for _, c := range []struct {
+		agg      AggState
+		expected string
+	}{
+		{&CountAggState{}, "count(total_ons)"},
+		{&SumAggState{}, "sum(total_ons)"},
+		{&AvgAggState{}, "avg(total_ons)"},
+		{&MaxAggState{}, "max(total_ons)"},
+		{&MinAggState{}, "min(total_ons)"},
+		{&BoolAndAggState{}, "bool_and(total_ons)"},
+		{&BoolOrAggState{}, "bool_or(total_ons)"},
+		{NewPercentileAggState(0.5, 0), "percentile(total_ons)"},
+		{NewTopKFrequentAggState(2), "top_k(total_ons)"},
+		{NewFilteredAggState(&SumAggState{}, expr, OpGt, IntConst(0)), "sum(total_ons)"},
+	} {
+		if err := c.agg.Init("", expr); err != nil {
+			t.Fatalf(err.Error())
+		}
+		c.agg.AddTuple(&Tuple{td, []DBValue{IntField{3}}, nil})
+		if name := c.agg.Finalize().Desc.Fields[0].Fname; name != c.expected {
+			t.Errorf("expected the default name %s, got %s", c.expected, name)
+		}
+	}
+
+	// an alias is kept, and a computed expression has no column to name
+	count := &CountAggState{}
+	count.Init("n", expr)
+	if name := count.GetTupleDesc().Fields[0].Fname; name != "n" {
+		t.Errorf("expected the alias n, got %s", name)
+	}
+	count.Init("", IntConst(1))
+	if name := count.GetTupleDesc().Fields[0].Fname; name != "count()" {
+		t.Errorf("expected the default name count(), got %s", name)
+	}
+}
+
+func TestAggTopKFrequent(t *testing.T) {
+	td := TupleDesc{[]FieldType{{Fname: "n", Ftype: IntType}}}
+	expr := FieldExpr{td.Fields[0]}
+	const k = 10
+	// a few heavy hitters among many values seen once
+	occurrences := map[int64]int64{1: 200, 2: 150, 3: 100}
+	var vals []int64
+	for v, n := range occurrences {
+		for i := int64(0); i < n; i++ {
+			vals = append(vals, v)
+		}
+	}
+	for v := int64(1000); v < 1500; v++ {
+		vals = append(vals, v)
+	}
+	rand.New(rand.NewSource(1)).Shuffle(len(vals), func(i, j int) { vals[i], vals[j] = vals[j], vals[i] })
+	bound := int64(len(vals) / k)
+
+	top := NewTopKFrequentAggState(k)
+	if err := top.Init("top", &expr); err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, v := range vals[:len(vals)/2] {
+		top.AddTuple(&Tuple{td, []DBValue{IntField{v}}, nil})
+	}
+	// copies count on their own
+	cp := top.Copy().(*TopKFrequentAggState)
+	for _, v := range vals[len(vals)/2:] {
+		top.AddTuple(&Tuple{td, []DBValue{IntField{v}}, nil})
+	}
+	top.AddTuple(&Tuple{td, []DBValue{NullField{}}, nil})
+	if cp.n != int64(len(vals)/2) {
+		t.Errorf("expected the copy to hold %d values, got %d", len(vals)/2, cp.n)
+	}
+
+	rows := top.FinalizeRows()
+	if len(rows) != k {
+		t.Fatalf("expected %d values, got %d", k, len(rows))
+	}
+	for v, n := range occurrences {
+		found := false
+		for _, row := range rows {
+			if row.Fields[0] != (IntField{v}) {
+				continue
+			}
+			found = true
+			if count := row.Fields[1].(IntField).Value; count < n || count > n+bound {
+				t.Errorf("value %d: expected a count within [%d, %d], got %d", v, n, n+bound, count)
+			}
+		}
+		if !found {
+			t.Errorf("expected the heavy hitter %d to be reported, got %v", v, rows)
+		}
+	}
+	for i := 1; i < len(rows); i++ {
+		if rows[i-1].Fields[1].(IntField).Value < rows[i].Fields[1].(IntField).Value {
+			t.Fatalf("expected the values from the most frequent down, got %v", rows)
+		}
+	}
+	if first := top.Finalize(); first.Fields[0] != (IntField{1}) {
+		t.Errorf("expected Finalize to return the most frequent value, got %v", first)
+	}
+	if names := top.GetTupleDesc().Fields; names[0].Fname != "top" || names[1].Fname != "top_count" {
+		t.Errorf("expected the fields top and top_count, got %v", names)
+	}
+
+	empty := NewTopKFrequentAggState(k)
+	empty.Init("top", &expr)
+	if res := empty.Finalize(); res.Fields[0] != (NullField{}) || res.Fields[1] != (IntField{0}) {
+		t.Errorf("expected NULL and 0 without values, got %v", res)
+	}
+	if err := NewTopKFrequentAggState(0).Init("top", &expr); err == nil {
+		t.Errorf("expected an error for k = 0")
+	}
+}
+
+func TestAggTopKFrequentRows(t *testing.T) {
+	td, _, _, hf, _, tid := makeTestVars(t)
+	for _, r := range []struct {
+		name string
+		age  int64
+	}{{"a", 1}, {"b", 5}, {"a", 1}, {"a", 2}, {"b", 5}, {"a", 1}} {
+		insertTupleForTest(t, hf, &Tuple{td, []DBValue{StringField{r.name}, IntField{r.age}}, nil}, tid)
+	}
+	nameExpr := FieldExpr{td.Fields[0]}
+	ageExpr := FieldExpr{td.Fields[1]}
+	newStates := func() []AggState {
+		count := &CountAggState{}
+		count.Init("count", &nameExpr)
+		// large enough to count every value exactly
+		top := NewTopKFrequentAggState(3)
+		top.Init("top", &ageExpr)
+		return []AggState{count, top}
+	}
+
+	// without group-by, a row per value
+	desc := TupleDesc{[]FieldType{{Fname: "count", Ftype: IntType}, {Fname: "top", Ftype: IntType}, {Fname: "top_count", Ftype: IntType}}}
+	iter, err := NewAggregator(newStates(), hf).Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatches(iter, []*Tuple{
+		{desc, []DBValue{IntField{6}, IntField{1}, IntField{3}}, nil},
+		{desc, []DBValue{IntField{6}, IntField{5}, IntField{2}}, nil},
+		{desc, []DBValue{IntField{6}, IntField{2}, IntField{1}}, nil},
+	}); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// with group-by, a row per value of every group, by hashing and streaming
+	desc = TupleDesc{append([]FieldType{{Fname: "name", Ftype: StringType}}, desc.Fields...)}
+	expected := []*Tuple{
+		{desc, []DBValue{StringField{"a"}, IntField{4}, IntField{1}, IntField{3}}, nil},
+		{desc, []DBValue{StringField{"a"}, IntField{4}, IntField{2}, IntField{1}}, nil},
+		{desc, []DBValue{StringField{"b"}, IntField{2}, IntField{5}, IntField{2}}, nil},
+	}
+	iter, err = NewGroupedAggregator(newStates(), []Expr{&nameExpr}, hf).Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatchesUnordered(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+	sorted, err := NewOrderBy([]Expr{&nameExpr}, hf, []bool{true})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err = NewGroupedAggregator(newStates(), []Expr{&nameExpr}, sorted).Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatches(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func TestAggPartitionKey(t *testing.T) {
+	const numPartitions = 8
+	// the partitions do not depend on the run of the program
+	for _, c := range []struct {
+		value     DBValue
+		partition int
+	}{
+		{IntField{42}, 5},
+		{StringField{"sam"}, 5},
+		{NullField{}, 2},
+	} {
+		if p := partitionKey(c.value, numPartitions); p != c.partition {
+			t.Errorf("expected %v in partition %d, got %d", c.value, c.partition, p)
+		}
+	}
+	// values equal as group keys share a partition
+	if partitionKey(IntField{5}, numPartitions) != partitionKey(DecimalField{500, 2}, numPartitions) {
+		t.Errorf("expected 5 and 5.00 in the same partition")
+	}
+
+	// every group is in exactly one partition, and the groups spread across all
+	groups := make(map[any]int)
+	sizes := make([]int, numPartitions)
+	for i := 0; i < 1000; i++ {
+		for _, v := range []DBValue{IntField{int64(i)}, StringField{fmt.Sprintf("group%d", i)}} {
+			p := partitionKey(v, numPartitions)
+			if p < 0 || p >= numPartitions {
+				t.Fatalf("expected a partition in [0, %d), got %d", numPartitions, p)
+			}
+			if prev, ok := groups[v.HashKey()]; ok && prev != p {
+				t.Fatalf("expected %v in a single partition, got %d and %d", v, prev, p)
+			}
+			if p2 := partitionKey(v, numPartitions); p2 != p {
+				t.Fatalf("expected %v in a single partition, got %d and %d", v, p, p2)
+			}
+			groups[v.HashKey()] = p
+			sizes[p]++
+		}
+	}
+	for p, size := range sizes {
+		if size < 2000/numPartitions/2 {
+			t.Errorf("expected about %d groups per partition, got %d in partition %d", 2000/numPartitions, size, p)
+		}
+	}
+}
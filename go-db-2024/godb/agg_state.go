@@ -1,10 +1,13 @@
 package godb
 
+import "fmt"
+
 // AggState interface for an aggregation state
 type AggState interface {
 	// Init Initializes an aggregation state. Is supplied with an alias, an expr to
 	// evaluate an input tuple into a DBValue, and a getter to extract from the
-	// DBValue its int or string field's value.
+	// DBValue its int or string field's value. An empty alias names the result
+	// after the aggregate and its column, e.g., sum(total_ons).
 	Init(alias string, expr Expr) error
 
 	// Copy Makes an copy of the aggregation state.
@@ -20,6 +23,30 @@ type AggState interface {
 	GetTupleDesc() *TupleDesc
 }
 
+// MultiRowAggState is an AggState whose result is several tuples, e.g., the
+// values of a [TopKFrequentAggState]. An [Aggregator] returns a result row per
+// tuple of FinalizeRows for every group, each combined with the results of the
+// other aggregation states of the group.
+type MultiRowAggState interface {
+	AggState
+
+	// FinalizeRows Returns the final result of the aggregation as tuples,
+	// possibly none. Finalize returns the first of them.
+	FinalizeRows() []*Tuple
+}
+
+// Return alias, or if it is empty the default name of the result of aggregate
+// fn over expr: fn(column), or fn() if expr is not a column.
+func aggAlias(alias string, fn string, expr Expr) string {
+	if alias != "" {
+		return alias
+	}
+	if field, ok := expr.(*FieldExpr); ok {
+		return fmt.Sprintf("%s(%s)", fn, field.selectField.Fname)
+	}
+	return fn + "()"
+}
+
 // CountAggState Implements the aggregation state for COUNT
 // We are supplying the implementation of CountAggState as an example. You need to
 // implement the rest of the aggregation states.
@@ -36,7 +63,7 @@ func (a *CountAggState) Copy() AggState {
 func (a *CountAggState) Init(alias string, expr Expr) error {
 	a.count = 0
 	a.expr = expr
-	a.alias = alias
+	a.alias = aggAlias(alias, "count", expr)
 	return nil
 }
 
@@ -60,15 +87,18 @@ func (a *CountAggState) GetTupleDesc() *TupleDesc {
 	return &td
 }
 
-// SumAggState Implements the aggregation state for SUM
+// SumAggState Implements the aggregation state for SUM. The sum of a decimal
+// expression is a decimal of its scale, accumulated exactly in scaled units.
 type SumAggState struct {
-	alias string
-	expr  Expr
-	sum   int64
+	alias   string
+	expr    Expr
+	sum     int64
+	decimal bool  // whether expr is a decimal
+	scale   uint8 // the scale of a decimal expr
 }
 
 func (a *SumAggState) Copy() AggState {
-	return &SumAggState{a.alias, a.expr, a.sum}
+	return &SumAggState{a.alias, a.expr, a.sum, a.decimal, a.scale}
 }
 
 func intAggGetter(v DBValue) any {
@@ -82,9 +112,12 @@ func stringAggGetter(v DBValue) any {
 }
 
 func (a *SumAggState) Init(alias string, expr Expr) error {
-	a.alias = alias
+	a.alias = aggAlias(alias, "sum", expr)
 	a.expr = expr
 	a.sum = 0
+	ft := expr.GetExprType()
+	a.decimal = ft.Ftype.kind() == DecimalType
+	a.scale = ft.Ftype.Scale()
 	return nil
 }
 
@@ -94,6 +127,19 @@ func (a *SumAggState) AddTuple(t *Tuple) {
 		return
 	}
 
+	if a.decimal {
+		val, ok := toDecimal(tmpVal)
+		if !ok {
+			return
+		}
+		units, ok := val.rescale(a.scale)
+		if !ok {
+			return
+		}
+		a.sum += units
+		return
+	}
+
 	val, ok := tmpVal.(IntField)
 	if !ok {
 		return
@@ -103,6 +149,11 @@ func (a *SumAggState) AddTuple(t *Tuple) {
 }
 
 func (a *SumAggState) GetTupleDesc() *TupleDesc {
+	if a.decimal {
+		return &TupleDesc{
+			Fields: []FieldType{{a.alias, "", DecimalTypeOf(a.scale)}},
+		}
+	}
 	return &TupleDesc{
 		Fields: []FieldType{{a.alias, "", IntType}},
 	}
@@ -110,6 +161,9 @@ func (a *SumAggState) GetTupleDesc() *TupleDesc {
 
 func (a *SumAggState) Finalize() *Tuple {
 	td := a.GetTupleDesc()
+	if a.decimal {
+		return &Tuple{*td, []DBValue{DecimalField{a.sum, a.scale}}, nil}
+	}
 	return &Tuple{*td, []DBValue{IntField{a.sum}}, nil}
 }
 
@@ -128,7 +182,7 @@ func (a *AvgAggState) Copy() AggState {
 }
 
 func (a *AvgAggState) Init(alias string, expr Expr) error {
-	a.alias = alias
+	a.alias = aggAlias(alias, "avg", expr)
 	a.expr = expr
 	a.sum = 0
 	a.count = 0
@@ -175,7 +229,7 @@ func (a *MaxAggState) Copy() AggState {
 }
 
 func (a *MaxAggState) Init(alias string, expr Expr) error {
-	a.alias = alias
+	a.alias = aggAlias(alias, "max", expr)
 	a.expr = expr
 	a.max = nil
 	return nil
@@ -222,7 +276,7 @@ func (a *MinAggState) Copy() AggState {
 }
 
 func (a *MinAggState) Init(alias string, expr Expr) error {
-	a.alias = alias
+	a.alias = aggAlias(alias, "min", expr)
 	a.expr = expr
 	a.min = nil
 	return nil
@@ -254,3 +308,183 @@ func (a *MinAggState) Finalize() *Tuple {
 	td := a.GetTupleDesc()
 	return &Tuple{*td, []DBValue{a.min}, nil}
 }
+
+// FilteredAggState Wraps another aggregation state so that it only sees the
+// tuples satisfying a predicate, as in SQL's SUM(x) FILTER (WHERE cond). The
+// predicate has the same form as a [Filter]: left op right.
+type FilteredAggState struct {
+	agg   AggState
+	left  Expr
+	op    BoolOp
+	right Expr
+}
+
+// NewFilteredAggState Construct an aggregation state that adds a tuple to agg
+// only if left op right holds for it.
+func NewFilteredAggState(agg AggState, left Expr, op BoolOp, right Expr) *FilteredAggState {
+	return &FilteredAggState{agg, left, op, right}
+}
+
+func (a *FilteredAggState) Copy() AggState {
+	return &FilteredAggState{a.agg.Copy(), a.left, a.op, a.right}
+}
+
+func (a *FilteredAggState) Init(alias string, expr Expr) error {
+	return a.agg.Init(alias, expr)
+}
+
+func (a *FilteredAggState) AddTuple(t *Tuple) {
+	leftVal, err := a.left.EvalExpr(t)
+	if err != nil {
+		return
+	}
+
+	rightVal, err := a.right.EvalExpr(t)
+	if err != nil {
+		return
+	}
+
+	if !leftVal.EvalPred(rightVal, a.op) {
+		return
+	}
+	a.agg.AddTuple(t)
+}
+
+func (a *FilteredAggState) GetTupleDesc() *TupleDesc {
+	return a.agg.GetTupleDesc()
+}
+
+func (a *FilteredAggState) Finalize() *Tuple {
+	return a.agg.Finalize()
+}
+
+// BoolAndAggState Implements the aggregation state for BOOL_AND over a bool
+// expression, or an int expression where any non-zero value is true. The
+// result is true if every value is true and false otherwise, as a BoolField for
+// a bool expression and as 1 or 0 for an int one; an empty input is true.
+type BoolAndAggState struct {
+	alias  string
+	expr   Expr
+	ftype  DBType
+	result bool
+}
+
+func (a *BoolAndAggState) Copy() AggState {
+	return &BoolAndAggState{a.alias, a.expr, a.ftype, a.result}
+}
+
+func (a *BoolAndAggState) Init(alias string, expr Expr) error {
+	ftype := expr.GetExprType().Ftype
+	if ftype != BoolType && ftype != IntType {
+		return GoDBError{TypeMismatchError, "bool_and needs a bool or int expression"}
+	}
+	a.alias = aggAlias(alias, "bool_and", expr)
+	a.expr = expr
+	a.ftype = ftype
+	a.result = true
+	return nil
+}
+
+func (a *BoolAndAggState) AddTuple(t *Tuple) {
+	tmpVal, err := a.expr.EvalExpr(t)
+	if err != nil {
+		return
+	}
+
+	val, ok := truthValue(tmpVal)
+	if !ok {
+		return
+	}
+
+	a.result = a.result && val
+}
+
+func (a *BoolAndAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{
+		Fields: []FieldType{{a.alias, "", a.ftype}},
+	}
+}
+
+func (a *BoolAndAggState) Finalize() *Tuple {
+	td := a.GetTupleDesc()
+	return &Tuple{*td, []DBValue{boolResultField(a.result, a.ftype)}, nil}
+}
+
+// BoolOrAggState Implements the aggregation state for BOOL_OR over a bool
+// expression, or an int expression where any non-zero value is true. The
+// result is true if some value is true and false otherwise, as a BoolField for
+// a bool expression and as 1 or 0 for an int one; an empty input is false.
+type BoolOrAggState struct {
+	alias  string
+	expr   Expr
+	ftype  DBType
+	result bool
+}
+
+func (a *BoolOrAggState) Copy() AggState {
+	return &BoolOrAggState{a.alias, a.expr, a.ftype, a.result}
+}
+
+func (a *BoolOrAggState) Init(alias string, expr Expr) error {
+	ftype := expr.GetExprType().Ftype
+	if ftype != BoolType && ftype != IntType {
+		return GoDBError{TypeMismatchError, "bool_or needs a bool or int expression"}
+	}
+	a.alias = aggAlias(alias, "bool_or", expr)
+	a.expr = expr
+	a.ftype = ftype
+	a.result = false
+	return nil
+}
+
+func (a *BoolOrAggState) AddTuple(t *Tuple) {
+	tmpVal, err := a.expr.EvalExpr(t)
+	if err != nil {
+		return
+	}
+
+	val, ok := truthValue(tmpVal)
+	if !ok {
+		return
+	}
+
+	a.result = a.result || val
+}
+
+func (a *BoolOrAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{
+		Fields: []FieldType{{a.alias, "", a.ftype}},
+	}
+}
+
+func (a *BoolOrAggState) Finalize() *Tuple {
+	td := a.GetTupleDesc()
+	return &Tuple{*td, []DBValue{boolResultField(a.result, a.ftype)}, nil}
+}
+
+// Return the truth value of a BoolField, or of an IntField, which is true if
+// non-zero, and whether v is one of those.
+func truthValue(v DBValue) (bool, bool) {
+	switch v := v.(type) {
+	case BoolField:
+		return v.Value, true
+	case IntField:
+		return v.Value != 0, true
+	}
+	return false, false
+}
+
+// Return b as a field of type ftype, a BoolField or an IntField of 1 or 0.
+func boolResultField(b bool, ftype DBType) DBValue {
+	if ftype == BoolType {
+		return BoolField{b}
+	}
+	return boolToIntField(b)
+}
+
+func boolToIntField(b bool) IntField {
+	if b {
+		return IntField{1}
+	}
+	return IntField{0}
+}
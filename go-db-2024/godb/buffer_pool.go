@@ -7,7 +7,10 @@ package godb
 
 import (
 	"fmt"
+	"slices"
+	"sort"
 	"sync"
+	"sync/atomic"
 )
 
 // RWPerm Permissions used to when reading / locking pages
@@ -18,17 +21,79 @@ const (
 	WritePerm RWPerm = iota
 )
 
+// AccessHint tells the buffer pool how a page is being accessed, see
+// [BufferPool.GetPageWithHint]
+type AccessHint int
+
+const (
+	// RandomAccess pages may be accessed again soon, and are worth caching
+	RandomAccess AccessHint = iota
+	// SequentialAccess pages are read once by a scan, and are evicted first
+	SequentialAccess AccessHint = iota
+)
+
 type BufferPool struct {
 	sync.RWMutex
 	PageNum int
 	Pages   map[any]Page
+
+	// the cached pages that were read with SequentialAccess, and have not been
+	// accessed randomly since; they are evicted before the other pages
+	scanPages map[any]struct{}
+	// the number of GetPages batches loading every page, which is not evicted
+	// until they all return
+	pinned map[any]int
+
+	// the number of GetPage calls, and of those that had to read the page
+	// from disk, for statistics
+	getPageCalls atomic.Int64
+	misses       atomic.Int64
+
+	// the number of GetPage calls for every page, see [BufferPool.WarmFromStats]
+	accessLock sync.Mutex
+	accesses   map[any]*pageAccess
+
+	// the running transactions, and the running transaction that got every
+	// page for writing, which the other transactions may not write to until
+	// it ends (see [BufferPool.GetPage])
+	txnLock    sync.Mutex
+	activeTxns map[TransactionID]*txnState
+	pageOwners map[any]TransactionID
+}
+
+// the state of a running transaction
+type txnState struct {
+	files    map[txnFile]struct{} // the files it wrote to
+	pages    map[any]struct{}     // the keys of the pages it got for writing
+	beginSeq int64                // the write sequence number (see [nextWriteSeq]) as of its beginning
+}
+
+// txnFile is implemented by the files that keep the writes of running
+// transactions apart from other transactions (see [HeapFile]).
+type txnFile interface {
+	// endTransaction makes the writes of tid visible to all if commit is set,
+	// and forgets them otherwise, once the buffer pool has flushed or
+	// discarded the pages tid dirtied
+	endTransaction(tid TransactionID, commit bool)
+}
+
+// number of accesses to a page
+type pageAccess struct {
+	file   DBFile
+	pageNo int
+	count  int64
 }
 
 // NewBufferPool Create a new BufferPool with the specified number of pages
 func NewBufferPool(numPages int) (buf *BufferPool, err error) {
 	buf = &BufferPool{
-		PageNum: numPages,
-		Pages:   make(map[any]Page),
+		PageNum:    numPages,
+		Pages:      make(map[any]Page),
+		scanPages:  make(map[any]struct{}),
+		pinned:     make(map[any]int),
+		accesses:   make(map[any]*pageAccess),
+		activeTxns: make(map[TransactionID]*txnState),
+		pageOwners: make(map[any]TransactionID),
 	}
 	return
 }
@@ -57,11 +122,44 @@ func (bp *BufferPool) FlushAllPages() {
 	}
 }
 
+// Flush the dirty pages of file cached in the buffer pool, and mark them as not
+// dirty. Unlike [BufferPool.FlushAllPages], the first error is returned.
+func (bp *BufferPool) flushFilePages(file DBFile) error {
+	bp.Lock()
+	defer bp.Unlock()
+
+	for _, page := range bp.Pages {
+		if page.getFile() != file || !page.isDirty() {
+			continue
+		}
+		if err := file.flushPage(page); err != nil {
+			DPrintf("BufferPool flushFilePages err:%v", err)
+			return err
+		}
+		page.setDirty(0, false)
+	}
+	return nil
+}
+
 // AbortTransaction Abort the transaction, releasing locks. Because GoDB is FORCE/NO STEAL, none
 // of the pages tid has dirtied will be on disk so it is sufficient to just
 // release locks to abort. You do not need to implement this for lab 1.
+//
+// The pages tid got for writing are dropped from the cache, so that they are
+// read back from disk without the writes of tid. Pages flushed in the meantime
+// by [BufferPool.FlushAllPages], which does not heed transactions, keep the
+// writes of tid.
 func (bp *BufferPool) AbortTransaction(tid TransactionID) {
-	// TODO: some code goes here
+	bp.Lock()
+	for _, key := range bp.pagesOf(tid) {
+		delete(bp.Pages, key)
+		delete(bp.scanPages, key)
+	}
+	bp.Unlock()
+
+	for _, file := range bp.endTransaction(tid) {
+		file.endTransaction(tid, false)
+	}
 }
 
 // CommitTransaction Commit the transaction, releasing locks. Because GoDB is FORCE/NO STEAL, none
@@ -70,17 +168,191 @@ func (bp *BufferPool) AbortTransaction(tid TransactionID) {
 // that the system will not crash while doing this, allowing us to avoid using a
 // WAL. You do not need to implement this for lab 1.
 func (bp *BufferPool) CommitTransaction(tid TransactionID) {
-	// TODO: some code goes here
+	bp.Lock()
+	for _, key := range bp.pagesOf(tid) {
+		page, ok := bp.Pages[key]
+		if !ok || !page.isDirty() {
+			continue
+		}
+		if err := page.getFile().flushPage(page); err != nil {
+			DPrintf("BufferPool CommitTransaction flushPage err:%v", err)
+			continue
+		}
+		page.setDirty(tid, false)
+	}
+	bp.Unlock()
+
+	for _, file := range bp.endTransaction(tid) {
+		file.endTransaction(tid, true)
+	}
 }
 
 // BeginTransaction Begin a new transaction. You do not need to implement this for lab 1.
 //
 // Returns an error if the transaction is already running.
 func (bp *BufferPool) BeginTransaction(tid TransactionID) error {
-	// TODO: some code goes here
+	bp.txnLock.Lock()
+	defer bp.txnLock.Unlock()
+	if _, ok := bp.activeTxns[tid]; ok {
+		return GoDBError{IllegalTransactionError, fmt.Sprintf("transaction %d is already running", tid)}
+	}
+	bp.activeTxns[tid] = &txnState{
+		files:    make(map[txnFile]struct{}),
+		pages:    make(map[any]struct{}),
+		beginSeq: writeSeq.Load(),
+	}
 	return nil
 }
 
+// NewTransaction Begin a transaction with a new id from [NewTID], greater than
+// the ids of the transactions begun before it, and return the id. The
+// transaction runs until it is committed or aborted.
+func (bp *BufferPool) NewTransaction() TransactionID {
+	for {
+		tid := NewTID()
+		// an id may have been begun explicitly already
+		if bp.BeginTransaction(tid) == nil {
+			return tid
+		}
+	}
+}
+
+// ActiveTransactions Return the ids of the running transactions, in increasing
+// order.
+func (bp *BufferPool) ActiveTransactions() []TransactionID {
+	bp.txnLock.Lock()
+	defer bp.txnLock.Unlock()
+	tids := make([]TransactionID, 0, len(bp.activeTxns))
+	for tid := range bp.activeTxns {
+		tids = append(tids, tid)
+	}
+	slices.Sort(tids)
+	return tids
+}
+
+// Report whether transaction tid has begun and not yet committed or aborted.
+func (bp *BufferPool) isActive(tid TransactionID) bool {
+	bp.txnLock.Lock()
+	defer bp.txnLock.Unlock()
+	_, ok := bp.activeTxns[tid]
+	return ok
+}
+
+// Return the write sequence number (see [nextWriteSeq]) as of the beginning of
+// transaction tid, and whether tid is running.
+func (bp *BufferPool) beginWriteSeq(tid TransactionID) (int64, bool) {
+	bp.txnLock.Lock()
+	defer bp.txnLock.Unlock()
+	txn, ok := bp.activeTxns[tid]
+	if !ok {
+		return 0, false
+	}
+	return txn.beginSeq, true
+}
+
+// Record that running transaction tid wrote to file.
+func (bp *BufferPool) noteWrite(tid TransactionID, file txnFile) {
+	bp.txnLock.Lock()
+	defer bp.txnLock.Unlock()
+	if txn, ok := bp.activeTxns[tid]; ok {
+		txn.files[file] = struct{}{}
+	}
+}
+
+// Return the keys of the pages running transaction tid got for writing.
+func (bp *BufferPool) pagesOf(tid TransactionID) []any {
+	bp.txnLock.Lock()
+	defer bp.txnLock.Unlock()
+	txn, ok := bp.activeTxns[tid]
+	if !ok {
+		return nil
+	}
+	keys := make([]any, 0, len(txn.pages))
+	for key := range txn.pages {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Report whether tid may write to page pageNo of file, i.e., no other running
+// transaction got the page for writing.
+func (bp *BufferPool) canWrite(file DBFile, pageNo int, tid TransactionID) bool {
+	bp.txnLock.Lock()
+	defer bp.txnLock.Unlock()
+	owner, ok := bp.pageOwners[file.pageKey(pageNo)]
+	return !ok || owner == tid
+}
+
+// Return whether tid is the running transaction that got page pageNo of file
+// for writing.
+func (bp *BufferPool) ownsPage(file DBFile, pageNo int, tid TransactionID) bool {
+	bp.txnLock.Lock()
+	defer bp.txnLock.Unlock()
+	owner, ok := bp.pageOwners[file.pageKey(pageNo)]
+	return ok && owner == tid
+}
+
+// Undo [BufferPool.claimPage] of page pageNo of file by tid, which must not
+// have written to the page.
+func (bp *BufferPool) releasePage(file DBFile, pageNo int, tid TransactionID) {
+	key := file.pageKey(pageNo)
+	bp.txnLock.Lock()
+	defer bp.txnLock.Unlock()
+	if owner, ok := bp.pageOwners[key]; ok && owner == tid {
+		delete(bp.pageOwners, key)
+		delete(bp.activeTxns[tid].pages, key)
+	}
+}
+
+// Record that tid gets page pageNo of file for writing, if tid is a running
+// transaction. Returns a ConflictError if another running transaction got the
+// page for writing.
+func (bp *BufferPool) claimPage(file DBFile, pageNo int, tid TransactionID) error {
+	key := file.pageKey(pageNo)
+	bp.txnLock.Lock()
+	defer bp.txnLock.Unlock()
+	if owner, ok := bp.pageOwners[key]; ok && owner != tid {
+		return GoDBError{ConflictError, fmt.Sprintf("page %d is being written by transaction %d", pageNo, owner)}
+	}
+	if txn, ok := bp.activeTxns[tid]; ok {
+		txn.pages[key] = struct{}{}
+		bp.pageOwners[key] = tid
+	}
+	return nil
+}
+
+// Mark transaction tid as no longer running, releasing the pages it got for
+// writing, and return the files it wrote to.
+func (bp *BufferPool) endTransaction(tid TransactionID) []txnFile {
+	bp.txnLock.Lock()
+	defer bp.txnLock.Unlock()
+	txn, ok := bp.activeTxns[tid]
+	if !ok {
+		return nil
+	}
+	for key := range txn.pages {
+		delete(bp.pageOwners, key)
+	}
+	files := make([]txnFile, 0, len(txn.files))
+	for file := range txn.files {
+		files = append(files, file)
+	}
+	delete(bp.activeTxns, tid)
+	return files
+}
+
+// Return the write sequence number as of the beginning of the oldest running
+// transaction, or the current one if no transaction is running.
+func (bp *BufferPool) oldestActiveWriteSeq() int64 {
+	bp.txnLock.Lock()
+	defer bp.txnLock.Unlock()
+	oldest := writeSeq.Load()
+	for _, txn := range bp.activeTxns {
+		oldest = min(oldest, txn.beginSeq)
+	}
+	return oldest
+}
+
 // GetPage Retrieve the specified page from the specified DBFile (e.g., a HeapFile), on
 // behalf of the specified transaction. If a page is not cached in the buffer pool,
 // you can read it from disk uing [DBFile.readPage]. If the buffer pool is full (i.e.,
@@ -92,48 +364,355 @@ func (bp *BufferPool) BeginTransaction(tid TransactionID) error {
 // one of the transactions in the deadlock. For lab 1, you do not need to
 // implement locking or deadlock detection. You will likely want to store a list
 // of pages in the BufferPool in a map keyed by the [DBFile.pageKey].
+//
+// A running transaction that gets a page with WritePerm owns it until it
+// commits or aborts: the other transactions get a ConflictError if they ask for
+// the page with WritePerm, so that committing flushes, and aborting discards,
+// the writes of the owner alone.
 func (bp *BufferPool) GetPage(file DBFile, pageNo int, tid TransactionID, perm RWPerm) (Page, error) {
+	return bp.GetPageWithHint(file, pageNo, tid, perm, RandomAccess)
+}
+
+// GetPageWithHint Retrieve a page like [BufferPool.GetPage], telling the buffer
+// pool how the page is being accessed. Pages read by a scan with
+// SequentialAccess are the first to be evicted to make room for other pages,
+// so that a large scan only cycles through the pages it brought in itself,
+// instead of evicting the hot pages of random accesses. A random access to a
+// page cached by a scan makes it an ordinary cached page.
+func (bp *BufferPool) GetPageWithHint(file DBFile, pageNo int, tid TransactionID, perm RWPerm, hint AccessHint) (Page, error) {
 	switch perm {
-	case ReadPerm:
-		bp.RLock()
-		defer bp.RUnlock()
-	case WritePerm:
-		bp.Lock()
-		defer bp.Unlock()
+	case ReadPerm, WritePerm:
 	default:
 		return nil, fmt.Errorf("unknown permission")
 	}
 
-	pageKey := file.pageKey(pageNo)
-	if page, ok := bp.Pages[pageKey]; ok {
-		return page, nil
+	if perm == WritePerm {
+		if err := bp.claimPage(file, pageNo, tid); err != nil {
+			DPrintf("BufferPool GetPage page:%d err:%v", pageNo, err)
+			return nil, err
+		}
 	}
 
-	// page full, find a not dirty page and remove it
-	if len(bp.Pages) >= bp.PageNum {
-		var found bool
-		for key, page := range bp.Pages {
-			if page.isDirty() {
-				continue
+	bp.getPageCalls.Add(1)
+	bp.recordAccess(file, pageNo)
+	page, read, err := bp.getPage(file, pageNo, hint)
+	if read {
+		bp.misses.Add(1)
+	}
+	return page, err
+}
+
+// GetPages Retrieve several pages of file like [BufferPool.GetPage], returning
+// them in the order of pageNos. The pages are retrieved in ascending page
+// number order whatever the order of pageNos, and are not evicted while the
+// others are read, so that they are all cached when GetPages returns.
+//
+// Returns an error if the pages do not all fit in the buffer pool at once, or
+// if retrieving one of them fails, e.g., with a ConflictError for a page
+// another transaction is writing. Then the pages that tid got for writing in
+// this call are released, as if it had not been made.
+func (bp *BufferPool) GetPages(file DBFile, pageNos []int, tid TransactionID, perm RWPerm) ([]Page, error) {
+	sorted := slices.Clone(pageNos)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+	if len(sorted) > bp.PageNum {
+		return nil, GoDBError{BufferPoolFullError, fmt.Sprintf("can not hold %d pages in a buffer pool of %d pages", len(sorted), bp.PageNum)}
+	}
+
+	bp.Lock()
+	for _, pageNo := range sorted {
+		bp.pinned[file.pageKey(pageNo)]++
+	}
+	bp.Unlock()
+	defer func() {
+		bp.Lock()
+		defer bp.Unlock()
+		for _, pageNo := range sorted {
+			key := file.pageKey(pageNo)
+			if bp.pinned[key]--; bp.pinned[key] == 0 {
+				delete(bp.pinned, key)
 			}
+		}
+	}()
 
-			found = true
-			delete(bp.Pages, key)
-			break
+	pages := make(map[int]Page, len(sorted))
+	var claimed []int // the pages tid got for writing in this call
+	for _, pageNo := range sorted {
+		owned := perm == WritePerm && bp.ownsPage(file, pageNo, tid)
+		page, err := bp.GetPage(file, pageNo, tid, perm)
+		if err != nil {
+			DPrintf("BufferPool GetPages page:%d err:%v", pageNo, err)
+			for _, claimedNo := range claimed {
+				bp.releasePage(file, claimedNo, tid)
+			}
+			return nil, err
+		}
+		if perm == WritePerm && !owned {
+			claimed = append(claimed, pageNo)
+		}
+		pages[pageNo] = page
+	}
+
+	reply := make([]Page, len(pageNos))
+	for i, pageNo := range pageNos {
+		reply[i] = pages[pageNo]
+	}
+	return reply, nil
+}
+
+// Count an access to a page in the access statistics.
+func (bp *BufferPool) recordAccess(file DBFile, pageNo int) {
+	pageKey := file.pageKey(pageNo)
+	bp.accessLock.Lock()
+	defer bp.accessLock.Unlock()
+	access, ok := bp.accesses[pageKey]
+	if !ok {
+		access = &pageAccess{file: file, pageNo: pageNo}
+		bp.accesses[pageKey] = access
+	}
+	access.count++
+}
+
+// Return the specified page from the cache, reading it from disk if needed, and
+// whether it was read.
+func (bp *BufferPool) getPage(file DBFile, pageNo int, hint AccessHint) (Page, bool, error) {
+	// the mutex only protects the page cache itself; it is independent of
+	// the page level locks held by transactions
+	pageKey := file.pageKey(pageNo)
+	bp.RLock()
+	page, ok := bp.Pages[pageKey]
+	_, isScanPage := bp.scanPages[pageKey]
+	bp.RUnlock()
+	if ok && !(isScanPage && hint == RandomAccess) {
+		return page, false, nil
+	}
+
+	bp.Lock()
+	defer bp.Unlock()
+
+	// another goroutine may have loaded the page while we waited for the lock
+	if page, ok := bp.Pages[pageKey]; ok {
+		if hint == RandomAccess {
+			delete(bp.scanPages, pageKey)
 		}
+		return page, false, nil
+	}
 
-		if !found {
+	// page full, find a not dirty page and remove it
+	if len(bp.Pages) >= bp.PageNum {
+		if !bp.evictPage() {
 			DPrintf("BufferPool GetPage not found non-dirty page")
-			return nil, GoDBError{BufferPoolFullError, "buffer pool all dirty"}
+			return nil, false, GoDBError{BufferPoolFullError, "buffer pool all dirty"}
 		}
 	}
 
 	page, err := file.readPage(pageNo)
 	if err != nil {
 		DPrintf("BufferPool GetPage readPage:%d err:%v", pageNo, err)
-		return nil, err
+		return nil, false, err
 	}
 
 	bp.Pages[pageKey] = page
-	return page, nil
+	if hint == SequentialAccess {
+		bp.scanPages[pageKey] = struct{}{}
+	} else {
+		delete(bp.scanPages, pageKey)
+	}
+	return page, true, nil
+}
+
+// Remove a page that is not dirty nor pinned by [BufferPool.GetPages] from the
+// cache, preferring the pages read by scans. Returns false if there is none. The caller must hold bp's lock.
+func (bp *BufferPool) evictPage() bool {
+	for key := range bp.scanPages {
+		page, ok := bp.Pages[key]
+		if !ok {
+			delete(bp.scanPages, key)
+			continue
+		}
+		if page.isDirty() || bp.pinned[key] > 0 {
+			continue
+		}
+
+		delete(bp.Pages, key)
+		delete(bp.scanPages, key)
+		return true
+	}
+
+	for key, page := range bp.Pages {
+		if page.isDirty() || bp.pinned[key] > 0 {
+			continue
+		}
+
+		delete(bp.Pages, key)
+		return true
+	}
+	return false
+}
+
+// Preload Read the first pages of file into the buffer pool, as many as fit,
+// so that the first queries on file do not have to wait for disk reads.
+// Preloading does not count as accesses to the pages.
+func (bp *BufferPool) Preload(file DBFile, tid TransactionID) error {
+	var pages []pageAccess
+	for pageNo := 0; pageNo < min(file.NumPages(), bp.PageNum); pageNo++ {
+		pages = append(pages, pageAccess{file: file, pageNo: pageNo})
+	}
+	return bp.loadPages(pages)
+}
+
+// WarmFromStats Read the pages accessed most through GetPage so far, as many
+// as fit, into the buffer pool.
+func (bp *BufferPool) WarmFromStats(tid TransactionID) error {
+	bp.accessLock.Lock()
+	hottest := make([]pageAccess, 0, len(bp.accesses))
+	for _, access := range bp.accesses {
+		hottest = append(hottest, *access)
+	}
+	bp.accessLock.Unlock()
+
+	sort.SliceStable(hottest, func(i, j int) bool {
+		return hottest[i].count > hottest[j].count
+	})
+	if len(hottest) > bp.PageNum {
+		hottest = hottest[:bp.PageNum]
+	}
+	return bp.loadPages(hottest)
+}
+
+// Read pages into the buffer pool, first evicting the clean pages that are not
+// among them so that loading them does not evict one another.
+func (bp *BufferPool) loadPages(pages []pageAccess) error {
+	keep := make(map[any]bool, len(pages))
+	for _, p := range pages {
+		keep[p.file.pageKey(p.pageNo)] = true
+	}
+	bp.Lock()
+	for key, page := range bp.Pages {
+		if !keep[key] && !page.isDirty() {
+			delete(bp.Pages, key)
+		}
+	}
+	bp.Unlock()
+
+	for _, p := range pages {
+		if _, _, err := bp.getPage(p.file, p.pageNo, RandomAccess); err != nil {
+			DPrintf("BufferPool loadPages page:%d err:%v", p.pageNo, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// Misses Return the number of GetPage calls that had to read the page from
+// disk.
+func (bp *BufferPool) Misses() int64 {
+	return bp.misses.Load()
+}
+
+// Return the page pageNo of file if it is cached, without reading it from disk.
+func (bp *BufferPool) cachedPage(file DBFile, pageNo int) (Page, bool) {
+	bp.RLock()
+	defer bp.RUnlock()
+	page, ok := bp.Pages[file.pageKey(pageNo)]
+	return page, ok
+}
+
+// Cache a page that was created outside of the buffer pool (e.g., a page newly
+// appended to a HeapFile), if the buffer pool has room for it. Returns whether
+// the page was cached.
+func (bp *BufferPool) cachePage(file DBFile, pageNo int, page Page) bool {
+	bp.Lock()
+	defer bp.Unlock()
+
+	if len(bp.Pages) >= bp.PageNum {
+		return false
+	}
+	bp.Pages[file.pageKey(pageNo)] = page
+	return true
+}
+
+// BufferPoolSnapshot is the state of a buffer pool captured by
+// [BufferPool.Snapshot].
+type BufferPoolSnapshot struct {
+	pages map[any]pageSnapshot
+}
+
+// the state of a cached page
+type pageSnapshot struct {
+	page  Page
+	dirty bool
+
+	// the slots of a heap page, which later writes replace
+	tuples   []*Tuple
+	slotUsed int32
+}
+
+// Snapshot Testing method -- capture the set of cached pages, their dirty
+// status, and the contents of the cached heap pages, to be restored by
+// [BufferPool.Restore].
+func (bp *BufferPool) Snapshot() *BufferPoolSnapshot {
+	bp.RLock()
+	defer bp.RUnlock()
+
+	snapshot := &BufferPoolSnapshot{pages: make(map[any]pageSnapshot, len(bp.Pages))}
+	for key, page := range bp.Pages {
+		pageSnap := pageSnapshot{page: page, dirty: page.isDirty()}
+		if hp, ok := page.(*heapPage); ok {
+			pageSnap.tuples = make([]*Tuple, len(hp.tuples))
+			copy(pageSnap.tuples, hp.tuples)
+			pageSnap.slotUsed = hp.slotUsed
+		}
+		snapshot.pages[key] = pageSnap
+	}
+	return snapshot
+}
+
+// Restore Testing method -- return the buffer pool to the state captured by
+// snapshot: pages cached since are dropped, and pages evicted since are cached
+// again, with their dirty status and heap page contents as of the snapshot.
+// Changes made to the files themselves, such as pages flushed or appended
+// since the snapshot, are not undone.
+//
+// Lock order: a heap file's spaceLock is always taken before the lock of the
+// buffer pool, as insertTuple does when it reads pages through GetPage, so
+// Restore takes the spaceLock of every file it touches first, in file name
+// order.
+func (bp *BufferPool) Restore(snapshot *BufferPoolSnapshot) {
+	var files []*HeapFile
+	seen := make(map[*HeapFile]bool)
+	for _, pageSnap := range snapshot.pages {
+		if hp, ok := pageSnap.page.(*heapPage); ok && !seen[hp.file] {
+			seen[hp.file] = true
+			files = append(files, hp.file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].fromFile < files[j].fromFile })
+	for _, f := range files {
+		f.spaceLock.Lock()
+		defer f.spaceLock.Unlock()
+	}
+
+	bp.Lock()
+	defer bp.Unlock()
+
+	// the pages cached since the snapshot are dropped even if dirty; mark them
+	// clean so that whoever still holds them (see [HeapFile.insertTuple]) does
+	// not take them for cached pages
+	for key, page := range bp.Pages {
+		if _, ok := snapshot.pages[key]; !ok {
+			page.setDirty(0, false)
+		}
+	}
+	bp.Pages = make(map[any]Page, len(snapshot.pages))
+	clear(bp.scanPages)
+	for key, pageSnap := range snapshot.pages {
+		page := pageSnap.page
+		page.setDirty(0, pageSnap.dirty)
+		if hp, ok := page.(*heapPage); ok {
+			hp.restoreSlots(pageSnap.tuples, pageSnap.slotUsed)
+			hp.file.updateFreeSpace(hp.pageNo, hp)
+		}
+		bp.Pages[key] = page
+	}
 }
@@ -1,7 +1,12 @@
 package godb
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"sync"
 	"testing"
 )
 
@@ -100,3 +105,511 @@ func TestBufferPoolHoldsMultipleHeapFiles(t *testing.T) {
 		t.Errorf("should cause bufferpool dirty page overflow here")
 	}
 }
+
+func TestBufferPoolConcurrentGetPage(t *testing.T) {
+	_, t1, t2, hf, bp, tid := makeTestVars(t)
+	for hf.NumPages() < 6 {
+		insertTupleForTest(t, hf, &t1, tid)
+		insertTupleForTest(t, hf, &t2, tid)
+		bp.FlushAllPages()
+	}
+	bp.CommitTransaction(tid)
+
+	// the buffer pool only holds 3 pages, so the goroutines race on both cache
+	// hits and evictions
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			tid := NewTID()
+			for i := 0; i < 200; i++ {
+				pageNo := (g + i) % 6
+				perm := ReadPerm
+				if i%2 == 0 {
+					perm = WritePerm
+				}
+				pg, err := bp.GetPage(hf, pageNo, tid, perm)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if pg.(*heapPage).pageNo != pageNo {
+					errs <- fmt.Errorf("asked for page %d, got page %d", pageNo, pg.(*heapPage).pageNo)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("%v", err)
+	}
+	if len(bp.Pages) > bp.PageNum {
+		t.Fatalf("buffer pool holds %d pages, more than its capacity of %d", len(bp.Pages), bp.PageNum)
+	}
+}
+
+func TestBufferPoolPreload(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeTestVars(t)
+	for hf.NumPages() < 4 {
+		insertTupleForTest(t, hf, &t1, tid)
+		bp.FlushAllPages()
+	}
+	bp.FlushAllPages()
+
+	// a fresh buffer pool, so that no page is cached
+	bp2, err := NewBufferPool(4)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf2, err := NewHeapFile(hf.BackingFile(), hf.Descriptor(), bp2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := bp2.Preload(hf2, tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := hf2.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+	}
+	if bp2.Misses() != 0 {
+		t.Errorf("expected a scan of preloaded pages to hit the cache, got %d misses", bp2.Misses())
+	}
+
+	// with room for two pages, warming keeps the two hottest ones
+	bp3, err := NewBufferPool(2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf3, err := NewHeapFile(hf.BackingFile(), hf.Descriptor(), bp3)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, pageNo := range []int{3, 0, 3, 1, 3, 1, 2} {
+		if _, err := bp3.GetPage(hf3, pageNo, tid, ReadPerm); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if err := bp3.WarmFromStats(tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	misses := bp3.Misses()
+	for _, pageNo := range []int{1, 3} {
+		if _, err := bp3.GetPage(hf3, pageNo, tid, ReadPerm); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if bp3.Misses() != misses {
+		t.Errorf("expected the hottest pages to be cached after warming, got %d misses", bp3.Misses()-misses)
+	}
+}
+
+func TestBufferPoolSnapshotRestore(t *testing.T) {
+	_, t1, t2, hf, bp, tid := makeTestVars(t)
+	for hf.NumPages() < 2 {
+		insertTupleForTest(t, hf, &t1, tid)
+		bp.FlushAllPages()
+	}
+	// fill up page 1 as well, so that both cached pages are full and clean
+	for len(hf.freeSpace) > 0 {
+		insertTupleForTest(t, hf, &t1, tid)
+	}
+	bp.FlushAllPages()
+
+	tupleOnPage := func(pageNo int) *Tuple {
+		iter, err := hf.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		for {
+			tup, err := iter()
+			if err != nil || tup == nil {
+				t.Fatalf("no tuple on page %d: %v", pageNo, err)
+			}
+			if p, _ := splitRecordID(tup.Rid); p == pageNo {
+				return tup
+			}
+		}
+	}
+	countTuples := func() int {
+		iter, err := hf.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		cnt := 0
+		for tup, err := iter(); tup != nil || err != nil; tup, err = iter() {
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			cnt++
+		}
+		return cnt
+	}
+
+	// dirty page 0 only
+	if err := hf.deleteTuple(tupleOnPage(0), tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	before := countTuples()
+	snapshot := bp.Snapshot()
+
+	// more writes: dirty page 1, and refill the free slot of page 0
+	if err := hf.deleteTuple(tupleOnPage(1), tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	insertTupleForTest(t, hf, &t2, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+
+	bp.Restore(snapshot)
+	if len(bp.Pages) != len(snapshot.pages) {
+		t.Fatalf("expected %d cached pages, got %d", len(snapshot.pages), len(bp.Pages))
+	}
+	for key, pageSnap := range snapshot.pages {
+		page, ok := bp.Pages[key]
+		if !ok || page != pageSnap.page {
+			t.Fatalf("expected page %v to be cached", key)
+		}
+		if page.isDirty() != pageSnap.dirty {
+			t.Errorf("expected page %v dirty=%v, got %v", key, pageSnap.dirty, page.isDirty())
+		}
+	}
+	if !bp.Pages[hf.pageKey(0)].isDirty() || bp.Pages[hf.pageKey(1)].isDirty() {
+		t.Errorf("expected only page 0 to be dirty after restoring")
+	}
+	if cnt := countTuples(); cnt != before {
+		t.Errorf("expected %d tuples after restoring, got %d", before, cnt)
+	}
+}
+
+func TestBufferPoolRestoreDictionaryAndBloom(t *testing.T) {
+	td, t1, _ := makeTupleTestVars()
+	dir := t.TempDir()
+	bp, err := NewBufferPool(3)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// the inserts are not part of a running transaction, so page 0 is cached
+	tid := NewTID()
+	newTuple := func(name string) *Tuple {
+		return &Tuple{td, []DBValue{StringField{name}, IntField{1}}, nil}
+	}
+	deleteAll := func(page *heapPage) {
+		for _, tup := range page.tuples {
+			if tup != nil {
+				if err := page.deleteTuple(tup.Rid); err != nil {
+					t.Fatalf(err.Error())
+				}
+			}
+		}
+	}
+
+	// a dictionary page full of strings, emptied after the snapshot, takes no
+	// new string once restored
+	dictFile, err := NewHeapFileWithDictionary(filepath.Join(dir, "dict.dat"), &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for i := 0; i < heapPageDictEntries; i++ {
+		if err := dictFile.insertTuple(newTuple(fmt.Sprintf("s%d", i)), tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	snapshot := bp.Snapshot()
+	page := bp.Pages[dictFile.pageKey(0)].(*heapPage)
+	deleteAll(page)
+	bp.Restore(snapshot)
+	for i := 0; i < 2; i++ {
+		if _, err := page.insertTuple(newTuple(fmt.Sprintf("new%d", i))); err == nil {
+			t.Fatalf("expected the restored dictionary to be full")
+		}
+	}
+	buf, err := page.toBuffer()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	page2, err := newHeapPage(&td, 0, dictFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := page2.initFromBuffer(buf); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if page2.slotUsed != heapPageDictEntries {
+		t.Errorf("expected %d tuples after restoring and flushing, got %d", heapPageDictEntries, page2.slotUsed)
+	}
+
+	// the bloom filter of a restored page holds the values of its tuples
+	bloomFile, err := NewHeapFileWithBloomFilter(filepath.Join(dir, "bloom.dat"), &td, bp, 0)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tup := t1
+	if err := bloomFile.insertTuple(&tup, tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	snapshot = bp.Snapshot()
+	page = bp.Pages[bloomFile.pageKey(0)].(*heapPage)
+	deleteAll(page)
+	bp.Restore(snapshot)
+	if !page.mayContain(0, t1.Fields[0]) {
+		t.Errorf("expected the bloom filter to hold %v after restoring", t1.Fields[0])
+	}
+}
+
+func TestBufferPoolRestoreConcurrentInsert(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	snapshot := bp.Snapshot()
+
+	// insertTuple holds the spaceLock of the file while it reads pages from
+	// the buffer pool, so Restore must not take the two locks the other way
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var gerr GoDBError
+		for i := 0; i < 2000; i++ {
+			tup := t1
+			if err := hf.insertTuple(&tup, tid); err != nil {
+				t.Errorf(err.Error())
+				return
+			}
+			// Restore may have dropped the insert already
+			err := hf.deleteTuple(&tup, tid)
+			if err != nil && (!errors.As(err, &gerr) || gerr.code != TupleNotFoundError) {
+				t.Errorf(err.Error())
+				return
+			}
+		}
+	}()
+	for i := 0; i < 2000; i++ {
+		bp.Restore(snapshot)
+	}
+	wg.Wait()
+}
+
+func TestBufferPoolSequentialScanKeepsHotPages(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeTestVars(t)
+	for hf.NumPages() < 8 {
+		insertTupleForTest(t, hf, &t1, tid)
+		bp.FlushAllPages()
+	}
+	bp.FlushAllPages()
+
+	bp2, err := NewBufferPool(3)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf2, err := NewHeapFile(hf.BackingFile(), hf.Descriptor(), bp2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hot := []int{5, 6}
+	for round := 0; round < 3; round++ {
+		for _, pageNo := range hot {
+			if _, err := bp2.GetPage(hf2, pageNo, tid, ReadPerm); err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+		if round > 0 && bp2.Misses() != int64(len(hot)+round*(hf2.NumPages()-len(hot))) {
+			t.Errorf("round %d: expected the hot pages to stay cached, got %d misses", round, bp2.Misses())
+		}
+
+		iter, err := hf2.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		for tup, err := iter(); tup != nil || err != nil; tup, err = iter() {
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+		for _, pageNo := range hot {
+			if _, ok := bp2.cachedPage(hf2, pageNo); !ok {
+				t.Errorf("round %d: expected hot page %d to survive the scan", round, pageNo)
+			}
+		}
+	}
+}
+
+// readOrderFile records the order in which the pages of a HeapFile are read
+type readOrderFile struct {
+	*HeapFile
+	sync.Mutex
+	reads []int
+}
+
+func (f *readOrderFile) readPage(pageNo int) (Page, error) {
+	f.Lock()
+	f.reads = append(f.reads, pageNo)
+	f.Unlock()
+	return f.HeapFile.readPage(pageNo)
+}
+
+func TestBufferPoolGetPages(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeTestVars(t)
+	for hf.NumPages() < 4 {
+		insertTupleForTest(t, hf, &t1, tid)
+		bp.FlushAllPages()
+	}
+	bp.FlushAllPages()
+
+	bp2, err := NewBufferPool(4)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf2, err := NewHeapFile(hf.BackingFile(), hf.Descriptor(), bp2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	file := &readOrderFile{HeapFile: hf2}
+
+	pageNos := []int{3, 0, 2, 0}
+	pages, err := bp2.GetPages(file, pageNos, tid, ReadPerm)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for i, page := range pages {
+		if page.(*heapPage).pageNo != pageNos[i] {
+			t.Errorf("expected page %d at index %d, got page %d", pageNos[i], i, page.(*heapPage).pageNo)
+		}
+		if cached, ok := bp2.cachedPage(file, pageNos[i]); !ok || cached != page {
+			t.Errorf("expected page %d to be cached", pageNos[i])
+		}
+	}
+	if fmt.Sprint(file.reads) != fmt.Sprint([]int{0, 2, 3}) {
+		t.Errorf("expected the pages to be read once each in ascending order, got %v", file.reads)
+	}
+
+	// batches asking for the same pages in opposite orders both read them in
+	// ascending order
+	for _, pageNos := range [][]int{{1, 2, 3}, {3, 2, 1}} {
+		bp3, err := NewBufferPool(4)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		hf3, err := NewHeapFile(hf.BackingFile(), hf.Descriptor(), bp3)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		file := &readOrderFile{HeapFile: hf3}
+		if _, err := bp3.GetPages(file, pageNos, tid, ReadPerm); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if fmt.Sprint(file.reads) != fmt.Sprint([]int{1, 2, 3}) {
+			t.Errorf("expected %v to be read in ascending order, got %v", pageNos, file.reads)
+		}
+	}
+
+	if _, err := bp2.GetPages(file, []int{0, 1, 2, 3, 4}, tid, ReadPerm); err == nil {
+		t.Errorf("expected an error for more pages than the buffer pool holds")
+	}
+
+	// the pages of a batch are not evicted to make room for its other pages
+	for i := 0; i < 20; i++ {
+		bp4, err := NewBufferPool(2)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		hf4, err := NewHeapFile(hf.BackingFile(), hf.Descriptor(), bp4)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if _, err := bp4.GetPage(hf4, 0, tid, ReadPerm); err != nil {
+			t.Fatalf(err.Error())
+		}
+		pages, err := bp4.GetPages(hf4, []int{1, 2}, tid, ReadPerm)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		for i, pageNo := range []int{1, 2} {
+			if cached, ok := bp4.cachedPage(hf4, pageNo); !ok || cached != pages[i] {
+				t.Fatalf("expected page %d of the batch to be cached", pageNo)
+			}
+		}
+	}
+}
+
+func TestBufferPoolGetPagesConflict(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeTestVars(t)
+	for hf.NumPages() < 4 {
+		insertTupleForTest(t, hf, &t1, tid)
+		bp.FlushAllPages()
+	}
+	bp.CommitTransaction(tid)
+
+	writer := bp.NewTransaction()
+	defer bp.AbortTransaction(writer)
+	if _, err := bp.GetPage(hf, 2, writer, WritePerm); err != nil {
+		t.Fatalf(err.Error())
+	}
+	batch := bp.NewTransaction()
+	defer bp.AbortTransaction(batch)
+	if _, err := bp.GetPage(hf, 0, batch, WritePerm); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// page 2 conflicts, after pages 0 and 1 were got for writing
+	_, err := bp.GetPages(hf, []int{2, 1, 0}, batch, WritePerm)
+	var gerr GoDBError
+	if !errors.As(err, &gerr) || gerr.code != ConflictError {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	// page 1 is released, while page 0, which batch had already, is kept
+	if !bp.canWrite(hf, 1, writer) {
+		t.Errorf("expected page 1 to be released")
+	}
+	if !bp.ownsPage(hf, 0, batch) {
+		t.Errorf("expected batch to keep page 0")
+	}
+	if len(bp.pinned) != 0 {
+		t.Errorf("expected no page left pinned, got %v", bp.pinned)
+	}
+}
+
+func TestBufferPoolNewTransaction(t *testing.T) {
+	bp, err := NewBufferPool(3)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// an id begun explicitly is skipped
+	taken := NewTID() + 1
+	if err := bp.BeginTransaction(taken); err != nil {
+		t.Fatalf(err.Error())
+	}
+	tids := []TransactionID{taken}
+	for i := 0; i < 5; i++ {
+		tid := bp.NewTransaction()
+		if tid == taken || (i > 0 && tid <= tids[len(tids)-1]) {
+			t.Fatalf("expected a new increasing id, got %d after %v", tid, tids)
+		}
+		tids = append(tids, tid)
+	}
+	if active := bp.ActiveTransactions(); !slices.Equal(active, tids) {
+		t.Fatalf("expected active transactions %v, got %v", tids, active)
+	}
+
+	bp.CommitTransaction(tids[1])
+	bp.AbortTransaction(tids[3])
+	expected := []TransactionID{tids[0], tids[2], tids[4], tids[5]}
+	if active := bp.ActiveTransactions(); !slices.Equal(active, expected) {
+		t.Fatalf("expected active transactions %v, got %v", expected, active)
+	}
+	if bp.isActive(tids[1]) || !bp.isActive(tids[2]) {
+		t.Fatalf("expected only running transactions to be active")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 )
@@ -18,6 +19,10 @@ type Table struct {
 	stats *TableStats
 
 	file DBFile
+
+	// backingFile is set when the table is stored somewhere other than the
+	// default rootPath/name.dat location, and is persisted in the catalog file
+	backingFile string
 }
 
 type Catalog struct {
@@ -91,17 +96,30 @@ func (c *Catalog) parseCatalogFile() error {
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 	scanner := bufio.NewScanner(f)
 
 	for scanner.Scan() {
 		// code to read each line
-		line := strings.ToLower(scanner.Text())
+		rawLine := scanner.Text()
+		line := strings.ToLower(rawLine)
 		sep := strings.Split(line, "(")
 		if len(sep) != 2 {
 			return GoDBError{ParseError, fmt.Sprintf("expected one paren in catalog entry, got %d (%s)", len(sep), line)}
 		}
 		tableName := strings.TrimSpace(sep[0])
-		rest := strings.Trim(sep[1], "()")
+
+		// an optional backing file may follow the closing paren; it is taken
+		// from the raw line since file names are case sensitive
+		closeIdx := strings.LastIndex(line, ")")
+		if closeIdx < len(sep[0]) {
+			closeIdx = len(line)
+		}
+		backingFile := ""
+		if closeIdx < len(line) {
+			backingFile = strings.TrimSpace(rawLine[closeIdx+1:])
+		}
+		rest := line[len(sep[0])+1 : closeIdx]
 		fields := strings.Split(rest, ",")
 
 		var fieldArray []FieldType
@@ -125,13 +143,17 @@ func (c *Catalog) parseCatalogFile() error {
 				fallthrough
 			case "text":
 				fieldType.Ftype = StringType
+			case "bool":
+				fallthrough
+			case "boolean":
+				fieldType.Ftype = BoolType
 			default:
 				return GoDBError{ParseError, fmt.Sprintf("unknown type %s (line %s)", nameType[1], line)}
 			}
 			fieldArray = append(fieldArray, fieldType)
 		}
 
-		_, err := c.addTable(tableName, TupleDesc{fieldArray})
+		_, err := c.addTableWithFile(tableName, TupleDesc{fieldArray}, backingFile)
 		if err != nil {
 			return err
 		}
@@ -151,21 +173,45 @@ func NewCatalogFromFile(catalogFile string, bp *BufferPool, rootPath string) (*C
 	return c, nil
 }
 
+// LoadCatalog Load the catalog stored at path, opening a HeapFile for every
+// table it lists. Tables without an explicit backing file are stored next to
+// the catalog file as name.dat.
+func LoadCatalog(path string, bp *BufferPool) (*Catalog, error) {
+	return NewCatalogFromFile(filepath.Base(path), bp, filepath.Dir(path))
+}
+
 // Add a new table to the catalog.
 //
 // Returns an error if the table already exists.
 func (c *Catalog) addTable(named string, desc TupleDesc) (DBFile, error) {
+	return c.addTableWithFile(named, desc, "")
+}
+
+// Add a new table to the catalog stored in backingFile. An empty backingFile
+// selects the default location given by [Catalog.tableNameToFile]; relative
+// paths are resolved against the catalog's rootPath.
+//
+// Returns an error if the table already exists.
+func (c *Catalog) addTableWithFile(named string, desc TupleDesc, backingFile string) (DBFile, error) {
 	f, err := c.GetTable(named)
 	if err == nil {
 		return f, GoDBError{DuplicateTableError, fmt.Sprintf("a table named '%s' already exists", named)}
 	}
 
-	hf, err := NewHeapFile(c.tableNameToFile(named), &desc, c.bufferPool)
+	fileName := c.tableNameToFile(named)
+	if backingFile != "" {
+		fileName = backingFile
+		if !filepath.IsAbs(fileName) {
+			fileName = c.rootPath + "/" + fileName
+		}
+	}
+
+	hf, err := NewHeapFile(fileName, &desc, c.bufferPool)
 	if err != nil {
 		return nil, err
 	}
 
-	t := &Table{len(c.tableMap), named, desc, nil, hf}
+	t := &Table{len(c.tableMap), named, desc, nil, hf, backingFile}
 	c.tableMap[named] = t
 	for _, f := range desc.Fields {
 		mapList := c.columnMap[f.Fname]
@@ -252,7 +298,12 @@ func (t *Table) String() string {
 		buf.WriteByte(' ')
 		buf.WriteString(f.Ftype.String())
 	}
-	buf.WriteString(")\n")
+	buf.WriteByte(')')
+	if t.backingFile != "" {
+		buf.WriteByte(' ')
+		buf.WriteString(t.backingFile)
+	}
+	buf.WriteByte('\n')
 	return buf.String()
 }
 
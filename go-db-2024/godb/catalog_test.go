@@ -0,0 +1,67 @@
+package godb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCatalogSaveAndLoad(t *testing.T) {
+	const catalogFile = "saved_catalog.txt"
+	const backingFile = "saved_people.dat"
+	os.Remove(catalogFile)
+	os.Remove(backingFile)
+	defer os.Remove(catalogFile)
+	defer os.Remove(backingFile)
+
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	td, t1, t2 := makeTupleTestVars()
+	c := NewCatalog(catalogFile, bp, ".")
+	tbl, err := c.addTableWithFile("people", td, backingFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf := tbl.(*HeapFile)
+
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+	bp.FlushAllPages()
+	bp.CommitTransaction(tid)
+
+	if err := c.SaveToFile(catalogFile, "."); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	bp2, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c2, err := LoadCatalog(catalogFile, bp2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tbl2, err := c2.GetTable("people")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !tbl2.Descriptor().equals(&td) {
+		t.Fatalf("reloaded descriptor does not match, got %v", tbl2.Descriptor())
+	}
+	if tbl2.(*HeapFile).BackingFile() != "./"+backingFile {
+		t.Fatalf("expected backing file %s, got %s", backingFile, tbl2.(*HeapFile).BackingFile())
+	}
+
+	tid = NewTID()
+	bp2.BeginTransaction(tid)
+	iter, err := tbl2.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatchesUnordered(iter, []*Tuple{&t1, &t2}); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
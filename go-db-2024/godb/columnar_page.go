@@ -0,0 +1,436 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/* Columnar pages are the pages of a HeapFile created with
+[NewHeapFileColumnar], flagged by heapPageColumnarFlag. After the header, they
+store the values of each column in turn, for the live tuples in slot order, so
+that every column is encoded on its own. A column starts with an 8 bit
+encoding and the 32 bit length of its data, which lets projected reads skip
+the columns they do not need, followed by its data in one of the encodings:
+
+- plain: the values, each as in a row page
+- run length: a 16 bit count of runs, then every run as its 16 bit length and
+  its value; good for low-cardinality columns whose equal values are clustered
+- delta: int columns only, the first value, then the difference of every value
+  to the previous one as a varint; good for sorted or slowly changing ints
+
+The encoding of a column is chosen every time the page is written, as the
+smallest one for its values. As encoded columns are smaller than rows, a
+columnar page has columnarSlotsFactor times the slots of a row page, and takes
+a tuple only as long as its encoded columns fit in the page; otherwise,
+inserting returns a PageFullError.
+*/
+
+const (
+	// heapPageColumnarFlag is set in the flags byte of columnar pages
+	heapPageColumnarFlag uint8 = 4
+	// columnarSlotsFactor is how many times more slots a columnar page has
+	// than a row page for the same tuples
+	columnarSlotsFactor = 8
+	// columnHeaderSize is the size of the header of a column of a columnar
+	// page: its encoding (1) and the length of its data (4)
+	columnHeaderSize = 5
+)
+
+// columnEncoding is the encoding of a column of a columnar page
+type columnEncoding uint8
+
+const (
+	plainEncoding columnEncoding = iota
+	runLengthEncoding
+	deltaEncoding
+)
+
+// Return the size of a serialized value of type t, as in a row page.
+func valueSize(t DBType) int {
+	switch t.kind() {
+	case IntType:
+		return 8
+	case StringType:
+		return StringLength
+	case BoolType:
+		return 1
+	case DecimalType:
+		return decimalFieldSize
+	}
+	return 0
+}
+
+// Append v, a value of field ft, to buf as it is serialized in a row page.
+func appendValue(buf []byte, v DBValue, ft FieldType) ([]byte, error) {
+	switch v := v.(type) {
+	case IntField:
+		if ft.Ftype == IntType {
+			return binary.LittleEndian.AppendUint64(buf, uint64(v.Value)), nil
+		}
+	case StringField:
+		if ft.Ftype == StringType {
+			str := truncateString(v.Value, StringLength)
+			buf = append(buf, str...)
+			return append(buf, strings.Repeat(" ", StringLength-len(str))...), nil
+		}
+	case BoolField:
+		if ft.Ftype == BoolType {
+			return append(buf, byte(boolRank(v.Value))), nil
+		}
+	case DecimalField:
+		if ft.Ftype.kind() == DecimalType {
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(v.Value))
+			return append(buf, v.Scale), nil
+		}
+	case NullField:
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("can not serialize NULL in field %s", ft.Fname)}
+	}
+	return nil, GoDBError{TypeMismatchError, fmt.Sprintf("value %v does not match the type of field %s", v, ft.Fname)}
+}
+
+// Return the value of type t serialized at the start of data, which holds at
+// least valueSize(t) bytes.
+func decodeValue(data []byte, t DBType) DBValue {
+	switch t.kind() {
+	case IntType:
+		return IntField{int64(binary.LittleEndian.Uint64(data))}
+	case StringType:
+		return StringField{strings.TrimSpace(string(data[:StringLength]))}
+	case BoolType:
+		return BoolField{data[0] != 0}
+	case DecimalType:
+		return DecimalField{int64(binary.LittleEndian.Uint64(data)), data[8]}
+	}
+	return NullField{}
+}
+
+// Report whether a and b are serialized the same in a page.
+func sameStoredValue(a, b DBValue) bool {
+	if sa, ok := a.(StringField); ok {
+		sb, ok := b.(StringField)
+		return ok && truncateString(sa.Value, StringLength) == truncateString(sb.Value, StringLength)
+	}
+	return a == b
+}
+
+// Return the size of the data of the column of values of type t in every
+// encoding, or -1 for an encoding that does not apply.
+func columnSizes(values []DBValue, t DBType) (sizes [3]int) {
+	width := valueSize(t)
+	sizes[plainEncoding] = len(values) * width
+
+	runs := 0
+	for i := range values {
+		if i == 0 || !sameStoredValue(values[i], values[i-1]) {
+			runs++
+		}
+	}
+	sizes[runLengthEncoding] = 2 + runs*(2+width)
+
+	sizes[deltaEncoding] = -1
+	if t == IntType && len(values) > 0 {
+		var varint [binary.MaxVarintLen64]byte
+		sizes[deltaEncoding] = 8
+		for i := 1; i < len(values); i++ {
+			diff := intValue(values[i]) - intValue(values[i-1])
+			sizes[deltaEncoding] += len(binary.AppendVarint(varint[:0], diff))
+		}
+	}
+	return
+}
+
+// Return the value of an IntField, or 0 for another value.
+func intValue(v DBValue) int64 {
+	i, _ := v.(IntField)
+	return i.Value
+}
+
+// Return the smallest encoding of the column of values of type t, and its
+// size. Ties go to the simplest encoding.
+func chooseEncoding(values []DBValue, t DBType) (columnEncoding, int) {
+	sizes := columnSizes(values, t)
+	best := plainEncoding
+	for enc := runLengthEncoding; enc <= deltaEncoding; enc++ {
+		if sizes[enc] >= 0 && sizes[enc] < sizes[best] {
+			best = enc
+		}
+	}
+	return best, sizes[best]
+}
+
+// Append the column of values of field ft to buf in encoding enc.
+func appendColumn(buf []byte, values []DBValue, ft FieldType, enc columnEncoding) ([]byte, error) {
+	var err error
+	switch enc {
+	case plainEncoding:
+		for _, v := range values {
+			if buf, err = appendValue(buf, v, ft); err != nil {
+				return nil, err
+			}
+		}
+	case runLengthEncoding:
+		countAt := len(buf)
+		buf = binary.LittleEndian.AppendUint16(buf, 0)
+		runs := 0
+		for i := 0; i < len(values); {
+			j := i + 1
+			for j < len(values) && sameStoredValue(values[j], values[i]) {
+				j++
+			}
+			buf = binary.LittleEndian.AppendUint16(buf, uint16(j-i))
+			if buf, err = appendValue(buf, values[i], ft); err != nil {
+				return nil, err
+			}
+			runs++
+			i = j
+		}
+		binary.LittleEndian.PutUint16(buf[countAt:], uint16(runs))
+	case deltaEncoding:
+		var prev int64
+		for i, v := range values {
+			if _, ok := v.(IntField); !ok {
+				return nil, GoDBError{TypeMismatchError, fmt.Sprintf("value %v does not match the type of field %s", v, ft.Fname)}
+			}
+			if i == 0 {
+				buf = binary.LittleEndian.AppendUint64(buf, uint64(intValue(v)))
+			} else {
+				buf = binary.AppendVarint(buf, intValue(v)-prev)
+			}
+			prev = intValue(v)
+		}
+	}
+	return buf, nil
+}
+
+// Return the n values of type t of a column whose data in encoding enc is
+// data.
+func decodeColumn(data []byte, t DBType, enc columnEncoding, n int) ([]DBValue, error) {
+	malformed := func(what string) error {
+		return GoDBError{MalformedDataError, fmt.Sprintf("column of %d values: %s", n, what)}
+	}
+	width := valueSize(t)
+	values := make([]DBValue, 0, n)
+	switch enc {
+	case plainEncoding:
+		if len(data) < n*width {
+			return nil, malformed("plain data cut short")
+		}
+		for i := 0; i < n; i++ {
+			values = append(values, decodeValue(data[i*width:], t))
+		}
+	case runLengthEncoding:
+		if len(data) < 2 {
+			return nil, malformed("run count cut short")
+		}
+		runs := int(binary.LittleEndian.Uint16(data))
+		data = data[2:]
+		for r := 0; r < runs; r++ {
+			if len(data) < 2+width {
+				return nil, malformed("run cut short")
+			}
+			length := int(binary.LittleEndian.Uint16(data))
+			if len(values)+length > n {
+				return nil, malformed("runs hold too many values")
+			}
+			v := decodeValue(data[2:], t)
+			for i := 0; i < length; i++ {
+				values = append(values, v)
+			}
+			data = data[2+width:]
+		}
+	case deltaEncoding:
+		if t != IntType {
+			return nil, malformed("delta encoding of a non-int column")
+		}
+		if n == 0 {
+			break
+		}
+		if len(data) < 8 {
+			return nil, malformed("first value cut short")
+		}
+		prev := int64(binary.LittleEndian.Uint64(data))
+		values = append(values, IntField{prev})
+		data = data[8:]
+		for i := 1; i < n; i++ {
+			diff, read := binary.Varint(data)
+			if read <= 0 {
+				return nil, malformed("delta cut short")
+			}
+			prev += diff
+			values = append(values, IntField{prev})
+			data = data[read:]
+		}
+	default:
+		return nil, malformed(fmt.Sprintf("unknown encoding %d", enc))
+	}
+	if len(values) != n {
+		return nil, malformed(fmt.Sprintf("found %d values", len(values)))
+	}
+	return values, nil
+}
+
+// Return the live tuples of the page, in slot order.
+func (h *heapPage) liveTuples() []*Tuple {
+	live := make([]*Tuple, 0, h.slotUsed)
+	for _, tuple := range h.tuples {
+		if tuple != nil {
+			live = append(live, tuple)
+		}
+	}
+	return live
+}
+
+// Return the values of column col of tuples.
+func columnValues(tuples []*Tuple, col int) []DBValue {
+	values := make([]DBValue, len(tuples))
+	for i, tuple := range tuples {
+		values[i] = tuple.Fields[col]
+	}
+	return values
+}
+
+// Return the size of the columns of a columnar page, once encoded.
+func (h *heapPage) columnarSize() int {
+	live := h.liveTuples()
+	size := 0
+	for col, field := range h.desc.Fields {
+		_, colSize := chooseEncoding(columnValues(live, col), field.Ftype)
+		size += columnHeaderSize + colSize
+	}
+	return size
+}
+
+// Write the columns of a columnar page to buf, each in its smallest encoding.
+func (h *heapPage) writeColumns(buf *bytes.Buffer) error {
+	live := h.liveTuples()
+	var data []byte
+	for col, field := range h.desc.Fields {
+		values := columnValues(live, col)
+		enc, _ := chooseEncoding(values, field.Ftype)
+		var err error
+		if data, err = appendColumn(data[:0], values, field, enc); err != nil {
+			return err
+		}
+		buf.WriteByte(byte(enc))
+		binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+		buf.Write(data)
+	}
+	return nil
+}
+
+// Report for every column of desc whether it is one of cols, or true for all of
+// them if cols is nil.
+func neededColumns(desc *TupleDesc, cols []int) []bool {
+	needed := make([]bool, len(desc.Fields))
+	for col := range needed {
+		needed[col] = cols == nil
+	}
+	for _, col := range cols {
+		needed[col] = true
+	}
+	return needed
+}
+
+// Read page pageNo from file like [HeapFile.readProjectedPage] with the columns
+// cols. If it is a columnar page, only its header, the headers of its columns
+// and the data of the columns cols are read; the data of the other columns is
+// left zero in the page bytes, where [readColumns] skips it.
+func (f *HeapFile) readProjectedColumns(file io.ReaderAt, pageNo int, cols []int) (*heapPage, error) {
+	data := make([]byte, PageSize)
+	start := int64(pageNo * PageSize)
+	read := func(from, to int) error {
+		n, err := file.ReadAt(data[from:to], start+int64(from))
+		f.bytesRead.Add(int64(n))
+		return err
+	}
+
+	if err := read(0, heapPageHeaderSize); err != nil {
+		DPrintf("HeapFile path:%s readProjectedColumns Read header err:%v", f.fromFile, err)
+		return nil, err
+	}
+	if data[3]&heapPageColumnarFlag == 0 {
+		if err := read(heapPageHeaderSize, PageSize); err != nil {
+			DPrintf("HeapFile path:%s readProjectedColumns Read err:%v", f.fromFile, err)
+			return nil, err
+		}
+		return f.pageFromBytes(data, pageNo, cols)
+	}
+
+	offset := heapPageHeaderSize
+	if data[3]&heapPageBloomFlag != 0 {
+		if err := read(offset, offset+heapPageBloomAreaSize); err != nil {
+			DPrintf("HeapFile path:%s readProjectedColumns Read bloom filter err:%v", f.fromFile, err)
+			return nil, err
+		}
+		offset += heapPageBloomAreaSize
+	}
+	for _, needed := range neededColumns(f.desc, cols) {
+		if offset+columnHeaderSize > PageSize {
+			// readColumns reports the page as malformed
+			break
+		}
+		if err := read(offset, offset+columnHeaderSize); err != nil {
+			DPrintf("HeapFile path:%s readProjectedColumns Read column header err:%v", f.fromFile, err)
+			return nil, err
+		}
+		end := offset + columnHeaderSize + int(binary.LittleEndian.Uint32(data[offset+1:]))
+		if end > PageSize {
+			break
+		}
+		if needed {
+			if err := read(offset+columnHeaderSize, end); err != nil {
+				DPrintf("HeapFile path:%s readProjectedColumns Read column err:%v", f.fromFile, err)
+				return nil, err
+			}
+		}
+		offset = end
+	}
+	return f.pageFromBytes(data, pageNo, cols)
+}
+
+// Read the columns of a columnar page holding n tuples from buf, and return
+// the tuples, with their fields in desc's order, or in cols' order if cols is
+// not nil, skipping the other columns.
+func readColumns(buf *bytes.Buffer, desc *TupleDesc, cols []int, n int) ([]*Tuple, error) {
+	columns := make([][]DBValue, len(desc.Fields))
+	needed := neededColumns(desc, cols)
+
+	for col, field := range desc.Fields {
+		var header [columnHeaderSize]byte
+		if _, err := buf.Read(header[:]); err != nil {
+			return nil, err
+		}
+		length := int(binary.LittleEndian.Uint32(header[1:]))
+		data := buf.Next(length)
+		if len(data) < length {
+			return nil, GoDBError{MalformedDataError, fmt.Sprintf("column %s cut short", field.Fname)}
+		}
+		if !needed[col] {
+			continue
+		}
+		values, err := decodeColumn(data, field.Ftype, columnEncoding(header[0]), n)
+		if err != nil {
+			return nil, err
+		}
+		columns[col] = values
+	}
+
+	if cols == nil {
+		cols = make([]int, len(desc.Fields))
+		for col := range cols {
+			cols[col] = col
+		}
+	}
+	tuples := make([]*Tuple, n)
+	for i := range tuples {
+		fields := make([]DBValue, len(cols))
+		for j, col := range cols {
+			fields[j] = columns[col][i]
+		}
+		tuples[i] = &Tuple{Fields: fields}
+	}
+	return tuples, nil
+}
@@ -0,0 +1,255 @@
+package godb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestColumnEncodings(t *testing.T) {
+	var clustered, sorted, distinct []DBValue
+	for i := 0; i < 100; i++ {
+		clustered = append(clustered, StringField{fmt.Sprintf("line%d", i/25)})
+		sorted = append(sorted, IntField{int64(1000 + 3*i)})
+		distinct = append(distinct, StringField{fmt.Sprintf("name%d", i)})
+	}
+	bools := []DBValue{BoolField{true}, BoolField{false}, BoolField{true}}
+	decimals := []DBValue{DecimalField{150, 2}, DecimalField{-7, 1}, DecimalField{3, 0}}
+	negative := []DBValue{IntField{5}, IntField{-1 << 40}, IntField{1 << 62}, IntField{0}}
+
+	for _, test := range []struct {
+		name     string
+		values   []DBValue
+		ftype    DBType
+		expected columnEncoding
+	}{
+		{"clustered strings", clustered, StringType, runLengthEncoding},
+		{"sorted ints", sorted, IntType, deltaEncoding},
+		{"distinct strings", distinct, StringType, plainEncoding},
+		{"bools", bools, BoolType, plainEncoding},
+		{"decimals", decimals, DecimalType, plainEncoding},
+		{"scattered ints", negative, IntType, plainEncoding},
+	} {
+		enc, size := chooseEncoding(test.values, test.ftype)
+		if enc != test.expected {
+			t.Errorf("%s: expected encoding %d, got %d", test.name, test.expected, enc)
+		}
+
+		// every encoding that applies round trips, with the size it reports
+		ft := FieldType{Fname: "f", Ftype: test.ftype}
+		for enc, encSize := range columnSizes(test.values, test.ftype) {
+			if encSize < 0 {
+				continue
+			}
+			data, err := appendColumn(nil, test.values, ft, columnEncoding(enc))
+			if err != nil {
+				t.Fatalf("%s: encoding %d: %v", test.name, enc, err)
+			}
+			if len(data) != encSize {
+				t.Errorf("%s: encoding %d: expected %d bytes, got %d", test.name, enc, encSize, len(data))
+			}
+			values, err := decodeColumn(data, test.ftype, columnEncoding(enc), len(test.values))
+			if err != nil {
+				t.Fatalf("%s: encoding %d: %v", test.name, enc, err)
+			}
+			for i, v := range values {
+				if v != test.values[i] {
+					t.Fatalf("%s: encoding %d: value %d: expected %v, got %v", test.name, enc, i, test.values[i], v)
+				}
+			}
+		}
+		if size > len(test.values)*valueSize(test.ftype) {
+			t.Errorf("%s: chosen encoding takes %d bytes, more than plain", test.name, size)
+		}
+	}
+
+	// data that does not hold the values is reported
+	data, _ := appendColumn(nil, clustered, FieldType{Fname: "f", Ftype: StringType}, runLengthEncoding)
+	if _, err := decodeColumn(data, StringType, runLengthEncoding, len(clustered)+1); err == nil {
+		t.Errorf("expected an error decoding too few values")
+	}
+	if _, err := decodeColumn(data[:len(data)-1], StringType, runLengthEncoding, len(clustered)); err == nil {
+		t.Errorf("expected an error decoding truncated data")
+	}
+}
+
+func TestHeapFileColumnar(t *testing.T) {
+	td := TupleDesc{Fields: []FieldType{{Fname: "line", Ftype: StringType}, {Fname: "riders", Ftype: IntType}}}
+	lines := []string{"red", "blue", "green", "orange"}
+	dir := t.TempDir()
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	rows, err := NewHeapFile(filepath.Join(dir, "rows.dat"), &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	columnar, err := NewHeapFileColumnar(filepath.Join(dir, "columnar.dat"), &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	const ntups = 2000
+	var expected []*Tuple
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	for i := 0; i < ntups; i++ {
+		tup := &Tuple{td, []DBValue{StringField{lines[i*len(lines)/ntups]}, IntField{int64(i)}}, nil}
+		expected = append(expected, tup)
+		for _, hf := range []*HeapFile{rows, columnar} {
+			if err := hf.insertTuple(tup, tid); err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+		if i%100 == 99 {
+			bp.FlushAllPages()
+		}
+	}
+	bp.CommitTransaction(tid)
+	bp.FlushAllPages()
+
+	if columnar.NumPages() >= rows.NumPages() {
+		t.Errorf("expected fewer columnar pages, got %d and %d", columnar.NumPages(), rows.NumPages())
+	}
+
+	// the tuples round trip through the pages on disk
+	bp2, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	reopened, err := NewHeapFileColumnar(columnar.BackingFile(), &td, bp2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid = NewTID()
+	bp2.BeginTransaction(tid)
+	iter, err := reopened.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatches(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err = reopened.IteratorProject(tid, []int{1, 0})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for i, tup := range drainIterator(t, iter) {
+		if len(tup.Fields) != 2 || tup.Fields[0] != expected[i].Fields[1] || tup.Fields[1] != expected[i].Fields[0] {
+			t.Fatalf("tuple %d: expected fields %v reversed, got %v", i, expected[i].Fields, tup.Fields)
+		}
+	}
+	bp2.CommitTransaction(tid)
+}
+
+func TestHeapFileColumnarFull(t *testing.T) {
+	td := TupleDesc{Fields: []FieldType{{Fname: "name", Ftype: StringType}}}
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf, err := NewHeapFileColumnar(filepath.Join(t.TempDir(), "columnar.dat"), &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+
+	// distinct strings do not compress, so the page fills up by size long
+	// before it runs out of slots
+	page, err := newHeapPage(&td, 0, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	fits := (PageSize - heapPageHeaderSize - columnHeaderSize) / StringLength
+	for i := 0; i < fits; i++ {
+		if _, err := page.insertTuple(&Tuple{td, []DBValue{StringField{fmt.Sprintf("name%d", i)}}, nil}); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	tup := &Tuple{td, []DBValue{StringField{"another"}}, nil}
+	_, err = page.insertTuple(tup)
+	var gerr GoDBError
+	if !errors.As(err, &gerr) || gerr.code != PageFullError {
+		t.Fatalf("expected a PageFullError, got %v", err)
+	}
+	if tup.Rid != nil || page.NumFreeSlots() != page.getNumSlots()-fits {
+		t.Fatalf("expected the rejected tuple to leave the page unchanged")
+	}
+
+	// so does the file, which moves on to a new page
+	for i := 0; i <= fits; i++ {
+		if err := hf.insertTuple(&Tuple{td, []DBValue{StringField{fmt.Sprintf("name%d", i)}}, nil}, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if hf.NumPages() != 2 {
+		t.Fatalf("expected 2 pages, got %d", hf.NumPages())
+	}
+	bp.CommitTransaction(tid)
+}
+
+func TestHeapFileColumnarProjectReadsColumns(t *testing.T) {
+	const ncols, ntups = 6, 200
+	var td TupleDesc
+	for col := 0; col < ncols; col++ {
+		td.Fields = append(td.Fields, FieldType{Fname: fmt.Sprintf("c%d", col), Ftype: StringType})
+	}
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf, err := NewHeapFileColumnar(filepath.Join(t.TempDir(), "wide.dat"), &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	for i := 0; i < ntups; i++ {
+		fields := make([]DBValue, ncols)
+		for col := range fields {
+			fields[col] = StringField{fmt.Sprintf("c%d-%d", col, i)}
+		}
+		if err := hf.insertTuple(&Tuple{td, fields, nil}, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp.CommitTransaction(tid)
+	bp.FlushAllPages()
+
+	// read the pages from disk rather than from the buffer pool
+	bp2, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	reopened, err := NewHeapFileColumnar(hf.BackingFile(), &td, bp2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid = NewTID()
+	bp2.BeginTransaction(tid)
+	iter, err := reopened.IteratorProject(tid, []int{3})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tuples := drainIterator(t, iter)
+	if len(tuples) != ntups {
+		t.Fatalf("expected %d tuples, got %d", ntups, len(tuples))
+	}
+	for i, tup := range tuples {
+		if got := tup.Fields[0].(StringField).Value; got != fmt.Sprintf("c3-%d", i) {
+			t.Fatalf("tuple %d: expected c3-%d, got %s", i, i, got)
+		}
+	}
+	bp2.CommitTransaction(tid)
+
+	// the distinct strings are stored plain, so only the headers and the
+	// strings of column 3 are read
+	pages := int64(reopened.NumPages())
+	expected := pages*(heapPageHeaderSize+ncols*columnHeaderSize) + ntups*int64(StringLength)
+	if got := reopened.BytesRead(); got != expected {
+		t.Fatalf("expected %d bytes read for one column, got %d (%d for whole pages)", expected, got, pages*int64(PageSize))
+	}
+}
@@ -0,0 +1,110 @@
+package godb
+
+import (
+	"slices"
+)
+
+type CrossTabOp struct {
+	rowKey Expr
+	colKey Expr
+	child  Operator
+
+	// the descriptor of the last iteration, nil before the first one
+	desc *TupleDesc
+}
+
+// NewCrossTabOp Construct an operator counting the tuples of child for each
+// pair of rowKey and colKey values, as a matrix with one row per distinct
+// rowKey value and one column per distinct colKey value.
+func NewCrossTabOp(rowKey Expr, colKey Expr, child Operator) *CrossTabOp {
+	return &CrossTabOp{rowKey: rowKey, colKey: colKey, child: child}
+}
+
+// Descriptor Return the TupleDesc of the matrix: the rowKey field, then one int
+// field per distinct colKey value, named after the value, in ascending order.
+// The columns depend on the data, so the child is read to find them if the
+// operator has not been iterated yet.
+func (c *CrossTabOp) Descriptor() *TupleDesc {
+	if c.desc == nil {
+		if _, err := c.Iterator(NewTID()); err != nil {
+			DPrintf("CrossTabOp Descriptor Iterator err: %v", err)
+			return &TupleDesc{Fields: []FieldType{c.rowKey.GetExprType()}}
+		}
+	}
+	return c.desc
+}
+
+// Iterator Return one tuple per distinct rowKey value, in the order the values
+// first appear in the child, holding the value and the count of the child's
+// tuples with it for each colKey value; pairs that never appear count 0. The
+// whole child is read before the first tuple is returned.
+func (c *CrossTabOp) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error), err error) {
+	childIter, err := c.child.Iterator(tid)
+	if err != nil {
+		DPrintf("CrossTabOp Iterator get child iterator err: %v", err)
+		return
+	}
+
+	var rows, cols []DBValue
+	// the counts by the [DBValue.HashKey] keys of the row and column values
+	counts := make(map[any]map[any]int64)
+	colSeen := make(map[any]bool)
+	for {
+		var tuple *Tuple
+		tuple, err = childIter()
+		if err != nil {
+			DPrintf("CrossTabOp Iterator childIter() err: %v", err)
+			return nil, err
+		}
+		if tuple == nil {
+			break
+		}
+		var row, col DBValue
+		if row, err = c.rowKey.EvalExpr(tuple); err != nil {
+			return nil, err
+		}
+		if col, err = c.colKey.EvalExpr(tuple); err != nil {
+			return nil, err
+		}
+		ReleaseTuple(c.child, tuple)
+
+		rowCounts, ok := counts[row.HashKey()]
+		if !ok {
+			rowCounts = make(map[any]int64)
+			counts[row.HashKey()] = rowCounts
+			rows = append(rows, row)
+		}
+		if !colSeen[col.HashKey()] {
+			colSeen[col.HashKey()] = true
+			cols = append(cols, col)
+		}
+		rowCounts[col.HashKey()]++
+	}
+
+	slices.SortStableFunc(cols, func(a, b DBValue) int {
+		if a.EvalPred(b, OpLt) {
+			return -1
+		}
+		if b.EvalPred(a, OpLt) {
+			return 1
+		}
+		return 0
+	})
+	desc := &TupleDesc{Fields: make([]FieldType, 0, len(cols)+1)}
+	desc.Fields = append(desc.Fields, c.rowKey.GetExprType())
+	for _, col := range cols {
+		desc.Fields = append(desc.Fields, FieldType{valueString(col), "", IntType})
+	}
+	c.desc = desc
+
+	tuples := make([]*Tuple, len(rows))
+	for i, row := range rows {
+		fields := make([]DBValue, 0, len(cols)+1)
+		fields = append(fields, row)
+		for _, col := range cols {
+			fields = append(fields, IntField{counts[row.HashKey()][col.HashKey()]})
+		}
+		tuples[i] = &Tuple{*desc, fields, nil}
+	}
+	return sliceIterator(tuples), nil
+}
@@ -0,0 +1,75 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestCrossTabCounts(t *testing.T) {
+	var rows [][]Expr
+	for _, r := range []struct {
+		dept  string
+		level int64
+	}{{"eng", 2}, {"sales", 1}, {"eng", 1}, {"eng", 2}, {"ops", 3}, {"sales", 1}} {
+		rows = append(rows, []Expr{StringConst(r.dept), IntConst(r.level)})
+	}
+	child := NewValueOp(rows)
+	rowKey, err := NewPositionalExpr(child.Descriptor(), 0)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	colKey, err := NewPositionalExpr(child.Descriptor(), 1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	op := NewCrossTabOp(rowKey, colKey, child)
+
+	// the columns are known before the first iteration
+	desc := op.Descriptor()
+	names := []string{"1", "2", "3"}
+	if len(desc.Fields) != len(names)+1 {
+		t.Fatalf("expected %d fields, got %v", len(names)+1, desc)
+	}
+	if desc.Fields[0].Ftype != StringType {
+		t.Errorf("expected a string row key, got %v", desc.Fields[0])
+	}
+	for i, name := range names {
+		if f := desc.Fields[i+1]; f.Fname != name || f.Ftype != IntType {
+			t.Errorf("expected int column %s, got %v", name, f)
+		}
+	}
+
+	iter, err := op.Iterator(NewTID())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var expected []*Tuple
+	for _, r := range []struct {
+		dept   string
+		counts []int64
+	}{{"eng", []int64{1, 2, 0}}, {"sales", []int64{2, 0, 0}}, {"ops", []int64{0, 0, 1}}} {
+		fields := []DBValue{StringField{r.dept}}
+		for _, c := range r.counts {
+			fields = append(fields, IntField{c})
+		}
+		expected = append(expected, &Tuple{*desc, fields, nil})
+	}
+	if err := CheckIfOutputMatches(iter, expected); err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestCrossTabEmpty(t *testing.T) {
+	td, _, _, hf, _, tid := makeTestVars(t)
+	rowKey := &FieldExpr{td.Fields[0]}
+	op := NewCrossTabOp(rowKey, &FieldExpr{td.Fields[1]}, hf)
+	iter, err := op.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatches(iter, nil); err != nil {
+		t.Errorf(err.Error())
+	}
+	if desc := op.Descriptor(); len(desc.Fields) != 1 || desc.Fields[0] != rowKey.GetExprType() {
+		t.Errorf("expected only the row key field, got %v", desc)
+	}
+}
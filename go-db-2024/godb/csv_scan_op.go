@@ -0,0 +1,82 @@
+package godb
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+)
+
+// A CSVScanOp is an external table: it returns the lines of a CSV file as
+// tuples, parsing them as it reads them, without loading them into a
+// [HeapFile]. It suits one-shot queries over a file that will not be queried
+// again; a file that is scanned repeatedly is better loaded once.
+type CSVScanOp struct {
+	fileName  string
+	td        *TupleDesc
+	hasHeader bool
+	sep       string
+}
+
+// NewCSVScanOp Construct an operator scanning the CSV file fileName, whose
+// lines hold the fields of td separated by sep, as for [HeapFile.LoadFromCSV].
+// When hasHeader is set, the first line is skipped as the header. Returns an
+// error if the file does not exist.
+func NewCSVScanOp(fileName string, td *TupleDesc, hasHeader bool, sep string) (*CSVScanOp, error) {
+	if td == nil || td.Fields == nil {
+		return nil, GoDBError{MalformedDataError, "Descriptor was nil"}
+	}
+	if _, err := os.Stat(fileName); err != nil {
+		DPrintf("NewCSVScanOp path:%s Stat err:%v", fileName, err)
+		return nil, err
+	}
+	return &CSVScanOp{fileName, td, hasHeader, sep}, nil
+}
+
+// Descriptor Return the TupleDesc of the lines of the file.
+func (c *CSVScanOp) Descriptor() *TupleDesc {
+	return c.td
+}
+
+// Iterator Return the lines of the file as tuples, in the order of the file.
+// Every call opens the file anew, and reads it one line per tuple. A line that
+// cannot be parsed ends the iteration with an error, as it aborts
+// [HeapFile.LoadFromCSV]. The file is closed once the iteration ends.
+func (c *CSVScanOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	file, err := os.Open(c.fileName)
+	if err != nil {
+		DPrintf("CSVScanOp path:%s Iterator Open err:%v", c.fileName, err)
+		return nil, err
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxCSVLineSize)
+
+	var cnt int
+	done := false
+	finish := func(err error) (*Tuple, error) {
+		done = true
+		file.Close()
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		for !done {
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					DPrintf("CSVScanOp path:%s scan after line %d err:%v", c.fileName, cnt, err)
+					return finish(fmt.Errorf("CSVScanOp: reading after line %d: %w", cnt, err))
+				}
+				return finish(nil)
+			}
+			cnt++
+
+			isHeader := cnt == 1 && c.hasHeader
+			tuple, err := parseCSVLine(c.td, scanner.Text(), cnt, c.sep, false, isHeader)
+			if err != nil {
+				return finish(err)
+			}
+			if !isHeader {
+				return tuple, nil
+			}
+		}
+		return nil, nil
+	}, nil
+}
@@ -0,0 +1,106 @@
+package godb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Return the query "SELECT name FROM child WHERE age > 30".
+func makeCSVScanQuery(t *testing.T, td *TupleDesc, child Operator) Operator {
+	filter, err := NewFilter(IntConst(30), OpGt, &FieldExpr{td.Fields[1]}, child)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	proj, err := NewProjectOp([]Expr{&FieldExpr{td.Fields[0]}}, []string{"name"}, false, filter)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return proj
+}
+
+func TestCSVScanMatchesHeapFile(t *testing.T) {
+	csvFile := filepath.Join(t.TempDir(), "people.csv")
+	data := "name,age\nsam,25\ngeorge jones,999\nann,31\nbob,30\ntom,42\n"
+	if err := os.WriteFile(csvFile, []byte(data), 0666); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	bp, hf := makeTestFile(t, 10)
+	file, err := os.Open(csvFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer file.Close()
+	if err := hf.LoadFromCSV(file, true, ",", false); err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	iter, err := makeCSVScanQuery(t, hf.Descriptor(), hf).Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var expected []*Tuple
+	for {
+		tuple, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tuple == nil {
+			break
+		}
+		expected = append(expected, tuple)
+	}
+	if len(expected) != 3 {
+		t.Fatalf("expected 3 tuples from the heap file, got %d", len(expected))
+	}
+	bp.CommitTransaction(tid)
+
+	scan, err := NewCSVScanOp(csvFile, hf.Descriptor(), true, ",")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	query := makeCSVScanQuery(t, scan.Descriptor(), scan)
+	// a second iteration reads the file again
+	for i := 0; i < 2; i++ {
+		iter, err := query.Iterator(NewTID())
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := CheckIfOutputMatches(iter, expected); err != nil {
+			t.Errorf("iteration %d: %v", i, err)
+		}
+	}
+}
+
+func TestCSVScanErrors(t *testing.T) {
+	td, _, _ := makeTupleTestVars()
+	dir := t.TempDir()
+	if _, err := NewCSVScanOp(filepath.Join(dir, "missing.csv"), &td, false, ","); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+
+	csvFile := filepath.Join(dir, "bad.csv")
+	if err := os.WriteFile(csvFile, []byte("sam,25\nbob,old\ntom,42\n"), 0666); err != nil {
+		t.Fatalf(err.Error())
+	}
+	scan, err := NewCSVScanOp(csvFile, &td, false, ",")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := scan.Iterator(NewTID())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tuple, err := iter()
+	if err != nil || tuple == nil || tuple.Fields[0] != (StringField{"sam"}) {
+		t.Fatalf("expected the first line, got %v, %v", tuple, err)
+	}
+	if _, err := iter(); err == nil {
+		t.Fatalf("expected an error for the malformed second line")
+	}
+	if tuple, err := iter(); tuple != nil || err != nil {
+		t.Errorf("expected the iteration to end after the error, got %v, %v", tuple, err)
+	}
+}
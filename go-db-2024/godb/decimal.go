@@ -0,0 +1,155 @@
+package godb
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// decimalFieldSize is the size of a serialized [DecimalField]: its units as an
+// int64, then its scale as a byte.
+const decimalFieldSize = 9
+
+// maxDecimalScale is the largest scale of a [DecimalField], whose scaled units
+// must fit in an int64.
+const maxDecimalScale = 18
+
+// DecimalField is an exact fixed-point value, e.g., an amount of money: Value
+// units of 10^-Scale, so that 12.34 is {1234, 2}. Unlike a float, adding such
+// values never rounds. The values of a column of type [DecimalTypeOf](s) all
+// have scale s.
+type DecimalField struct {
+	Value int64
+	Scale uint8
+}
+
+// String Return the value in decimal notation, e.g., 12.34 or -0.05.
+func (d DecimalField) String() string {
+	if d.Scale == 0 {
+		return strconv.FormatInt(d.Value, 10)
+	}
+	sign := ""
+	units := strconv.FormatUint(uint64(d.Value), 10)
+	if d.Value < 0 {
+		sign = "-"
+		units = strconv.FormatUint(uint64(-d.Value), 10)
+	}
+	if len(units) <= int(d.Scale) {
+		units = strings.Repeat("0", int(d.Scale)-len(units)+1) + units
+	}
+	point := len(units) - int(d.Scale)
+	return sign + units[:point] + "." + units[point:]
+}
+
+// Return the value in units of 10^-scale, which must not be less than d's own
+// scale, and whether it fits in an int64.
+func (d DecimalField) rescale(scale uint8) (int64, bool) {
+	if d.Value == 0 {
+		return 0, true
+	}
+	if scale-d.Scale > maxDecimalScale {
+		return 0, false
+	}
+	factor := pow10(scale - d.Scale)
+	if d.Value > math.MaxInt64/factor || d.Value < math.MinInt64/factor {
+		return 0, false
+	}
+	return d.Value * factor, true
+}
+
+// Return 10^n, for n up to maxDecimalScale.
+func pow10(n uint8) int64 {
+	p := int64(1)
+	for ; n > 0; n-- {
+		p *= 10
+	}
+	return p
+}
+
+// Return v as a decimal, if it is one or an int, which is a decimal of scale 0.
+func toDecimal(v DBValue) (DecimalField, bool) {
+	switch v := v.(type) {
+	case DecimalField:
+		return v, true
+	case IntField:
+		return DecimalField{v.Value, 0}, true
+	}
+	return DecimalField{}, false
+}
+
+// EvalPred Compare two decimals by value, whatever their scales, so that 1.5
+// equals 1.50. An int is compared as a decimal of scale 0.
+func (d DecimalField) EvalPred(v2 DBValue, op BoolOp) bool {
+	d2, ok := toDecimal(v2)
+	if !ok {
+		return false
+	}
+	scale := max(d.Scale, d2.Scale)
+	x1, ok1 := d.rescale(scale)
+	x2, ok2 := d2.rescale(scale)
+	if !ok1 || !ok2 {
+		// a value too big to rescale is beyond any value that is not
+		x1, x2 = overflowRank(d.Value, ok1), overflowRank(d2.Value, ok2)
+	}
+	return evalIntPred(x1, x2, op)
+}
+
+// numericKey is the [DBValue.HashKey] of ints and decimals: the units and
+// scale of the value without trailing zeros, so that 5, 5.0 and 5.00 share it
+type numericKey struct {
+	units int64
+	scale uint8
+}
+
+func (d DecimalField) HashKey() any {
+	units, scale := d.Value, d.Scale
+	for scale > 0 && units%10 == 0 {
+		units /= 10
+		scale--
+	}
+	return numericKey{units, scale}
+}
+
+// Return the rank of a rescaled value with the given sign: 0 if it fit in an
+// int64, and otherwise 1 or -1, for a value above or below every one that did.
+func overflowRank(value int64, fits bool) int64 {
+	switch {
+	case fits:
+		return 0
+	case value > 0:
+		return 1
+	}
+	return -1
+}
+
+// Parse str, e.g., "12.34", into a decimal of the given scale. Returns an error
+// if str is not a number, or has more digits after the point than scale, as
+// rounding a price is rarely what is meant.
+func parseDecimal(str string, scale uint8) (DecimalField, error) {
+	if scale > maxDecimalScale {
+		return DecimalField{}, GoDBError{TypeMismatchError, fmt.Sprintf("decimal scale %d is above %d", scale, maxDecimalScale)}
+	}
+	num := strings.TrimSpace(str)
+	intPart, fracPart, _ := strings.Cut(num, ".")
+	if strings.TrimLeft(intPart, "+-")+fracPart == "" {
+		return DecimalField{}, GoDBError{TypeMismatchError, fmt.Sprintf("%q is not a decimal", str)}
+	}
+	if len(fracPart) > int(scale) {
+		return DecimalField{}, GoDBError{TypeMismatchError, fmt.Sprintf("%q has more than %d digits after the point", str, scale)}
+	}
+	for _, c := range fracPart {
+		if c < '0' || c > '9' {
+			return DecimalField{}, GoDBError{TypeMismatchError, fmt.Sprintf("%q is not a decimal", str)}
+		}
+	}
+	if intPart == "" || intPart == "-" || intPart == "+" {
+		// e.g., ".5"
+		intPart += "0"
+	}
+	units, err := strconv.ParseInt(intPart+fracPart+strings.Repeat("0", int(scale)-len(fracPart)), 10, 64)
+	if err != nil {
+		return DecimalField{}, GoDBError{TypeMismatchError, fmt.Sprintf("%q is not a decimal of scale %d", str, scale)}
+	}
+	return DecimalField{units, scale}, nil
+}
@@ -0,0 +1,171 @@
+package godb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecimalParseAndString(t *testing.T) {
+	for _, c := range []struct {
+		str      string
+		scale    uint8
+		expected DecimalField
+		text     string
+	}{
+		{"12.34", 2, DecimalField{1234, 2}, "12.34"},
+		{"12.3", 2, DecimalField{1230, 2}, "12.30"},
+		{" 7 ", 2, DecimalField{700, 2}, "7.00"},
+		{"-0.05", 2, DecimalField{-5, 2}, "-0.05"},
+		{".5", 1, DecimalField{5, 1}, "0.5"},
+		{"42", 0, DecimalField{42, 0}, "42"},
+	} {
+		d, err := parseDecimal(c.str, c.scale)
+		if err != nil {
+			t.Fatalf("%q: %v", c.str, err)
+		}
+		if d != c.expected {
+			t.Errorf("%q: expected %v, got %v", c.str, c.expected, d)
+		}
+		if d.String() != c.text {
+			t.Errorf("%q: expected %s, got %s", c.str, c.text, d.String())
+		}
+	}
+	for _, str := range []string{"1.234", "abc", "1.2x", "", ".", "1e3"} {
+		if _, err := parseDecimal(str, 2); err == nil {
+			t.Errorf("expected an error parsing %q", str)
+		}
+	}
+
+	// values compare by value, whatever their scales
+	if !(DecimalField{150, 2}).EvalPred(DecimalField{15, 1}, OpEq) {
+		t.Errorf("expected 1.50 = 1.5")
+	}
+	if !(DecimalField{-1, 2}).EvalPred(IntField{0}, OpLt) {
+		t.Errorf("expected -0.01 < 0")
+	}
+}
+
+func TestDecimalExactArithmetic(t *testing.T) {
+	dime := DecimalConst(10, 2)
+	fifth := DecimalConst(2, 1)
+	sum, err := NewBinaryExpr("+", dime, fifth)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if ft := sum.GetExprType(); ft.Ftype != DecimalTypeOf(2) {
+		t.Errorf("expected a decimal of scale 2, got %v", ft)
+	}
+	val, err := sum.EvalExpr(&Tuple{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// 0.1 + 0.2 is not 0.3 in floating point
+	f1, f2 := 0.1, 0.2
+	if f1+f2 == 0.3 {
+		t.Fatalf("expected float addition to round")
+	}
+	if val != (DecimalField{30, 2}) {
+		t.Errorf("expected 0.10 + 0.2 = 0.30, got %v", val)
+	}
+
+	product, err := NewBinaryExpr("*", DecimalConst(125, 2), DecimalConst(5, 1))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if val, err := product.EvalExpr(&Tuple{}); err != nil || val != (DecimalField{625, 3}) {
+		t.Errorf("expected 1.25 * 0.5 = 0.625, got %v, %v", val, err)
+	}
+	diff, err := NewBinaryExpr("-", IntConst(3), dime)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if val, err := diff.EvalExpr(&Tuple{}); err != nil || val != (DecimalField{290, 2}) {
+		t.Errorf("expected 3 - 0.10 = 2.90, got %v, %v", val, err)
+	}
+	if _, err := NewBinaryExpr("+", dime, StringConst("x")); err == nil {
+		t.Errorf("expected an error adding a string")
+	}
+	huge, err := NewBinaryExpr("*", DecimalConst(1<<62, 0), IntConst(4))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := huge.EvalExpr(&Tuple{}); err == nil {
+		t.Errorf("expected an error for an overflowing product")
+	}
+}
+
+func TestDecimalLoadAndSum(t *testing.T) {
+	td := TupleDesc{[]FieldType{{"item", "", StringType}, {"price", "", DecimalTypeOf(2)}}}
+	dir := t.TempDir()
+	csvFile := filepath.Join(dir, "prices.csv")
+	lines := []string{"item,price"}
+	var floatSum float64
+	for i := 0; i < 10; i++ {
+		lines = append(lines, "gum,0.10")
+		floatSum += 0.10
+	}
+	if floatSum == 1 {
+		t.Fatalf("expected the float sum of ten 0.10 to round")
+	}
+	lines = append(lines, "tea,2.35", "refund,-1.05")
+	if err := os.WriteFile(csvFile, []byte(strings.Join(lines, "\n")+"\n"), 0666); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf, err := NewHeapFile(filepath.Join(dir, "prices.dat"), &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	file, err := os.Open(csvFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer file.Close()
+	if err := hf.LoadFromCSV(file, true, ",", false); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// the values read back from the pages are summed exactly
+	sa := &SumAggState{}
+	if err := sa.Init("total", &FieldExpr{td.Fields[1]}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	agg := NewAggregator([]AggState{sa}, hf)
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	iter, err := agg.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	outDesc := TupleDesc{[]FieldType{{"total", "", DecimalTypeOf(2)}}}
+	expected := &Tuple{outDesc, []DBValue{DecimalField{230, 2}}, nil}
+	if err := CheckIfOutputMatches(iter, []*Tuple{expected}); err != nil {
+		t.Errorf(err.Error())
+	}
+	bp.CommitTransaction(tid)
+
+	bad := filepath.Join(dir, "bad.csv")
+	if err := os.WriteFile(bad, []byte("tea,2.355\n"), 0666); err != nil {
+		t.Fatalf(err.Error())
+	}
+	badFile, err := os.Open(bad)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer badFile.Close()
+	if err := hf.LoadFromCSV(badFile, false, ",", false); err == nil {
+		t.Errorf("expected an error loading a price with 3 decimals")
+	}
+
+	// the scale is part of the layout of the pages
+	wider := TupleDesc{[]FieldType{{"item", "", StringType}, {"price", "", DecimalTypeOf(4)}}}
+	if _, err := NewHeapFile(filepath.Join(dir, "prices.dat"), &wider, bp); err == nil || err.(GoDBError).code != SchemaMismatchError {
+		t.Errorf("expected a SchemaMismatchError opening decimal(2) prices as decimal(4), got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package godb
+
+// DedupKeep selects which of the tuples with the same key a [DedupOp] returns
+type DedupKeep int
+
+const (
+	// KeepFirst returns the first tuple of every key
+	KeepFirst DedupKeep = iota
+	// KeepLast returns the last tuple of every key
+	KeepLast DedupKeep = iota
+)
+
+type DedupOp struct {
+	keyExprs []Expr
+	keep     DedupKeep
+	child    Operator
+}
+
+// NewDedupOp Construct an operator that returns one tuple of child for every
+// distinct value of keyExprs, like DISTINCT ON. Which tuple is returned for a
+// key is selected by keep.
+func NewDedupOp(keyExprs []Expr, keep DedupKeep, child Operator) (*DedupOp, error) {
+	if len(keyExprs) == 0 {
+		return nil, GoDBError{IllegalOperationError, "dedup needs at least one key expression"}
+	}
+	return &DedupOp{keyExprs, keep, child}, nil
+}
+
+// Descriptor Return the TupleDesc of the child, as tuples are returned whole.
+func (d *DedupOp) Descriptor() *TupleDesc {
+	return d.child.Descriptor()
+}
+
+// Iterator Return the deduplicated tuples of the child, in the order the child
+// first returned their keys. With KeepFirst tuples are returned as they are
+// read; with KeepLast the whole child is read first.
+func (d *DedupOp) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error), err error) {
+	childIter, err := d.child.Iterator(tid)
+	if err != nil {
+		DPrintf("DedupOp Iterator get child iterator err: %v", err)
+		return
+	}
+
+	if d.keep == KeepFirst {
+		seen := make(map[any]struct{})
+		iterFunc = func() (*Tuple, error) {
+			for {
+				tuple, err := childIter()
+				if err != nil || tuple == nil {
+					return nil, err
+				}
+
+				key, err := d.tupleKey(tuple)
+				if err != nil {
+					return nil, err
+				}
+				if _, isExist := seen[key]; isExist {
+					continue
+				}
+				seen[key] = struct{}{}
+				return tuple, nil
+			}
+		}
+		return
+	}
+
+	// KeepLast: the last tuple of a key is only known at the end of the child
+	var (
+		keys   []any
+		latest = make(map[any]*Tuple)
+	)
+	for {
+		var tuple *Tuple
+		tuple, err = childIter()
+		if err != nil {
+			DPrintf("DedupOp Iterator childIter() err: %v", err)
+			return
+		}
+		if tuple == nil {
+			break
+		}
+
+		var key any
+		key, err = d.tupleKey(tuple)
+		if err != nil {
+			return
+		}
+		if _, isExist := latest[key]; !isExist {
+			keys = append(keys, key)
+		}
+		latest[key] = tuple
+	}
+
+	var index int
+	iterFunc = func() (*Tuple, error) {
+		if index >= len(keys) {
+			return nil, nil
+		}
+		reply := latest[keys[index]]
+		index++
+		return reply, nil
+	}
+	return
+}
+
+// Return the map key of the key expressions evaluated on tuple.
+func (d *DedupOp) tupleKey(tuple *Tuple) (any, error) {
+	keyTup := &Tuple{
+		Desc:   TupleDesc{make([]FieldType, 0, len(d.keyExprs))},
+		Fields: make([]DBValue, 0, len(d.keyExprs)),
+	}
+	for _, expr := range d.keyExprs {
+		val, err := expr.EvalExpr(tuple)
+		if err != nil {
+			DPrintf("DedupOp key EvalExpr err: %v", err)
+			return nil, err
+		}
+		keyTup.Desc.Fields = append(keyTup.Desc.Fields, expr.GetExprType())
+		keyTup.Fields = append(keyTup.Fields, val)
+	}
+	return keyTup.tupleKey(), nil
+}
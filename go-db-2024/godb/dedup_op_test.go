@@ -0,0 +1,57 @@
+package godb
+
+import (
+	"testing"
+)
+
+func makeDedupTestVars(t *testing.T) (TupleDesc, *HeapFile, TransactionID) {
+	td, _, _, hf, _, tid := makeTestVars(t)
+	for _, row := range []struct {
+		name string
+		age  int64
+	}{{"sam", 1}, {"joe", 2}, {"sam", 3}, {"ann", 4}, {"joe", 5}, {"sam", 6}} {
+		tup := Tuple{td, []DBValue{StringField{row.name}, IntField{row.age}}, nil}
+		insertTupleForTest(t, hf, &tup, tid)
+	}
+	return td, hf, tid
+}
+
+func TestDedupKeepFirst(t *testing.T) {
+	td, hf, tid := makeDedupTestVars(t)
+	dedup, err := NewDedupOp([]Expr{&FieldExpr{td.Fields[0]}}, KeepFirst, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := dedup.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := []*Tuple{
+		{td, []DBValue{StringField{"sam"}, IntField{1}}, nil},
+		{td, []DBValue{StringField{"joe"}, IntField{2}}, nil},
+		{td, []DBValue{StringField{"ann"}, IntField{4}}, nil},
+	}
+	if err := CheckIfOutputMatches(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func TestDedupKeepLast(t *testing.T) {
+	td, hf, tid := makeDedupTestVars(t)
+	dedup, err := NewDedupOp([]Expr{&FieldExpr{td.Fields[0]}}, KeepLast, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := dedup.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := []*Tuple{
+		{td, []DBValue{StringField{"sam"}, IntField{6}}, nil},
+		{td, []DBValue{StringField{"joe"}, IntField{5}}, nil},
+		{td, []DBValue{StringField{"ann"}, IntField{4}}, nil},
+	}
+	if err := CheckIfOutputMatches(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
@@ -159,3 +159,83 @@ func TestParseEasy(t *testing.T) {
 		}
 	}
 }
+
+func TestParseOrderByDroppedColumn(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	tid := BeginTransactionForTest(t, bp)
+
+	_, plan, err := Parse(c, "select name from t where age < 45 order by age desc, name asc")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(plan.Descriptor().Fields) != 1 || plan.Descriptor().Fields[0].Fname != "name" {
+		t.Fatalf("expected only the name column, got %v", plan.Descriptor())
+	}
+
+	iter, err := plan.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var expected []*Tuple
+	for _, name := range []string{"riza", "joe", "pat", "bill", "sam", "ang", "riza"} {
+		expected = append(expected, &Tuple{Desc: *plan.Descriptor(), Fields: []DBValue{StringField{name}}})
+	}
+	if err := CheckIfOutputMatches(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func TestParseCreateTableBool(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	os.Remove(c.tableNameToFile("flags"))
+	defer os.Remove(c.tableNameToFile("flags"))
+
+	if _, _, err := Parse(c, "create table flags (name varchar(10), active tinyint(4))"); err == nil {
+		t.Fatalf("expected an error for a tinyint wider than a bool")
+	}
+	if _, _, err := Parse(c, "create table flags (name varchar(10), active boolean)"); err == nil {
+		t.Fatalf("expected an error for a type the SQL parser does not know")
+	}
+	qType, _, err := Parse(c, "create table flags (name varchar(10), active tinyint(1), flag bit)")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if qType != CreateTableQueryType {
+		t.Fatalf("expected a create table query, got %v", qType)
+	}
+	table, err := c.GetTable("flags")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	desc := *table.Descriptor()
+	if desc.Fields[1].Ftype != BoolType || desc.Fields[2].Ftype != BoolType {
+		t.Fatalf("expected active and flag to be bool columns, got %v", desc.Fields)
+	}
+
+	tid := BeginTransactionForTest(t, bp)
+	for i, active := range []bool{true, false, true} {
+		tup := &Tuple{desc, []DBValue{StringField{fmt.Sprintf("f%d", i)}, BoolField{active}, BoolField{false}}, nil}
+		if err := table.insertTuple(tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	_, plan, err := Parse(c, "select bool_and(active), bool_or(active) from flags")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := plan.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := []*Tuple{{Desc: *plan.Descriptor(), Fields: []DBValue{BoolField{false}, BoolField{true}}}}
+	if err := CheckIfOutputMatches(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
@@ -2,7 +2,10 @@ package godb
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -21,20 +24,89 @@ type FieldExpr struct {
 	selectField FieldType
 }
 
+// maxFieldIndexes is the number of resolved field indexes [fieldIndexes] holds
+// before it is cleared.
+const maxFieldIndexes = 4096
+
+// fieldIndexKey identifies a [FieldExpr] and a descriptor it is resolved in, by
+// the first element and the length of its Fields slice.
+type fieldIndexKey struct {
+	expr   *FieldExpr
+	fields *FieldType
+	n      int
+}
+
+// fieldIndexes caches the index each FieldExpr resolved its field to in each
+// descriptor. It is kept outside of FieldExpr, which stays a plain struct that
+// can be copied and built from an unkeyed literal, and is cleared when full, so
+// that the expressions and descriptors of finished queries are not kept.
+var fieldIndexes = struct {
+	sync.RWMutex
+	m map[fieldIndexKey]int
+}{m: make(map[fieldIndexKey]int)}
+
+// EvalExpr Return the selected field of t. The index of the field is cached
+// for the descriptor of t, so that the tuples of an operator, which share their
+// descriptor, only resolve it once. A tuple with another descriptor, i.e., whose
+// Fields slice is another one, resolves it again.
 func (f *FieldExpr) EvalExpr(t *Tuple) (DBValue, error) {
-	outTup, err := t.project([]FieldType{f.selectField})
+	fields := t.Desc.Fields
+	if len(fields) == 0 {
+		return nil, GoDBError{IncompatibleTypesError, fmt.Sprintf("field %s.%s not found", f.selectField.TableQualifier, f.selectField.Fname)}
+	}
+	key := fieldIndexKey{f, &fields[0], len(fields)}
+	fieldIndexes.RLock()
+	index, ok := fieldIndexes.m[key]
+	fieldIndexes.RUnlock()
+	if ok {
+		return t.Fields[index], nil
+	}
+
+	index, err := findFieldInTd(f.selectField, &t.Desc)
 	if err != nil {
-		//fmt.Printf("err in project: %s", err.Error())
 		return nil, err
 	}
-	return outTup.Fields[0], nil
-
+	fieldIndexes.Lock()
+	if len(fieldIndexes.m) >= maxFieldIndexes {
+		clear(fieldIndexes.m)
+	}
+	fieldIndexes.m[key] = index
+	fieldIndexes.Unlock()
+	return t.Fields[index], nil
 }
 
 func (f *FieldExpr) GetExprType() FieldType {
 	return f.selectField
 }
 
+// PositionalExpr evaluates to the field at a fixed index of the tuple, without
+// resolving any field name. Unlike a [FieldExpr] it can tell apart fields that
+// share a name, e.g., the two name fields of a self-join.
+type PositionalExpr struct {
+	index int
+	field FieldType
+}
+
+// NewPositionalExpr Construct an expression for field number index of tuples
+// with descriptor desc. Returns an error if index is out of range.
+func NewPositionalExpr(desc *TupleDesc, index int) (*PositionalExpr, error) {
+	if index < 0 || index >= len(desc.Fields) {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("field index %d out of range for %d fields", index, len(desc.Fields))}
+	}
+	return &PositionalExpr{index, desc.Fields[index]}, nil
+}
+
+func (p *PositionalExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	if p.index >= len(t.Fields) {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("field index %d out of range for %d fields", p.index, len(t.Fields))}
+	}
+	return t.Fields[p.index], nil
+}
+
+func (p *PositionalExpr) GetExprType() FieldType {
+	return p.field
+}
+
 type ConstExpr struct {
 	val       DBValue
 	constType DBType
@@ -48,6 +120,236 @@ func (c *ConstExpr) EvalExpr(_ *Tuple) (DBValue, error) {
 	return c.val, nil
 }
 
+// IntConst Return a constant expression evaluating to the int v.
+func IntConst(v int64) Expr {
+	return &ConstExpr{IntField{v}, IntType}
+}
+
+// StringConst Return a constant expression evaluating to the string s.
+func StringConst(s string) Expr {
+	return &ConstExpr{StringField{s}, StringType}
+}
+
+// BoolConst Return a constant expression evaluating to the bool b.
+func BoolConst(b bool) Expr {
+	return &ConstExpr{BoolField{b}, BoolType}
+}
+
+// DecimalConst Return a constant expression evaluating to the decimal of the
+// given units and scale, e.g., 1234 and 2 for 12.34.
+func DecimalConst(units int64, scale uint8) Expr {
+	return &ConstExpr{DecimalField{units, scale}, DecimalTypeOf(scale)}
+}
+
+// NullConst Return a constant expression evaluating to NULL, typed as t so that
+// it can stand in for a value of that type.
+func NullConst(t DBType) Expr {
+	return &ConstExpr{NullField{}, t}
+}
+
+// CollationExpr compares strings case-insensitively: it evaluates to the
+// lower-cased value of its string expression, so a predicate whose operands are
+// both wrapped in CollationExprs ignores case. Non-string values are returned
+// unchanged.
+type CollationExpr struct {
+	expr Expr
+}
+
+// NewCaseInsensitiveExpr Wrap expr in a case-insensitive [CollationExpr].
+func NewCaseInsensitiveExpr(expr Expr) *CollationExpr {
+	return &CollationExpr{expr}
+}
+
+func (c *CollationExpr) GetExprType() FieldType {
+	return c.expr.GetExprType()
+}
+
+func (c *CollationExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	val, err := c.expr.EvalExpr(t)
+	if err != nil {
+		return nil, err
+	}
+	if str, ok := val.(StringField); ok {
+		return StringField{strings.ToLower(str.Value)}, nil
+	}
+	return val, nil
+}
+
+// CoalesceExpr evaluates to the first of its expressions that is not NULL, or
+// to NULL if all of them are, like SQL's COALESCE.
+type CoalesceExpr struct {
+	exprs []Expr
+}
+
+// NewCoalesceExpr Construct a COALESCE of exprs. Returns an error if there are
+// no expressions, or if their types differ.
+func NewCoalesceExpr(exprs ...Expr) (*CoalesceExpr, error) {
+	if len(exprs) == 0 {
+		return nil, GoDBError{IllegalOperationError, "coalesce needs at least one expression"}
+	}
+	for _, expr := range exprs[1:] {
+		if expr.GetExprType().Ftype != exprs[0].GetExprType().Ftype {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("coalesce of %v and %v", exprs[0].GetExprType().Ftype, expr.GetExprType().Ftype)}
+		}
+	}
+	return &CoalesceExpr{exprs}, nil
+}
+
+func (c *CoalesceExpr) GetExprType() FieldType {
+	return c.exprs[0].GetExprType()
+}
+
+func (c *CoalesceExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	for _, expr := range c.exprs {
+		val, err := expr.EvalExpr(t)
+		if err != nil {
+			return nil, err
+		}
+		if _, isNull := val.(NullField); !isNull {
+			return val, nil
+		}
+	}
+	return NullField{}, nil
+}
+
+// NullIfExpr evaluates to NULL if its two expressions are equal, and to the
+// first one otherwise, like SQL's NULLIF.
+type NullIfExpr struct {
+	expr, other Expr
+}
+
+// NewNullIfExpr Construct a NULLIF(expr, other). Returns an error if the types
+// of the expressions differ.
+func NewNullIfExpr(expr, other Expr) (*NullIfExpr, error) {
+	if expr.GetExprType().Ftype != other.GetExprType().Ftype {
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("nullif of %v and %v", expr.GetExprType().Ftype, other.GetExprType().Ftype)}
+	}
+	return &NullIfExpr{expr, other}, nil
+}
+
+func (n *NullIfExpr) GetExprType() FieldType {
+	return n.expr.GetExprType()
+}
+
+func (n *NullIfExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	val, err := n.expr.EvalExpr(t)
+	if err != nil {
+		return nil, err
+	}
+	otherVal, err := n.other.EvalExpr(t)
+	if err != nil {
+		return nil, err
+	}
+	if val.EvalPred(otherVal, OpEq) {
+		return NullField{}, nil
+	}
+	return val, nil
+}
+
+// BinaryExpr is the sum, difference or product of two int or decimal
+// expressions. Decimal arithmetic is exact: a sum or difference has the larger
+// scale of its operands, and a product the sum of their scales, so that 1.25 *
+// 0.5 is 0.625. An int operand is a decimal of scale 0, and two ints give an int.
+type BinaryExpr struct {
+	op          string
+	left, right Expr
+	outType     FieldType
+}
+
+// NewBinaryExpr Construct the expression left op right, where op is "+", "-" or
+// "*". Returns an error for another op, for operands that are not ints or
+// decimals, or if the scale of the result would be above 18.
+func NewBinaryExpr(op string, left, right Expr) (*BinaryExpr, error) {
+	if op != "+" && op != "-" && op != "*" {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("unknown arithmetic operator %s", op)}
+	}
+	lt, rt := left.GetExprType(), right.GetExprType()
+	for _, t := range []FieldType{lt, rt} {
+		if t.Ftype != IntType && t.Ftype.kind() != DecimalType {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("%s of a %v", op, t.Ftype)}
+		}
+	}
+
+	outType := FieldType{op, "", IntType}
+	if lt.Ftype != IntType || rt.Ftype != IntType {
+		ls, rs := lt.Ftype.Scale(), rt.Ftype.Scale()
+		outType.Ftype = DecimalTypeOf(max(ls, rs))
+		if op == "*" {
+			if int(ls)+int(rs) > maxDecimalScale {
+				return nil, GoDBError{TypeMismatchError, fmt.Sprintf("product of scale %d is above %d", int(ls)+int(rs), maxDecimalScale)}
+			}
+			outType.Ftype = DecimalTypeOf(ls + rs)
+		}
+	}
+	// named after a field operand, as a FuncExpr is
+	for _, e := range []Expr{left, right} {
+		if field, ok := e.(*FieldExpr); ok {
+			outType.Fname, outType.TableQualifier = field.selectField.Fname, field.selectField.TableQualifier
+			break
+		}
+	}
+	return &BinaryExpr{op, left, right, outType}, nil
+}
+
+func (b *BinaryExpr) GetExprType() FieldType {
+	return b.outType
+}
+
+// EvalExpr Return the result of the operation, or NULL if an operand is NULL.
+// Returns an error if the result does not fit in an int64.
+func (b *BinaryExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	leftVal, err := b.left.EvalExpr(t)
+	if err != nil {
+		return nil, err
+	}
+	rightVal, err := b.right.EvalExpr(t)
+	if err != nil {
+		return nil, err
+	}
+	l, lok := toDecimal(leftVal)
+	r, rok := toDecimal(rightVal)
+	if !lok || !rok {
+		if _, isNull := leftVal.(NullField); isNull {
+			return NullField{}, nil
+		}
+		if _, isNull := rightVal.(NullField); isNull {
+			return NullField{}, nil
+		}
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("%v %s %v", leftVal, b.op, rightVal)}
+	}
+
+	var x1, x2 int64
+	var ok bool
+	if b.op == "*" {
+		x1, x2, ok = l.Value, r.Value, true
+	} else {
+		x1, ok = l.rescale(b.outType.Ftype.Scale())
+		if ok {
+			x2, ok = r.rescale(b.outType.Ftype.Scale())
+		}
+	}
+	var result int64
+	switch b.op {
+	case "+":
+		// overflows iff the operands have the same sign and the result not
+		result = x1 + x2
+		ok = ok && ((x1 < 0) != (x2 < 0) || (result < 0) == (x1 < 0))
+	case "-":
+		result = x1 - x2
+		ok = ok && ((x1 < 0) == (x2 < 0) || (result < 0) == (x1 < 0))
+	case "*":
+		result = x1 * x2
+		ok = x1 == 0 || (result/x1 == x2 && !(x1 == -1 && x2 == math.MinInt64))
+	}
+	if !ok {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("%v %s %v overflows", leftVal, b.op, rightVal)}
+	}
+	if b.outType.Ftype == IntType {
+		return IntField{result}, nil
+	}
+	return DecimalField{result, b.outType.Ftype.Scale()}, nil
+}
+
 type FuncExpr struct {
 	op   string
 	args []*Expr
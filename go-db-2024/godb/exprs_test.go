@@ -0,0 +1,163 @@
+package godb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCoalesceExpr(t *testing.T) {
+	_, t1, _ := makeTupleTestVars()
+	null := &ConstExpr{NullField{}, IntType}
+	age := &FieldExpr{t1.Desc.Fields[1]}
+
+	cases := []struct {
+		exprs    []Expr
+		expected DBValue
+	}{
+		{[]Expr{null, null}, NullField{}},
+		{[]Expr{null, age, &ConstExpr{IntField{7}, IntType}}, IntField{25}},
+		{[]Expr{&ConstExpr{IntField{7}, IntType}, age}, IntField{7}},
+	}
+	for i, c := range cases {
+		coalesce, err := NewCoalesceExpr(c.exprs...)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		val, err := coalesce.EvalExpr(&t1)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if val != c.expected {
+			t.Errorf("case %d: expected %v, got %v", i, c.expected, val)
+		}
+	}
+
+	if _, err := NewCoalesceExpr(age, &FieldExpr{t1.Desc.Fields[0]}); err == nil {
+		t.Errorf("expected an error for expressions of different types")
+	}
+	if _, err := NewCoalesceExpr(); err == nil {
+		t.Errorf("expected an error for no expressions")
+	}
+}
+
+func TestNullIfExpr(t *testing.T) {
+	_, t1, _ := makeTupleTestVars()
+	name := &FieldExpr{t1.Desc.Fields[0]}
+
+	nullIf, err := NewNullIfExpr(name, &ConstExpr{StringField{"sam"}, StringType})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if val, err := nullIf.EvalExpr(&t1); err != nil || val != (NullField{}) {
+		t.Errorf("expected NULL for equal values, got %v (%v)", val, err)
+	}
+
+	nullIf, err = NewNullIfExpr(name, &ConstExpr{StringField{"george"}, StringType})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if val, err := nullIf.EvalExpr(&t1); err != nil || val != (StringField{"sam"}) {
+		t.Errorf("expected sam for unequal values, got %v (%v)", val, err)
+	}
+
+	if _, err := NewNullIfExpr(name, &ConstExpr{IntField{1}, IntType}); err == nil {
+		t.Errorf("expected an error for expressions of different types")
+	}
+}
+
+func TestFieldExprCacheInvalidates(t *testing.T) {
+	_, t1, _ := makeTupleTestVars()
+	age := &FieldExpr{t1.Desc.Fields[1]}
+	cached := func(desc *TupleDesc) (int, bool) {
+		fieldIndexes.RLock()
+		defer fieldIndexes.RUnlock()
+		index, ok := fieldIndexes.m[fieldIndexKey{age, &desc.Fields[0], len(desc.Fields)}]
+		return index, ok
+	}
+	for i := 0; i < 2; i++ {
+		val, err := age.EvalExpr(&t1)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if val != (IntField{25}) {
+			t.Fatalf("expected 25, got %v", val)
+		}
+	}
+	if index, ok := cached(&t1.Desc); !ok || index != 1 {
+		t.Fatalf("expected the index 1 to be cached, got %d", index)
+	}
+
+	// the same fields in another order make another descriptor
+	swapped := &Tuple{TupleDesc{[]FieldType{t1.Desc.Fields[1], t1.Desc.Fields[0]}}, []DBValue{IntField{30}, StringField{"ann"}}, nil}
+	val, err := age.EvalExpr(swapped)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if val != (IntField{30}) {
+		t.Errorf("expected 30 from the new descriptor, got %v", val)
+	}
+	if index, ok := cached(&swapped.Desc); !ok || index != 0 {
+		t.Errorf("expected the index 0 to be cached, got %d", index)
+	}
+
+	// a descriptor without the field is an error, not a stale index
+	other := &Tuple{TupleDesc{[]FieldType{{"x", "", IntType}, {"y", "", IntType}}}, []DBValue{IntField{1}, IntField{2}}, nil}
+	if _, err := age.EvalExpr(other); err == nil {
+		t.Errorf("expected an error for a descriptor without the field")
+	}
+	if _, err := age.EvalExpr(&Tuple{}); err == nil {
+		t.Errorf("expected an error for an empty descriptor")
+	}
+
+	// the cache does not grow with the descriptors it has seen
+	for i := 0; i <= maxFieldIndexes; i++ {
+		desc := TupleDesc{[]FieldType{t1.Desc.Fields[1]}}
+		if _, err := age.EvalExpr(&Tuple{desc, []DBValue{IntField{int64(i)}}, nil}); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	fieldIndexes.RLock()
+	size := len(fieldIndexes.m)
+	fieldIndexes.RUnlock()
+	if size > maxFieldIndexes {
+		t.Errorf("expected at most %d cached indexes, got %d", maxFieldIndexes, size)
+	}
+}
+
+// Return a tuple of n int fields, and the last of its fields.
+func makeWideTuple(n int) (*Tuple, FieldType) {
+	desc := TupleDesc{}
+	fields := make([]DBValue, n)
+	for i := 0; i < n; i++ {
+		desc.Fields = append(desc.Fields, FieldType{fmt.Sprintf("f%d", i), "", IntType})
+		fields[i] = IntField{int64(i)}
+	}
+	return &Tuple{desc, fields, nil}, desc.Fields[n-1]
+}
+
+// BenchmarkFieldExprResolve resolves the field on every tuple, as FieldExpr did
+// before caching its index.
+func BenchmarkFieldExprResolve(b *testing.B) {
+	tuple, field := makeWideTuple(8)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		outTup, err := tuple.project([]FieldType{field})
+		if err != nil {
+			b.Fatalf(err.Error())
+		}
+		releasePooledTuple(outTup)
+	}
+}
+
+func BenchmarkFieldExprCached(b *testing.B) {
+	tuple, field := makeWideTuple(8)
+	expr := &FieldExpr{field}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := expr.EvalExpr(tuple); err != nil {
+			b.Fatalf(err.Error())
+		}
+	}
+}
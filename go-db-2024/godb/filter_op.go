@@ -57,7 +57,7 @@ func (f *Filter) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error), e
 				return
 			}
 
-			if !leftVal.EvalPred(rightVal, f.op) {
+			if !evalPred(leftVal, rightVal, f.op) {
 				// not match, iter the next tuple
 				continue
 			}
@@ -69,3 +69,67 @@ func (f *Filter) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error), e
 	}
 	return
 }
+
+// NullFilter keeps the tuples whose field is NULL, like SQL's IS NULL, or those
+// whose field is not NULL, like IS NOT NULL. A [Filter] cannot find NULLs, as
+// comparing NULL with anything, even NULL, is false.
+type NullFilter struct {
+	field  Expr
+	isNull bool
+	child  Operator
+}
+
+// NewNullFilter Construct a filter keeping the tuples of child whose field is
+// NULL if isNull is set, or those whose field is not NULL otherwise.
+func NewNullFilter(field Expr, isNull bool, child Operator) *NullFilter {
+	return &NullFilter{field, isNull, child}
+}
+
+// Descriptor Return the TupleDesc of the child, as tuples are returned whole.
+func (f *NullFilter) Descriptor() *TupleDesc {
+	return f.child.Descriptor()
+}
+
+// Iterator Return the tuples of the child whose field is NULL, or is not NULL,
+// in order.
+func (f *NullFilter) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error), err error) {
+	childIter, err := f.child.Iterator(tid)
+	if err != nil {
+		DPrintf("NullFilter Iterator get child iterator err: %v", err)
+		return
+	}
+
+	iterFunc = func() (*Tuple, error) {
+		for {
+			tuple, err := childIter()
+			if err != nil {
+				DPrintf("NullFilter Iterator childIter() err: %v", err)
+				return nil, err
+			}
+			if tuple == nil {
+				return nil, nil
+			}
+
+			val, err := f.field.EvalExpr(tuple)
+			if err != nil {
+				DPrintf("NullFilter field EvalExpr err: %v", err)
+				return nil, err
+			}
+			if _, isNull := val.(NullField); isNull == f.isNull {
+				return tuple, nil
+			}
+		}
+	}
+	return
+}
+
+// Compare left and right with op as [DBValue.EvalPred] does, taking the fast
+// path when both are ints.
+func evalPred(left, right DBValue, op BoolOp) bool {
+	if l, ok := left.(IntField); ok {
+		if r, ok := right.(IntField); ok {
+			return evalIntPred(l.Value, r.Value, op)
+		}
+	}
+	return left.EvalPred(right, op)
+}
@@ -76,3 +76,257 @@ func TestFilterString(t *testing.T) {
 		t.Errorf("unexpected number of results")
 	}
 }
+
+func TestFilterStringCaseInsensitive(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+
+	nameField := &FieldExpr{t1.Desc.Fields[0]}
+	mixedCase := &ConstExpr{StringField{"George JONES"}, StringType}
+	count := func(filt *Filter) int {
+		iter, err := filt.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		cnt := 0
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				return cnt
+			}
+			if tup.Fields[0].(StringField).Value != "george jones" {
+				t.Errorf("unexpected tuple %v", tup)
+			}
+			cnt++
+		}
+	}
+
+	filt, err := NewFilter(mixedCase, OpEq, nameField, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if cnt := count(filt); cnt != 0 {
+		t.Errorf("expected a case-sensitive match to find nothing, got %d tuples", cnt)
+	}
+
+	filt, err = NewFilter(NewCaseInsensitiveExpr(mixedCase), OpEq, NewCaseInsensitiveExpr(nameField), hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if cnt := count(filt); cnt != 1 {
+		t.Errorf("expected a case-insensitive match to find 1 tuple, got %d", cnt)
+	}
+}
+
+func TestFilterTypedConsts(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+
+	cases := []struct {
+		constExpr Expr
+		op        BoolOp
+		field     FieldType
+		expected  []*Tuple
+	}{
+		{IntConst(25), OpGt, t1.Desc.Fields[1], []*Tuple{&t2}},
+		{IntConst(999), OpLe, t1.Desc.Fields[1], []*Tuple{&t1, &t2}},
+		{StringConst("sam"), OpEq, t1.Desc.Fields[0], []*Tuple{&t1}},
+		{StringConst("sam"), OpNeq, t1.Desc.Fields[0], []*Tuple{&t2}},
+	}
+	for i, c := range cases {
+		filt, err := NewFilter(c.constExpr, c.op, &FieldExpr{c.field}, hf)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		iter, err := filt.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := CheckIfOutputMatchesUnordered(iter, c.expected); err != nil {
+			t.Errorf("case %d: %v", i, err)
+		}
+	}
+
+	for _, c := range []struct {
+		expr  Expr
+		ftype DBType
+	}{{IntConst(1), IntType}, {StringConst("a"), StringType}, {BoolConst(true), BoolType}, {NullConst(IntType), IntType}} {
+		if got := c.expr.GetExprType().Ftype; got != c.ftype {
+			t.Errorf("expected %v constant, got %v", c.ftype, got)
+		}
+	}
+	if val, _ := NullConst(StringType).EvalExpr(nil); val != (NullField{}) {
+		t.Errorf("expected NULL, got %v", val)
+	}
+}
+
+func TestEvalPredIntFastPath(t *testing.T) {
+	vals := []DBValue{IntField{-3}, IntField{0}, IntField{7}, IntField{7}, StringField{"7"}, NullField{}}
+	for _, op := range []BoolOp{OpGt, OpLt, OpGe, OpLe, OpEq, OpNeq, OpLike} {
+		for _, left := range vals {
+			for _, right := range vals {
+				if got, expected := evalPred(left, right, op), left.EvalPred(right, op); got != expected {
+					t.Errorf("%v %v %v: expected %v, got %v", left, op, right, expected, got)
+				}
+			}
+		}
+	}
+
+	// sorting by an int takes the fast path in both directions
+	td := TupleDesc{[]FieldType{{Fname: "n", Ftype: IntType}}}
+	expr := &FieldExpr{td.Fields[0]}
+	for _, x := range []int64{-3, 0, 7} {
+		for _, y := range []int64{-3, 0, 7} {
+			xTup, yTup := &Tuple{td, []DBValue{IntField{x}}, nil}, &Tuple{td, []DBValue{IntField{y}}, nil}
+			if got := tupleLess(xTup, yTup, []Expr{expr}, []bool{true}); got != (x < y) {
+				t.Errorf("ascending %d < %d: got %v", x, y, got)
+			}
+			if got := tupleLess(xTup, yTup, []Expr{expr}, []bool{false}); got != (x > y) {
+				t.Errorf("descending %d < %d: got %v", x, y, got)
+			}
+		}
+	}
+}
+
+func benchmarkEvalPredVals() []DBValue {
+	vals := make([]DBValue, 1024)
+	for i := range vals {
+		vals[i] = IntField{int64(i * 37 % 101)}
+	}
+	return vals
+}
+
+func BenchmarkEvalPredGeneric(b *testing.B) {
+	vals := benchmarkEvalPredVals()
+	var cnt int
+	for i := 0; i < b.N; i++ {
+		if vals[i%1024].EvalPred(vals[(i+1)%1024], BoolOp(i%6)) {
+			cnt++
+		}
+	}
+}
+
+func BenchmarkEvalPredInt(b *testing.B) {
+	vals := benchmarkEvalPredVals()
+	var cnt int
+	for i := 0; i < b.N; i++ {
+		if evalPred(vals[i%1024], vals[(i+1)%1024], BoolOp(i%6)) {
+			cnt++
+		}
+	}
+}
+
+func TestFilterLeGeBoundaries(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+
+	name, age := t1.Desc.Fields[0], t1.Desc.Fields[1]
+	cases := []struct {
+		field     FieldType
+		op        BoolOp
+		constExpr Expr
+		expected  []*Tuple
+	}{
+		{age, OpLe, IntConst(25), []*Tuple{&t1}},
+		{age, OpLe, IntConst(24), nil},
+		{age, OpGe, IntConst(999), []*Tuple{&t2}},
+		{age, OpGe, IntConst(1000), nil},
+		{age, OpGe, IntConst(25), []*Tuple{&t1, &t2}},
+		{name, OpLe, StringConst("sam"), []*Tuple{&t1, &t2}},
+		{name, OpLe, StringConst("george jones"), []*Tuple{&t2}},
+		{name, OpGe, StringConst("sam"), []*Tuple{&t1}},
+		{name, OpGe, StringConst("samuel"), nil},
+	}
+	for i, c := range cases {
+		filt, err := NewFilter(c.constExpr, c.op, &FieldExpr{c.field}, hf)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		iter, err := filt.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := CheckIfOutputMatchesUnordered(iter, c.expected); err != nil {
+			t.Errorf("case %d: %v", i, err)
+		}
+	}
+}
+
+func TestStatefulFilterRunningTotal(t *testing.T) {
+	// keep the tuples until the running total exceeds 10
+	untilTotal := func(state DBValue, t *Tuple) (DBValue, bool) {
+		total := state.(IntField).Value + t.Fields[0].(IntField).Value
+		return IntField{total}, total <= 10
+	}
+	child := newIntsOp(3, 4, 3, 1, 5, 2)
+	op := NewStatefulFilter(child, IntField{0}, untilTotal)
+	// 3, 7 and 10 are within the limit, 11 is over it and so are all later ones
+	var expected []*Tuple
+	for _, v := range []int64{3, 4, 3} {
+		expected = append(expected, &Tuple{*child.Descriptor(), []DBValue{IntField{v}}, nil})
+	}
+	for i := 0; i < 2; i++ {
+		iter, err := op.Iterator(NewTID())
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := CheckIfOutputMatches(iter, expected); err != nil {
+			t.Errorf("iteration %d: %v", i, err)
+		}
+	}
+}
+
+func TestNullFilter(t *testing.T) {
+	rows := [][]Expr{
+		{StringConst("sam"), IntConst(25)},
+		{StringConst("ann"), NullConst(IntType)},
+		{StringConst("bob"), IntConst(0)},
+		{StringConst("tom"), NullConst(IntType)},
+	}
+	child := NewValueOp(rows)
+	age, err := NewPositionalExpr(child.Descriptor(), 1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	td := *child.Descriptor()
+
+	for _, c := range []struct {
+		isNull bool
+		names  []string
+		ages   []DBValue
+	}{
+		{true, []string{"ann", "tom"}, []DBValue{NullField{}, NullField{}}},
+		{false, []string{"sam", "bob"}, []DBValue{IntField{25}, IntField{0}}},
+	} {
+		iter, err := NewNullFilter(age, c.isNull, child).Iterator(NewTID())
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var expected []*Tuple
+		for i, name := range c.names {
+			expected = append(expected, &Tuple{td, []DBValue{StringField{name}, c.ages[i]}, nil})
+		}
+		if err := CheckIfOutputMatches(iter, expected); err != nil {
+			t.Errorf("isNull %v: %v", c.isNull, err)
+		}
+	}
+
+	// comparing with NULL finds nothing
+	filt, err := NewFilter(NullConst(IntType), OpEq, age, child)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := filt.Iterator(NewTID())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatches(iter, nil); err != nil {
+		t.Errorf("age = NULL: %v", err)
+	}
+}
@@ -3,12 +3,19 @@ package godb
 import (
 	"bufio"
 	"bytes"
+	"container/heap"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // A HeapFile is an unordered collection of tuples.
@@ -18,12 +25,79 @@ import (
 type HeapFile struct {
 	// HeapFile should include the fields below;  you may want to add
 	// additional fields
-	fromFile  string
-	file      *os.File
-	desc      *TupleDesc
-	bufPool   *BufferPool
-	idlePage  map[int]struct{}
+	fromFile string
+	desc     *TupleDesc
+	bufPool  *BufferPool
+
+	// fileLock guards file, the backing file flushPage writes pages to. It is
+	// opened on the first write and stays open until [HeapFile.Close]
+	fileLock sync.Mutex
+	file     *os.File
+
+	// spaceLock guards the free space map and the page count, and serializes
+	// the changes to the slots of the pages, so that concurrent transactions
+	// can insert into and delete from the file. It is taken before the lock
+	// of the buffer pool, never while holding it
+	spaceLock sync.Mutex
+	freeSpace map[int]int // free slots of the pages known to have some
+	freePages freePageHeap
 	pageCount int
+	// the page every running transaction last inserted into, which it got
+	// for writing, so that its next inserts skip the search for a page
+	inserting map[TransactionID]*heapPage
+
+	// slotsLock guards slots: the slots of the tuples of every page last
+	// written back with a free slot before some of its tuples. Pages are
+	// written compacted, so reading such a page back puts its tuples in these
+	// slots again, and the record ids that versions, insertedBy and the cursors
+	// of [HeapFile.IteratorFrom] refer to stay stable while the HeapFile is used
+	slotsLock sync.Mutex
+	slots     map[int][]int
+
+	// whether the pages are dictionary pages, see [NewHeapFileWithDictionary]
+	dictionary bool
+	// whether the pages are columnar pages, see [NewHeapFileColumnar]
+	columnar bool
+	// whether the pages keep a bloom filter of column bloomColumn, see
+	// [NewHeapFileWithBloomFilter]
+	bloom       bool
+	bloomColumn int
+
+	// the memory map pages are read from, see [NewHeapFileMmap]
+	mmapLock sync.RWMutex
+	mmapData []byte
+
+	// versions holds the write sequence number (see [nextWriteSeq]) and the
+	// writer of the last write to every record id, so that optimistic writers
+	// (see [UpdateOp]) can detect that another transaction changed a tuple
+	// after they read it. Entries older than every running transaction are
+	// dropped, see [HeapFile.pruneVersions]
+	versionLock sync.Mutex
+	versions    map[any]recordVersion
+	writes      atomic.Int64 // the writes to all record ids
+
+	// number of tuple fields deserialized from disk, see [HeapFile.DecodedFields]
+	decodedFields atomic.Int64
+	// number of bytes read from the backing file, see [HeapFile.BytesRead]
+	bytesRead atomic.Int64
+
+	// the uncommitted writes of running transactions, which only they see
+	txnLock    sync.Mutex
+	txnWrites  map[TransactionID]*txnWrites
+	insertedBy map[any]TransactionID // the transaction that inserted every pending record id
+}
+
+// the last write to a record id of a HeapFile
+type recordVersion struct {
+	seq    int64 // the write sequence number of the write
+	writer TransactionID
+}
+
+// the uncommitted writes of a running transaction to a HeapFile
+type txnWrites struct {
+	inserted map[any]struct{} // record ids of the inserted tuples
+	deleted  map[int][]*Tuple // copies of the deleted tuples, by page number
+	pages    map[int]struct{} // the pages written to
 }
 
 // NewHeapFile Create a HeapFile.
@@ -31,19 +105,91 @@ type HeapFile struct {
 // - fromFile: backing file for the HeapFile.  May be empty or a previously created heap file.
 // - td: the TupleDesc for the HeapFile.
 // - bp: the BufferPool that is used to store pages read from the HeapFile
-// May return an error if the file cannot be opened or created.
+// May return an error if the file cannot be opened or created, or a
+// SchemaMismatchError if its pages were written with another StringLength or
+// for other field types than td's.
 func NewHeapFile(fromFile string, td *TupleDesc, bp *BufferPool) (heapFile *HeapFile, err error) {
 	heapFile = &HeapFile{
-		fromFile: fromFile,
-		desc:     td,
-		bufPool:  bp,
-		idlePage: make(map[int]struct{}),
+		fromFile:   fromFile,
+		desc:       td,
+		bufPool:    bp,
+		freeSpace:  make(map[int]int),
+		freePages:  freePageHeap{queued: make(map[int]struct{})},
+		inserting:  make(map[TransactionID]*heapPage),
+		slots:      make(map[int][]int),
+		versions:   make(map[any]recordVersion),
+		txnWrites:  make(map[TransactionID]*txnWrites),
+		insertedBy: make(map[any]TransactionID),
+	}
+	if err = heapFile.checkLayout(); err != nil {
+		return nil, err
 	}
 
 	heapFile.pageCount = heapFile.NumPages()
 	return
 }
 
+// NewHeapFileWithDictionary Construct a HeapFile like [NewHeapFile], whose new
+// pages encode their strings with a per-page dictionary of up to
+// heapPageDictEntries distinct strings, stored once per page; each string
+// field then takes 2 bytes instead of StringLength. This packs many more tuples
+// per page for low-cardinality string columns, and fewer for columns with many
+// distinct values, as a page then fills its dictionary first.
+//
+// The format is recorded in every page, so the file may also hold pages
+// written without a dictionary, which are read as usual.
+func NewHeapFileWithDictionary(fromFile string, td *TupleDesc, bp *BufferPool) (*HeapFile, error) {
+	heapFile, err := NewHeapFile(fromFile, td, bp)
+	if err != nil {
+		return nil, err
+	}
+	heapFile.dictionary = true
+	return heapFile, nil
+}
+
+// NewHeapFileColumnar Construct a HeapFile like [NewHeapFile], whose new pages
+// store their tuples by column, each column in the smallest of a plain, a run
+// length and, for ints, a delta encoding. Clustered low-cardinality columns and
+// sorted int columns then take a fraction of their row size, so a page holds
+// many more tuples, and scans projecting a few columns skip decoding the others.
+//
+// The format is recorded in every page, so the file may also hold row pages,
+// which are read as usual.
+func NewHeapFileColumnar(fromFile string, td *TupleDesc, bp *BufferPool) (*HeapFile, error) {
+	heapFile, err := NewHeapFile(fromFile, td, bp)
+	if err != nil {
+		return nil, err
+	}
+	heapFile.columnar = true
+	return heapFile, nil
+}
+
+// Check that the pages of the backing file were written with the current
+// StringLength and for the field types of the file, as recorded in the header
+// of its first page. Files without pages, and pages of other formats, are left
+// to be reported when their pages are read.
+func (f *HeapFile) checkLayout() error {
+	file, err := os.Open(f.fromFile)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	header := make([]byte, heapPageHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return nil
+	}
+	if binary.LittleEndian.Uint16(header[0:2]) != heapPageMagic || header[2] != heapPageVersion {
+		return nil
+	}
+	layout := [2]uint16{binary.LittleEndian.Uint16(header[12:14]), binary.LittleEndian.Uint16(header[14:16])}
+	if err := checkPageLayout(layout, f.desc); err != nil {
+		DPrintf("HeapFile path:%s checkLayout err:%v", f.fromFile, err)
+		return err
+	}
+	return nil
+}
+
 // BackingFile Return the name of the backing file
 func (f *HeapFile) BackingFile() string {
 	return f.fromFile
@@ -64,6 +210,71 @@ func (f *HeapFile) NumPages() int {
 	return num
 }
 
+// Return the number of pages of the file, including the appended pages not yet
+// flushed to the backing file.
+func (f *HeapFile) pages() int {
+	f.spaceLock.Lock()
+	defer f.spaceLock.Unlock()
+	return f.pageCount
+}
+
+// SizeBytes Return the size of the backing file in bytes. Pages that were
+// appended but not yet flushed are not counted, and deleting tuples does not
+// shrink the file.
+func (f *HeapFile) SizeBytes() int64 {
+	fileInfo, err := os.Stat(f.fromFile)
+	if err != nil {
+		DPrintf("HeapFile path:%s SizeBytes Stat err:%v", f.fromFile, err)
+		return 0
+	}
+	return fileInfo.Size()
+}
+
+// LiveTupleCount Return the number of tuples stored in the heap file, i.e., the
+// used slots of all of its pages. Pages in the buffer pool are counted as
+// cached, other pages are read from disk without being cached.
+func (f *HeapFile) LiveTupleCount() (int, error) {
+	var count int
+	for pageNo := 0; pageNo < f.pages(); pageNo++ {
+		page, ok := f.bufPool.cachedPage(f, pageNo)
+		if !ok {
+			var err error
+			page, err = f.readPage(pageNo)
+			if err != nil {
+				DPrintf("HeapFile LiveTupleCount readPage err:%v", err)
+				return 0, err
+			}
+		}
+		count += int(page.(*heapPage).slotUsed)
+	}
+	return count, nil
+}
+
+// CSVErrorMode selects how [HeapFile.LoadFromCSVWithErrorMode] handles
+// malformed lines
+type CSVErrorMode int
+
+const (
+	// CSVAbort stops the load at the first malformed line and returns its error
+	CSVAbort CSVErrorMode = iota
+	// CSVSkip skips malformed lines, only counting them
+	CSVSkip CSVErrorMode = iota
+	// CSVCollect skips malformed lines, returning the error of every one of them
+	CSVCollect CSVErrorMode = iota
+)
+
+// maxCSVLineSize is the longest line, in bytes, that [HeapFile.LoadFromCSV]
+// accepts. It is far above bufio.Scanner's default, as the rows of wide tables
+// (e.g., of TPC datasets) can be long.
+const maxCSVLineSize = 64 << 20
+
+// CSVLoadResult summarizes a load by [HeapFile.LoadFromCSVWithErrorMode]
+type CSVLoadResult struct {
+	Loaded  int     // number of tuples inserted
+	Skipped int     // number of malformed lines that were skipped
+	Errors  []error // the errors of the skipped lines, in CSVCollect mode only
+}
+
 // LoadFromCSV Load the contents of a heap file from a specified CSV file.  Parameters are as follows:
 // - hasHeader:  whether or not the CSV file has a header
 // - sep: the character to use to separate fields
@@ -72,60 +283,343 @@ func (f *HeapFile) NumPages() int {
 // We provide the implementation of this method, but it won't work until
 // [HeapFile.insertTuple] and some other utility functions are implemented
 func (f *HeapFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skipLastField bool) error {
-	scanner := bufio.NewScanner(file)
-	cnt := 0
-	for scanner.Scan() {
-		line := scanner.Text()
-		fields := strings.Split(line, sep)
-		if skipLastField {
-			fields = fields[0 : len(fields)-1]
+	_, err := f.LoadFromCSVWithErrorMode(file, hasHeader, sep, skipLastField, CSVAbort)
+	return err
+}
+
+// LoadFromCSVShards Load the contents of a heap file from several CSV files,
+// one after the other, as if with [HeapFile.LoadFromCSV] on each. Every path
+// may be a glob pattern (see [filepath.Match]), whose matches are loaded in
+// lexical order. When hasHeader is set, the first line of every file is
+// skipped as its header. Returns an error if a path or pattern matches no file,
+// or if a file cannot be loaded.
+func (f *HeapFile) LoadFromCSVShards(paths []string, hasHeader bool, sep string, skipLastField bool) error {
+	var files []string
+	for _, path := range paths {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return GoDBError{MalformedDataError, fmt.Sprintf("LoadFromCSVShards: no file matches %s", path)}
 		}
+		files = append(files, matches...)
+	}
 
-		numFields := len(fields)
-		cnt++
-		desc := f.Descriptor()
-		if desc == nil || desc.Fields == nil {
-			return GoDBError{MalformedDataError, "Descriptor was nil"}
+	for _, path := range files {
+		file, err := os.Open(path)
+		if err != nil {
+			DPrintf("HeapFile path:%s LoadFromCSVShards Open %s err:%v", f.fromFile, path, err)
+			return err
 		}
-		if numFields != len(desc.Fields) {
-			return GoDBError{MalformedDataError, fmt.Sprintf("LoadFromCSV:  line %d (%s) does not have expected number of fields (expected %d, got %d)", cnt, line, len(f.Descriptor().Fields), numFields)}
+		err = f.LoadFromCSV(file, hasHeader, sep, skipLastField)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
 		}
-		if cnt == 1 && hasHeader {
-			continue
+	}
+	return nil
+}
+
+// MergeFrom Insert all the tuples of other into the heap file, as transaction
+// tid, filling the free slots of its pages first, as [HeapFile.insertTuple]
+// does. other is left unchanged. Useful to combine shards loaded separately.
+//
+// Returns a SchemaMismatchError if other has a different TupleDesc, and an
+// IllegalOperationError if other is the heap file itself.
+func (f *HeapFile) MergeFrom(other *HeapFile, tid TransactionID) error {
+	if other == f {
+		return GoDBError{IllegalOperationError, "MergeFrom: cannot merge a heap file into itself"}
+	}
+	if !f.desc.equals(other.desc) {
+		return GoDBError{SchemaMismatchError, fmt.Sprintf("MergeFrom: %s has a different descriptor", other.fromFile)}
+	}
+
+	iter, err := other.Iterator(tid)
+	if err != nil {
+		DPrintf("HeapFile path:%s MergeFrom Iterator err:%v", f.fromFile, err)
+		return err
+	}
+	for {
+		tuple, err := iter()
+		if err != nil {
+			DPrintf("HeapFile path:%s MergeFrom iter err:%v", f.fromFile, err)
+			return err
+		}
+		if tuple == nil {
+			return nil
 		}
+		if err := f.insertTuple(&Tuple{*f.desc, tuple.Fields, nil}, tid); err != nil {
+			DPrintf("HeapFile path:%s MergeFrom insertTuple err:%v", f.fromFile, err)
+			return err
+		}
+	}
+}
 
-		var newFields []DBValue
-		for fno, field := range fields {
-			switch f.Descriptor().Fields[fno].Ftype {
-			case IntType:
-				field = strings.TrimSpace(field)
-				floatVal, err := strconv.ParseFloat(field, 64)
-				if err != nil {
-					return GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: couldn't convert value %s to int, tuple %d", field, cnt)}
-				}
-				intValue := int(floatVal)
-				newFields = append(newFields, IntField{int64(intValue)})
-			case StringType:
-				if len(field) > StringLength {
-					field = field[0:StringLength]
-				}
-				newFields = append(newFields, StringField{field})
+// LoadFromCSVWithErrorMode Load the contents of a heap file from a specified
+// CSV file like [HeapFile.LoadFromCSV], handling malformed lines as selected
+// by mode. In CSVSkip and CSVCollect modes, the well formed lines are loaded
+// and the malformed ones are reported in the returned CSVLoadResult.
+func (f *HeapFile) LoadFromCSVWithErrorMode(file *os.File, hasHeader bool, sep string, skipLastField bool, mode CSVErrorMode) (result CSVLoadResult, err error) {
+	return f.loadCSVFrom(file, hasHeader, sep, skipLastField, mode)
+}
+
+// Load the CSV lines read from r like [HeapFile.LoadFromCSVWithErrorMode]. If
+// reading r fails, the lines before the failure stay loaded and the read error
+// is returned, wrapped.
+func (f *HeapFile) loadCSVFrom(r io.Reader, hasHeader bool, sep string, skipLastField bool, mode CSVErrorMode) (result CSVLoadResult, err error) {
+	desc := f.Descriptor()
+	if desc == nil || desc.Fields == nil {
+		return result, GoDBError{MalformedDataError, "Descriptor was nil"}
+	}
+
+	// the load is not a running transaction of the buffer pool, so every
+	// tuple is visible to all once inserted
+	tid := NewTID()
+	bp := f.bufPool
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxCSVLineSize)
+	cnt := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		cnt++
+
+		isHeader := cnt == 1 && hasHeader
+		newT, lineErr := f.parseCSVLine(line, cnt, sep, skipLastField, isHeader)
+		if lineErr != nil {
+			switch mode {
+			case CSVSkip:
+				result.Skipped++
+				continue
+			case CSVCollect:
+				result.Skipped++
+				result.Errors = append(result.Errors, lineErr)
+				continue
+			default:
+				return result, lineErr
 			}
 		}
+		if isHeader {
+			continue
+		}
 
-		newT := Tuple{*f.Descriptor(), newFields, nil}
-		tid := NewTID()
-		bp := f.bufPool
-		f.insertTuple(&newT, tid)
+		if err = f.insertTuple(newT, tid); err != nil {
+			DPrintf("HeapFile path:%s LoadFromCSV line %d insertTuple err:%v", f.fromFile, cnt, err)
+			return result, fmt.Errorf("LoadFromCSV: line %d: %w", cnt, err)
+		}
+		result.Loaded++
 
 		// Force dirty pages to disk. CommitTransaction may not be implemented
 		// yet if this is called in lab 1 or 2.
 		bp.FlushAllPages()
 
 	}
+	if err = scanner.Err(); err != nil {
+		DPrintf("HeapFile path:%s LoadFromCSV scan after line %d err:%v", f.fromFile, cnt, err)
+		return result, fmt.Errorf("LoadFromCSV: reading after line %d: %w", cnt, err)
+	}
+	return result, nil
+}
+
+// LoadFromJSON Load the contents of a heap file from a JSON file holding an
+// array of objects, one per tuple. Object keys are matched by name to the
+// fields of the HeapFile's TupleDesc; other keys are ignored. Int fields accept
+// JSON numbers (truncated, as by [HeapFile.LoadFromCSV]) and numeric strings;
+// string fields accept strings and numbers; decimal fields accept numbers and
+// numeric strings, exactly. Returns an error if the file is not
+// a JSON array of objects, an object lacks a field or has a value of the
+// wrong type, or a tuple cannot be inserted; the objects before it stay
+// loaded.
+func (f *HeapFile) LoadFromJSON(file *os.File) error {
+	desc := f.Descriptor()
+	if desc == nil || desc.Fields == nil {
+		return GoDBError{MalformedDataError, "Descriptor was nil"}
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(file))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return GoDBError{MalformedDataError, "LoadFromJSON: expected a JSON array of objects"}
+	}
+
+	// as for LoadFromCSV, the load is not a running transaction. Its pages are
+	// written out as they fill up, so that a file larger than the buffer pool
+	// does not fill it with dirty pages, and once at the end
+	tid := NewTID()
+	bp := f.bufPool
+	defer bp.FlushAllPages()
+	numPages := f.NumPages()
+	for cnt := 1; dec.More(); cnt++ {
+		var obj map[string]any
+		if err := dec.Decode(&obj); err != nil {
+			return GoDBError{MalformedDataError, fmt.Sprintf("LoadFromJSON: object %d: %v", cnt, err)}
+		}
+
+		newT, err := f.parseJSONObject(obj, cnt)
+		if err != nil {
+			return err
+		}
+
+		if err := f.insertTuple(newT, tid); err != nil {
+			DPrintf("HeapFile path:%s LoadFromJSON object %d insertTuple err:%v", f.fromFile, cnt, err)
+			return fmt.Errorf("LoadFromJSON: object %d: %w", cnt, err)
+		}
+		if n := f.NumPages(); n != numPages {
+			bp.FlushAllPages()
+			numPages = n
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return GoDBError{MalformedDataError, fmt.Sprintf("LoadFromJSON: unterminated array: %v", err)}
+	}
 	return nil
 }
 
+// Convert object number objNo of a JSON file into a tuple of the HeapFile's
+// TupleDesc.
+func (f *HeapFile) parseJSONObject(obj map[string]any, objNo int) (*Tuple, error) {
+	desc := f.Descriptor()
+	var newFields []DBValue
+	for _, field := range desc.Fields {
+		val, ok := obj[field.Fname]
+		if !ok {
+			return nil, GoDBError{MalformedDataError, fmt.Sprintf("LoadFromJSON: object %d has no field %s", objNo, field.Fname)}
+		}
+
+		switch field.Ftype.kind() {
+		case IntType:
+			var num string
+			switch val := val.(type) {
+			case json.Number:
+				num = val.String()
+			case string:
+				num = strings.TrimSpace(val)
+			}
+			floatVal, err := strconv.ParseFloat(num, 64)
+			if err != nil {
+				return nil, GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromJSON: object %d: couldn't convert value %v of field %s to int", objNo, val, field.Fname)}
+			}
+			newFields = append(newFields, IntField{int64(floatVal)})
+		case StringType:
+			var str string
+			switch val := val.(type) {
+			case string:
+				str = val
+			case json.Number:
+				str = val.String()
+			default:
+				return nil, GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromJSON: object %d: couldn't convert value %v of field %s to string", objNo, val, field.Fname)}
+			}
+			str = truncateString(str, StringLength)
+			newFields = append(newFields, StringField{str})
+		case BoolType:
+			var boolVal bool
+			var err error
+			switch val := val.(type) {
+			case bool:
+				boolVal = val
+			case string:
+				boolVal, err = parseBoolLiteral(val)
+			case json.Number:
+				boolVal, err = parseBoolLiteral(val.String())
+			default:
+				err = GoDBError{TypeMismatchError, "not a boolean"}
+			}
+			if err != nil {
+				return nil, GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromJSON: object %d: couldn't convert value %v of field %s to bool", objNo, val, field.Fname)}
+			}
+			newFields = append(newFields, BoolField{boolVal})
+		case DecimalType:
+			var num string
+			switch val := val.(type) {
+			case json.Number:
+				num = val.String()
+			case string:
+				num = val
+			}
+			decimal, err := parseDecimal(num, field.Ftype.Scale())
+			if err != nil {
+				return nil, GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromJSON: object %d: couldn't convert value %v of field %s to %v", objNo, val, field.Fname, field.Ftype)}
+			}
+			newFields = append(newFields, decimal)
+		}
+	}
+
+	return &Tuple{*desc, newFields, nil}, nil
+}
+
+// Parse line number lineNo of a CSV file into a tuple of the HeapFile's
+// TupleDesc, as [parseCSVLine] does.
+func (f *HeapFile) parseCSVLine(line string, lineNo int, sep string, skipLastField bool, isHeader bool) (*Tuple, error) {
+	return parseCSVLine(f.Descriptor(), line, lineNo, sep, skipLastField, isHeader)
+}
+
+// Parse line number lineNo of a CSV file into a tuple of desc. Returns an error
+// if the line does not have the right number of fields or a field cannot be
+// converted to its column's type. Header lines are only checked for their
+// number of fields, and yield a nil tuple.
+func parseCSVLine(desc *TupleDesc, line string, lineNo int, sep string, skipLastField bool, isHeader bool) (*Tuple, error) {
+	fields := strings.Split(line, sep)
+	if skipLastField {
+		fields = fields[0 : len(fields)-1]
+	}
+
+	numFields := len(fields)
+	if numFields != len(desc.Fields) {
+		return nil, GoDBError{MalformedDataError, fmt.Sprintf("LoadFromCSV:  line %d (%s) does not have expected number of fields (expected %d, got %d)", lineNo, line, len(desc.Fields), numFields)}
+	}
+	if isHeader {
+		return nil, nil
+	}
+
+	var newFields []DBValue
+	for fno, field := range fields {
+		switch desc.Fields[fno].Ftype.kind() {
+		case IntType:
+			rawField := field
+			field = strings.TrimSpace(field)
+			floatVal, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				colName := desc.Fields[fno].Fname
+				return nil, GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: line %d: couldn't convert value %q in column %d (%s) to int", lineNo, rawField, fno+1, colName)}
+			}
+			intValue := int(floatVal)
+			newFields = append(newFields, IntField{int64(intValue)})
+		case StringType:
+			field = truncateString(field, StringLength)
+			newFields = append(newFields, StringField{field})
+		case BoolType:
+			boolVal, err := parseBoolLiteral(field)
+			if err != nil {
+				colName := desc.Fields[fno].Fname
+				return nil, GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: line %d: couldn't convert value %q in column %d (%s) to bool", lineNo, field, fno+1, colName)}
+			}
+			newFields = append(newFields, BoolField{boolVal})
+		case DecimalType:
+			decimal, err := parseDecimal(field, desc.Fields[fno].Ftype.Scale())
+			if err != nil {
+				colName := desc.Fields[fno].Fname
+				return nil, GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: line %d: couldn't convert value %q in column %d (%s) to %v", lineNo, field, fno+1, colName, desc.Fields[fno].Ftype)}
+			}
+			newFields = append(newFields, decimal)
+		}
+	}
+
+	return &Tuple{*desc, newFields, nil}, nil
+}
+
+// Parse a boolean literal of a data file: true/false, t/f or 1/0, in any case.
+func parseBoolLiteral(str string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(str)) {
+	case "true", "t", "1":
+		return true, nil
+	case "false", "f", "0":
+		return false, nil
+	}
+	return false, GoDBError{TypeMismatchError, fmt.Sprintf("%q is not a boolean", str)}
+}
+
 // Read the specified page number from the HeapFile on disk. This method is
 // called by the [BufferPool.GetPage] method when it cannot find the page in its
 // cache.
@@ -134,11 +628,26 @@ func (f *HeapFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skipLa
 // the appropriate offset, read the bytes in, and construct a [heapPage] object,
 // using the [heapPage.initFromBuffer] method.
 func (f *HeapFile) readPage(pageNo int) (Page, error) {
+	return f.readProjectedPage(pageNo, nil)
+}
+
+// Read the specified page number from disk like [HeapFile.readPage], but only
+// deserialize the columns cols of its tuples. A nil cols reads every column.
+func (f *HeapFile) readProjectedPage(pageNo int, cols []int) (*heapPage, error) {
+	if hp, ok, err := f.readMappedPage(pageNo, cols); ok {
+		return hp, err
+	}
+
 	file, err := os.OpenFile(f.fromFile, os.O_CREATE|os.O_RDWR, 0666)
 	if err != nil {
 		DPrintf("HeapFile path:%s readPage OpenFile path:%s err:%v", f.fromFile, f.fromFile, err)
 		return nil, err
 	}
+	defer file.Close()
+
+	if cols != nil {
+		return f.readProjectedColumns(file, pageNo, cols)
+	}
 
 	_, err = file.Seek(int64(pageNo*PageSize), io.SeekStart)
 	if err != nil {
@@ -146,31 +655,45 @@ func (f *HeapFile) readPage(pageNo int) (Page, error) {
 		return nil, err
 	}
 
+	return f.pageFromReader(file, pageNo, cols)
+}
+
+// Read page pageNo, whose bytes are next in r. A single Read may return only
+// part of a page, so r is read until the whole page has been read.
+func (f *HeapFile) pageFromReader(r io.Reader, pageNo int, cols []int) (*heapPage, error) {
 	data := make([]byte, PageSize)
-	_, err = file.Read(data)
+	_, err := io.ReadFull(r, data)
 	if err != nil {
 		DPrintf("HeapFile path:%s readPage Read err:%v", f.fromFile, err)
 		return nil, err
 	}
+	f.bytesRead.Add(int64(PageSize))
+	return f.pageFromBytes(data, pageNo, cols)
+}
 
-	buf := new(bytes.Buffer)
-	err = binary.Write(buf, binary.LittleEndian, data)
-	if err != nil {
-		DPrintf("HeapFile path:%s readPage Write err:%v", f.fromFile, err)
-		return nil, err
-	}
+// Read page pageNo from data, which holds its bytes. The page does not keep
+// references to data.
+func (f *HeapFile) pageFromBytes(data []byte, pageNo int, cols []int) (*heapPage, error) {
+	buf := bytes.NewBuffer(data)
 
 	hp := &heapPage{
 		pageNo: pageNo,
 		desc:   f.desc,
 		file:   f,
 	}
-	err = hp.initFromBuffer(buf)
+	width := len(f.desc.Fields)
+	if cols != nil {
+		hp.projectCols = cols
+		hp.projectDesc = f.desc.projectCols(cols)
+		width = len(cols)
+	}
+	err := hp.initFromBuffer(buf)
 	if err != nil {
 		DPrintf("HeapFile path:%s readPage initFromBuffer err:%v", f.fromFile, err)
 		return nil, err
 	}
 
+	f.decodedFields.Add(int64(hp.slotUsed) * int64(width))
 	return hp, nil
 }
 
@@ -196,29 +719,70 @@ func (f *HeapFile) insertTuple(t *Tuple, tid TransactionID) (err error) {
 		return GoDBError{TypeMismatchError, "tuple desc not match"}
 	}
 
+	active := f.bufPool.isActive(tid)
+	f.spaceLock.Lock()
+	defer f.spaceLock.Unlock()
+
+	// use the first page with free slots, per the free space map, that takes
+	// the tuple: a dictionary page may have no room for its strings, and a
+	// columnar page for its encoded columns
 	var (
-		reply     Page
-		tmpPage   *heapPage
 		validPage *heapPage
+		fullPages []int // the pages with free slots that did not take the tuple
 	)
-	for pageNo := range f.idlePage {
+	defer func() {
+		for _, pageNo := range fullPages {
+			f.freePages.add(pageNo)
+		}
+	}()
+	if active {
+		validPage = f.insertIntoLastPage(t, tid)
+	}
+	for validPage == nil && f.freePages.Len() > 0 {
+		pageNo := f.freePages.pageNos[0]
+		if _, ok := f.freeSpace[pageNo]; !ok {
+			// the page filled up since it was queued
+			f.freePages.remove()
+			continue
+		}
+		if !f.bufPool.canWrite(f, pageNo, tid) {
+			f.freePages.remove()
+			fullPages = append(fullPages, pageNo)
+			continue
+		}
+
+		var reply Page
 		reply, err = f.bufPool.GetPage(f, pageNo, tid, WritePerm)
 		if err != nil {
 			DPrintf("HeapFile path:%s insertTuple GetPage err:%v", f.fromFile, err)
 			return
 		}
 
-		tmpPage = reply.(*heapPage)
-		if tmpPage.slotUsed >= tmpPage.slotCount {
-			delete(f.idlePage, tmpPage.pageNo)
-			continue
+		page := reply.(*heapPage)
+		_, err = page.insertTuple(t)
+		if err != nil {
+			var gerr GoDBError
+			if errors.As(err, &gerr) && gerr.code == PageFullError {
+				f.freePages.remove()
+				fullPages = append(fullPages, pageNo)
+				continue
+			}
+			DPrintf("HeapFile path:%s page insertTuple err:%v", f.fromFile, err)
+			return
 		}
-
-		// slot not full
-		validPage = tmpPage
+		validPage = page
 		break
 	}
 
+	if validPage == nil && active {
+		// NO STEAL: the new page goes to disk empty, and only holds the tuple
+		// in the buffer pool until tid commits
+		validPage, err = f.appendEmptyPage(t, tid)
+		if err != nil {
+			return
+		}
+	}
+
 	if validPage == nil {
 		DPrintf("HeapFile path:%s insertTuple valid nil, new page", f.fromFile)
 		validPage, err = newHeapPage(f.desc, f.pageCount, f)
@@ -239,22 +803,137 @@ func (f *HeapFile) insertTuple(t *Tuple, tid TransactionID) (err error) {
 			return
 		}
 
-		if len(f.bufPool.Pages) < f.bufPool.PageNum {
-			f.bufPool.Pages[f.pageKey(f.pageCount)] = validPage
-		}
+		f.bufPool.cachePage(f, f.pageCount, validPage)
 
-		f.idlePage[f.pageCount] = struct{}{}
+		f.updateFreeSpace(validPage.pageNo, validPage)
 		f.pageCount++
+		f.writes.Add(1)
 		return
 	}
 
-	_, err = validPage.insertTuple(t)
+	validPage.setDirty(tid, true)
+	f.updateFreeSpace(validPage.pageNo, validPage)
+	// a new record id has no version to bump: nobody read a tuple there since
+	// the tuple last deleted from the slot, whose delete bumped it
+	f.writes.Add(1)
+	if active {
+		f.inserting[tid] = validPage
+		f.recordInsert(t.Rid, tid)
+	}
+	return
+}
+
+// Insert t into the page running transaction tid last inserted into, if it is
+// still the first page with free slots and is cached. tid got the page for
+// writing, so no other transaction can have written it since. Returns nil if
+// the page can not take t. The caller must hold spaceLock.
+func (f *HeapFile) insertIntoLastPage(t *Tuple, tid TransactionID) *heapPage {
+	page, ok := f.inserting[tid]
+	if !ok || f.freePages.Len() == 0 || f.freePages.pageNos[0] != page.pageNo {
+		return nil
+	}
+	if _, ok := f.freeSpace[page.pageNo]; !ok {
+		return nil
+	}
+	// a dirty page is not evicted, but once written back (e.g., by
+	// [BufferPool.FlushAllPages]) it may have been evicted and read again
+	if !page.isDirty() {
+		if cached, ok := f.bufPool.cachedPage(f, page.pageNo); !ok || cached != Page(page) {
+			delete(f.inserting, tid)
+			return nil
+		}
+	}
+	if _, err := page.insertTuple(t); err != nil {
+		return nil
+	}
+	return page
+}
+
+// Write a new empty page at the end of the file, and insert t into it through
+// the buffer pool on behalf of tid, returning the page. The caller must hold
+// spaceLock.
+func (f *HeapFile) appendEmptyPage(t *Tuple, tid TransactionID) (*heapPage, error) {
+	DPrintf("HeapFile path:%s insertTuple valid nil, new empty page", f.fromFile)
+	emptyPage, err := newHeapPage(f.desc, f.pageCount, f)
 	if err != nil {
+		DPrintf("HeapFile path:%s insertTuple newHeapPage err:%v", f.fromFile, err)
+		return nil, err
+	}
+	if err = f.flushPage(emptyPage); err != nil {
+		DPrintf("HeapFile path:%s page flushPage err:%v", f.fromFile, err)
+		return nil, err
+	}
+	pageNo := f.pageCount
+	f.pageCount++
+	f.updateFreeSpace(pageNo, emptyPage)
+
+	reply, err := f.bufPool.GetPage(f, pageNo, tid, WritePerm)
+	if err != nil {
+		DPrintf("HeapFile path:%s insertTuple GetPage err:%v", f.fromFile, err)
+		return nil, err
+	}
+	page := reply.(*heapPage)
+	if _, err = page.insertTuple(t); err != nil {
 		DPrintf("HeapFile path:%s page insertTuple err:%v", f.fromFile, err)
+		return nil, err
+	}
+	return page, nil
+}
+
+// Record the number of free slots of page pageNo in the free space map. The
+// caller must hold spaceLock.
+func (f *HeapFile) updateFreeSpace(pageNo int, page Page) {
+	if free := page.NumFreeSlots(); free > 0 {
+		f.freeSpace[pageNo] = free
+		f.freePages.add(pageNo)
+	} else {
+		delete(f.freeSpace, pageNo)
+	}
+}
+
+// freePageHeap is a [heap.Interface] of the page numbers in the free space map
+// of a [HeapFile], with the lowest one on top, so that inserts find the first
+// page with free slots without sorting the map. Pages that fill up stay queued
+// until they reach the top.
+type freePageHeap struct {
+	pageNos []int
+	queued  map[int]struct{} // the page numbers in pageNos
+}
+
+func (h *freePageHeap) Len() int {
+	return len(h.pageNos)
+}
+
+func (h *freePageHeap) Less(i, j int) bool {
+	return h.pageNos[i] < h.pageNos[j]
+}
+
+func (h *freePageHeap) Swap(i, j int) {
+	h.pageNos[i], h.pageNos[j] = h.pageNos[j], h.pageNos[i]
+}
+
+func (h *freePageHeap) Push(x any) {
+	h.pageNos = append(h.pageNos, x.(int))
+}
+
+func (h *freePageHeap) Pop() any {
+	reply := h.pageNos[len(h.pageNos)-1]
+	h.pageNos = h.pageNos[:len(h.pageNos)-1]
+	return reply
+}
+
+// Queue page pageNo, unless it is queued already.
+func (h *freePageHeap) add(pageNo int) {
+	if _, ok := h.queued[pageNo]; ok {
 		return
 	}
-	validPage.setDirty(tid, true)
-	return
+	h.queued[pageNo] = struct{}{}
+	heap.Push(h, pageNo)
+}
+
+// Remove the lowest page number.
+func (h *freePageHeap) remove() {
+	delete(h.queued, heap.Pop(h).(int))
 }
 
 // Remove the provided tuple from the HeapFile.
@@ -275,22 +954,311 @@ func (f *HeapFile) deleteTuple(t *Tuple, tid TransactionID) (err error) {
 	}
 
 	page := tmpPage.(*heapPage)
+	f.spaceLock.Lock()
 	err = page.deleteTuple(t.Rid)
 	if err != nil {
+		f.spaceLock.Unlock()
 		DPrintf("HeapFile path:%s page deleteTuple err:%v", f.fromFile, err)
 		return
 	}
+	f.updateFreeSpace(pageNo, page)
+	f.spaceLock.Unlock()
+	f.bumpVersion(t.Rid, tid)
+	f.recordDelete(t, tid)
+	return
+}
+
+// Return the writes of running transaction tid, creating them if needed, and
+// whether they were created. The caller must hold txnLock.
+func (f *HeapFile) writesOf(tid TransactionID) (*txnWrites, bool) {
+	w, ok := f.txnWrites[tid]
+	if !ok {
+		w = &txnWrites{
+			inserted: make(map[any]struct{}),
+			deleted:  make(map[int][]*Tuple),
+			pages:    make(map[int]struct{}),
+		}
+		f.txnWrites[tid] = w
+	}
+	return w, !ok
+}
+
+// Record that running transaction tid inserted the tuple with record id rid,
+// so that other transactions do not see the tuple before tid commits.
+func (f *HeapFile) recordInsert(rid recordID, tid TransactionID) {
+	pageNo, _ := splitRecordID(rid)
+	f.txnLock.Lock()
+	w, created := f.writesOf(tid)
+	w.inserted[rid] = struct{}{}
+	w.pages[pageNo] = struct{}{}
+	f.insertedBy[rid] = tid
+	f.txnLock.Unlock()
+	if created {
+		f.bufPool.noteWrite(tid, f)
+	}
+}
 
-	f.idlePage[pageNo] = struct{}{}
+// Record that tid deleted tuple t, if tid is a running transaction, so that
+// other transactions keep seeing the tuple until tid commits.
+func (f *HeapFile) recordDelete(t *Tuple, tid TransactionID) {
+	if !f.bufPool.isActive(tid) {
+		return
+	}
+	pageNo, _ := splitRecordID(t.Rid)
+	f.txnLock.Lock()
+	w, created := f.writesOf(tid)
+	w.pages[pageNo] = struct{}{}
+	if _, ok := w.inserted[t.Rid]; ok {
+		// nobody else ever saw the tuple
+		delete(w.inserted, t.Rid)
+		delete(f.insertedBy, t.Rid)
+	} else {
+		w.deleted[pageNo] = append(w.deleted[pageNo], &Tuple{t.Desc, t.Fields, t.Rid})
+	}
+	f.txnLock.Unlock()
+	if created {
+		f.bufPool.noteWrite(tid, f)
+	}
+}
+
+// Report whether the tuple with record id rid is visible to transaction tid,
+// i.e., it was not inserted by another running transaction.
+func (f *HeapFile) visibleTo(rid recordID, tid TransactionID) bool {
+	f.txnLock.Lock()
+	defer f.txnLock.Unlock()
+	inserter, ok := f.insertedBy[rid]
+	return !ok || inserter == tid
+}
+
+// Return the tuples of page pageNo deleted by running transactions other than
+// tid, which tid still sees, by ascending slot.
+func (f *HeapFile) deletedByOthers(pageNo int, tid TransactionID) (deleted []*Tuple) {
+	f.txnLock.Lock()
+	for other, w := range f.txnWrites {
+		if other != tid {
+			deleted = append(deleted, w.deleted[pageNo]...)
+		}
+	}
+	f.txnLock.Unlock()
+	slices.SortFunc(deleted, func(a, b *Tuple) int {
+		_, slotA := splitRecordID(a.Rid)
+		_, slotB := splitRecordID(b.Rid)
+		return slotA - slotB
+	})
 	return
 }
 
+// Return a function that iterates through the tuples of page pageNo that tid
+// sees, by ascending slot, or descending if reverse is set: the tuples returned
+// by pageIter that are visible to tid, and, in their slots, the tuples deleted
+// from the page by other running transactions, which convert is applied to.
+func (f *HeapFile) visibleTupleIter(pageNo int, pageIter func() (*Tuple, error), tid TransactionID, reverse bool, convert func(*Tuple) *Tuple) func() (*Tuple, error) {
+	deleted := f.deletedByOthers(pageNo, tid)
+	if reverse {
+		slices.Reverse(deleted)
+	}
+	var next *Tuple // the next visible tuple of pageIter
+	return func() (tuple *Tuple, err error) {
+		for next == nil {
+			next, err = pageIter()
+			if err != nil || next == nil {
+				break
+			}
+			if !f.visibleTo(next.Rid, tid) {
+				next = nil
+			}
+		}
+		if err != nil {
+			return
+		}
+		if len(deleted) > 0 {
+			_, slot := splitRecordID(deleted[0].Rid)
+			if next != nil {
+				_, nextSlot := splitRecordID(next.Rid)
+				if reverse == (nextSlot > slot) {
+					tuple, next = next, nil
+					return
+				}
+			}
+			tuple, deleted = deleted[0], deleted[1:]
+			if convert != nil {
+				tuple = convert(tuple)
+			}
+			return
+		}
+		tuple, next = next, nil
+		return
+	}
+}
+
+// Make the writes of transaction tid visible to all transactions if commit is
+// set, or forget them otherwise. Called by the buffer pool when tid ends, after
+// it flushed the pages tid dirtied, or discarded them from its cache so that
+// they are read back from disk as they were before tid wrote them.
+func (f *HeapFile) endTransaction(tid TransactionID, commit bool) {
+	defer f.pruneVersions()
+	f.spaceLock.Lock()
+	delete(f.inserting, tid)
+	f.spaceLock.Unlock()
+	f.txnLock.Lock()
+	w := f.txnWrites[tid]
+	delete(f.txnWrites, tid)
+	if w != nil {
+		for rid := range w.inserted {
+			delete(f.insertedBy, rid)
+		}
+	}
+	f.txnLock.Unlock()
+	if w == nil || commit {
+		return
+	}
+
+	// the free slots of the discarded pages are those of their disk versions
+	for pageNo := range w.pages {
+		page, err := f.bufPool.GetPage(f, pageNo, tid, ReadPerm)
+		f.spaceLock.Lock()
+		if err != nil {
+			DPrintf("HeapFile path:%s endTransaction GetPage err:%v", f.fromFile, err)
+			delete(f.freeSpace, pageNo)
+		} else {
+			f.updateFreeSpace(pageNo, page)
+		}
+		f.spaceLock.Unlock()
+	}
+}
+
+// Return the version of the tuple with record id rid: the write sequence
+// number of its last write, or 0 if it was not written since the oldest running
+// transaction began. Callers that remember this value can later detect (via
+// [HeapFile.updateTuple]) whether the tuple was changed in the meantime.
+func (f *HeapFile) tupleVersion(rid recordID) int64 {
+	f.versionLock.Lock()
+	defer f.versionLock.Unlock()
+	return f.versions[rid].seq
+}
+
+// Record a write by tid to the tuple with record id rid.
+func (f *HeapFile) bumpVersion(rid recordID, tid TransactionID) {
+	f.versionLock.Lock()
+	defer f.versionLock.Unlock()
+	f.versions[rid] = recordVersion{nextWriteSeq(), tid}
+	f.writes.Add(1)
+}
+
+// Drop the versions of the record ids last written before the oldest running
+// transaction began. No running transaction can have read an older version of
+// those tuples, so a version of 0 is as good as theirs to check an update
+// against. Updates by transactions that were not begun with the buffer pool
+// are only checked reliably while some transaction runs.
+func (f *HeapFile) pruneVersions() {
+	oldest := f.bufPool.oldestActiveWriteSeq()
+	f.versionLock.Lock()
+	defer f.versionLock.Unlock()
+	for rid, version := range f.versions {
+		if version.seq <= oldest {
+			delete(f.versions, rid)
+		}
+	}
+}
+
+// Return the number of writes that have been made to the file, so that callers
+// that remember this value (see [MaterializedView]) can detect later writes.
+func (f *HeapFile) writeCount() int64 {
+	return f.writes.Load()
+}
+
+// Replace the tuple oldT with newT, provided no transaction other than tid
+// wrote oldT's record id after readVersion, a write sequence number as of
+// before oldT was read: the beginning of tid (see
+// [BufferPool.beginWriteSeq]), or the [HeapFile.tupleVersion] of oldT when it
+// was read. Otherwise some other writer got there first and a ConflictError is
+// returned, in which case the caller should abort and retry.
+//
+// The version check and the claim on the record id happen atomically, so of
+// several writers that read the same version exactly one succeeds. The update
+// replaces the fields of oldT in place, so newT gets the record id of oldT,
+// unless the new fields do not fit in the page of oldT (see
+// [heapPage.updateTuple]); the update is then a delete of oldT followed by an
+// insert of newT.
+func (f *HeapFile) updateTuple(oldT *Tuple, newT *Tuple, readVersion int64, tid TransactionID) (err error) {
+	if !f.desc.equals(&newT.Desc) {
+		return GoDBError{TypeMismatchError, "tuple desc not match"}
+	}
+
+	f.versionLock.Lock()
+	if last := f.versions[oldT.Rid]; last.seq > readVersion && last.writer != tid {
+		f.versionLock.Unlock()
+		DPrintf("HeapFile path:%s updateTuple rid:%v version conflict", f.fromFile, oldT.Rid)
+		return GoDBError{ConflictError, fmt.Sprintf("tuple %v was modified by another transaction", oldT.Rid)}
+	}
+	f.versions[oldT.Rid] = recordVersion{nextWriteSeq(), tid}
+	f.versionLock.Unlock()
+
+	err = f.updateTupleInPlace(oldT, newT, tid)
+	var gerr GoDBError
+	if !errors.As(err, &gerr) || gerr.code != PageFullError {
+		return
+	}
+
+	err = f.deleteTuple(oldT, tid)
+	if err != nil {
+		DPrintf("HeapFile path:%s updateTuple deleteTuple err:%v", f.fromFile, err)
+		return
+	}
+
+	err = f.insertTuple(newT, tid)
+	if err != nil {
+		DPrintf("HeapFile path:%s updateTuple insertTuple err:%v", f.fromFile, err)
+		return
+	}
+	return
+}
+
+// Replace the fields of oldT with those of newT in the page holding oldT, like
+// [heapPage.updateTuple]. To the other running transactions, this is a delete
+// of oldT and an insert of newT.
+func (f *HeapFile) updateTupleInPlace(oldT *Tuple, newT *Tuple, tid TransactionID) error {
+	pageNo, _ := splitRecordID(oldT.Rid)
+	tmpPage, err := f.bufPool.GetPage(f, pageNo, tid, WritePerm)
+	if err != nil {
+		DPrintf("HeapFile path:%s updateTupleInPlace GetPage err:%v", f.fromFile, err)
+		return err
+	}
+
+	page := tmpPage.(*heapPage)
+	f.spaceLock.Lock()
+	err = page.updateTuple(oldT.Rid, newT.Fields)
+	f.spaceLock.Unlock()
+	if err != nil {
+		DPrintf("HeapFile path:%s page updateTuple err:%v", f.fromFile, err)
+		return err
+	}
+	page.setDirty(tid, true)
+	newT.Rid = oldT.Rid
+	f.recordDelete(oldT, tid)
+	if f.bufPool.isActive(tid) {
+		f.recordInsert(newT.Rid, tid)
+	}
+	return nil
+}
+
 // Method to force the specified page back to the backing file at the
 // appropriate location. This will be called by BufferPool when it wants to
 // evict a page. The Page object should store information about its offset on
 // disk (e.g., that it is the ith page in the heap file), so you can determine
 // where to write it back.
 func (f *HeapFile) flushPage(p Page) (err error) {
+	page := p.(*heapPage)
+	buf, err := page.toBuffer()
+	if err != nil {
+		DPrintf("HeapFile path:%s flushPage ToBuffer err:%v", f.fromFile, err)
+		return
+	}
+
+	// pages are flushed both under spaceLock and under the lock of the buffer
+	// pool, so the file is shared: write at an offset rather than seeking
+	f.fileLock.Lock()
+	defer f.fileLock.Unlock()
 	if f.file == nil {
 		f.file, err = os.OpenFile(f.fromFile, os.O_CREATE|os.O_RDWR, 0666)
 		if err != nil {
@@ -299,27 +1267,69 @@ func (f *HeapFile) flushPage(p Page) (err error) {
 		}
 	}
 
-	page := p.(*heapPage)
-	_, err = f.file.Seek(int64(page.pageNo*PageSize), io.SeekStart)
+	_, err = f.file.WriteAt(buf.Bytes(), int64(page.pageNo*PageSize))
 	if err != nil {
-		DPrintf("HeapFile path:%s flushPage Seek err:%v", f.fromFile, err)
+		DPrintf("HeapFile path:%s flushPage WriteAt err:%v", f.fromFile, err)
 		return
 	}
+	f.setWrittenSlots(page)
 
-	buf, err := page.toBuffer()
-	if err != nil {
-		DPrintf("HeapFile path:%s flushPage ToBuffer err:%v", f.fromFile, err)
-		return
+	page.dirty = false
+	return
+}
+
+// Record the slots of the tuples of page, which was just written back, if they
+// are not its first slots.
+func (f *HeapFile) setWrittenSlots(page *heapPage) {
+	var slots []int
+	compacted := false
+	for slot, tuple := range page.tuples {
+		if tuple != nil {
+			compacted = compacted || slot != len(slots)
+			slots = append(slots, slot)
+		}
+	}
+	f.slotsLock.Lock()
+	defer f.slotsLock.Unlock()
+	if compacted {
+		f.slots[page.pageNo] = slots
+	} else {
+		delete(f.slots, page.pageNo)
 	}
+}
 
-	_, err = buf.WriteTo(f.file)
-	if err != nil {
-		DPrintf("HeapFile path:%s flushPage WriteTo err:%v", f.fromFile, err)
-		return
+// Return the slots of the tuples of page pageNo as written back, in the order
+// they are written, or nil if they are its first slots.
+func (f *HeapFile) writtenSlots(pageNo int) []int {
+	f.slotsLock.Lock()
+	defer f.slotsLock.Unlock()
+	return f.slots[pageNo]
+}
+
+// Close Flush the dirty pages of the file cached in the buffer pool, and close
+// the backing file, which flushPage keeps open, and the memory map of a file
+// constructed with [NewHeapFileMmap]. The pages stay cached, and the HeapFile
+// remains usable: the backing file is opened again to write the next page.
+func (f *HeapFile) Close() error {
+	if err := f.bufPool.flushFilePages(f); err != nil {
+		return err
+	}
+	if err := f.Unmap(); err != nil {
+		DPrintf("HeapFile path:%s Close Unmap err:%v", f.fromFile, err)
+		return err
 	}
 
-	page.dirty = false
-	return
+	f.fileLock.Lock()
+	defer f.fileLock.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		DPrintf("HeapFile path:%s Close err:%v", f.fromFile, err)
+	}
+	return err
 }
 
 // Descriptor method -- return the TupleDesc for this HeapFile
@@ -338,42 +1348,290 @@ func (f *HeapFile) Descriptor() *TupleDesc {
 // set appropriate so that [deleteTuple] will work (see additional comments there).
 // Make sure to set the returned tuple's TupleDescriptor to the TupleDescriptor of
 // the HeapFile. This allows it to correctly capture the table qualifier.
+//
+// Tuples are returned in physical order, which callers may rely on (e.g., to
+// break ties stably, or to resume a scan with [HeapFile.IteratorFrom]): by
+// ascending page number, and in a page by ascending slot, so a tuple inserted
+// into a slot freed by a delete is returned at the place of that slot rather
+// than last. A page is written back with its tuples compacted, but read back
+// with its tuples in the same slots, so that the record ids of the tuples do
+// not change while the HeapFile is used; another HeapFile of the same backing
+// file, e.g., after a restart, may number them differently. The tuples deleted
+// by other running transactions, which tid still sees, are returned at the
+// place of their slots.
 func (f *HeapFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
-	var iterIndex int
+	return f.IteratorFrom(tid, nil)
+}
+
+// IteratorFrom Return a function that iterates through the records in the heap
+// file like [HeapFile.Iterator], but starting just after the tuple with record
+// id after, e.g., the Rid of the last tuple returned by an interrupted scan. A
+// nil after iterates from the start of the file. The scan can be resumed after
+// the pages it read were written back and evicted, since they are read back
+// with the same record ids, but only with the HeapFile that returned after:
+// another HeapFile of the same backing file, e.g., after a restart, may number
+// the tuples of a page differently.
+func (f *HeapFile) IteratorFrom(tid TransactionID, after recordID) (func() (*Tuple, error), error) {
+	var (
+		iterIndex int
+		skipSlot  = -1 // in page iterIndex, skip the tuples up to this slot
+	)
+	if after != nil {
+		if _, ok := after.(string); !ok {
+			return nil, GoDBError{IllegalOperationError, fmt.Sprintf("%v is not a heap file record id", after)}
+		}
+		iterIndex, skipSlot = splitRecordID(after)
+	}
+	return f.iteratorPages(tid, iterIndex, skipSlot, -1, nil, nil), nil
+}
+
+// IteratorRange Return a function that iterates through the records in pages
+// startPage (inclusive) to endPage (exclusive) of the heap file like
+// [HeapFile.Iterator], so that disjoint page ranges can be scanned by different
+// workers, together covering the file once. Pages past the end of the file are
+// ignored. Returns an error if the range is invalid.
+func (f *HeapFile) IteratorRange(tid TransactionID, startPage, endPage int) (func() (*Tuple, error), error) {
+	if startPage < 0 || endPage < startPage {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("invalid page range [%d, %d)", startPage, endPage)}
+	}
+	return f.iteratorPages(tid, startPage, -1, endPage, nil, nil), nil
+}
+
+// ScanProgress reports how many pages of a heap file a scan started by
+// [HeapFile.IteratorWithProgress] has consumed. It may be read by another
+// goroutine than the one running the scan, e.g., to display progress.
+type ScanProgress struct {
+	pagesDone  atomic.Int64
+	totalPages atomic.Int64
+}
+
+// PagesDone Return the number of pages the scan has consumed.
+func (p *ScanProgress) PagesDone() int {
+	return int(p.pagesDone.Load())
+}
+
+// TotalPages Return the number of pages of the file, which grows if tuples are
+// appended during the scan.
+func (p *ScanProgress) TotalPages() int {
+	return int(p.totalPages.Load())
+}
+
+// Fraction Return the fraction of the pages consumed, from 0 to 1. An empty
+// file counts as done.
+func (p *ScanProgress) Fraction() float64 {
+	done, total := p.pagesDone.Load(), p.totalPages.Load()
+	if total == 0 {
+		return 1
+	}
+	return float64(done) / float64(total)
+}
+
+// Record that done of total pages have been consumed. A nil p records nothing.
+func (p *ScanProgress) update(done, total int) {
+	if p == nil {
+		return
+	}
+	p.totalPages.Store(int64(total))
+	p.pagesDone.Store(int64(done))
+}
+
+// IteratorWithProgress Return a function that iterates through the records in
+// the heap file like [HeapFile.Iterator], along with the progress of the scan.
+func (f *HeapFile) IteratorWithProgress(tid TransactionID) (func() (*Tuple, error), *ScanProgress, error) {
+	progress := &ScanProgress{}
+	progress.update(0, f.pages())
+	return f.iteratorPages(tid, 0, -1, -1, progress, nil), progress, nil
+}
+
+// Return a function that iterates through the records of the pages from
+// startPage up to endPage (exclusive), or to the end of the file if endPage is
+// negative, skipping the tuples of startPage up to slot skipSlot, and the pages
+// for which skipPage, unless it is nil, returns true. The pages consumed are
+// reported to progress, unless it is nil.
+func (f *HeapFile) iteratorPages(tid TransactionID, startPage int, skipSlot int, endPage int, progress *ScanProgress, skipPage func(pageNo int) bool) func() (*Tuple, error) {
+	iterIndex := startPage
+	lastPage := func() int {
+		if pageCount := f.pages(); endPage < 0 || endPage > pageCount {
+			return pageCount
+		}
+		return endPage
+	}
+
 	tupleIterMap := make(map[int]func() (*Tuple, error))
 	return func() (tuple *Tuple, err error) {
-		var (
-			tmpPage Page
-			page    *heapPage
-			i       int
-		)
-		for i = iterIndex; i < f.pageCount; i++ {
-			tmpPage, err = f.bufPool.GetPage(f, i, tid, ReadPerm)
-			if err != nil {
-				DPrintf("HeapFile path:%s Iterator GetPage err:%v", f.fromFile, err)
+		if err = transactionCtxErr(tid); err != nil {
+			return
+		}
+
+		for i := iterIndex; i < lastPage(); i++ {
+			if tupleIterMap[i] == nil {
+				if skipPage != nil && skipPage(i) && len(f.deletedByOthers(i, tid)) == 0 {
+					iterIndex++
+					progress.update(iterIndex-startPage, lastPage()-startPage)
+					continue
+				}
+
+				var tmpPage Page
+				tmpPage, err = f.bufPool.GetPageWithHint(f, i, tid, ReadPerm, SequentialAccess)
+				if err != nil {
+					DPrintf("HeapFile path:%s Iterator GetPage err:%v", f.fromFile, err)
+					return
+				}
+				tupleIterMap[i] = f.visibleTupleIter(i, tmpPage.(*heapPage).tupleIter(), tid, false, nil)
+			}
+
+			for {
+				tuple, err = tupleIterMap[i]()
+				if err != nil {
+					return
+				}
+				if tuple == nil {
+					break
+				}
+				if i == startPage {
+					if _, slot := splitRecordID(tuple.Rid); slot <= skipSlot {
+						continue
+					}
+				}
+				tuple = f.scanTuple(tuple)
 				return
 			}
 
-			page = tmpPage.(*heapPage)
+			delete(tupleIterMap, i)
+			iterIndex++
+			progress.update(iterIndex-startPage, lastPage()-startPage)
+		}
+		return
+	}
+}
 
-			if tupleIterMap[i] == nil {
-				tupleIterMap[i] = page.tupleIter()
+// ReverseIterator Return a function that iterates through the records in the
+// heap file like [HeapFile.Iterator], but in the reverse order: from the last
+// page down to the first one, and in every page from the highest slot down.
+// Pages appended during the scan are not read.
+func (f *HeapFile) ReverseIterator(tid TransactionID) (func() (*Tuple, error), error) {
+	pageNo := f.pages() - 1
+
+	var tupleIter func() (*Tuple, error)
+	return func() (tuple *Tuple, err error) {
+		if err = transactionCtxErr(tid); err != nil {
+			return
+		}
+
+		for ; pageNo >= 0; pageNo-- {
+			if tupleIter == nil {
+				var tmpPage Page
+				tmpPage, err = f.bufPool.GetPage(f, pageNo, tid, ReadPerm)
+				if err != nil {
+					DPrintf("HeapFile path:%s ReverseIterator GetPage err:%v", f.fromFile, err)
+					return
+				}
+				tupleIter = f.visibleTupleIter(pageNo, tmpPage.(*heapPage).reverseTupleIter(), tid, true, nil)
 			}
 
-			tuple, err = tupleIterMap[i]()
-			if tuple == nil {
-				iterIndex++
-				continue
+			tuple, err = tupleIter()
+			if err != nil {
+				return
+			}
+			if tuple != nil {
+				tuple = f.scanTuple(tuple)
+				return
 			}
+			tupleIter = nil
+		}
+		return
+	}, nil
+}
+
+// IteratorProject Return a function that iterates through the records in the
+// heap file like [HeapFile.Iterator], but only returns the columns at indexes
+// cols, in that order. Pages cached in the buffer pool are projected from
+// their cached tuples; other pages are read from disk without being cached,
+// deserializing only the requested columns. Of a columnar page (see
+// [NewHeapFileColumnar]), only the requested columns are read.
+func (f *HeapFile) IteratorProject(tid TransactionID, cols []int) (func() (*Tuple, error), error) {
+	for _, col := range cols {
+		if col < 0 || col >= len(f.desc.Fields) {
+			return nil, GoDBError{IllegalOperationError, fmt.Sprintf("column %d out of range for a table of %d columns", col, len(f.desc.Fields))}
+		}
+	}
+	cols = append([]int(nil), cols...)
+	projectDesc := f.desc.projectCols(cols)
+	project := func(t *Tuple) *Tuple {
+		return projectTuple(t, cols, projectDesc)
+	}
 
-			tuple.Desc = *f.desc
+	var (
+		pageNo    int
+		tupleIter func() (*Tuple, error)
+	)
+	return func() (tuple *Tuple, err error) {
+		if err = transactionCtxErr(tid); err != nil {
 			return
 		}
 
+		for ; pageNo < f.pages(); pageNo++ {
+			if tupleIter == nil {
+				var pageIter func() (*Tuple, error)
+				if cachedPage, ok := f.bufPool.cachedPage(f, pageNo); ok {
+					cachedIter := cachedPage.(*heapPage).tupleIter()
+					pageIter = func() (*Tuple, error) {
+						t, err := cachedIter()
+						if t == nil || err != nil {
+							return t, err
+						}
+						return project(t), nil
+					}
+				} else {
+					page, err := f.readProjectedPage(pageNo, cols)
+					if err != nil {
+						DPrintf("HeapFile path:%s IteratorProject readProjectedPage err:%v", f.fromFile, err)
+						return nil, err
+					}
+					pageIter = page.tupleIter()
+				}
+				tupleIter = f.visibleTupleIter(pageNo, pageIter, tid, false, project)
+			}
+
+			tuple, err = tupleIter()
+			if err != nil || tuple != nil {
+				return
+			}
+			tupleIter = nil
+		}
 		return
 	}, nil
 }
 
+// Return a copy of tuple t of a cached page, with the descriptor of the file,
+// which the parser may have given a table alias since the page was read. The
+// tuples of a cached page are shared by all the scans of the page, so scans
+// must not modify them.
+func (f *HeapFile) scanTuple(t *Tuple) *Tuple {
+	return &Tuple{*f.desc, t.Fields, t.Rid}
+}
+
+// Return the fields at indexes cols of tuple t, which have descriptor desc.
+func projectTuple(t *Tuple, cols []int, desc *TupleDesc) *Tuple {
+	fields := make([]DBValue, len(cols))
+	for i, col := range cols {
+		fields[i] = t.Fields[col]
+	}
+	return &Tuple{*desc, fields, t.Rid}
+}
+
+// DecodedFields Return the number of tuple fields deserialized from disk pages
+// of this file so far.
+func (f *HeapFile) DecodedFields() int64 {
+	return f.decodedFields.Load()
+}
+
+// BytesRead Return the number of bytes read from the backing file so far. Pages
+// read through a memory map (see [NewHeapFileMmap]) are not counted.
+func (f *HeapFile) BytesRead() int64 {
+	return f.bytesRead.Load()
+}
+
 // internal strucuture to use as key for a heap page
 type heapHash struct {
 	FileName string
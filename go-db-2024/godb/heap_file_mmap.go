@@ -0,0 +1,73 @@
+package godb
+
+import (
+	"os"
+)
+
+// NewHeapFileMmap Construct a HeapFile like [NewHeapFile], which reads its
+// pages from a read-only memory map of the backing file rather than with a
+// seek and a read per page, for faster scans of large tables that are mostly
+// read. The map covers the pages of the file when it is constructed; the pages
+// added later are read as usual. Writes to the mapped pages are seen by later
+// reads, as the map shares the pages of the file.
+//
+// On platforms without memory maps, or if the file cannot be mapped (e.g., as
+// it has no pages yet), the HeapFile reads its pages as usual. Call
+// [HeapFile.Unmap] to release the map.
+func NewHeapFileMmap(fromFile string, td *TupleDesc, bp *BufferPool) (*HeapFile, error) {
+	heapFile, err := NewHeapFile(fromFile, td, bp)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(fromFile)
+	if err != nil {
+		return heapFile, nil
+	}
+	defer file.Close()
+	size := heapFile.NumPages() * PageSize
+	if size == 0 {
+		return heapFile, nil
+	}
+	data, err := mmapFile(file, size)
+	if err != nil {
+		DPrintf("HeapFile path:%s NewHeapFileMmap mmap err:%v", fromFile, err)
+		return heapFile, nil
+	}
+	heapFile.mmapData = data
+	return heapFile, nil
+}
+
+// Mapped Report whether the HeapFile reads its pages from a memory map.
+func (f *HeapFile) Mapped() bool {
+	f.mmapLock.RLock()
+	defer f.mmapLock.RUnlock()
+	return f.mmapData != nil
+}
+
+// Unmap Release the memory map of a HeapFile constructed with
+// [NewHeapFileMmap]; its pages are then read as usual.
+func (f *HeapFile) Unmap() error {
+	f.mmapLock.Lock()
+	defer f.mmapLock.Unlock()
+	if f.mmapData == nil {
+		return nil
+	}
+	err := munmapFile(f.mmapData)
+	f.mmapData = nil
+	return err
+}
+
+// Read page pageNo from the memory map like [HeapFile.readProjectedPage], if
+// the map covers it. ok is false if it does not, and the page must be read
+// from the file.
+func (f *HeapFile) readMappedPage(pageNo int, cols []int) (hp *heapPage, ok bool, err error) {
+	f.mmapLock.RLock()
+	defer f.mmapLock.RUnlock()
+	end := (pageNo + 1) * PageSize
+	if f.mmapData == nil || end > len(f.mmapData) {
+		return nil, false, nil
+	}
+	hp, err = f.pageFromBytes(f.mmapData[end-PageSize:end], pageNo, cols)
+	return hp, true, err
+}
@@ -0,0 +1,183 @@
+package godb
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// Write a heap file of ntups tuples in dir, and return its name and desc.
+func makeMmapTestFile(tb testing.TB, dir string, ntups int) (string, *TupleDesc) {
+	tb.Helper()
+	td := &TupleDesc{Fields: []FieldType{{Fname: "name", Ftype: StringType}, {Fname: "n", Ftype: IntType}}}
+	name := filepath.Join(dir, "mmap.dat")
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		tb.Fatalf(err.Error())
+	}
+	hf, err := NewHeapFile(name, td, bp)
+	if err != nil {
+		tb.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	for i := 0; i < ntups; i++ {
+		tup := Tuple{*td, []DBValue{StringField{fmt.Sprintf("name%d", i)}, IntField{int64(i)}}, nil}
+		if err := hf.insertTuple(&tup, tid); err != nil {
+			tb.Fatalf(err.Error())
+		}
+		if i%100 == 99 {
+			bp.FlushAllPages()
+		}
+	}
+	bp.FlushAllPages()
+	return name, td
+}
+
+// Return all the tuples of a new HeapFile over name, read with a new buffer
+// pool, and the file.
+func scanFile(t *testing.T, name string, td *TupleDesc, mmap bool) ([]*Tuple, *HeapFile) {
+	t.Helper()
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	newFile := NewHeapFile
+	if mmap {
+		newFile = NewHeapFileMmap
+	}
+	hf, err := newFile(name, td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := hf.Iterator(NewTID())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return drainIterator(t, iter), hf
+}
+
+func TestHeapFileMmapScan(t *testing.T) {
+	name, td := makeMmapTestFile(t, t.TempDir(), 1000)
+
+	expected, _ := scanFile(t, name, td, false)
+	tuples, hf := scanFile(t, name, td, true)
+	defer hf.Unmap()
+	if !hf.Mapped() {
+		t.Fatalf("expected the file to be mapped")
+	}
+	if len(tuples) != 1000 || len(tuples) != len(expected) {
+		t.Fatalf("expected 1000 tuples, got %d and %d", len(expected), len(tuples))
+	}
+	for i := range tuples {
+		if !tuples[i].equals(expected[i]) || tuples[i].Rid != expected[i].Rid {
+			t.Fatalf("tuple %d: expected %v, got %v", i, expected[i], tuples[i])
+		}
+	}
+
+	// writes to the mapped pages, and the pages added after mapping, are read
+	tid := NewTID()
+	hf.bufPool.BeginTransaction(tid)
+	if err := hf.deleteTuple(tuples[0], tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	pages := hf.NumPages()
+	for i := 0; i < 200; i++ {
+		tup := Tuple{*td, []DBValue{StringField{"added"}, IntField{int64(i)}}, nil}
+		if err := hf.insertTuple(&tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	hf.bufPool.FlushAllPages()
+	hf.bufPool.CommitTransaction(tid)
+	if hf.NumPages() <= pages {
+		t.Fatalf("expected pages past the map")
+	}
+	plain, err := NewHeapFile(name, td, hf.bufPool)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for pageNo := 0; pageNo < hf.NumPages(); pageNo++ {
+		mapped, err := hf.readPage(pageNo)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		read, err := plain.readPage(pageNo)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if got, want := mapped.(*heapPage).slotUsed, read.(*heapPage).slotUsed; got != want {
+			t.Errorf("page %d: expected %d tuples, got %d", pageNo, want, got)
+		}
+	}
+	// the first added tuple took the slot of the deleted one
+	if got := mustReadPage(t, hf, 0).tuples[0].Fields[0]; got != (StringField{"added"}) {
+		t.Errorf("expected the write to page 0 to be read from the map, got %v", got)
+	}
+
+	hf.Unmap()
+	if hf.Mapped() {
+		t.Errorf("expected no map after Unmap")
+	}
+}
+
+func mustReadPage(t *testing.T, hf *HeapFile, pageNo int) *heapPage {
+	t.Helper()
+	page, err := hf.readPage(pageNo)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return page.(*heapPage)
+}
+
+func TestHeapFileMmapEmpty(t *testing.T) {
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	td := TupleDesc{Fields: []FieldType{{Fname: "n", Ftype: IntType}}}
+	hf, err := NewHeapFileMmap(filepath.Join(t.TempDir(), "empty.dat"), &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if hf.Mapped() {
+		t.Errorf("expected a file without pages not to be mapped")
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	insertTupleForTest(t, hf, &Tuple{td, []DBValue{IntField{1}}, nil}, tid)
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if got := len(drainIterator(t, iter)); got != 1 {
+		t.Errorf("expected 1 tuple, got %d", got)
+	}
+}
+
+func BenchmarkHeapFileReadPage(b *testing.B) {
+	name, td := makeMmapTestFile(b, b.TempDir(), 20000)
+	for _, mmap := range []bool{false, true} {
+		b.Run(fmt.Sprintf("mmap=%v", mmap), func(b *testing.B) {
+			bp, err := NewBufferPool(10)
+			if err != nil {
+				b.Fatalf(err.Error())
+			}
+			newFile := NewHeapFile
+			if mmap {
+				newFile = NewHeapFileMmap
+			}
+			hf, err := newFile(name, td, bp)
+			if err != nil {
+				b.Fatalf(err.Error())
+			}
+			defer hf.Unmap()
+			pages := hf.NumPages()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := hf.readPage(i % pages); err != nil {
+					b.Fatalf(err.Error())
+				}
+			}
+		})
+	}
+}
@@ -1,8 +1,18 @@
 package godb
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"unicode/utf8"
 )
 
 const TestingFile string = "test.dat"
@@ -315,3 +325,1785 @@ func TestHeapFileIteratorExtra(t *testing.T) {
 		t.Fatalf("Iterator returned error at end, expected nil, nil, got nil, %s", err.Error())
 	}
 }
+
+func TestHeapFileLoadCSVTypeError(t *testing.T) {
+	_, _, _, hf, _, _ := makeTestVars(t)
+	const csvFile = "bad_type_test.csv"
+	writeFile(t, csvFile, "name,age\nsam,25\njoe,twenty\n")
+	defer os.Remove(csvFile)
+
+	f, err := os.Open(csvFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f.Close()
+	err = hf.LoadFromCSV(f, true, ",", false)
+	if err == nil {
+		t.Fatalf("expected a type mismatch error")
+	}
+	gErr, ok := err.(GoDBError)
+	if !ok || gErr.code != TypeMismatchError {
+		t.Fatalf("expected a TypeMismatchError, got %v", err)
+	}
+	for _, want := range []string{"line 3", "column 2", "age", `"twenty"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should mention %s", err.Error(), want)
+		}
+	}
+}
+
+func TestHeapFileLoadCSVErrorModes(t *testing.T) {
+	const csvFile = "bad_rows_test.csv"
+	writeFile(t, csvFile, "name,age\nsam,25\njoe,twenty\nbob\ngeorge,999\nann,1,extra\n")
+	defer os.Remove(csvFile)
+
+	for _, mode := range []CSVErrorMode{CSVAbort, CSVSkip, CSVCollect} {
+		_, _, _, hf, _, tid := makeTestVars(t)
+		f, err := os.Open(csvFile)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		result, err := hf.LoadFromCSVWithErrorMode(f, true, ",", false, mode)
+		f.Close()
+
+		if mode == CSVAbort {
+			if err == nil {
+				t.Fatalf("expected the load to abort on the first malformed line")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("mode %d: unexpected error %v", mode, err)
+		}
+		if result.Loaded != 2 || result.Skipped != 3 {
+			t.Errorf("mode %d: expected 2 loaded and 3 skipped rows, got %d and %d", mode, result.Loaded, result.Skipped)
+		}
+		if mode == CSVSkip && len(result.Errors) != 0 {
+			t.Errorf("skip mode should not collect errors, got %v", result.Errors)
+		}
+		if mode == CSVCollect && len(result.Errors) != 3 {
+			t.Errorf("collect mode should return 3 errors, got %v", result.Errors)
+		}
+
+		iter, err := hf.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		td, _, _ := makeTupleTestVars()
+		sam := Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{25}}}
+		george := Tuple{Desc: td, Fields: []DBValue{StringField{"george"}, IntField{999}}}
+		if err := CheckIfOutputMatchesUnordered(iter, []*Tuple{&sam, &george}); err != nil {
+			t.Errorf("mode %d: %v", mode, err)
+		}
+	}
+}
+
+func TestHeapFileIteratorProject(t *testing.T) {
+	os.Remove(TestingFile)
+	defer os.Remove(TestingFile)
+
+	var fields []FieldType
+	for i := 0; i < 10; i++ {
+		fields = append(fields, FieldType{fmt.Sprintf("s%d", i), "", StringType}, FieldType{fmt.Sprintf("i%d", i), "", IntType})
+	}
+	td := TupleDesc{fields}
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf, err := NewHeapFile(TestingFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	const ntups = 100
+	for i := 0; i < ntups; i++ {
+		var vals []DBValue
+		for j := 0; j < 10; j++ {
+			vals = append(vals, StringField{fmt.Sprintf("s%d-%d", i, j)}, IntField{int64(i*10 + j)})
+		}
+		insertTupleForTest(t, hf, &Tuple{td, vals, nil}, tid)
+	}
+	bp.FlushAllPages()
+	bp.CommitTransaction(tid)
+
+	// read back through fresh buffer pools, so that no page is cached
+	readAll := func(project bool) ([]*Tuple, int64) {
+		bp, err := NewBufferPool(10)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		hf, err := NewHeapFile(TestingFile, &td, bp)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		tid := NewTID()
+		bp.BeginTransaction(tid)
+		defer bp.CommitTransaction(tid)
+
+		var iter func() (*Tuple, error)
+		if project {
+			iter, err = hf.IteratorProject(tid, []int{13, 0})
+		} else {
+			iter, err = hf.Iterator(tid)
+		}
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var ts []*Tuple
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				break
+			}
+			if !project {
+				tup = &Tuple{TupleDesc{[]FieldType{fields[13], fields[0]}}, []DBValue{tup.Fields[13], tup.Fields[0]}, tup.Rid}
+			}
+			ts = append(ts, tup)
+		}
+		return ts, hf.DecodedFields()
+	}
+
+	full, fullCost := readAll(false)
+	projected, projectedCost := readAll(true)
+	if len(full) != ntups || len(projected) != ntups {
+		t.Fatalf("expected %d tuples, got %d full and %d projected", ntups, len(full), len(projected))
+	}
+	for i := range full {
+		if !full[i].equals(projected[i]) || full[i].Rid != projected[i].Rid {
+			t.Fatalf("projected tuple %v does not match %v", projected[i], full[i])
+		}
+	}
+	if fullCost != ntups*20 || projectedCost != ntups*2 {
+		t.Errorf("expected %d and %d decoded fields, got %d and %d", ntups*20, ntups*2, fullCost, projectedCost)
+	}
+
+	if _, err := hf.IteratorProject(tid, []int{20}); err == nil {
+		t.Errorf("expected an error projecting a missing column")
+	}
+}
+
+func TestHeapFileIteratorFrom(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeTestVars(t)
+	const ntups = 600 // a few pages worth
+	for i := 0; i < ntups; i++ {
+		tup := Tuple{t1.Desc, []DBValue{StringField{fmt.Sprintf("n%d", i)}, IntField{int64(i)}}, nil}
+		insertTupleForTest(t, hf, &tup, tid)
+		if i%100 == 99 {
+			bp.FlushAllPages()
+		}
+	}
+	bp.FlushAllPages()
+
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	seen := make(map[int64]int)
+	var last recordID
+	for i := 0; i < ntups/2; i++ {
+		tup, err := iter()
+		if err != nil || tup == nil {
+			t.Fatalf("expected tuple %d, got %v (err %v)", i, tup, err)
+		}
+		seen[tup.Fields[1].(IntField).Value]++
+		last = tup.Rid
+	}
+
+	iter, err = hf.IteratorFrom(tid, last)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		seen[tup.Fields[1].(IntField).Value]++
+	}
+	if len(seen) != ntups {
+		t.Fatalf("expected %d distinct tuples, got %d", ntups, len(seen))
+	}
+	for v, cnt := range seen {
+		if cnt != 1 {
+			t.Fatalf("tuple %d returned %d times", v, cnt)
+		}
+	}
+}
+
+func TestHeapFileIteratorFromAfterFlush(t *testing.T) {
+	td, _, _, hf, bp, tid := makeTestVars(t)
+	const ntups = 10
+	for i := 0; i < ntups; i++ {
+		insertTupleForTest(t, hf, &Tuple{td, []DBValue{StringField{fmt.Sprintf("n%d", i)}, IntField{int64(i)}}, nil}, tid)
+	}
+	bp.CommitTransaction(tid)
+
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tuples := drainIterator(t, iter)
+	last := tuples[ntups/2-1].Rid
+
+	// the tuples before last are deleted, and the page written back without
+	// their slots and evicted before the scan resumes
+	deleter := bp.NewTransaction()
+	for _, tup := range tuples[:ntups/2] {
+		if err := hf.deleteTuple(tup, deleter); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp.CommitTransaction(deleter)
+	bp.Lock()
+	delete(bp.Pages, hf.pageKey(0))
+	bp.Unlock()
+
+	iter, err = hf.IteratorFrom(tid, last)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatches(iter, tuples[ntups/2:]); err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestHeapFileLoadCSVShards(t *testing.T) {
+	_, _, _, hf, _, tid := makeTestVars(t)
+	writeFile(t, "shard_test_1.csv", "name,age\nsam,25\njoe,30\n")
+	writeFile(t, "shard_test_2.csv", "name,age\nann,41\nbob,52\ncat,63\n")
+	defer os.Remove("shard_test_1.csv")
+	defer os.Remove("shard_test_2.csv")
+
+	if err := hf.LoadFromCSVShards([]string{"shard_test_*.csv"}, true, ",", false); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var names []string
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		names = append(names, tup.Fields[0].(StringField).Value)
+	}
+	if strings.Join(names, ",") != "sam,joe,ann,bob,cat" {
+		t.Errorf("expected the rows of both shards without their headers, got %v", names)
+	}
+
+	if err := hf.LoadFromCSVShards([]string{"no_such_shard_*.csv"}, true, ",", false); err == nil {
+		t.Errorf("expected an error for a pattern matching no file")
+	}
+}
+
+func TestHeapFileFreeSpaceMap(t *testing.T) {
+	_, t1, t2, hf, bp, tid := makeTestVars(t)
+	for hf.NumPages() < 5 {
+		insertTupleForTest(t, hf, &t1, tid)
+		bp.FlushAllPages()
+	}
+	// fill up the last page too, so that every page is full
+	for len(hf.freeSpace) > 0 {
+		insertTupleForTest(t, hf, &t1, tid)
+		bp.FlushAllPages()
+	}
+
+	// free a slot in a page in the middle of the file
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var victim *Tuple
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if pageNo, _ := splitRecordID(tup.Rid); pageNo == 2 {
+			victim = tup
+			break
+		}
+	}
+	if err := hf.deleteTuple(victim, tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.FlushAllPages()
+
+	before := bp.getPageCalls.Load()
+	numPages := hf.NumPages()
+	insertTupleForTest(t, hf, &t2, tid)
+	if calls := bp.getPageCalls.Load() - before; calls != 1 {
+		t.Errorf("expected the insert to get only the page with a free slot, got %d pages", calls)
+	}
+	if pageNo, _ := splitRecordID(t2.Rid); pageNo != 2 || hf.NumPages() != numPages {
+		t.Errorf("expected the tuple in the free slot of page 2, got %v with %d pages", t2.Rid, hf.NumPages())
+	}
+
+	// inserts fill the lowest page with a free slot first
+	victims := make(map[int]*Tuple)
+	iter, err = hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for len(victims) < 2 {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if pageNo, _ := splitRecordID(tup.Rid); (pageNo == 1 || pageNo == 3) && victims[pageNo] == nil {
+			victims[pageNo] = tup
+		}
+	}
+	for _, pageNo := range []int{3, 1} {
+		if err := hf.deleteTuple(victims[pageNo], tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	for _, want := range []int{1, 3} {
+		tup := t1
+		insertTupleForTest(t, hf, &tup, tid)
+		if pageNo, _ := splitRecordID(tup.Rid); pageNo != want {
+			t.Errorf("expected the tuple in the free slot of page %d, got %v", want, tup.Rid)
+		}
+	}
+	if hf.NumPages() != numPages {
+		t.Errorf("expected no new page, got %d pages", hf.NumPages())
+	}
+}
+
+func TestHeapFileLoadJSON(t *testing.T) {
+	_, t1, _, hf, _, tid := makeTestVars(t)
+	const jsonFile = "load_test.json"
+	writeFile(t, jsonFile, `[
+		{"name": "sam", "age": 25},
+		{"age": "999", "name": "george jones", "extra": true},
+		{"name": 42, "age": 7.9}
+	]`)
+	defer os.Remove(jsonFile)
+
+	f, err := os.Open(jsonFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f.Close()
+	if err := hf.LoadFromJSON(f); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := []*Tuple{
+		{t1.Desc, []DBValue{StringField{"sam"}, IntField{25}}, nil},
+		{t1.Desc, []DBValue{StringField{"george jones"}, IntField{999}}, nil},
+		{t1.Desc, []DBValue{StringField{"42"}, IntField{7}}, nil},
+	}
+	if err := CheckIfOutputMatches(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	writeFile(t, jsonFile, `[{"name": "sam"}]`)
+	f2, err := os.Open(jsonFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f2.Close()
+	if err := hf.LoadFromJSON(f2); err == nil || !strings.Contains(err.Error(), "no field age") {
+		t.Errorf("expected an error for a missing field, got %v", err)
+	}
+}
+
+func TestHeapFileLoadInsertError(t *testing.T) {
+	td, _, _ := makeTupleTestVars()
+	dir := t.TempDir()
+	bp, err := NewBufferPool(3)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, c := range []struct {
+		name string
+		data string
+		load func(hf *HeapFile, f *os.File) error
+	}{
+		{"json", `[{"name": "sam", "age": 25}, {"name": "ann", "age": 7}]`, (*HeapFile).LoadFromJSON},
+		{"csv", "name,age\nsam,25\nann,7\n", func(hf *HeapFile, f *os.File) error { return hf.LoadFromCSV(f, true, ",", false) }},
+	} {
+		path := filepath.Join(dir, "load."+c.name)
+		writeFile(t, path, c.data)
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		// the directory of the backing file is gone, so inserting the first
+		// tuple fails to write its page
+		tableDir := filepath.Join(dir, c.name)
+		if err := os.Mkdir(tableDir, 0777); err != nil {
+			t.Fatalf(err.Error())
+		}
+		hf, err := NewHeapFile(filepath.Join(tableDir, "t.dat"), &td, bp)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := os.RemoveAll(tableDir); err != nil {
+			t.Fatalf(err.Error())
+		}
+		err = c.load(hf, f)
+		f.Close()
+		if err == nil || !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: expected the insert error, got %v", c.name, err)
+		}
+	}
+}
+
+func TestHeapFileLoadJSONLargerThanBufferPool(t *testing.T) {
+	td, _, _ := makeTupleTestVars()
+	dir := t.TempDir()
+	bp, err := NewBufferPool(2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf, err := NewHeapFile(filepath.Join(dir, "large.dat"), &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	const ntups = 1000
+	var objs []string
+	for i := 0; i < ntups; i++ {
+		objs = append(objs, fmt.Sprintf(`{"name": "name%d", "age": %d}`, i, i))
+	}
+	path := filepath.Join(dir, "large.json")
+	writeFile(t, path, "["+strings.Join(objs, ",")+"]")
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f.Close()
+	if err := hf.LoadFromJSON(f); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if hf.NumPages() <= bp.PageNum {
+		t.Fatalf("expected more pages than the buffer pool holds, got %d", hf.NumPages())
+	}
+	for key, page := range bp.Pages {
+		if page.isDirty() {
+			t.Errorf("expected the pages flushed after the load, page %v is dirty", key)
+		}
+	}
+
+	bp2, err := NewBufferPool(2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	reopened, err := NewHeapFile(hf.BackingFile(), &td, bp2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := reopened.Iterator(NewTID())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := len(drainIterator(t, iter)); n != ntups {
+		t.Errorf("expected %d tuples on disk, got %d", ntups, n)
+	}
+}
+
+func TestHeapFileLoadCSVMultibyteTruncation(t *testing.T) {
+	_, _, _, hf, bp, tid := makeTestVars(t)
+	const csvFile = "multibyte_test.csv"
+	long1 := strings.Repeat("a", StringLength-1) + "é"  // é straddles the limit
+	long2 := strings.Repeat("日", StringLength/3) + "本本" // so does the 11th character
+	writeFile(t, csvFile, "name,age\n"+long1+",1\n"+long2+",2\n")
+	defer os.Remove(csvFile)
+
+	f, err := os.Open(csvFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f.Close()
+	if err := hf.LoadFromCSV(f, true, ",", false); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// read the tuples back from disk
+	bp.FlushAllPages()
+	bp2, err := NewBufferPool(3)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf2, err := NewHeapFile(hf.BackingFile(), hf.Descriptor(), bp2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := hf2.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := []string{strings.Repeat("a", StringLength-1), strings.Repeat("日", StringLength/3)}
+	for _, want := range expected {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		got := tup.Fields[0].(StringField).Value
+		if !utf8.ValidString(got) || len(got) > StringLength || got != want {
+			t.Errorf("expected %q truncated on a character boundary, got %q", want, got)
+		}
+	}
+}
+
+func TestHeapFileReadPageShortReads(t *testing.T) {
+	_, t1, t2, hf, bp, tid := makeTestVars(t)
+	for i := 0; i < 50; i++ {
+		insertTupleForTest(t, hf, &t1, tid)
+		insertTupleForTest(t, hf, &t2, tid)
+	}
+	bp.FlushAllPages()
+
+	page, err := hf.readPage(0)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// read the same page through a reader returning a byte per Read call
+	f, err := os.Open(hf.BackingFile())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f.Close()
+	shortPage, err := hf.pageFromReader(iotest.OneByteReader(f), 0, nil)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	hp := page.(*heapPage)
+	if shortPage.slotUsed != hp.slotUsed || shortPage.slotUsed != 100 {
+		t.Fatalf("expected 100 tuples from both reads, got %d and %d", hp.slotUsed, shortPage.slotUsed)
+	}
+	for i := 0; i < int(hp.slotUsed); i++ {
+		if !shortPage.tuples[i].equals(hp.tuples[i]) {
+			t.Fatalf("tuple %d differs between reads: %v and %v", i, hp.tuples[i], shortPage.tuples[i])
+		}
+	}
+}
+
+func TestHeapFileReadYourWrites(t *testing.T) {
+	_, t1, t2, hf, bp, setupTid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, setupTid)
+	bp.CommitTransaction(setupTid)
+
+	scan := func(tid TransactionID) []*Tuple {
+		t.Helper()
+		iter, err := hf.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var ts []*Tuple
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				return ts
+			}
+			ts = append(ts, tup)
+		}
+	}
+	expect := func(tid TransactionID, expected []*Tuple) {
+		t.Helper()
+		got := scan(tid)
+		if len(got) != len(expected) {
+			t.Fatalf("transaction %d: expected %v, got %v", tid, expected, got)
+		}
+		for i := range got {
+			if !got[i].equals(expected[i]) {
+				t.Fatalf("transaction %d: expected %v, got %v", tid, expected, got)
+			}
+		}
+	}
+
+	writer, reader := NewTID(), NewTID()
+	bp.BeginTransaction(writer)
+	bp.BeginTransaction(reader)
+	insertTupleForTest(t, hf, &t2, writer)
+	if err := hf.deleteTuple(scan(writer)[0], writer); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// the writer sees its own insert and delete, the reader neither
+	expect(writer, []*Tuple{&t2})
+	expect(reader, []*Tuple{&t1})
+
+	bp.CommitTransaction(writer)
+	expect(reader, []*Tuple{&t2})
+
+	// the writes of an aborted transaction are undone
+	aborted := NewTID()
+	bp.BeginTransaction(aborted)
+	insertTupleForTest(t, hf, &t1, aborted)
+	if err := hf.deleteTuple(&t2, aborted); err != nil {
+		t.Fatalf(err.Error())
+	}
+	expect(aborted, []*Tuple{&t1})
+	bp.AbortTransaction(aborted)
+	expect(reader, []*Tuple{&t2})
+}
+
+func TestHeapFileTransactionPages(t *testing.T) {
+	td, t1, t2, hf, bp, setupTid := makeTestVars(t)
+	for i := 0; i < 3; i++ {
+		insertTupleForTest(t, hf, &t1, setupTid)
+	}
+	bp.CommitTransaction(setupTid)
+
+	// the tuples of the file on disk, read through a buffer pool of its own
+	onDisk := func() []*Tuple {
+		t.Helper()
+		bp2, err := NewBufferPool(10)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		reopened, err := NewHeapFile(hf.BackingFile(), &td, bp2)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		iter, err := reopened.Iterator(NewTID())
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		return drainIterator(t, iter)
+	}
+	if n := len(onDisk()); n != 3 {
+		t.Fatalf("expected committing to flush the 3 tuples, got %d on disk", n)
+	}
+	iter, err := hf.Iterator(NewTID())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	before := drainIterator(t, iter)
+
+	aborted, other := bp.NewTransaction(), bp.NewTransaction()
+	if err := hf.deleteTuple(before[1], aborted); err != nil {
+		t.Fatalf(err.Error())
+	}
+	insertTupleForTest(t, hf, &t2, aborted)
+
+	// the other transaction sees the deleted tuple in its slot, but can not
+	// write to the page of the aborted one
+	iter, err = hf.IteratorFrom(other, before[0].Rid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	got := drainIterator(t, iter)
+	if len(got) != 2 || got[0].Rid != before[1].Rid || got[1].Rid != before[2].Rid {
+		t.Fatalf("expected the tuples after %v in slot order, got %v", before[0].Rid, got)
+	}
+	err = hf.deleteTuple(before[0], other)
+	var gErr GoDBError
+	if !errors.As(err, &gErr) || gErr.code != ConflictError {
+		t.Fatalf("expected a ConflictError writing a page of another transaction, got %v", err)
+	}
+
+	// aborting discards the page, so the deleted tuple keeps its record id
+	bp.AbortTransaction(aborted)
+	iter, err = hf.Iterator(other)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	after := drainIterator(t, iter)
+	if len(after) != len(before) {
+		t.Fatalf("expected %d tuples after the abort, got %d", len(before), len(after))
+	}
+	for i := range after {
+		if after[i].Rid != before[i].Rid || !after[i].equals(before[i]) {
+			t.Fatalf("expected %v after the abort, got %v", before, after)
+		}
+	}
+	if err := hf.deleteTuple(after[0], other); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(other)
+	if n := len(onDisk()); n != 2 {
+		t.Fatalf("expected 2 tuples on disk after the delete committed, got %d", n)
+	}
+}
+
+func TestHeapFileInsertAfterPageEvicted(t *testing.T) {
+	td, t1, t2, hf, bp, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+
+	// the page tid inserted into is written back and dropped from the buffer
+	// pool, so the next insert must go to the page read back
+	bp.FlushAllPages()
+	bp.Lock()
+	delete(bp.Pages, hf.pageKey(0))
+	bp.Unlock()
+	insertTupleForTest(t, hf, &t2, tid)
+	bp.CommitTransaction(tid)
+
+	hf2, err := NewHeapFile(TestingFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := hf2.Iterator(bp.NewTransaction())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatches(iter, []*Tuple{&t1, &t2}); err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestHeapFileRecordIDsSurviveFlush(t *testing.T) {
+	td, t1, _, hf, bp, tid := makeTestVars(t)
+	for i := 0; i < 4; i++ {
+		insertTupleForTest(t, hf, &Tuple{td, []DBValue{StringField{fmt.Sprintf("sam%d", i)}, IntField{int64(i)}}, nil}, tid)
+	}
+	bp.CommitTransaction(tid)
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	before := drainIterator(t, iter)
+
+	// the page is written back without the free slots of the deleted tuples,
+	// then dropped from the buffer pool
+	deleter := bp.NewTransaction()
+	for _, tup := range before[:2] {
+		if err := hf.deleteTuple(tup, deleter); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp.CommitTransaction(deleter)
+	bp.Lock()
+	delete(bp.Pages, hf.pageKey(0))
+	bp.Unlock()
+
+	reader := bp.NewTransaction()
+	iter, err = hf.Iterator(reader)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	after := drainIterator(t, iter)
+	if len(after) != 2 || after[0].Rid != before[2].Rid || after[1].Rid != before[3].Rid {
+		t.Fatalf("expected the tuples to keep record ids %v and %v, got %v", before[2].Rid, before[3].Rid, after)
+	}
+	if err := hf.updateTuple(before[3], &Tuple{td, t1.Fields, nil}, hf.tupleVersion(before[3].Rid), reader); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// the update replaced the last tuple, not the one now first on disk
+	bp.CommitTransaction(reader)
+	hf2, err := NewHeapFile(TestingFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err = hf2.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatches(iter, []*Tuple{before[2], {td, t1.Fields, nil}}); err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestHeapFileUpdateTupleInPlace(t *testing.T) {
+	td, t1, t2, hf, bp, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+	bp.CommitTransaction(tid)
+	bp.FlushAllPages()
+
+	updater, reader := NewTID(), NewTID()
+	bp.BeginTransaction(updater)
+	bp.BeginTransaction(reader)
+	updated := &Tuple{td, []DBValue{StringField{"joe"}, IntField{30}}, nil}
+	if err := hf.updateTuple(&t1, updated, hf.tupleVersion(t1.Rid), updater); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if updated.Rid != t1.Rid {
+		t.Fatalf("expected the update to keep record id %v, got %v", t1.Rid, updated.Rid)
+	}
+	page, err := bp.GetPage(hf, 0, updater, ReadPerm)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !page.isDirty() {
+		t.Fatalf("expected the updated page to be dirty")
+	}
+
+	// the reader sees the old fields until the update commits
+	iter, err := hf.Iterator(reader)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatchesUnordered(iter, []*Tuple{&t1, &t2}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(updater)
+	bp.CommitTransaction(reader)
+	bp.FlushAllPages()
+
+	// the update is on disk
+	bp2, err := NewBufferPool(3)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	reopened, err := NewHeapFile(hf.BackingFile(), &td, bp2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid = NewTID()
+	bp2.BeginTransaction(tid)
+	iter, err = reopened.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatches(iter, []*Tuple{updated, &t2}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp2.CommitTransaction(tid)
+}
+
+func TestHeapFileIteratorPhysicalOrder(t *testing.T) {
+	td, _, _, hf, bp, tid := makeTestVars(t)
+	var inserted []*Tuple
+	for i := 0; i < 250; i++ {
+		tup := &Tuple{td, []DBValue{StringField{fmt.Sprintf("sam%d", i)}, IntField{int64(i)}}, nil}
+		insertTupleForTest(t, hf, tup, tid)
+		inserted = append(inserted, tup)
+	}
+	if hf.NumPages() < 2 {
+		t.Fatalf("expected several pages, got %d", hf.NumPages())
+	}
+
+	// the slots freed by deletes are reused by later inserts
+	freed := make(map[recordID]bool)
+	for i := 0; i < len(inserted); i += 10 {
+		freed[inserted[i].Rid] = true
+		if err := hf.deleteTuple(inserted[i], tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	for i := 0; i < len(freed); i++ {
+		tup := &Tuple{td, []DBValue{StringField{fmt.Sprintf("new%d", i)}, IntField{int64(1000 + i)}}, nil}
+		insertTupleForTest(t, hf, tup, tid)
+		if !freed[tup.Rid] {
+			t.Fatalf("expected a freed slot for new tuple %d, got %v", i, tup.Rid)
+		}
+	}
+
+	check := func(hf *HeapFile, tid TransactionID) {
+		t.Helper()
+		iter, err := hf.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		tuples := drainIterator(t, iter)
+		if len(tuples) != len(inserted) {
+			t.Fatalf("expected %d tuples, got %d", len(inserted), len(tuples))
+		}
+		lastPage, lastSlot := -1, -1
+		for i, tup := range tuples {
+			pageNo, slot := splitRecordID(tup.Rid)
+			if pageNo < lastPage || (pageNo == lastPage && slot <= lastSlot) {
+				t.Fatalf("tuple %d: record id %v after page %d slot %d", i, tup.Rid, lastPage, lastSlot)
+			}
+			lastPage, lastSlot = pageNo, slot
+			// the new tuples replaced every tenth one
+			if isNew := tup.Fields[1].(IntField).Value >= 1000; isNew != (i%10 == 0) {
+				t.Fatalf("tuple %d: unexpected %v", i, tup.Fields)
+			}
+		}
+	}
+	check(hf, tid)
+
+	// the order survives the pages being written back and read again
+	bp.CommitTransaction(tid)
+	bp.FlushAllPages()
+	bp2, err := NewBufferPool(3)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	reopened, err := NewHeapFile(hf.BackingFile(), &td, bp2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid = NewTID()
+	bp2.BeginTransaction(tid)
+	check(reopened, tid)
+	bp2.CommitTransaction(tid)
+}
+
+func TestHeapFileLoadCSVBool(t *testing.T) {
+	td := TupleDesc{Fields: []FieldType{{Fname: "name", Ftype: StringType}, {Fname: "valid", Ftype: BoolType}}}
+	bp, err := NewBufferPool(3)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	os.Remove(TestingFile)
+	hf, err := NewHeapFile(TestingFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	const csvFile = "bool_test.csv"
+	writeFile(t, csvFile, "name,valid\na,true\nb,False\nc,1\nd,0\ne,t\nf,F\n")
+	defer os.Remove(csvFile)
+
+	f, err := os.Open(csvFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f.Close()
+	if err := hf.LoadFromCSV(f, true, ",", false); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var expected []*Tuple
+	for i, valid := range []bool{true, false, true, false, true, false} {
+		expected = append(expected, &Tuple{td, []DBValue{StringField{string(rune('a' + i))}, BoolField{valid}}, nil})
+	}
+	if err := CheckIfOutputMatches(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	writeFile(t, csvFile, "name,valid\na,maybe\n")
+	f2, err := os.Open(csvFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f2.Close()
+	if err := hf.LoadFromCSV(f2, true, ",", false); err == nil || !strings.Contains(err.Error(), "to bool") {
+		t.Errorf("expected an error for a bad boolean, got %v", err)
+	}
+}
+
+func TestHeapFileSizeAndLiveTuples(t *testing.T) {
+	_, t1, t2, hf, bp, tid := makeTestVars(t)
+	if hf.SizeBytes() != 0 {
+		t.Fatalf("expected an empty file, got %d bytes", hf.SizeBytes())
+	}
+
+	var inserted []*Tuple
+	for hf.NumPages() < 3 {
+		tup := t1
+		insertTupleForTest(t, hf, &tup, tid)
+		inserted = append(inserted, &tup)
+		bp.FlushAllPages()
+	}
+	size := hf.SizeBytes()
+	if size != int64(3*PageSize) {
+		t.Errorf("expected %d bytes for 3 pages, got %d", 3*PageSize, size)
+	}
+	live, err := hf.LiveTupleCount()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if live != len(inserted) {
+		t.Errorf("expected %d live tuples, got %d", len(inserted), live)
+	}
+
+	for _, tup := range inserted[:10] {
+		if err := hf.deleteTuple(tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp.FlushAllPages()
+	if live, err = hf.LiveTupleCount(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if live != len(inserted)-10 {
+		t.Errorf("expected %d live tuples after deletes, got %d", len(inserted)-10, live)
+	}
+	if hf.SizeBytes() != size {
+		t.Errorf("expected deletes to keep the file at %d bytes, got %d", size, hf.SizeBytes())
+	}
+
+	// dirty pages in the buffer pool are counted too
+	insertTupleForTest(t, hf, &t2, tid)
+	if live, err = hf.LiveTupleCount(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if live != len(inserted)-9 {
+		t.Errorf("expected %d live tuples after an insert, got %d", len(inserted)-9, live)
+	}
+}
+
+func TestHeapFileLoadCSVLongLine(t *testing.T) {
+	_, t1, _, hf, _, tid := makeTestVars(t)
+	const csvFile = "long_line_test.csv"
+	longName := strings.Repeat("x", 100*1024)
+	writeFile(t, csvFile, "name,age\n"+longName+",7\nsam,25\n")
+	defer os.Remove(csvFile)
+
+	f, err := os.Open(csvFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f.Close()
+	if err := hf.LoadFromCSV(f, true, ",", false); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := []*Tuple{
+		{t1.Desc, []DBValue{StringField{longName[:StringLength]}, IntField{7}}, nil},
+		{t1.Desc, []DBValue{StringField{"sam"}, IntField{25}}, nil},
+	}
+	if err := CheckIfOutputMatches(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func TestHeapFileLoadCSVReadError(t *testing.T) {
+	_, t1, _, hf, _, tid := makeTestVars(t)
+	errDisk := errors.New("disk failed")
+	r := io.MultiReader(strings.NewReader("name,age\nsam,25\n"), iotest.ErrReader(errDisk))
+
+	result, err := hf.loadCSVFrom(r, true, ",", false, CSVAbort)
+	if !errors.Is(err, errDisk) {
+		t.Fatalf("expected the read error, got %v", err)
+	}
+	if result.Loaded != 1 {
+		t.Errorf("expected the line before the error to be loaded, got %d lines", result.Loaded)
+	}
+
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatches(iter, []*Tuple{&t1}); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func TestHeapFileIteratorRange(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeTestVars(t)
+	const ntups = 600 // a few pages worth
+	for i := 0; i < ntups; i++ {
+		tup := Tuple{t1.Desc, []DBValue{StringField{fmt.Sprintf("n%d", i)}, IntField{int64(i)}}, nil}
+		insertTupleForTest(t, hf, &tup, tid)
+		if i%100 == 99 {
+			bp.FlushAllPages()
+		}
+	}
+	bp.FlushAllPages()
+	if hf.NumPages() < 3 {
+		t.Fatalf("expected at least 3 pages, got %d", hf.NumPages())
+	}
+
+	if _, err := hf.IteratorRange(tid, 2, 1); err == nil {
+		t.Fatalf("expected an error for an empty range")
+	}
+
+	split := hf.NumPages() / 2
+	seen := make(map[any]int)
+	for _, r := range [][2]int{{0, split}, {split, hf.NumPages() + 1}} {
+		iter, err := hf.IteratorRange(tid, r[0], r[1])
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				break
+			}
+			if pageNo, _ := splitRecordID(tup.Rid); pageNo < r[0] || pageNo >= r[1] {
+				t.Fatalf("range [%d, %d) returned tuple %v", r[0], r[1], tup.Rid)
+			}
+			seen[tup.Rid]++
+		}
+	}
+
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var full int
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		full++
+		if seen[tup.Rid] != 1 {
+			t.Fatalf("tuple %v returned %d times by the ranges", tup.Rid, seen[tup.Rid])
+		}
+	}
+	if full != ntups || len(seen) != ntups {
+		t.Fatalf("expected %d tuples, got %d from the full scan and %d from the ranges", ntups, full, len(seen))
+	}
+}
+
+func TestHeapFileConcurrentInserts(t *testing.T) {
+	bp, hf := makeTestFile(t, 20)
+	_, t1, _ := makeTupleTestVars()
+	const nworkers, ntups = 4, 100
+
+	tids := make([]TransactionID, nworkers)
+	errs := make([]error, nworkers)
+	var wg sync.WaitGroup
+	for w := 0; w < nworkers; w++ {
+		tids[w] = NewTID()
+		bp.BeginTransaction(tids[w])
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < ntups; i++ {
+				tup := Tuple{t1.Desc, []DBValue{StringField{fmt.Sprintf("w%d", w)}, IntField{int64(i)}}, nil}
+				if err := hf.insertTuple(&tup, tids[w]); err != nil {
+					errs[w] = err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	for w := 0; w < nworkers; w++ {
+		if errs[w] != nil {
+			t.Fatalf(errs[w].Error())
+		}
+		bp.CommitTransaction(tids[w])
+	}
+
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	seen := make(map[string]int)
+	rids := make(map[any]bool)
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		if rids[tup.Rid] {
+			t.Fatalf("record id %v returned twice", tup.Rid)
+		}
+		rids[tup.Rid] = true
+		seen[fmt.Sprintf("%s/%d", tup.Fields[0].(StringField).Value, tup.Fields[1].(IntField).Value)]++
+	}
+	if len(seen) != nworkers*ntups {
+		t.Fatalf("expected %d distinct tuples, got %d", nworkers*ntups, len(seen))
+	}
+	for key, cnt := range seen {
+		if cnt != 1 {
+			t.Fatalf("tuple %s stored %d times", key, cnt)
+		}
+	}
+	if count, err := hf.LiveTupleCount(); err != nil || count != nworkers*ntups {
+		t.Fatalf("expected %d live tuples, got %d (err %v)", nworkers*ntups, count, err)
+	}
+}
+
+func TestHeapFileIteratorProgress(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeTestVars(t)
+	const ntups = 600 // a few pages worth
+	for i := 0; i < ntups; i++ {
+		tup := Tuple{t1.Desc, []DBValue{StringField{fmt.Sprintf("n%d", i)}, IntField{int64(i)}}, nil}
+		insertTupleForTest(t, hf, &tup, tid)
+		if i%100 == 99 {
+			bp.FlushAllPages()
+		}
+	}
+	bp.FlushAllPages()
+
+	iter, progress, err := hf.IteratorWithProgress(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if progress.TotalPages() != hf.NumPages() || progress.Fraction() != 0 {
+		t.Fatalf("expected 0 of %d pages before the scan, got %d of %d", hf.NumPages(), progress.PagesDone(), progress.TotalPages())
+	}
+	last, cnt := 0.0, 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if progress.Fraction() < last {
+			t.Fatalf("progress went back from %v to %v", last, progress.Fraction())
+		}
+		last = progress.Fraction()
+		if tup == nil {
+			break
+		}
+		cnt++
+		if last >= 1 {
+			t.Fatalf("expected the scan not to be done after %d of %d tuples", cnt, ntups)
+		}
+	}
+	if cnt != ntups || last != 1 || progress.PagesDone() != hf.NumPages() {
+		t.Fatalf("expected %d tuples and all %d pages done, got %d tuples and %d pages (%v)", ntups, hf.NumPages(), cnt, progress.PagesDone(), last)
+	}
+}
+
+func TestHeapFileEmptyScan(t *testing.T) {
+	td, _, _ := makeTupleTestVars()
+	bp, err := NewBufferPool(3)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	missing := filepath.Join(t.TempDir(), "missing.dat")
+	empty := filepath.Join(t.TempDir(), "empty.dat")
+	if err := os.WriteFile(empty, nil, 0666); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	for _, name := range []string{missing, empty} {
+		hf, err := NewHeapFile(name, &td, bp)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if hf.NumPages() != 0 {
+			t.Fatalf("%s: expected no pages, got %d", name, hf.NumPages())
+		}
+		tid := NewTID()
+		bp.BeginTransaction(tid)
+		scans := map[string]func() (func() (*Tuple, error), error){
+			"Iterator":        func() (func() (*Tuple, error), error) { return hf.Iterator(tid) },
+			"IteratorRange":   func() (func() (*Tuple, error), error) { return hf.IteratorRange(tid, 0, 10) },
+			"IteratorProject": func() (func() (*Tuple, error), error) { return hf.IteratorProject(tid, []int{1}) },
+		}
+		for scan, start := range scans {
+			iter, err := start()
+			if err != nil {
+				t.Fatalf("%s %s: %v", name, scan, err)
+			}
+			if tup, err := iter(); tup != nil || err != nil {
+				t.Fatalf("%s %s: expected EOF, got %v (err %v)", name, scan, tup, err)
+			}
+		}
+		if misses := bp.Misses(); misses != 0 {
+			t.Fatalf("%s: expected no pages read, got %d", name, misses)
+		}
+		bp.CommitTransaction(tid)
+	}
+}
+
+func TestHeapFileSchemaMismatch(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	bp.CommitTransaction(tid)
+
+	// a file written by a build with 16 byte strings
+	data, err := os.ReadFile(TestingFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	shorter := bytes.Clone(data)
+	binary.LittleEndian.PutUint16(shorter[12:14], 16)
+	if err := os.WriteFile(TestingFile, shorter, 0666); err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, err = NewHeapFile(TestingFile, &t1.Desc, bp)
+	var gerr GoDBError
+	if !errors.As(err, &gerr) || gerr.code != SchemaMismatchError || !strings.Contains(err.Error(), "string length 16") {
+		t.Fatalf("expected a SchemaMismatchError naming string length 16, got %v", err)
+	}
+	if err := os.WriteFile(TestingFile, data, 0666); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	ints := TupleDesc{[]FieldType{{Fname: "a", Ftype: IntType}, {Fname: "b", Ftype: IntType}}}
+	_, err = NewHeapFile(TestingFile, &ints, bp)
+	if !errors.As(err, &gerr) || gerr.code != SchemaMismatchError {
+		t.Fatalf("expected a SchemaMismatchError for other field types, got %v", err)
+	}
+
+	// the layout the file was written with reads it back
+	hf2, err := NewHeapFile(TestingFile, &t1.Desc, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	iter, err := hf2.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatches(iter, []*Tuple{&t1}); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+// Return all the tuples of iter, failing t on an error.
+func drainIterator(t *testing.T, iter func() (*Tuple, error)) []*Tuple {
+	t.Helper()
+	var tuples []*Tuple
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			return tuples
+		}
+		tuples = append(tuples, tup)
+	}
+}
+
+func TestHeapFileReverseIterator(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeTestVars(t)
+	const ntups = 600 // a few pages worth
+	for i := 0; i < ntups; i++ {
+		tup := Tuple{t1.Desc, []DBValue{StringField{fmt.Sprintf("n%d", i)}, IntField{int64(i)}}, nil}
+		insertTupleForTest(t, hf, &tup, tid)
+		if i%100 == 99 {
+			bp.FlushAllPages()
+		}
+	}
+	bp.FlushAllPages()
+	if hf.NumPages() < 3 {
+		t.Fatalf("expected at least 3 pages, got %d", hf.NumPages())
+	}
+
+	// leave empty slots in the pages
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for i, tup := range drainIterator(t, iter) {
+		if i%7 == 0 {
+			if err := hf.deleteTuple(tup, tid); err != nil {
+				t.Fatalf(err.Error())
+			}
+			bp.FlushAllPages()
+		}
+	}
+
+	iter, err = hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	forward := drainIterator(t, iter)
+	iter, err = hf.ReverseIterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	reverse := drainIterator(t, iter)
+	if len(forward) != ntups-(ntups+6)/7 {
+		t.Fatalf("expected %d tuples, got %d", ntups-(ntups+6)/7, len(forward))
+	}
+	if len(reverse) != len(forward) {
+		t.Fatalf("expected %d tuples in reverse, got %d", len(forward), len(reverse))
+	}
+	// pages are written without their empty slots, so the record ids of a page
+	// depend on whether it was evicted between the scans; the values are unique
+	for i, tup := range reverse {
+		if expected := forward[len(forward)-1-i]; !tup.equals(expected) {
+			t.Fatalf("tuple %d: expected %v, got %v", i, expected, tup)
+		}
+	}
+}
+
+func TestHeapFileDictionary(t *testing.T) {
+	td := TupleDesc{Fields: []FieldType{{Fname: "line", Ftype: StringType}, {Fname: "riders", Ftype: IntType}}}
+	lines := []string{"red", "blue", "green", "orange"}
+	dir := t.TempDir()
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	plain, err := NewHeapFile(filepath.Join(dir, "plain.dat"), &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	dict, err := NewHeapFileWithDictionary(filepath.Join(dir, "dict.dat"), &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	const ntups = 2000
+	var expected []*Tuple
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	for i := 0; i < ntups; i++ {
+		tup := &Tuple{td, []DBValue{StringField{lines[i%len(lines)]}, IntField{int64(i)}}, nil}
+		expected = append(expected, tup)
+		for _, hf := range []*HeapFile{plain, dict} {
+			if err := hf.insertTuple(tup, tid); err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+		if i%100 == 99 {
+			bp.FlushAllPages()
+		}
+	}
+	bp.CommitTransaction(tid)
+
+	plainPage, _ := newHeapPage(&td, 0, plain)
+	dictPage, _ := newHeapPage(&td, 0, dict)
+	if dictPage.getNumSlots() <= plainPage.getNumSlots() {
+		t.Errorf("expected more slots per dictionary page, got %d and %d", dictPage.getNumSlots(), plainPage.getNumSlots())
+	}
+	if dict.NumPages() >= plain.NumPages() {
+		t.Errorf("expected fewer dictionary pages, got %d and %d", dict.NumPages(), plain.NumPages())
+	}
+
+	// the strings round trip through the pages on disk
+	bp2, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	reopened, err := NewHeapFileWithDictionary(dict.BackingFile(), &td, bp2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid = NewTID()
+	bp2.BeginTransaction(tid)
+	iter, err := reopened.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatches(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err = reopened.IteratorProject(tid, []int{0})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for i, tup := range drainIterator(t, iter) {
+		if got := tup.Fields[0].(StringField).Value; got != lines[i%len(lines)] {
+			t.Fatalf("tuple %d: expected line %s, got %s", i, lines[i%len(lines)], got)
+		}
+	}
+	bp2.CommitTransaction(tid)
+}
+
+func TestHeapFileDictionaryFull(t *testing.T) {
+	td := TupleDesc{Fields: []FieldType{{Fname: "name", Ftype: StringType}}}
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf, err := NewHeapFileWithDictionary(filepath.Join(t.TempDir(), "dict.dat"), &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	insert := func(name string) *Tuple {
+		tup := &Tuple{td, []DBValue{StringField{name}}, nil}
+		if err := hf.insertTuple(tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+		return tup
+	}
+
+	// a string past the dictionary of the first page goes to a new page
+	var first *Tuple
+	for i := 0; i <= heapPageDictEntries; i++ {
+		tup := insert(fmt.Sprintf("name%d", i))
+		if i == 0 {
+			first = tup
+		}
+	}
+	if hf.NumPages() != 2 {
+		t.Fatalf("expected 2 pages, got %d", hf.NumPages())
+	}
+	if pageNo, _ := splitRecordID(first.Rid); pageNo != 0 {
+		t.Fatalf("expected the first tuple on page 0, got %d", pageNo)
+	}
+
+	// deleting the only use of a string makes room in the dictionary
+	if err := hf.deleteTuple(first, tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	tup := insert("another")
+	if pageNo, _ := splitRecordID(tup.Rid); pageNo != 0 {
+		t.Fatalf("expected the new string on page 0, got page %d", pageNo)
+	}
+	bp.CommitTransaction(tid)
+}
+
+func TestHeapFileMergeFrom(t *testing.T) {
+	td := TupleDesc{Fields: []FieldType{{Fname: "name", Ftype: StringType}, {Fname: "age", Ftype: IntType}}}
+	dir := t.TempDir()
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	files := make([]*HeapFile, 2)
+	var expected []*Tuple
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	for i, n := range []int{250, 120} {
+		files[i], err = NewHeapFile(filepath.Join(dir, fmt.Sprintf("shard%d.dat", i)), &td, bp)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		for j := 0; j < n; j++ {
+			tup := &Tuple{td, []DBValue{StringField{fmt.Sprintf("shard%d-%d", i, j)}, IntField{int64(j)}}, nil}
+			insertTupleForTest(t, files[i], tup, tid)
+			expected = append(expected, tup)
+		}
+	}
+	bp.CommitTransaction(tid)
+
+	// leave a free slot in the first page of the target
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	iter, err := files[0].Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	first, err := iter()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := files[0].deleteTuple(first, tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected = expected[1:]
+	pages := files[0].NumPages()
+
+	if err := files[0].MergeFrom(files[1], tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(tid)
+
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	iter, err = files[0].Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatchesUnordered(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if count, err := files[0].LiveTupleCount(); err != nil || count != 250-1+120 {
+		t.Fatalf("expected %d tuples, got %d (err %v)", 250-1+120, count, err)
+	}
+	// the merged tuples fill the free slots before new pages
+	page, err := newHeapPage(&td, 0, files[0])
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	slots := page.getNumSlots()
+	if got, want := files[0].NumPages(), (250-1+120+slots-1)/slots; got != want || got < pages {
+		t.Errorf("expected %d pages, got %d", want, got)
+	}
+	iter, err = files[1].Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := len(drainIterator(t, iter)); n != 120 {
+		t.Errorf("expected the merged file to keep its 120 tuples, got %d", n)
+	}
+
+	other := TupleDesc{Fields: []FieldType{{Fname: "name", Ftype: StringType}}}
+	mismatched, err := NewHeapFile(filepath.Join(dir, "other.dat"), &other, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var gerr GoDBError
+	if err := files[0].MergeFrom(mismatched, tid); !errors.As(err, &gerr) || gerr.code != SchemaMismatchError {
+		t.Errorf("expected a SchemaMismatchError, got %v", err)
+	}
+	if err := files[0].MergeFrom(files[0], tid); !errors.As(err, &gerr) || gerr.code != IllegalOperationError {
+		t.Errorf("expected an IllegalOperationError, got %v", err)
+	}
+	bp.CommitTransaction(tid)
+}
+
+func TestHeapFileClose(t *testing.T) {
+	td, _, _ := makeTupleTestVars()
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	path := filepath.Join(t.TempDir(), "close.dat")
+	hf, err := NewHeapFile(path, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// the inserts are not part of a running transaction, which would flush its
+	// pages when committing, so the pages they dirty stay cached
+	const ntups = 300
+	tid := NewTID()
+	for i := 0; i < ntups; i++ {
+		tup := &Tuple{td, []DBValue{StringField{fmt.Sprintf("name%d", i)}, IntField{int64(i)}}, nil}
+		if err := hf.insertTuple(tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	// the number of tuples of the file on disk, read through a buffer pool of
+	// its own
+	countOnDisk := func() int {
+		t.Helper()
+		bp2, err := NewBufferPool(10)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		reopened, err := NewHeapFile(path, &td, bp2)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		defer reopened.Close()
+		tid := bp2.NewTransaction()
+		defer bp2.CommitTransaction(tid)
+		iter, err := reopened.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		return len(drainIterator(t, iter))
+	}
+	// openFiles returns the descriptors of the process open on path, or -1 if
+	// the platform does not list them
+	openFiles := func() int {
+		fds, err := os.ReadDir("/proc/self/fd")
+		if err != nil {
+			return -1
+		}
+		n := 0
+		for _, fd := range fds {
+			if target, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name())); err == nil && target == path {
+				n++
+			}
+		}
+		return n
+	}
+
+	if n := countOnDisk(); n >= ntups {
+		t.Fatalf("expected some inserted tuples to be only in dirty pages, got %d of %d on disk", n, ntups)
+	}
+	if hf.file == nil || openFiles() == 0 {
+		t.Fatalf("expected the backing file to be open after writing pages")
+	}
+	if err := hf.Close(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if hf.file != nil {
+		t.Errorf("expected Close to release the backing file")
+	}
+	if n := openFiles(); n > 0 {
+		t.Errorf("expected no descriptor open on the file, got %d", n)
+	}
+	if n := countOnDisk(); n != ntups {
+		t.Fatalf("expected the %d tuples on disk after Close, got %d", ntups, n)
+	}
+	if err := hf.Close(); err != nil {
+		t.Errorf("expected closing twice to succeed, got %v", err)
+	}
+
+	// the file remains usable after Close
+	tid = bp.NewTransaction()
+	tup := &Tuple{td, []DBValue{StringField{"last"}, IntField{ntups}}, nil}
+	if err := hf.insertTuple(tup, tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(tid)
+	if err := hf.Close(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := countOnDisk(); n != ntups+1 {
+		t.Fatalf("expected %d tuples on disk, got %d", ntups+1, n)
+	}
+}
+
+func TestHeapFileConcurrentFlush(t *testing.T) {
+	td, _, _ := makeTupleTestVars()
+	bp, err := NewBufferPool(20)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	path := filepath.Join(t.TempDir(), "flush.dat")
+	hf, err := NewHeapFile(path, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	const ntups = 1000
+	tid := NewTID()
+	for i := 0; i < ntups; i++ {
+		tup := &Tuple{td, []DBValue{StringField{fmt.Sprintf("name%d", i)}, IntField{int64(i)}}, nil}
+		if err := hf.insertTuple(tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	// the flushes below open the backing file again, and every page is
+	// written at its own offset of the shared file, so pages flushed at the
+	// same time do not overwrite each other
+	if err := hf.Close(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	var pages []Page
+	bp.RLock()
+	for _, page := range bp.Pages {
+		pages = append(pages, page)
+	}
+	bp.RUnlock()
+	if len(pages) < 2 {
+		t.Fatalf("expected several cached pages, got %d", len(pages))
+	}
+	var wg sync.WaitGroup
+	for _, page := range pages {
+		wg.Add(1)
+		go func(page Page) {
+			defer wg.Done()
+			if err := hf.flushPage(page); err != nil {
+				t.Errorf(err.Error())
+			}
+		}(page)
+	}
+	wg.Wait()
+
+	bp2, err := NewBufferPool(20)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	reopened, err := NewHeapFile(path, &td, bp2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid2 := bp2.NewTransaction()
+	defer bp2.CommitTransaction(tid2)
+	iter, err := reopened.Iterator(tid2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := len(drainIterator(t, iter)); n != ntups {
+		t.Fatalf("expected %d tuples on disk, got %d", ntups, n)
+	}
+	if err := hf.Close(); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
@@ -3,6 +3,9 @@ package godb
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
 )
 
 /* HeapPage implements the Page interface for pages of HeapFiles. We have
@@ -15,27 +18,46 @@ tuples.
 In GoDB all tuples are fixed length, which means that given a TupleDesc it is
 possible to figure out how many tuple "slots" fit on a given page.
 
-In addition, all pages are PageSize bytes.  They begin with a header with a 32
-bit integer with the number of slots (tuples), and a second 32 bit integer with
-the number of used slots.
+In addition, all pages are PageSize bytes.  They begin with a header with a 16
+bit magic number identifying a GoDB heap page, an 8 bit page format version, an
+8 bit flags byte, a 32 bit integer with the number of slots (tuples), a
+second 32 bit integer with the number of used slots, a 16 bit integer with the
+StringLength the page was written with, and a 16 bit checksum of the field
+types, so that a file is not misread with another layout.  All header fields and
+tuples are written in little endian order regardless of the host architecture,
+so heap files are portable between machines.
 
 Each tuple occupies the same number of bytes.  You can use the go function
 unsafe.Sizeof() to determine the size in bytes of an object.  So, a GoDB integer
 (represented as an int64) requires unsafe.Sizeof(int64(0)) bytes.  For strings,
 we encode them as byte arrays of StringLength, so they are size
-((int)(unsafe.Sizeof(byte('a')))) * StringLength bytes.  The size in bytes  of a
+((int)(unsafe.Sizeof(byte('a')))) * StringLength bytes.  Booleans are stored
+as a single byte, 0 or 1.  The size in bytes  of a
 tuple is just the sum of the size in bytes of its fields.
 
+Pages of a HeapFile created with [NewHeapFileWithDictionary] are dictionary
+pages, flagged by heapPageDictFlag: the header is followed by a 16 bit count of
+distinct strings and a dictionary area of heapPageDictEntries strings of
+StringLength bytes, and the string fields of the tuples are 16 bit indexes in
+the dictionary. A page whose dictionary is full takes no tuple with a new
+string, but low-cardinality string columns fit many more tuples per page.
+Pages of a HeapFile created with [NewHeapFileColumnar] store their tuples by
+column instead, flagged by heapPageColumnarFlag; see columnar_page.go. Pages of
+any kind may also keep a bloom filter of a column, flagged by heapPageBloomFlag;
+see heap_page_bloom.go.
+
 Once you have figured out how big a record is, you can determine the number of
 slots on on the page as:
 
-remPageSize = PageSize - 8 // bytes after header
+remPageSize = PageSize - heapPageHeaderSize // bytes after header
 numSlots = remPageSize / bytesPerTuple //integer division will round down
 
 To serialize a page to a buffer, you can then:
 
+write the magic number, format version and flags byte
 write the number of slots as an int32
 write the number of used slots as an int32
+write the string length and the field types checksum as uint16s
 write the tuples themselves to the buffer
 
 You will follow the inverse process to read pages from a buffer.
@@ -44,9 +66,33 @@ Note that to process deletions you will likely delete tuples at a specific
 position (slot) in the heap page.  This means that after a page is read from
 disk, tuples should retain the same slot number. Because GoDB will never evict a
 dirty page, it's OK if tuples are renumbered when they are written back to disk.
+GoDB does keep them in their slots when reading the page back, though, so that
+record ids stay valid, see [HeapFile.writtenSlots].
 
 */
 
+const (
+	// heapPageMagic marks the start of every serialized heap page
+	heapPageMagic uint16 = 0x6DB1
+	// heapPageVersion is the page format written by [heapPage.toBuffer];
+	// bump it whenever the on-disk layout changes
+	heapPageVersion uint8 = 2
+	// heapPageHeaderSize is magic (2) + version (1) + flags (1) + slot
+	// count (4) + used slots (4) + string length (2) + field types checksum (2)
+	heapPageHeaderSize = 16
+
+	// heapPageDictFlag is set in the flags byte of dictionary pages, whose
+	// header is followed by the dictionary, then tuples with dictionary
+	// encoded strings
+	heapPageDictFlag uint8 = 2
+	// heapPageDictEntries is the number of distinct strings a dictionary page
+	// holds
+	heapPageDictEntries = 16
+	// heapPageDictSize is the size of the dictionary of a dictionary page: the
+	// string count (2) and the strings
+	heapPageDictSize = 2 + heapPageDictEntries*StringLength
+)
+
 type heapPage struct {
 	// meta data
 	pageNo int
@@ -54,36 +100,85 @@ type heapPage struct {
 	desc   *TupleDesc
 	file   *HeapFile
 
+	// for a dictionary page, the number of tuples using each distinct string
+	dict map[string]int
+	// whether the page stores its tuples by column
+	columnar bool
+	// the bloom filter of the values of column bloomColumn, or nil
+	bloom       []byte
+	bloomColumn int
+
 	// page data
 	slotCount int32
 	slotUsed  int32
 	tuples    []*Tuple
+	firstFree int // the slots below firstFree are used
+
+	// if non-nil, initFromBuffer only deserializes these columns of each
+	// tuple, giving them projectDesc. Such pages are read only and never
+	// cached in the buffer pool.
+	projectCols []int
+	projectDesc *TupleDesc
 }
 
-// Construct a new heap page
+// Construct a new heap page, which is a dictionary or columnar page if f is a
+// file of such pages.
 func newHeapPage(desc *TupleDesc, pageNo int, f *HeapFile) (page *heapPage, err error) {
+	dictionary := f != nil && f.dictionary
+	columnar := f != nil && f.columnar
+	bloom := f != nil && f.bloom
 	var perTupleSize int32
 	for _, field := range desc.Fields {
-		switch field.Ftype {
+		switch field.Ftype.kind() {
 		case IntType:
 			perTupleSize += 8
 		case StringType:
-			perTupleSize += int32(StringLength)
+			if dictionary {
+				perTupleSize += 2
+			} else {
+				perTupleSize += int32(StringLength)
+			}
+		case BoolType:
+			perTupleSize += 1
+		case DecimalType:
+			perTupleSize += decimalFieldSize
 		default:
 			DPrintf("newHeapPage invalid field type: %d", field.Ftype)
 			return nil, GoDBError{IncompatibleTypesError, "unknown field type"}
 		}
 	}
 
-	remPageSize := int32(PageSize - 8)
+	remPageSize := int32(PageSize - heapPageHeaderSize)
+	if dictionary {
+		remPageSize -= int32(heapPageDictSize)
+	}
+	if bloom {
+		remPageSize -= int32(heapPageBloomAreaSize)
+	}
+	if perTupleSize == 0 || perTupleSize > remPageSize {
+		DPrintf("newHeapPage tuple size %d does not fit in page size %d", perTupleSize, remPageSize)
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("tuple of %d fields takes %d bytes, but a page holds at most %d bytes of tuples", len(desc.Fields), perTupleSize, remPageSize)}
+	}
 	page = &heapPage{
 		pageNo:    pageNo,
 		slotCount: remPageSize / perTupleSize,
 		slotUsed:  0,
 		desc:      desc,
 		file:      f,
+		columnar:  columnar,
+	}
+	if columnar {
+		// run lengths are 16 bit
+		page.slotCount = min(page.slotCount*columnarSlotsFactor, math.MaxUint16)
 	}
 	page.tuples = make([]*Tuple, page.slotCount)
+	if dictionary {
+		page.dict = make(map[string]int)
+	}
+	if bloom {
+		page.bloom = make([]byte, heapPageBloomSize)
+		page.bloomColumn = f.bloomColumn
+	}
 	return
 }
 
@@ -92,22 +187,50 @@ func (h *heapPage) getNumSlots() int {
 }
 
 // Insert the tuple into a free slot on the page, or return an error if there are
-// no free slots.  Set the tuples rid and return it.
+// no free slots.  Set the tuples rid and return it. On a dictionary page, a
+// PageFullError is also returned if the dictionary has no room for the new
+// strings of the tuple, and on a columnar page, if the encoded columns would no
+// longer fit in the page.
 func (h *heapPage) insertTuple(t *Tuple) (id recordID, err error) {
-	for index, tuple := range h.tuples {
-		if tuple != nil {
+	if h.dict != nil && h.slotUsed < h.slotCount {
+		newStrings := make(map[string]struct{})
+		for _, str := range dictStrings(t) {
+			if _, ok := h.dict[str]; !ok {
+				newStrings[str] = struct{}{}
+			}
+		}
+		if len(h.dict)+len(newStrings) > heapPageDictEntries {
+			DPrintf("heapPage page:%d insertTuple dictionary full", h.pageNo)
+			return nil, GoDBError{PageFullError, "page dictionary full"}
+		}
+	}
+
+	for index := h.firstFree; index < len(h.tuples); index++ {
+		if h.tuples[index] != nil {
+			h.firstFree = index + 1
 			continue
 		}
 
 		id = getRecordID(h.pageNo, index)
-		t.Rid = id
 		h.tuples[index] = &Tuple{
 			Desc:   *h.desc,
 			Fields: t.Fields,
 			Rid:    id,
 		}
 		h.slotUsed++
+		if h.columnar && h.columnarSize() > h.dataSize() {
+			h.tuples[index] = nil
+			h.slotUsed--
+			DPrintf("heapPage page:%d insertTuple columns full", h.pageNo)
+			return nil, GoDBError{PageFullError, "page columns full"}
+		}
+		t.Rid = id
+		h.firstFree = index + 1
 		h.dirty = true
+		h.addDictStrings(t, 1)
+		if h.bloom != nil {
+			bloomAdd(h.bloom, t.Fields[h.bloomColumn])
+		}
 		break
 	}
 
@@ -132,12 +255,136 @@ func (h *heapPage) deleteTuple(rid recordID) error {
 		return GoDBError{TupleNotFoundError, "invalid record id"}
 	}
 
+	h.addDictStrings(h.tuples[slot], -1)
 	h.tuples[slot] = nil
+	h.firstFree = min(h.firstFree, slot)
 	h.slotUsed--
 	h.dirty = true
+	h.rebuildBloom()
+	return nil
+}
+
+// Replace the fields of the tuple at the specified record ID with newFields, in
+// the same slot, and mark the page dirty. Returns a TupleNotFoundError if the ID
+// is invalid, and a TypeMismatchError if newFields do not match the fields of
+// the page. Like [heapPage.insertTuple], returns a PageFullError if a
+// dictionary page has no room for the new strings, or the columns of a
+// columnar page would no longer fit; the tuple is then left unchanged.
+func (h *heapPage) updateTuple(rid recordID, newFields []DBValue) error {
+	_, slot := splitRecordID(rid)
+	if slot < 0 || slot >= len(h.tuples) || h.tuples[slot] == nil {
+		DPrintf("heapPage page:%d updateTuple rid:%s invalid", h.pageNo, rid)
+		return GoDBError{TupleNotFoundError, "invalid record id"}
+	}
+	if err := checkFields(newFields, h.desc); err != nil {
+		DPrintf("heapPage page:%d updateTuple err:%v", h.pageNo, err)
+		return err
+	}
+
+	old := h.tuples[slot]
+	updated := &Tuple{Desc: *h.desc, Fields: newFields, Rid: rid}
+	if h.dict != nil {
+		h.addDictStrings(old, -1)
+		newStrings := make(map[string]struct{})
+		for _, str := range dictStrings(updated) {
+			if _, ok := h.dict[str]; !ok {
+				newStrings[str] = struct{}{}
+			}
+		}
+		if len(h.dict)+len(newStrings) > heapPageDictEntries {
+			h.addDictStrings(old, 1)
+			DPrintf("heapPage page:%d updateTuple dictionary full", h.pageNo)
+			return GoDBError{PageFullError, "page dictionary full"}
+		}
+	}
+	h.tuples[slot] = updated
+	if h.columnar && h.columnarSize() > h.dataSize() {
+		h.tuples[slot] = old
+		DPrintf("heapPage page:%d updateTuple columns full", h.pageNo)
+		return GoDBError{PageFullError, "page columns full"}
+	}
+	h.addDictStrings(updated, 1)
+	h.rebuildBloom()
+	h.dirty = true
 	return nil
 }
 
+// Return the size of the page after its header and bloom filter.
+func (h *heapPage) dataSize() int {
+	if h.bloom != nil {
+		return PageSize - heapPageHeaderSize - heapPageBloomAreaSize
+	}
+	return PageSize - heapPageHeaderSize
+}
+
+// Check that fields are values of the fields of desc, which a page can store:
+// as many, of the Go types of their DBTypes, and not NULL.
+func checkFields(fields []DBValue, desc *TupleDesc) error {
+	if len(fields) != len(desc.Fields) {
+		return GoDBError{TypeMismatchError, fmt.Sprintf("expected %d fields, got %d", len(desc.Fields), len(fields))}
+	}
+	for i, field := range desc.Fields {
+		var ok bool
+		switch field.Ftype.kind() {
+		case IntType:
+			_, ok = fields[i].(IntField)
+		case StringType:
+			_, ok = fields[i].(StringField)
+		case BoolType:
+			_, ok = fields[i].(BoolField)
+		case DecimalType:
+			_, ok = fields[i].(DecimalField)
+		}
+		if !ok {
+			return GoDBError{TypeMismatchError, fmt.Sprintf("value %v does not match the type of field %s", fields[i], field.Fname)}
+		}
+	}
+	return nil
+}
+
+// Replace the slots of the page with tuples, of which slotUsed are used, as
+// [BufferPool.Restore] does, and rebuild the dictionary and the bloom filter of
+// the page, which follow its tuples.
+func (h *heapPage) restoreSlots(tuples []*Tuple, slotUsed int32) {
+	h.tuples = make([]*Tuple, len(tuples))
+	copy(h.tuples, tuples)
+	h.slotUsed = slotUsed
+	h.firstFree = 0
+	if h.dict != nil {
+		h.dict = make(map[string]int)
+		for _, t := range h.tuples {
+			if t != nil {
+				h.addDictStrings(t, 1)
+			}
+		}
+	}
+	h.rebuildBloom()
+}
+
+// Return the strings of t as a dictionary page stores them.
+func dictStrings(t *Tuple) []string {
+	var strs []string
+	for _, field := range t.Fields {
+		if str, ok := field.(StringField); ok {
+			strs = append(strs, truncateString(str.Value, StringLength))
+		}
+	}
+	return strs
+}
+
+// Count delta more uses of the strings of t in the dictionary of a dictionary
+// page, dropping the strings no tuple uses anymore.
+func (h *heapPage) addDictStrings(t *Tuple, delta int) {
+	if h.dict == nil {
+		return
+	}
+	for _, str := range dictStrings(t) {
+		if h.dict[str] += delta; h.dict[str] <= 0 {
+			delete(h.dict, str)
+		}
+	}
+}
+
 // Page method - return whether or not the page is dirty
 func (h *heapPage) isDirty() bool {
 	return h.dirty
@@ -156,6 +403,11 @@ func (h *heapPage) getFile() DBFile {
 	return h.file
 }
 
+// NumFreeSlots Page method - return the number of empty slots of the page.
+func (h *heapPage) NumFreeSlots() int {
+	return int(h.slotCount - h.slotUsed)
+}
+
 // Allocate a new bytes.Buffer and write the heap page to it. Returns an error
 // if the write to the the buffer fails. You will likely want to call this from
 // your [HeapFile.flushPage] method.  You should write the page header, using
@@ -163,6 +415,27 @@ func (h *heapPage) getFile() DBFile {
 // page, written using the Tuple.writeTo method.
 func (h *heapPage) toBuffer() (buf *bytes.Buffer, err error) {
 	buf = new(bytes.Buffer)
+	err = binary.Write(buf, binary.LittleEndian, heapPageMagic)
+	if err != nil {
+		DPrintf("heapPage page:%d toBuffer Write magic err:%v", h.pageNo, err)
+		return nil, err
+	}
+
+	var flags uint8
+	if h.dict != nil {
+		flags |= heapPageDictFlag
+	} else if h.columnar {
+		flags |= heapPageColumnarFlag
+	}
+	if h.bloom != nil {
+		flags |= heapPageBloomFlag
+	}
+	err = binary.Write(buf, binary.LittleEndian, [2]uint8{heapPageVersion, flags})
+	if err != nil {
+		DPrintf("heapPage page:%d toBuffer Write version err:%v", h.pageNo, err)
+		return nil, err
+	}
+
 	err = binary.Write(buf, binary.LittleEndian, h.slotCount)
 	if err != nil {
 		DPrintf("heapPage page:%d toBuffer Write slot count err:%v", h.pageNo, err)
@@ -175,12 +448,44 @@ func (h *heapPage) toBuffer() (buf *bytes.Buffer, err error) {
 		return nil, err
 	}
 
+	err = binary.Write(buf, binary.LittleEndian, [2]uint16{uint16(StringLength), fieldTypesChecksum(h.desc)})
+	if err != nil {
+		DPrintf("heapPage page:%d toBuffer Write layout err:%v", h.pageNo, err)
+		return nil, err
+	}
+
+	if flags&heapPageBloomFlag != 0 {
+		err = binary.Write(buf, binary.LittleEndian, uint16(h.bloomColumn))
+		if err == nil {
+			_, err = buf.Write(h.bloom)
+		}
+		if err != nil {
+			DPrintf("heapPage page:%d toBuffer Write bloom filter err:%v", h.pageNo, err)
+			return nil, err
+		}
+	}
+
+	if h.columnar {
+		if err = h.writeColumns(buf); err != nil {
+			DPrintf("heapPage page:%d toBuffer Write columns err:%v", h.pageNo, err)
+			return nil, err
+		}
+	}
+
+	var dictIndex map[string]uint16
+	if h.dict != nil {
+		if dictIndex, err = h.writeDict(buf); err != nil {
+			DPrintf("heapPage page:%d toBuffer Write dictionary err:%v", h.pageNo, err)
+			return nil, err
+		}
+	}
+
 	for _, tuple := range h.tuples {
-		if tuple == nil {
+		if tuple == nil || h.columnar {
 			continue
 		}
 
-		err = tuple.writeTo(buf)
+		err = tuple.writeEncodedTo(buf, dictIndex)
 		if err != nil {
 			DPrintf("heapPage page:%d toBuffer Write tuple err:%v", h.pageNo, err)
 			return nil, err
@@ -198,14 +503,90 @@ func (h *heapPage) toBuffer() (buf *bytes.Buffer, err error) {
 	return
 }
 
+// Write the dictionary of a dictionary page to buf: the strings of its tuples,
+// in the order of their first use. Return the index of every string.
+func (h *heapPage) writeDict(buf *bytes.Buffer) (map[string]uint16, error) {
+	var strs []string
+	index := make(map[string]uint16, len(h.dict))
+	for _, tuple := range h.tuples {
+		if tuple == nil {
+			continue
+		}
+		for _, str := range dictStrings(tuple) {
+			if _, ok := index[str]; !ok {
+				index[str] = uint16(len(strs))
+				strs = append(strs, str)
+			}
+		}
+	}
+
+	if err := binary.Write(buf, binary.LittleEndian, uint16(len(strs))); err != nil {
+		return nil, err
+	}
+	area := make([]byte, heapPageDictEntries*StringLength)
+	for i, str := range strs {
+		copy(area[i*StringLength:], str+strings.Repeat(" ", StringLength-len(str)))
+	}
+	_, err := buf.Write(area)
+	return index, err
+}
+
+// Read the dictionary of a dictionary page from buf.
+func readDict(buf *bytes.Buffer) ([]string, error) {
+	var count uint16
+	if err := binary.Read(buf, binary.LittleEndian, &count); err != nil {
+		return nil, err
+	}
+	if count > heapPageDictEntries {
+		return nil, GoDBError{MalformedDataError, fmt.Sprintf("page dictionary of %d strings, above %d", count, heapPageDictEntries)}
+	}
+	area := buf.Next(heapPageDictEntries * StringLength)
+	if len(area) < heapPageDictEntries*StringLength {
+		return nil, GoDBError{MalformedDataError, "page dictionary cut short"}
+	}
+	dict := make([]string, count)
+	for i := range dict {
+		dict[i] = strings.TrimSpace(string(area[i*StringLength : (i+1)*StringLength]))
+	}
+	return dict, nil
+}
+
 // Read the contents of the HeapPage from the supplied buffer.
 func (h *heapPage) initFromBuffer(buf *bytes.Buffer) (err error) {
+	var (
+		magic   uint16
+		version [2]uint8
+	)
+	err = binary.Read(buf, binary.LittleEndian, &magic)
+	if err != nil {
+		DPrintf("heapPage page:%d initFromBuffer Read magic err:%v", h.pageNo, err)
+		return
+	}
+	if magic != heapPageMagic {
+		DPrintf("heapPage page:%d initFromBuffer bad magic:%#x", h.pageNo, magic)
+		return GoDBError{MalformedDataError, fmt.Sprintf("page %d is not a heap page (magic %#04x, expected %#04x)", h.pageNo, magic, heapPageMagic)}
+	}
+
+	err = binary.Read(buf, binary.LittleEndian, &version)
+	if err != nil {
+		DPrintf("heapPage page:%d initFromBuffer Read version err:%v", h.pageNo, err)
+		return
+	}
+	if version[0] != heapPageVersion {
+		DPrintf("heapPage page:%d initFromBuffer version:%d mismatch", h.pageNo, version[0])
+		return GoDBError{MalformedDataError, fmt.Sprintf("page %d has unsupported heap page format version %d (this build reads version %d only)", h.pageNo, version[0], heapPageVersion)}
+	}
+	if version[1]&heapPageDictFlag != 0 && version[1]&heapPageColumnarFlag != 0 {
+		return GoDBError{MalformedDataError, fmt.Sprintf("page %d is flagged both a dictionary and a columnar page", h.pageNo)}
+	}
+
 	err = binary.Read(buf, binary.LittleEndian, &h.slotCount)
 	if err != nil {
 		DPrintf("heapPage page:%d initFromBuffer Read slot count err:%v", h.pageNo, err)
 		return
 	}
 	h.tuples = make([]*Tuple, h.slotCount)
+	h.firstFree = 0
 
 	err = binary.Read(buf, binary.LittleEndian, &h.slotUsed)
 	if err != nil {
@@ -213,17 +594,105 @@ func (h *heapPage) initFromBuffer(buf *bytes.Buffer) (err error) {
 		return
 	}
 
+	var layout [2]uint16
+	err = binary.Read(buf, binary.LittleEndian, &layout)
+	if err != nil {
+		DPrintf("heapPage page:%d initFromBuffer Read layout err:%v", h.pageNo, err)
+		return
+	}
+	if err = checkPageLayout(layout, h.desc); err != nil {
+		DPrintf("heapPage page:%d initFromBuffer layout err:%v", h.pageNo, err)
+		return
+	}
+
+	h.bloom = nil
+	if version[1]&heapPageBloomFlag != 0 {
+		var col uint16
+		if err = binary.Read(buf, binary.LittleEndian, &col); err != nil {
+			DPrintf("heapPage page:%d initFromBuffer Read bloom column err:%v", h.pageNo, err)
+			return
+		}
+		if int(col) >= len(h.desc.Fields) {
+			return GoDBError{MalformedDataError, fmt.Sprintf("page %d has a bloom filter of column %d, past the %d columns", h.pageNo, col, len(h.desc.Fields))}
+		}
+		filter := buf.Next(heapPageBloomSize)
+		if len(filter) < heapPageBloomSize {
+			return GoDBError{MalformedDataError, fmt.Sprintf("page %d bloom filter cut short", h.pageNo)}
+		}
+		h.bloom = append([]byte(nil), filter...)
+		h.bloomColumn = int(col)
+	}
+
+	var dict []string
+	h.dict = nil
+	if version[1]&heapPageDictFlag != 0 {
+		if dict, err = readDict(buf); err != nil {
+			DPrintf("heapPage page:%d initFromBuffer Read dictionary err:%v", h.pageNo, err)
+			return
+		}
+		h.dict = make(map[string]int, len(dict))
+	}
+
+	var columnTuples []*Tuple
+	h.columnar = version[1]&heapPageColumnarFlag != 0
+	if h.columnar {
+		if columnTuples, err = readColumns(buf, h.desc, h.projectCols, int(h.slotUsed)); err != nil {
+			DPrintf("heapPage page:%d initFromBuffer Read columns err:%v", h.pageNo, err)
+			return
+		}
+	}
+
+	// the tuples are written compacted, but go back to their slots
+	var slots []int
+	if h.file != nil {
+		slots = h.file.writtenSlots(h.pageNo)
+	}
+	if len(slots) != int(h.slotUsed) || (len(slots) > 0 && slots[len(slots)-1] >= int(h.slotCount)) {
+		slots = nil
+	}
+
+	// the tuples of whole pages are read, so allocate them at once
+	var (
+		rowTuples []Tuple
+		rowFields []DBValue
+	)
+	width := len(h.desc.Fields)
+	if !h.columnar && h.projectCols == nil {
+		rowTuples = make([]Tuple, h.slotUsed)
+		rowFields = make([]DBValue, int(h.slotUsed)*width)
+	}
+
+	ids := getRecordIDs(h.pageNo, slots, int(h.slotUsed))
 	var tuple *Tuple
 	for i := 0; i < int(h.slotUsed); i++ {
-		tuple, err = readTupleFrom(buf, h.desc)
+		if h.columnar {
+			tuple = columnTuples[i]
+		} else if h.projectCols != nil {
+			tuple, err = readProjectedTupleFrom(buf, h.desc, h.projectCols, dict)
+		} else {
+			tuple = &rowTuples[i]
+			tuple.Fields = rowFields[i*width : i*width : (i+1)*width]
+			err = readEncodedFieldsInto(buf, h.desc, dict, tuple)
+		}
 		if err != nil {
 			DPrintf("heapPage page:%d initFromBuffer readTupleFrom err:%v", h.pageNo, err)
 			return err
 		}
 
-		tuple.Desc = *h.desc
-		tuple.Rid = getRecordID(h.pageNo, i)
-		h.tuples[i] = tuple
+		if h.projectCols != nil {
+			tuple.Desc = *h.projectDesc
+		} else {
+			tuple.Desc = *h.desc
+		}
+		slot := i
+		if slots != nil {
+			slot = slots[i]
+		}
+		tuple.Rid = ids[i]
+		h.tuples[slot] = tuple
+		if h.projectCols == nil {
+			h.addDictStrings(tuple, 1)
+		}
 	}
 	return
 }
@@ -252,3 +721,43 @@ func (h *heapPage) tupleIter() func() (*Tuple, error) {
 		}
 	}
 }
+
+// Return a function that iterates through the tuples of the heap page like
+// [heapPage.tupleIter], but from the highest slot down.
+func (h *heapPage) reverseTupleIter() func() (*Tuple, error) {
+	iter := len(h.tuples) - 1
+	return func() (reply *Tuple, err error) {
+		if h.slotUsed == 0 {
+			return
+		}
+		for ; iter >= 0; iter-- {
+			if reply = h.tuples[iter]; reply != nil {
+				iter--
+				return
+			}
+		}
+		return
+	}
+}
+
+// Return a checksum of the field types of desc, which the pages of a file of
+// such tuples record in their header.
+func fieldTypesChecksum(desc *TupleDesc) uint16 {
+	sum := uint16(len(desc.Fields))
+	for _, field := range desc.Fields {
+		sum = sum*31 + uint16(field.Ftype) + 1
+	}
+	return sum
+}
+
+// Return a SchemaMismatchError if layout, the string length and field types
+// checksum in a page header, differs from the layout of tuples of desc.
+func checkPageLayout(layout [2]uint16, desc *TupleDesc) error {
+	if int(layout[0]) != StringLength {
+		return GoDBError{SchemaMismatchError, fmt.Sprintf("page written with string length %d, but the string length is %d", layout[0], StringLength)}
+	}
+	if layout[1] != fieldTypesChecksum(desc) {
+		return GoDBError{SchemaMismatchError, fmt.Sprintf("page written for other field types than %v", desc.HeaderString(false))}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package godb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+/* Pages of a HeapFile created with [NewHeapFileWithBloomFilter] keep a bloom
+filter of the values of one column of their tuples, so that equality scans (see
+[HeapFile.IteratorWithPred]) skip the pages that cannot hold the value they look
+for. Such pages set heapPageBloomFlag in the flags byte of their header, which
+is then followed by the 16 bit index of the column and the heapPageBloomSize
+bytes of the filter, before the rest of the page. The filter sets
+heapPageBloomHashes bits per value; it is updated on insert, and rebuilt from
+the remaining tuples on delete and update.
+*/
+
+const (
+	// heapPageBloomFlag is set in the flags byte of pages with a bloom filter
+	heapPageBloomFlag uint8 = 1
+	// heapPageBloomSize is the size of the bloom filter of a page
+	heapPageBloomSize = 128
+	// heapPageBloomAreaSize is the size of the column index (2) and the filter
+	heapPageBloomAreaSize = 2 + heapPageBloomSize
+	// heapPageBloomHashes is the number of bits a value sets in a filter
+	heapPageBloomHashes = 3
+)
+
+// Return the bits of the bloom filter set by v: those of its stored value, so
+// that values equal by [evalPred] (e.g., an int and a decimal) set the same bits.
+func bloomBits(v DBValue) [heapPageBloomHashes]uint32 {
+	key := v.HashKey()
+	if s, ok := v.(StringField); ok {
+		key = truncateString(s.Value, StringLength)
+	}
+	sum := stableHash(key)
+	// double hashing: the i-th bit is h1 + i*h2
+	h1, h2 := uint32(sum), uint32(sum>>32)
+	var bits [heapPageBloomHashes]uint32
+	for i := range bits {
+		bits[i] = (h1 + uint32(i)*h2) % (heapPageBloomSize * 8)
+	}
+	return bits
+}
+
+// Add v to the bloom filter. NULL is never added, as it equals nothing.
+func bloomAdd(filter []byte, v DBValue) {
+	if _, isNull := v.(NullField); isNull {
+		return
+	}
+	for _, bit := range bloomBits(v) {
+		filter[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// Report whether the bloom filter may hold v; if not, it does not.
+func bloomMayContain(filter []byte, v DBValue) bool {
+	for _, bit := range bloomBits(v) {
+		if filter[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Rebuild the bloom filter of the page from its tuples, if it has one.
+func (h *heapPage) rebuildBloom() {
+	if h.bloom == nil {
+		return
+	}
+	clear(h.bloom)
+	for _, tuple := range h.tuples {
+		if tuple != nil {
+			bloomAdd(h.bloom, tuple.Fields[h.bloomColumn])
+		}
+	}
+}
+
+// Report whether the page may hold a tuple whose column col equals v. Pages
+// without a bloom filter on col may hold any value.
+func (h *heapPage) mayContain(col int, v DBValue) bool {
+	return h.bloom == nil || h.bloomColumn != col || bloomMayContain(h.bloom, v)
+}
+
+// NewHeapFileWithBloomFilter Construct a HeapFile like [NewHeapFile], whose
+// new pages keep a bloom filter of the values of column col of their tuples,
+// so that [HeapFile.IteratorWithPred] skips the pages that cannot hold the
+// value of an equality predicate on col without reading them whole. The
+// filters take heapPageBloomAreaSize bytes of every page.
+//
+// Returns an IllegalOperationError if col is not a column of td.
+func NewHeapFileWithBloomFilter(fromFile string, td *TupleDesc, bp *BufferPool, col int) (*HeapFile, error) {
+	if col < 0 || col >= len(td.Fields) {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("column %d out of range for a table of %d columns", col, len(td.Fields))}
+	}
+	heapFile, err := NewHeapFile(fromFile, td, bp)
+	if err != nil {
+		return nil, err
+	}
+	heapFile.bloom = true
+	heapFile.bloomColumn = col
+	return heapFile, nil
+}
+
+// Report whether page pageNo may hold a tuple whose column col equals v, as
+// far as its bloom filter tells. A cached page is asked directly; otherwise
+// only the header and the filter of the page are read from disk.
+func (f *HeapFile) pageMayContain(pageNo int, col int, v DBValue) bool {
+	if page, ok := f.bufPool.cachedPage(f, pageNo); ok {
+		return page.(*heapPage).mayContain(col, v)
+	}
+
+	file, err := os.Open(f.fromFile)
+	if err != nil {
+		return true
+	}
+	defer file.Close()
+	data := make([]byte, heapPageHeaderSize+heapPageBloomAreaSize)
+	n, err := file.ReadAt(data, int64(pageNo*PageSize))
+	f.bytesRead.Add(int64(n))
+	if err != nil || data[3]&heapPageBloomFlag == 0 {
+		return true
+	}
+	if int(binary.LittleEndian.Uint16(data[heapPageHeaderSize:])) != col {
+		return true
+	}
+	return bloomMayContain(data[heapPageHeaderSize+2:], v)
+}
+
+// IteratorWithPred Return a function that iterates through the tuples of the
+// heap file like [HeapFile.Iterator] whose column col compares to v by op, as
+// evaluated by a [Filter]. For an equality predicate on the column of the bloom
+// filters of a file created by [NewHeapFileWithBloomFilter], the pages whose
+// filter does not hold v are skipped without being read whole.
+func (f *HeapFile) IteratorWithPred(tid TransactionID, col int, op BoolOp, v DBValue) (func() (*Tuple, error), error) {
+	if col < 0 || col >= len(f.desc.Fields) {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("column %d out of range for a table of %d columns", col, len(f.desc.Fields))}
+	}
+	var skipPage func(pageNo int) bool
+	if _, isNull := v.(NullField); !isNull && op == OpEq && f.bloom && col == f.bloomColumn {
+		skipPage = func(pageNo int) bool {
+			return !f.pageMayContain(pageNo, col, v)
+		}
+	}
+
+	iter := f.iteratorPages(tid, 0, -1, -1, nil, skipPage)
+	return func() (*Tuple, error) {
+		for {
+			tuple, err := iter()
+			if err != nil || tuple == nil {
+				return tuple, err
+			}
+			if evalPred(tuple.Fields[col], v, op) {
+				return tuple, nil
+			}
+		}
+	}, nil
+}
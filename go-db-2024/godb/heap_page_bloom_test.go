@@ -0,0 +1,107 @@
+package godb
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestHeapFileBloomFilterSkipsPages(t *testing.T) {
+	td := TupleDesc{Fields: []FieldType{{Fname: "id", Ftype: IntType}, {Fname: "name", Ftype: StringType}}}
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf, err := NewHeapFileWithBloomFilter(filepath.Join(t.TempDir(), "bloom.dat"), &td, bp, 0)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	const ntups = 1000
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	for i := 0; i < ntups; i++ {
+		id := i
+		if i%300 == 0 {
+			// a value on several pages
+			id = -1
+		}
+		tup := &Tuple{td, []DBValue{IntField{int64(id)}, StringField{fmt.Sprintf("name%d", i)}}, nil}
+		if err := hf.insertTuple(tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if i%50 == 49 {
+			bp.FlushAllPages()
+		}
+	}
+	bp.CommitTransaction(tid)
+	bp.FlushAllPages()
+	if hf.NumPages() < 8 {
+		t.Fatalf("expected at least 8 pages, got %d", hf.NumPages())
+	}
+
+	// read the pages from disk rather than from the buffer pool
+	bp2, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	reopened, err := NewHeapFileWithBloomFilter(hf.BackingFile(), &td, bp2, 0)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid = NewTID()
+	bp2.BeginTransaction(tid)
+	lookup := func(id int64) []*Tuple {
+		t.Helper()
+		iter, err := reopened.IteratorWithPred(tid, 0, OpEq, IntField{id})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		return drainIterator(t, iter)
+	}
+
+	misses := bp2.Misses()
+	if found := lookup(537); len(found) != 1 || found[0].Fields[1] != (StringField{"name537"}) {
+		t.Fatalf("expected name537, got %v", found)
+	}
+	if read := bp2.Misses() - misses; read > 2 {
+		t.Errorf("expected the lookup to read 1 page, and at most 1 false positive, read %d of %d", read, reopened.NumPages())
+	}
+
+	misses = bp2.Misses()
+	if found := lookup(-1); len(found) != 4 {
+		t.Fatalf("expected the 4 tuples with id -1, got %v", found)
+	}
+	if read := bp2.Misses() - misses; read > 6 {
+		t.Errorf("expected the lookup to read 4 pages, and at most 2 false positives, read %d of %d", read, reopened.NumPages())
+	}
+
+	// the filters do not change other predicates
+	iter, err := reopened.IteratorWithPred(tid, 0, OpLt, IntField{10})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if found := drainIterator(t, iter); len(found) != 13 {
+		t.Fatalf("expected 13 tuples with id < 10, got %d", len(found))
+	}
+
+	// deleting the tuple removes its id from the filter of its page
+	found := lookup(537)
+	if err := reopened.deleteTuple(found[0], tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	pageNo, _ := splitRecordID(found[0].Rid)
+	page, err := bp2.GetPage(reopened, pageNo, tid, ReadPerm)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if page.(*heapPage).mayContain(0, IntField{537}) {
+		t.Errorf("expected the filter to drop the deleted id")
+	}
+	if !page.(*heapPage).mayContain(0, IntField{538}) {
+		t.Errorf("expected the filter to keep the other ids")
+	}
+	if found := lookup(537); len(found) != 0 {
+		t.Fatalf("expected no tuple after the delete, got %v", found)
+	}
+	bp2.CommitTransaction(tid)
+}
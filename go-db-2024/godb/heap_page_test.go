@@ -1,6 +1,11 @@
 package godb
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
 	"unsafe"
 )
@@ -11,7 +16,7 @@ func TestHeapPageInsert(t *testing.T) {
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
-	var expectedSlots = (PageSize - 8) / (StringLength + int(unsafe.Sizeof(int64(0))))
+	var expectedSlots = (PageSize - heapPageHeaderSize) / (StringLength + int(unsafe.Sizeof(int64(0))))
 	if pg.getNumSlots() != expectedSlots {
 		t.Fatalf("Incorrect number of slots, expected %d, got %d", expectedSlots, pg.getNumSlots())
 	}
@@ -171,6 +176,40 @@ func TestHeapPageDeleteTuple(t *testing.T) {
 	}
 }
 
+func TestHeapPageInsertReusesFreedSlot(t *testing.T) {
+	td, t1, t2, hf, _, _ := makeTestVars(t)
+	page, err := newHeapPage(&td, 0, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var rids []recordID
+	for i := 0; i < 3; i++ {
+		rid, err := page.insertTuple(&t1)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		rids = append(rids, rid)
+	}
+	if err := page.deleteTuple(rids[1]); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	rid, err := page.insertTuple(&t2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if rid != rids[1] {
+		t.Errorf("expected the freed slot %v to be reused, got %v", rids[1], rid)
+	}
+	rid, err = page.insertTuple(&t2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if rid != getRecordID(0, 3) {
+		t.Errorf("expected the next slot %v, got %v", getRecordID(0, 3), rid)
+	}
+}
+
 // Unit test for isDirty, setDirty
 func TestHeapPageDirty(t *testing.T) {
 	td, _, _, hf, _, _ := makeTestVars(t)
@@ -193,6 +232,45 @@ func TestHeapPageDirty(t *testing.T) {
 	}
 }
 
+func TestHeapPageUpdateTuple(t *testing.T) {
+	td, t1, t2, hf, _, _ := makeTestVars(t)
+	page, err := newHeapPage(&td, 0, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	rid, _ := page.insertTuple(&t1)
+	page.insertTuple(&t2)
+	page.setDirty(0, false)
+
+	if err := page.updateTuple(rid, []DBValue{StringField{"joe"}, IntField{30}}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !page.isDirty() {
+		t.Errorf("page should be dirty")
+	}
+	tup := page.tuples[0]
+	if tup.Rid != rid || tup.Fields[0] != (StringField{"joe"}) || tup.Fields[1] != (IntField{30}) {
+		t.Fatalf("expected joe, 30 in the same slot, got %v", tup)
+	}
+	if page.NumFreeSlots() != page.getNumSlots()-2 {
+		t.Errorf("expected an update to keep the number of free slots")
+	}
+
+	for _, fields := range [][]DBValue{
+		{StringField{"joe"}},
+		{IntField{30}, StringField{"joe"}},
+		{StringField{"joe"}, NullField{}},
+	} {
+		if err := page.updateTuple(rid, fields); err == nil || err.(GoDBError).code != TypeMismatchError {
+			t.Errorf("fields %v: expected a TypeMismatchError, got %v", fields, err)
+		}
+	}
+	page.deleteTuple(rid)
+	if err := page.updateTuple(rid, t1.Fields); err == nil || err.(GoDBError).code != TupleNotFoundError {
+		t.Errorf("expected a TupleNotFoundError updating a deleted tuple, got %v", err)
+	}
+}
+
 // Unit test for toBuffer and initFromBuffer
 func TestHeapPageSerialization(t *testing.T) {
 	td, _, _, hf, _, _ := makeTestVars(t)
@@ -277,3 +355,148 @@ func TestHeapPageBufferLen(t *testing.T) {
 		t.Fatalf("HeapPage.toBuffer returns buffer of unexpected size;  NOTE:  This error may be OK, but many implementations that don't write full pages break.")
 	}
 }
+
+func TestHeapPageFormatVersion(t *testing.T) {
+	td, t1, _, hf, _, _ := makeTestVars(t)
+	page, err := newHeapPage(&td, 0, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	page.insertTuple(&t1)
+
+	buf, err := page.toBuffer()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	data := buf.Bytes()
+	if binary.LittleEndian.Uint16(data[0:2]) != heapPageMagic || data[2] != heapPageVersion {
+		t.Fatalf("page header does not start with magic and version")
+	}
+
+	// a page written by a newer format version must be rejected
+	data[2] = heapPageVersion + 1
+	page2, err := newHeapPage(&td, 0, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = page2.initFromBuffer(bytes.NewBuffer(data))
+	if err == nil {
+		t.Fatalf("expected an error reading a page with a bumped format version")
+	}
+	if !strings.Contains(err.Error(), fmt.Sprintf("version %d", heapPageVersion+1)) {
+		t.Errorf("error should mention the unsupported version, got: %v", err)
+	}
+
+	// as must a buffer that isn't a heap page at all
+	page3, err := newHeapPage(&td, 0, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = page3.initFromBuffer(bytes.NewBuffer(make([]byte, PageSize)))
+	if err == nil || !strings.Contains(err.Error(), "not a heap page") {
+		t.Errorf("expected a bad magic error, got: %v", err)
+	}
+}
+
+func TestHeapPageKindFlags(t *testing.T) {
+	td, t1, _, _, bp, _ := makeTestVars(t)
+	dir := t.TempDir()
+	newFiles := map[string]func(string, *TupleDesc, *BufferPool) (*HeapFile, error){
+		"row":        NewHeapFile,
+		"dictionary": NewHeapFileWithDictionary,
+		"columnar":   NewHeapFileColumnar,
+		"bloom": func(path string, td *TupleDesc, bp *BufferPool) (*HeapFile, error) {
+			return NewHeapFileWithBloomFilter(path, td, bp, 0)
+		},
+	}
+	flags := map[string]uint8{"row": 0, "dictionary": heapPageDictFlag, "columnar": heapPageColumnarFlag, "bloom": heapPageBloomFlag}
+	for kind, newFile := range newFiles {
+		hf, err := newFile(filepath.Join(dir, kind+".dat"), &td, bp)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		page, err := newHeapPage(&td, 0, hf)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		page.insertTuple(&t1)
+		buf, err := page.toBuffer()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		// every kind of page has the same format version, and its kind in the
+		// flags byte
+		data := buf.Bytes()
+		if data[2] != heapPageVersion || data[3] != flags[kind] {
+			t.Errorf("%s: expected version %d and flags %#x, got %d and %#x", kind, heapPageVersion, flags[kind], data[2], data[3])
+		}
+		page2, err := newHeapPage(&td, 0, hf)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := page2.initFromBuffer(bytes.NewBuffer(data)); err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		if (page2.dict != nil) != (kind == "dictionary") || page2.columnar != (kind == "columnar") {
+			t.Errorf("%s: read back as the wrong kind of page", kind)
+		}
+		if err := CheckIfOutputMatches(page2.tupleIter(), []*Tuple{&t1}); err != nil {
+			t.Errorf("%s: %v", kind, err)
+		}
+	}
+}
+
+func TestHeapPageNumFreeSlots(t *testing.T) {
+	td, t1, t2, hf, _, _ := makeTestVars(t)
+	pg, err := newHeapPage(&td, 0, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var page Page = pg
+	numSlots := pg.getNumSlots()
+	if page.NumFreeSlots() != numSlots {
+		t.Fatalf("expected %d free slots in an empty page, got %d", numSlots, page.NumFreeSlots())
+	}
+
+	rid1, err := pg.insertTuple(&t1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := pg.insertTuple(&t2); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if page.NumFreeSlots() != numSlots-2 {
+		t.Errorf("expected %d free slots after 2 inserts, got %d", numSlots-2, page.NumFreeSlots())
+	}
+
+	if err := pg.deleteTuple(rid1); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if page.NumFreeSlots() != numSlots-1 {
+		t.Errorf("expected %d free slots after a delete, got %d", numSlots-1, page.NumFreeSlots())
+	}
+
+	for page.NumFreeSlots() > 0 {
+		if _, err := pg.insertTuple(&t1); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if _, err := pg.insertTuple(&t1); err == nil {
+		t.Errorf("expected inserting into a page with no free slots to fail")
+	}
+}
+
+func TestHeapPageTupleTooLarge(t *testing.T) {
+	_, _, _, hf, _, _ := makeTestVars(t)
+	var td TupleDesc
+	for i := 0; i*StringLength <= PageSize; i++ {
+		td.Fields = append(td.Fields, FieldType{Fname: fmt.Sprintf("s%d", i), Ftype: StringType})
+	}
+	_, err := newHeapPage(&td, 0, hf)
+	if err == nil {
+		t.Fatalf("expected an error for a tuple larger than a page")
+	}
+	if !strings.Contains(err.Error(), "a page holds at most") {
+		t.Errorf("expected a descriptive error, got: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package godb
+
+import (
+	"fmt"
+	"sync"
+)
+
+// An IndexedHeapFile is a [HeapFile] with a unique key: it keeps a hash index of
+// the keys of its tuples, and rejects inserting a tuple whose key is already in
+// the file with a DuplicateKeyError, without scanning the file. NULL keys are
+// not indexed, so any number of tuples may have them.
+//
+// The index holds the keys of the tuples inserted by running transactions too,
+// and keeps the keys of the tuples they deleted until they commit, so that a
+// key is only reused once the tuple holding it is gone for good. A transaction
+// may reinsert a key it deleted itself, as an update does.
+type IndexedHeapFile struct {
+	*HeapFile
+	keyExpr Expr
+
+	indexLock sync.Mutex
+	index     map[any]struct{} // the [DBValue.HashKey] keys of the keys
+	txnKeys   map[TransactionID]*txnKeys
+}
+
+// the keys inserted and deleted by a running transaction
+type txnKeys struct {
+	inserted map[any]struct{}
+	deleted  map[any]struct{}
+}
+
+// NewIndexedHeapFile Construct an IndexedHeapFile over file, whose unique key is
+// keyExpr evaluated on its tuples. The index is built by scanning file.
+//
+// Returns a DuplicateKeyError if the tuples of file already repeat a key.
+func NewIndexedHeapFile(file *HeapFile, keyExpr Expr) (*IndexedHeapFile, error) {
+	f := &IndexedHeapFile{
+		HeapFile: file,
+		keyExpr:  keyExpr,
+		index:    make(map[any]struct{}),
+		txnKeys:  make(map[TransactionID]*txnKeys),
+	}
+
+	iter, err := file.Iterator(NewTID())
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tuple, err := iter()
+		if err != nil {
+			DPrintf("IndexedHeapFile path:%s build index iter err:%v", file.fromFile, err)
+			return nil, err
+		}
+		if tuple == nil {
+			break
+		}
+		key, err := f.keyOf(tuple)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			continue
+		}
+		if _, isExist := f.index[key.HashKey()]; isExist {
+			return nil, GoDBError{DuplicateKeyError, fmt.Sprintf("key %v appears more than once", key)}
+		}
+		f.index[key.HashKey()] = struct{}{}
+	}
+	return f, nil
+}
+
+// Return the key of t, or nil if it is NULL.
+func (f *IndexedHeapFile) keyOf(t *Tuple) (DBValue, error) {
+	key, err := f.keyExpr.EvalExpr(t)
+	if err != nil {
+		return nil, err
+	}
+	if _, isNull := key.(NullField); isNull {
+		return nil, nil
+	}
+	return key, nil
+}
+
+// Return the keys of running transaction tid, creating them if needed. The
+// caller must hold indexLock.
+func (f *IndexedHeapFile) keysOf(tid TransactionID) *txnKeys {
+	k, ok := f.txnKeys[tid]
+	if !ok {
+		k = &txnKeys{inserted: make(map[any]struct{}), deleted: make(map[any]struct{})}
+		f.txnKeys[tid] = k
+	}
+	return k
+}
+
+// Add the tuple to the file like [HeapFile.insertTuple], unless its key is
+// already in the index, in which case a DuplicateKeyError is returned.
+func (f *IndexedHeapFile) insertTuple(t *Tuple, tid TransactionID) error {
+	key, err := f.keyOf(t)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return f.HeapFile.insertTuple(t, tid)
+	}
+
+	f.indexLock.Lock()
+	defer f.indexLock.Unlock()
+	active := f.bufPool.isActive(tid)
+	reinsert := false
+	hashKey := key.HashKey()
+	if _, isExist := f.index[hashKey]; isExist {
+		if k, ok := f.txnKeys[tid]; ok {
+			_, reinsert = k.deleted[hashKey]
+		}
+		if !reinsert {
+			return GoDBError{DuplicateKeyError, fmt.Sprintf("key %v is already in the file", key)}
+		}
+	}
+
+	if err := f.HeapFile.insertTuple(t, tid); err != nil {
+		return err
+	}
+	if reinsert {
+		// the key stays, whether tid commits or aborts
+		delete(f.txnKeys[tid].deleted, hashKey)
+		return nil
+	}
+	f.index[hashKey] = struct{}{}
+	if active {
+		f.keysOf(tid).inserted[hashKey] = struct{}{}
+		f.bufPool.noteWrite(tid, f)
+	}
+	return nil
+}
+
+// Remove the tuple from the file like [HeapFile.deleteTuple]. Its key leaves the
+// index once the deleting transaction commits.
+func (f *IndexedHeapFile) deleteTuple(t *Tuple, tid TransactionID) error {
+	key, err := f.keyOf(t)
+	if err != nil {
+		return err
+	}
+
+	f.indexLock.Lock()
+	defer f.indexLock.Unlock()
+	if err := f.HeapFile.deleteTuple(t, tid); err != nil {
+		return err
+	}
+	if key == nil {
+		return nil
+	}
+
+	hashKey := key.HashKey()
+	if !f.bufPool.isActive(tid) {
+		delete(f.index, hashKey)
+		return nil
+	}
+	k := f.keysOf(tid)
+	if _, ok := k.inserted[hashKey]; ok {
+		// nobody else ever saw the key
+		delete(k.inserted, hashKey)
+		delete(f.index, hashKey)
+	} else {
+		k.deleted[hashKey] = struct{}{}
+	}
+	f.bufPool.noteWrite(tid, f)
+	return nil
+}
+
+// Drop the keys deleted by transaction tid from the index if commit is set, or
+// the keys it inserted otherwise. Called by the buffer pool when tid ends.
+func (f *IndexedHeapFile) endTransaction(tid TransactionID, commit bool) {
+	f.indexLock.Lock()
+	defer f.indexLock.Unlock()
+	k := f.txnKeys[tid]
+	delete(f.txnKeys, tid)
+	if k == nil {
+		return
+	}
+
+	dropped := k.inserted
+	if commit {
+		dropped = k.deleted
+	}
+	for key := range dropped {
+		delete(f.index, key)
+	}
+}
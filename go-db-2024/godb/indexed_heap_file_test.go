@@ -0,0 +1,91 @@
+package godb
+
+import (
+	"errors"
+	"testing"
+)
+
+func expectDuplicateKey(t *testing.T, err error) {
+	t.Helper()
+	var gerr GoDBError
+	if !errors.As(err, &gerr) || gerr.code != DuplicateKeyError {
+		t.Fatalf("expected a DuplicateKeyError, got %v", err)
+	}
+}
+
+func TestIndexedHeapFileUniqueKey(t *testing.T) {
+	td, t1, t2, hf, bp, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	bp.CommitTransaction(tid)
+
+	f, err := NewIndexedHeapFile(hf, &FieldExpr{td.Fields[0]})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	insertTupleForTest(t, f, &t2, tid)
+
+	// the duplicate is rejected by the index, without reading any page
+	calls := bp.getPageCalls.Load()
+	dup := Tuple{td, []DBValue{StringField{"sam"}, IntField{1}}, nil}
+	expectDuplicateKey(t, f.insertTuple(&dup, tid))
+	if bp.getPageCalls.Load() != calls {
+		t.Errorf("expected no page reads to reject a duplicate, got %d", bp.getPageCalls.Load()-calls)
+	}
+	bp.CommitTransaction(tid)
+
+	// the key of an aborted insert can be used again
+	alice := Tuple{td, []DBValue{StringField{"alice"}, IntField{30}}, nil}
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	insertTupleForTest(t, f, &alice, tid)
+	bp.AbortTransaction(tid)
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	insertTupleForTest(t, f, &alice, tid)
+
+	// a deleted key is only free once the delete commits, except to the deleter
+	iter, err := f.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var sam *Tuple
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		if tup.Fields[0].(StringField).Value == "sam" {
+			sam = tup
+		}
+	}
+	if err := f.deleteTuple(sam, tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	other := NewTID()
+	bp.BeginTransaction(other)
+	expectDuplicateKey(t, f.insertTuple(&dup, other))
+	bp.AbortTransaction(other)
+	insertTupleForTest(t, f, &dup, tid)
+	bp.CommitTransaction(tid)
+
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	iter, err = f.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatchesUnordered(iter, []*Tuple{&dup, &t2, &alice}); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// a file that already repeats a key cannot be indexed
+	insertTupleForTest(t, hf, &t2, tid)
+	bp.CommitTransaction(tid)
+	_, err = NewIndexedHeapFile(hf, &FieldExpr{td.Fields[0]})
+	expectDuplicateKey(t, err)
+}
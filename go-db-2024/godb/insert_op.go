@@ -1,10 +1,23 @@
 package godb
 
+import (
+	"errors"
+	"fmt"
+)
+
 type InsertOp struct {
 	insertFile DBFile
 	child      Operator
+	validate   TupleValidator // if set, checks every tuple before it is inserted
+
+	// if set, tuples whose unique key is already in insertFile are skipped
+	doNothingOnConflict bool
 }
 
+// TupleValidator checks a tuple an [InsertOp] is about to insert, as part of
+// transaction tid, and returns an error to reject the insert
+type TupleValidator func(t *Tuple, tid TransactionID) error
+
 // NewInsertOp Construct an insert operator that inserts the records in the child Operator
 // into the specified DBFile.
 func NewInsertOp(insertFile DBFile, child Operator) *InsertOp {
@@ -14,6 +27,73 @@ func NewInsertOp(insertFile DBFile, child Operator) *InsertOp {
 	}
 }
 
+// NewInsertOpWithValidator Construct an insert operator like [NewInsertOp], which
+// calls validate on every tuple before inserting it. The first tuple validate
+// rejects fails the insert with validate's error; the tuples inserted before it
+// are left to the transaction to abort.
+func NewInsertOpWithValidator(insertFile DBFile, child Operator, validate TupleValidator) *InsertOp {
+	return &InsertOp{
+		insertFile: insertFile,
+		child:      child,
+		validate:   validate,
+	}
+}
+
+// NewInsertOpOnConflictDoNothing Construct an insert operator like
+// [NewInsertOp], which skips the tuples whose unique key is already in
+// insertFile instead of failing, like INSERT ... ON CONFLICT DO NOTHING. The
+// key is checked by insertFile, e.g., an [IndexedHeapFile], which rejects the
+// tuples with a DuplicateKeyError. The returned count only includes the tuples
+// actually inserted.
+func NewInsertOpOnConflictDoNothing(insertFile DBFile, child Operator) *InsertOp {
+	return &InsertOp{
+		insertFile:          insertFile,
+		child:               child,
+		doNothingOnConflict: true,
+	}
+}
+
+// ForeignKeyValidator Return a [TupleValidator] checking that the value of
+// childKey in an inserted tuple is the value of parentKey in some tuple of
+// parent, as for a foreign key referencing parent. Inserts are rejected with a
+// ConstraintViolationError otherwise. A NULL key references nothing and is
+// accepted. The parent is scanned in full for every tuple.
+func ForeignKeyValidator(parent DBFile, parentKey Expr, childKey Expr) TupleValidator {
+	return func(t *Tuple, tid TransactionID) error {
+		key, err := childKey.EvalExpr(t)
+		if err != nil {
+			return err
+		}
+		if _, isNull := key.(NullField); isNull {
+			return nil
+		}
+
+		parentIter, err := parent.Iterator(tid)
+		if err != nil {
+			DPrintf("ForeignKeyValidator get parent iterator err: %v", err)
+			return err
+		}
+		for {
+			parentTup, err := parentIter()
+			if err != nil {
+				DPrintf("ForeignKeyValidator parentIter() err: %v", err)
+				return err
+			}
+			if parentTup == nil {
+				break
+			}
+			parentVal, err := parentKey.EvalExpr(parentTup)
+			if err != nil {
+				return err
+			}
+			if parentVal.EvalPred(key, OpEq) {
+				return nil
+			}
+		}
+		return GoDBError{ConstraintViolationError, fmt.Sprintf("foreign key %v not found in the referenced table", key)}
+	}
+}
+
 // Descriptor The insert TupleDesc is a one column descriptor with an integer field named "count"
 func (i *InsertOp) Descriptor() *TupleDesc {
 	return &TupleDesc{[]FieldType{{"count", "", IntType}}}
@@ -38,8 +118,20 @@ func (i *InsertOp) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error),
 				break
 			}
 
+			if i.validate != nil {
+				if err = i.validate(tuple, tid); err != nil {
+					DPrintf("InsertOp Iterator validate err: %v", err)
+					return
+				}
+			}
+
 			err = i.insertFile.insertTuple(tuple, tid)
 			if err != nil {
+				var gerr GoDBError
+				if i.doNothingOnConflict && errors.As(err, &gerr) && gerr.code == DuplicateKeyError {
+					err = nil
+					continue
+				}
 				return
 			}
 			insert++
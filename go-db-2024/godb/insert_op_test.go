@@ -1,7 +1,9 @@
 package godb
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -61,3 +63,112 @@ func TestInsert(t *testing.T) {
 
 	os.Remove(InsertTestFile)
 }
+
+func TestInsertForeignKeyValidator(t *testing.T) {
+	td, t1, t2, parent, bp, tid := makeTestVars(t)
+	insertTupleForTest(t, parent, &t1, tid)
+	insertTupleForTest(t, parent, &t2, tid)
+	bp.CommitTransaction(tid)
+	os.Remove(InsertTestFile)
+	defer os.Remove(InsertTestFile)
+	child, err := NewHeapFile(InsertTestFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// the child's name references the parent's name
+	name := &FieldExpr{td.Fields[0]}
+	validate := ForeignKeyValidator(parent, name, name)
+	insertFrom := func(tup Tuple) error {
+		// the pages the transaction dirties stay cached until it ends
+		tid := bp.NewTransaction()
+		src, err := NewHeapFile(filepath.Join(t.TempDir(), "src.dat"), &td, bp)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		insertTupleForTest(t, src, &tup, tid)
+		iter, err := NewInsertOpWithValidator(child, src, validate).Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if _, err = iter(); err != nil {
+			bp.AbortTransaction(tid)
+			return err
+		}
+		bp.CommitTransaction(tid)
+		return nil
+	}
+
+	if err := insertFrom(Tuple{td, []DBValue{StringField{"sam"}, IntField{1}}, nil}); err != nil {
+		t.Fatalf("expected a row referencing sam to be accepted, got %v", err)
+	}
+	err = insertFrom(Tuple{td, []DBValue{StringField{"alice"}, IntField{2}}, nil})
+	var gerr GoDBError
+	if !errors.As(err, &gerr) || gerr.code != ConstraintViolationError {
+		t.Fatalf("expected a ConstraintViolationError for alice, got %v", err)
+	}
+
+	iter, err := child.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := Tuple{td, []DBValue{StringField{"sam"}, IntField{1}}, nil}
+	if err := CheckIfOutputMatches(iter, []*Tuple{&expected}); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func TestInsertOnConflictDoNothing(t *testing.T) {
+	td, t1, _, hf, bp, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	bp.CommitTransaction(tid)
+	f, err := NewIndexedHeapFile(hf, &FieldExpr{td.Fields[0]})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// sam is already in the file, and alice is in the batch twice
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	src, err := NewHeapFile(filepath.Join(t.TempDir(), "src.dat"), &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, name := range []string{"sam", "alice", "bob", "alice"} {
+		insertTupleForTest(t, src, &Tuple{td, []DBValue{StringField{name}, IntField{1}}, nil}, tid)
+	}
+	bp.CommitTransaction(tid)
+
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	iter, err := NewInsertOp(f, src).Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, err = iter()
+	expectDuplicateKey(t, err)
+	bp.AbortTransaction(tid)
+
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	iter, err = NewInsertOpOnConflictDoNothing(f, src).Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	count, err := iter()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if cnt := count.Fields[0].(IntField).Value; cnt != 2 {
+		t.Errorf("expected 2 tuples to be inserted, got %d", cnt)
+	}
+
+	iter, err = f.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := []*Tuple{&t1, {td, []DBValue{StringField{"alice"}, IntField{1}}, nil}, {td, []DBValue{StringField{"bob"}, IntField{1}}, nil}}
+	if err := CheckIfOutputMatchesUnordered(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
@@ -0,0 +1,147 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// InstrumentOp is a pass-through operator that records how many tuples its
+// child emits and how long the child takes to emit them, for EXPLAIN ANALYZE
+// style reports of a plan (see [CollectInstrumentation]).
+type InstrumentOp struct {
+	child Operator
+
+	rows    int64
+	elapsed time.Duration
+}
+
+// NewInstrumentOp Construct an operator that instruments child.
+func NewInstrumentOp(child Operator) *InstrumentOp {
+	return &InstrumentOp{child: child}
+}
+
+// Descriptor Return the TupleDesc of the child.
+func (i *InstrumentOp) Descriptor() *TupleDesc {
+	return i.child.Descriptor()
+}
+
+// Iterator Return the tuples of the child, counting them and timing the calls
+// into the child. The time includes the time spent in the child's own
+// children.
+func (i *InstrumentOp) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error), err error) {
+	start := time.Now()
+	childIter, err := i.child.Iterator(tid)
+	i.elapsed += time.Since(start)
+	if err != nil {
+		DPrintf("InstrumentOp Iterator get child iterator err: %v", err)
+		return
+	}
+
+	iterFunc = func() (*Tuple, error) {
+		start := time.Now()
+		tuple, err := childIter()
+		i.elapsed += time.Since(start)
+		if tuple != nil {
+			i.rows++
+		}
+		return tuple, err
+	}
+	return
+}
+
+// Rows Return the number of tuples the child has emitted.
+func (i *InstrumentOp) Rows() int64 {
+	return i.rows
+}
+
+// Elapsed Return the time spent in the child.
+func (i *InstrumentOp) Elapsed() time.Duration {
+	return i.elapsed
+}
+
+// InstrumentStats are the counters of one [InstrumentOp] in a plan.
+type InstrumentStats struct {
+	Operator string // the type of the instrumented operator, e.g., "Filter"
+	Depth    int    // the number of instrumented operators above this one
+	Rows     int64
+	Elapsed  time.Duration
+}
+
+// CollectInstrumentation Walk the plan rooted at op, and return the counters of
+// every [InstrumentOp] in it, in pre-order.
+func CollectInstrumentation(op Operator) []InstrumentStats {
+	var stats []InstrumentStats
+	var walk func(op Operator, depth int)
+	walk = func(op Operator, depth int) {
+		if i, ok := op.(*InstrumentOp); ok {
+			stats = append(stats, InstrumentStats{
+				Operator: strings.TrimPrefix(fmt.Sprintf("%T", i.child), "*godb."),
+				Depth:    depth,
+				Rows:     i.rows,
+				Elapsed:  i.elapsed,
+			})
+			depth++
+		}
+		for _, child := range childOperators(op) {
+			walk(child, depth)
+		}
+	}
+	walk(op, 0)
+	return stats
+}
+
+// ExplainAnalyze Return a report of the counters of the plan rooted at op, one
+// line per [InstrumentOp], indented by depth.
+func ExplainAnalyze(op Operator) string {
+	var sb strings.Builder
+	for _, s := range CollectInstrumentation(op) {
+		sb.WriteString(fmt.Sprintf("%s%s (rows=%d time=%v)\n", strings.Repeat("  ", s.Depth), s.Operator, s.Rows, s.Elapsed))
+	}
+	return sb.String()
+}
+
+// Return the input operators of op.
+func childOperators(op Operator) []Operator {
+	switch op := op.(type) {
+	case *InstrumentOp:
+		return []Operator{op.child}
+	case *Filter:
+		return []Operator{op.child}
+	case *Project:
+		return []Operator{op.child}
+	case *OrderBy:
+		return []Operator{op.child}
+	case *LimitOp:
+		return []Operator{op.child}
+	case *Aggregator:
+		return []Operator{op.child}
+	case *EqualityJoin:
+		return []Operator{*op.left, *op.right}
+	case *InsertOp:
+		return []Operator{op.child}
+	case *DeleteOp:
+		return []Operator{op.child}
+	case *UpdateOp:
+		return []Operator{op.child}
+	case *DedupOp:
+		return []Operator{op.child}
+	case *SetOp:
+		return []Operator{op.left, op.right}
+	case *CachedResultOp:
+		return []Operator{op.child}
+	case *TopNOp:
+		return []Operator{op.child}
+	case *ReduceOp:
+		return []Operator{op.child}
+	case *CrossTabOp:
+		return []Operator{op.child}
+	case *MapOp:
+		return []Operator{op.child}
+	case *StatefulFilter:
+		return []Operator{op.child}
+	case *NullFilter:
+		return []Operator{op.child}
+	}
+	return nil
+}
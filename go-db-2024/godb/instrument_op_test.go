@@ -0,0 +1,58 @@
+package godb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInstrumentOpCounts(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars(t)
+	for i := 0; i < 5; i++ {
+		insertTupleForTest(t, hf, &t1, tid)
+		insertTupleForTest(t, hf, &t2, tid)
+	}
+
+	scan := NewInstrumentOp(hf)
+	filt, err := NewFilter(&ConstExpr{IntField{100}, IntType}, OpGt, &FieldExpr{t1.Desc.Fields[1]}, scan)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	lim := NewLimitOp(&ConstExpr{IntField{3}, IntType}, NewInstrumentOp(filt))
+	root := NewInstrumentOp(lim)
+
+	iter, err := root.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+	}
+
+	// the limit stops pulling at its limit, and the filter has to scan 6
+	// tuples to find 3 matching ones
+	expected := []InstrumentStats{
+		{Operator: "LimitOp", Depth: 0, Rows: 3},
+		{Operator: "Filter", Depth: 1, Rows: 3},
+		{Operator: "HeapFile", Depth: 2, Rows: 6},
+	}
+	stats := CollectInstrumentation(root)
+	if len(stats) != len(expected) {
+		t.Fatalf("expected %d instrumented operators, got %v", len(expected), stats)
+	}
+	for i, s := range stats {
+		if s.Operator != expected[i].Operator || s.Depth != expected[i].Depth || s.Rows != expected[i].Rows {
+			t.Errorf("expected %+v at %d, got %+v", expected[i], i, s)
+		}
+	}
+
+	report := ExplainAnalyze(root)
+	if !strings.HasPrefix(report, "LimitOp (rows=3") || !strings.Contains(report, "\n    HeapFile (rows=6") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+}
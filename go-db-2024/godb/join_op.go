@@ -1,5 +1,7 @@
 package godb
 
+import "fmt"
+
 type EqualityJoin struct {
 	// Expressions that when applied to tuples from the left or right operators,
 	// respectively, return the value of the left or right side of the join
@@ -10,17 +12,90 @@ type EqualityJoin struct {
 	// The maximum number of records of intermediate state that the join should
 	// use (only required for optional exercise).
 	maxBufferSize int
+
+	// if set, build the hash table on the right input instead of the left one
+	// when the whole right input fits in maxBufferSize records
+	chooseBuildSide bool
+
+	// which input the last iteration built its hash table on, and how many
+	// records it put into hash tables, for inspecting join plans
+	builtOnRight bool
+	buildRows    int
+
+	// the bucket sizes of the hash tables of the last iteration
+	keySkew JoinKeySkew
+}
+
+// JoinKeySkew describes how the records of the hash tables of an
+// [EqualityJoin] spread over their keys. A bucket holds the records of one key;
+// each tuple of the probe side is joined with every record of its bucket, so a
+// bucket much bigger than the others makes the join close to quadratic.
+type JoinKeySkew struct {
+	Rows      int         // the records put into the hash tables
+	Buckets   int         // the buckets of the hash tables, one per key and table
+	MaxBucket int         // the records of the biggest bucket
+	Sizes     map[int]int // the number of buckets of each size
 }
 
 // NewJoin Constructor for a join of integer expressions.
 //
-// Returns an error if either the left or right expression is not an integer.
+// Returns an error if either the left or right expression is not an integer,
+// or if maxBufferSize is not positive, as the join could not buffer any record.
 func NewJoin(left Operator, leftField Expr, right Operator, rightField Expr, maxBufferSize int) (*EqualityJoin, error) {
 	if leftField == nil || rightField == nil {
 		return nil, GoDBError{TypeMismatchError, "leftField and rightField must be non-nil"}
 	}
+	if maxBufferSize <= 0 {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("join maxBufferSize must be positive, got %d", maxBufferSize)}
+	}
 
-	return &EqualityJoin{leftField, rightField, &left, &right, maxBufferSize}, nil
+	return &EqualityJoin{leftField: leftField, rightField: rightField, left: &left, right: &right, maxBufferSize: maxBufferSize}, nil
+}
+
+// NewJoinChoosingBuildSide Constructor for a join like [NewJoin], which
+// builds its hash table on the smaller input. The right input is peeked at
+// first: if all of it fits in maxBufferSize records, it becomes the build side
+// and the left input is streamed past it once. Otherwise the join behaves as
+// one from [NewJoin]. Either way, output tuples are the left tuple's fields
+// followed by the right tuple's.
+func NewJoinChoosingBuildSide(left Operator, leftField Expr, right Operator, rightField Expr, maxBufferSize int) (*EqualityJoin, error) {
+	joinOp, err := NewJoin(left, leftField, right, rightField, maxBufferSize)
+	if err != nil {
+		return nil, err
+	}
+	joinOp.chooseBuildSide = true
+	return joinOp, nil
+}
+
+// BuiltOnRight Report whether the last iteration of the join built its hash
+// table on the right input.
+func (joinOp *EqualityJoin) BuiltOnRight() bool {
+	return joinOp.builtOnRight
+}
+
+// BuildRows Return the number of records the last iteration of the join put
+// into its hash tables.
+func (joinOp *EqualityJoin) BuildRows() int {
+	return joinOp.buildRows
+}
+
+// KeySkew Return the bucket sizes of the hash tables of the last iteration of
+// the join, as they are built during execution. When the build side does not
+// fit in maxBufferSize records, it is built in several hash tables, and their
+// buckets are all counted.
+func (joinOp *EqualityJoin) KeySkew() JoinKeySkew {
+	return joinOp.keySkew
+}
+
+// Count the buckets of the hash table joinBufMap in the key skew.
+func (joinOp *EqualityJoin) noteBuckets(joinBufMap map[any][]*Tuple) {
+	skew := &joinOp.keySkew
+	for _, bucket := range joinBufMap {
+		skew.Rows += len(bucket)
+		skew.Buckets++
+		skew.MaxBucket = max(skew.MaxBucket, len(bucket))
+		skew.Sizes[len(bucket)]++
+	}
 }
 
 // Descriptor Return a TupleDesc for this join. The returned descriptor should contain the
@@ -53,6 +128,33 @@ func (joinOp *EqualityJoin) Descriptor() *TupleDesc {
 func (joinOp *EqualityJoin) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error), err error) {
 	left := *joinOp.left
 	right := *joinOp.right
+	joinOp.builtOnRight = false
+	joinOp.buildRows = 0
+	joinOp.keySkew = JoinKeySkew{Sizes: make(map[int]int)}
+
+	if joinOp.chooseBuildSide {
+		var (
+			rightIter    func() (*Tuple, error)
+			rightScanEnd bool
+			rightBufMap  map[any][]*Tuple
+		)
+		rightIter, err = right.Iterator(tid)
+		if err != nil {
+			DPrintf("EqualityJoin Iterator get right iterator err: %v", err)
+			return
+		}
+		rightBufMap, err = joinOp.fillJoinBufMap(rightIter, joinOp.rightField, &rightScanEnd)
+		if err != nil {
+			return
+		}
+		if rightScanEnd {
+			joinOp.builtOnRight = true
+			joinOp.noteBuckets(rightBufMap)
+			return joinOp.probeLeftIterator(tid, rightBufMap)
+		}
+		// the right input is too big, build on the left one as usual
+		joinOp.buildRows = 0
+	}
 
 	leftIter, err := left.Iterator(tid)
 	if err != nil {
@@ -84,10 +186,11 @@ func (joinOp *EqualityJoin) Iterator(tid TransactionID) (iterFunc func() (*Tuple
 					return
 				}
 
-				joinBufMap, err = joinOp.fillJoinBufMap(leftIter, &leftScanEnd)
+				joinBufMap, err = joinOp.fillJoinBufMap(leftIter, joinOp.leftField, &leftScanEnd)
 				if err != nil {
 					return
 				}
+				joinOp.noteBuckets(joinBufMap)
 
 				rightIter, err = right.Iterator(tid)
 				if err != nil {
@@ -113,14 +216,14 @@ func (joinOp *EqualityJoin) Iterator(tid TransactionID) (iterFunc func() (*Tuple
 					return
 				}
 
-				matchTuples = joinBufMap[rightTmpVal]
+				matchTuples = joinBufMap[rightTmpVal.HashKey()]
 				if len(matchTuples) == 0 {
 					continue
 				}
 
 				validTupleCh = make(chan *Tuple, len(matchTuples))
 				for _, tuple := range matchTuples {
-					validTupleCh <- joinTuples(tuple, rightTuple)
+					validTupleCh <- joinPooledTuple(tuple, rightTuple)
 				}
 				reply = <-validTupleCh
 				return
@@ -133,37 +236,85 @@ func (joinOp *EqualityJoin) Iterator(tid TransactionID) (iterFunc func() (*Tuple
 	return
 }
 
+// ReleaseTuple Return a tuple produced by this join to the tuple pool. Callers
+// should only do so once they no longer hold any reference to it.
+func (joinOp *EqualityJoin) ReleaseTuple(t *Tuple) {
+	releasePooledTuple(t)
+}
+
+// Stream the left input once past a hash table holding all of the right input.
+func (joinOp *EqualityJoin) probeLeftIterator(tid TransactionID, rightBufMap map[any][]*Tuple) (iterFunc func() (*Tuple, error), err error) {
+	left := *joinOp.left
+	leftIter, err := left.Iterator(tid)
+	if err != nil {
+		DPrintf("EqualityJoin Iterator get left iterator err: %v", err)
+		return
+	}
+
+	var (
+		leftTuple   *Tuple
+		matchTuples []*Tuple
+	)
+	iterFunc = func() (*Tuple, error) {
+		for len(matchTuples) == 0 {
+			leftTuple, err = leftIter()
+			if err != nil {
+				DPrintf("EqualityJoin leftIter() err: %v", err)
+				return nil, err
+			}
+			if leftTuple == nil {
+				return nil, nil
+			}
+
+			leftTmpVal, err := joinOp.leftField.EvalExpr(leftTuple)
+			if err != nil {
+				DPrintf("EqualityJoin leftField EvalExpr err: %v", err)
+				return nil, err
+			}
+			matchTuples = rightBufMap[leftTmpVal.HashKey()]
+		}
+
+		reply := joinPooledTuple(leftTuple, matchTuples[0])
+		matchTuples = matchTuples[1:]
+		return reply, nil
+	}
+
+	return
+}
+
 // hash join:
 // Choose the bigger or has index table to be-driven table.
 // Fill the driver table fill into memory hash table(cap most maxBufferSize).
 // Iterate through the be-driven table and check each tuple in memory hash table.
 // If the be-driven table has been iter end, re fill the hash table by iter driver table.
 // Return until the driver table has been iter end.
-func (joinOp *EqualityJoin) fillJoinBufMap(leftIter func() (*Tuple, error), leftScanEnd *bool) (joinBufMap map[any][]*Tuple, err error) {
+func (joinOp *EqualityJoin) fillJoinBufMap(buildIter func() (*Tuple, error), buildField Expr, buildScanEnd *bool) (joinBufMap map[any][]*Tuple, err error) {
 	var (
 		tmpTuple *Tuple
 		tmpVal   DBValue
 	)
 	joinBufMap = make(map[any][]*Tuple, joinOp.maxBufferSize)
 	for i := 0; i < joinOp.maxBufferSize; i++ {
-		tmpTuple, err = leftIter()
+		tmpTuple, err = buildIter()
 		if err != nil {
-			DPrintf("EqualityJoin leftIter() err: %v", err)
+			DPrintf("EqualityJoin buildIter() err: %v", err)
 			return
 		}
 		if tmpTuple == nil {
-			DPrintf("EqualityJoin leftIter tuple first nil")
-			*leftScanEnd = true
+			DPrintf("EqualityJoin buildIter tuple first nil")
+			*buildScanEnd = true
 			break
 		}
 
-		tmpVal, err = joinOp.leftField.EvalExpr(tmpTuple)
+		tmpVal, err = buildField.EvalExpr(tmpTuple)
 		if err != nil {
-			DPrintf("EqualityJoin leftField EvalExpr err: %v", err)
+			DPrintf("EqualityJoin buildField EvalExpr err: %v", err)
 			return
 		}
 
-		joinBufMap[tmpVal] = append(joinBufMap[tmpVal], tmpTuple)
+		key := tmpVal.HashKey()
+		joinBufMap[key] = append(joinBufMap[key], tmpTuple)
+		joinOp.buildRows++
 	}
 
 	return
@@ -3,6 +3,7 @@ package godb
 import (
 	"fmt"
 	"os"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -314,3 +315,207 @@ func TestJoinTupleNil(t *testing.T) {
 		t.Fatalf("Unexpected output of joinTuple with nil")
 	}
 }
+
+func TestJoinReleaseTuple(t *testing.T) {
+	td, t1, t2, hf, bp, tid := makeTestVars(t)
+	os.Remove(JoinTestFile)
+	defer os.Remove(JoinTestFile)
+	hf2, err := NewHeapFile(JoinTestFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for i := 0; i < 20; i++ {
+		insertTupleForTest(t, hf, &t1, tid)
+		insertTupleForTest(t, hf, &t2, tid)
+	}
+	insertTupleForTest(t, hf2, &t1, tid)
+	insertTupleForTest(t, hf2, &t2, tid)
+
+	outT1 := joinTuples(&t1, &t1)
+	outT2 := joinTuples(&t2, &t2)
+	ageExpr := &FieldExpr{td.Fields[1]}
+	for _, chooseBuildSide := range []bool{false, true} {
+		newJoin := NewJoin
+		if chooseBuildSide {
+			newJoin = NewJoinChoosingBuildSide
+		}
+		join, err := newJoin(hf, ageExpr, hf2, ageExpr, 100)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		iter, err := join.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		cnt := 0
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				break
+			}
+			if !tup.equals(outT1) && !tup.equals(outT2) {
+				t.Fatalf("unexpected tuple after recycling: %v", tup)
+			}
+			cnt++
+			ReleaseTuple(join, tup)
+		}
+		if cnt != 40 {
+			t.Errorf("expected 40 tuples, got %d", cnt)
+		}
+	}
+
+	// recycling the joined tuples must leave the tuples of the inputs intact
+	iter, err := hf2.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatches(iter, []*Tuple{&t1, &t2}); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func TestJoinChoosesSmallBuildSide(t *testing.T) {
+	os.Remove(TestingFile)
+	os.Remove(JoinTestFile)
+	defer os.Remove(TestingFile)
+	defer os.Remove(JoinTestFile)
+
+	td, _, _ := makeTupleTestVars()
+	bp, err := NewBufferPool(50)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	bigHf, err := NewHeapFile(TestingFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	smallHf, err := NewHeapFile(JoinTestFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	const ntups = 2000
+	for i := 0; i < ntups; i++ {
+		tup := Tuple{td, []DBValue{StringField{fmt.Sprintf("big%d", i)}, IntField{int64(i % 10)}}, nil}
+		insertTupleForTest(t, bigHf, &tup, tid)
+	}
+	for i := 1; i <= 3; i++ {
+		tup := Tuple{td, []DBValue{StringField{fmt.Sprintf("small%d", i)}, IntField{int64(i)}}, nil}
+		insertTupleForTest(t, smallHf, &tup, tid)
+	}
+
+	ageField := FieldExpr{td.Fields[1]}
+	join, err := NewJoinChoosingBuildSide(bigHf, &ageField, smallHf, &ageField, 100)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := join.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !join.BuiltOnRight() || join.BuildRows() != 3 {
+		t.Fatalf("expected a hash table of the 3 right tuples, built on right %t with %d tuples", join.BuiltOnRight(), join.BuildRows())
+	}
+
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		if !tup.Desc.equals(join.Descriptor()) {
+			t.Fatalf("unexpected output descriptor %v", tup.Desc)
+		}
+		left := tup.Fields[1].(IntField).Value
+		right := tup.Fields[3].(IntField).Value
+		if left != right || left < 1 || left > 3 || tup.Fields[2].(StringField).Value != fmt.Sprintf("small%d", right) {
+			t.Fatalf("unexpected join result %v", tup)
+		}
+		cnt++
+	}
+	if cnt != 3*ntups/10 {
+		t.Errorf("unexpected number of join results (%d, expected %d)", cnt, 3*ntups/10)
+	}
+
+	// a right input that does not fit the buffer is not used as the build side
+	join, err = NewJoinChoosingBuildSide(smallHf, &ageField, bigHf, &ageField, 100)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := join.Iterator(tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if join.BuiltOnRight() {
+		t.Errorf("expected the hash table to be built on the small left input")
+	}
+}
+
+func TestJoinNonPositiveBufferSize(t *testing.T) {
+	td, _, _, hf, _, _ := makeTestVars(t)
+	ageField := FieldExpr{td.Fields[1]}
+	for _, size := range []int{0, -5} {
+		if _, err := NewJoin(hf, &ageField, hf, &ageField, size); err == nil {
+			t.Errorf("expected an error for maxBufferSize %d", size)
+		}
+		if _, err := NewJoinChoosingBuildSide(hf, &ageField, hf, &ageField, size); err == nil {
+			t.Errorf("expected an error for maxBufferSize %d when choosing the build side", size)
+		}
+	}
+}
+
+func TestJoinKeySkew(t *testing.T) {
+	// key 7 holds 51 of the 60 left tuples
+	var vals []int64
+	for i := 0; i < 50; i++ {
+		vals = append(vals, 7)
+	}
+	for i := int64(1); i <= 10; i++ {
+		vals = append(vals, i)
+	}
+	left := newIntsOp(vals...)
+	right := newIntsOp(7, 3)
+	field := &FieldExpr{left.Descriptor().Fields[0]}
+
+	for _, c := range []struct {
+		maxBufferSize int
+		expected      JoinKeySkew
+	}{
+		{100, JoinKeySkew{Rows: 60, Buckets: 10, MaxBucket: 51, Sizes: map[int]int{1: 9, 51: 1}}},
+		// built in three tables: 25 sevens, 25 sevens, then one of each key
+		{25, JoinKeySkew{Rows: 60, Buckets: 12, MaxBucket: 25, Sizes: map[int]int{1: 10, 25: 2}}},
+	} {
+		join, err := NewJoin(left, field, right, field, c.maxBufferSize)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		iter, err := join.Iterator(NewTID())
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		cnt := 0
+		for {
+			tuple, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tuple == nil {
+				break
+			}
+			cnt++
+		}
+		if cnt != 52 {
+			t.Errorf("maxBufferSize %d: expected 52 joined tuples, got %d", c.maxBufferSize, cnt)
+		}
+		if skew := join.KeySkew(); !reflect.DeepEqual(skew, c.expected) {
+			t.Errorf("maxBufferSize %d: expected %+v, got %+v", c.maxBufferSize, c.expected, skew)
+		}
+	}
+}
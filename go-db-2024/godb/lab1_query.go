@@ -52,7 +52,9 @@ func computeFieldSum(bp *BufferPool, fileName string, td TupleDesc, sumField str
 		return
 	}
 
-	iter, err := heapFile.Iterator(0)
+	tid := bp.NewTransaction()
+	defer bp.CommitTransaction(tid)
+	iter, err := heapFile.Iterator(tid)
 	if err != nil {
 		DPrintf("computeFieldSum get Iterator error: %v", err)
 		return
@@ -30,7 +30,9 @@ func (l *LimitOp) Descriptor() *TupleDesc {
 
 // Iterator Limit operator implementation. This function should iterate over the results
 // of the child iterator, and limit the result set to the first [lim] tuples it
-// sees (where lim is specified in the constructor).
+// sees (where lim is specified in the constructor). The child is not called
+// again once the limit is reached, so an expensive child, e.g., a distinct
+// [Project], does no work past the tuples returned.
 func (l *LimitOp) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error), err error) {
 	childIter, err := l.child.Iterator(tid)
 	if err != nil {
@@ -39,24 +41,16 @@ func (l *LimitOp) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error),
 
 	var count int64
 	iterFunc = func() (reply *Tuple, err error) {
-		var tuple *Tuple
-		for {
-			tuple, err = childIter()
-			if err != nil {
-				return
-			}
-			if tuple == nil {
-				return
-			}
-
-			if count >= l.limit {
-				return
-			}
-
-			reply = tuple
-			count++
+		if count >= l.limit {
 			return
 		}
+
+		reply, err = childIter()
+		if err != nil || reply == nil {
+			return
+		}
+		count++
+		return
 	}
 	return
 }
@@ -77,3 +77,27 @@ func TestLimit50(t *testing.T) {
 func TestLimit100(t *testing.T) {
 	testLimitCount(t, 100)
 }
+
+func TestLimitStopsPullingAtCap(t *testing.T) {
+	child := NewInstrumentOp(newIntsOp(1, 1, 2, 2, 2, 3, 4, 4, 5))
+	proj, err := NewProjectOp([]Expr{&FieldExpr{child.Descriptor().Fields[0]}}, []string{"n"}, true, child)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	lim := NewLimitOp(IntConst(3), proj)
+	iter, err := lim.Iterator(NewTID())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var expected []*Tuple
+	for _, v := range []int64{1, 2, 3} {
+		expected = append(expected, &Tuple{*proj.Descriptor(), []DBValue{IntField{v}}, nil})
+	}
+	if err := CheckIfOutputMatches(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// 1, 1, 2, 2, 2, 3: the three distinct values and their duplicates before 3
+	if rows := child.Rows(); rows != 6 {
+		t.Errorf("expected the child to be pulled 6 times, got %d", rows)
+	}
+}
@@ -0,0 +1,55 @@
+package godb
+
+// MapFunc transforms a tuple of a [MapOp]'s child into an output tuple
+type MapFunc func(t *Tuple) (*Tuple, error)
+
+type MapOp struct {
+	child   Operator
+	fn      MapFunc
+	outDesc *TupleDesc
+}
+
+// NewMapOp Construct an operator applying fn to every tuple of child, for
+// per-tuple transformations that a [Project] cannot express, e.g., normalizing
+// a string or bucketing a number. outDesc is the TupleDesc of the tuples fn
+// returns; their own descriptor is replaced by it.
+func NewMapOp(child Operator, fn MapFunc, outDesc *TupleDesc) *MapOp {
+	return &MapOp{child, fn, outDesc}
+}
+
+// Descriptor Return the TupleDesc given to the constructor.
+func (m *MapOp) Descriptor() *TupleDesc {
+	return m.outDesc
+}
+
+// Iterator Return fn applied to the tuples of the child, in order. An error of
+// fn is returned as the error of the iteration, as is a nil tuple from fn.
+func (m *MapOp) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error), err error) {
+	childIter, err := m.child.Iterator(tid)
+	if err != nil {
+		DPrintf("MapOp Iterator get child iterator err: %v", err)
+		return
+	}
+
+	iterFunc = func() (*Tuple, error) {
+		tuple, err := childIter()
+		if err != nil {
+			DPrintf("MapOp Iterator childIter() err: %v", err)
+			return nil, err
+		}
+		if tuple == nil {
+			return nil, nil
+		}
+		reply, err := m.fn(tuple)
+		if err != nil {
+			DPrintf("MapOp Iterator fn err: %v", err)
+			return nil, err
+		}
+		if reply == nil {
+			return nil, GoDBError{IllegalOperationError, "map function returned no tuple"}
+		}
+		reply.Desc = *m.outDesc
+		return reply, nil
+	}
+	return
+}
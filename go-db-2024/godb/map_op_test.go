@@ -0,0 +1,55 @@
+package godb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMapOpTransform(t *testing.T) {
+	td, t1, t2, hf, _, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+
+	// upper-case the name, and bucket the age by hundreds
+	outDesc := &TupleDesc{[]FieldType{{"name", "", StringType}, {"age_bucket", "", IntType}}}
+	fn := func(tup *Tuple) (*Tuple, error) {
+		name := strings.ToUpper(tup.Fields[0].(StringField).Value)
+		bucket := tup.Fields[1].(IntField).Value / 100 * 100
+		return &Tuple{Fields: []DBValue{StringField{name}, IntField{bucket}}}, nil
+	}
+	op := NewMapOp(hf, fn, outDesc)
+	if !op.Descriptor().equals(outDesc) {
+		t.Fatalf("expected descriptor %v, got %v", outDesc, op.Descriptor())
+	}
+	iter, err := op.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := []*Tuple{
+		{*outDesc, []DBValue{StringField{"SAM"}, IntField{0}}, nil},
+		{*outDesc, []DBValue{StringField{"GEORGE JONES"}, IntField{900}}, nil},
+	}
+	if err := CheckIfOutputMatches(iter, expected); err != nil {
+		t.Errorf(err.Error())
+	}
+
+	// the error of fn ends the iteration
+	errBad := errors.New("bad tuple")
+	op = NewMapOp(hf, func(tup *Tuple) (*Tuple, error) {
+		if tup.Fields[1].(IntField).Value > 100 {
+			return nil, errBad
+		}
+		return tup, nil
+	}, &td)
+	iter, err = op.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup, err := iter(); err != nil || tup == nil {
+		t.Fatalf("expected the first tuple, got %v, %v", tup, err)
+	}
+	if _, err := iter(); !errors.Is(err, errBad) {
+		t.Errorf("expected the error of the map function, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package godb
+
+import "slices"
+
+// A MaterializedView is a heap file holding the result of a query over a base
+// table. Scanning the view reads the stored result rather than running the
+// query; [MaterializedView.Refresh] runs the query again and replaces the
+// stored result. The view becomes dirty when the base table is written to after
+// the last refresh.
+type MaterializedView struct {
+	query Operator
+	base  *HeapFile
+	file  *HeapFile
+
+	refreshedAt int64 // the write count of base at the last refresh
+}
+
+// NewMaterializedView Construct a view of query, a query over base, stored in
+// the heap file fromFile, and fill it within transaction tid.
+//
+// Returns an error if fromFile cannot be opened or the query fails.
+func NewMaterializedView(fromFile string, query Operator, base *HeapFile, bp *BufferPool, tid TransactionID) (*MaterializedView, error) {
+	file, err := NewHeapFile(fromFile, query.Descriptor(), bp)
+	if err != nil {
+		return nil, err
+	}
+	v := &MaterializedView{query: query, base: base, file: file}
+	if err := v.Refresh(tid); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Descriptor Return the TupleDesc of the query.
+func (v *MaterializedView) Descriptor() *TupleDesc {
+	return v.file.Descriptor()
+}
+
+// Iterator Return the stored result of the query, which is stale if the view
+// is dirty.
+func (v *MaterializedView) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	return v.file.Iterator(tid)
+}
+
+// Dirty Report whether the base table has been written to since the last
+// refresh.
+func (v *MaterializedView) Dirty() bool {
+	return v.base.writeCount() != v.refreshedAt
+}
+
+// Refresh Run the query within transaction tid, and replace the stored result
+// with its output, which makes the view clean. On error the view is left dirty,
+// with a partial result that aborting tid rolls back.
+func (v *MaterializedView) Refresh(tid TransactionID) error {
+	// the base writes the query sees; later ones make the view dirty again
+	writes := v.base.writeCount()
+
+	iter, err := v.file.Iterator(tid)
+	if err != nil {
+		return err
+	}
+	var stale []*Tuple
+	for {
+		tuple, err := iter()
+		if err != nil {
+			DPrintf("MaterializedView Refresh iter() err: %v", err)
+			return err
+		}
+		if tuple == nil {
+			break
+		}
+		stale = append(stale, tuple)
+	}
+	for _, tuple := range stale {
+		if err := v.file.deleteTuple(tuple, tid); err != nil {
+			DPrintf("MaterializedView Refresh deleteTuple err: %v", err)
+			return err
+		}
+	}
+
+	queryIter, err := v.query.Iterator(tid)
+	if err != nil {
+		DPrintf("MaterializedView Refresh get query iterator err: %v", err)
+		return err
+	}
+	desc := v.Descriptor()
+	for {
+		tuple, err := queryIter()
+		if err != nil {
+			DPrintf("MaterializedView Refresh queryIter() err: %v", err)
+			return err
+		}
+		if tuple == nil {
+			break
+		}
+		// the page keeps the fields, while the query may reuse tuple's
+		if err := v.file.insertTuple(&Tuple{*desc, slices.Clone(tuple.Fields), nil}, tid); err != nil {
+			DPrintf("MaterializedView Refresh insertTuple err: %v", err)
+			return err
+		}
+	}
+	v.refreshedAt = writes
+	return nil
+}
@@ -0,0 +1,66 @@
+package godb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMaterializedViewRefresh(t *testing.T) {
+	const viewFile = "view_test.dat"
+	os.Remove(viewFile)
+	defer os.Remove(viewFile)
+
+	_, t1, t2, hf, bp, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+
+	// SELECT name, SUM(age) FROM t WHERE age < 500 GROUP BY name
+	name, age := &FieldExpr{t1.Desc.Fields[0]}, &FieldExpr{t1.Desc.Fields[1]}
+	sa := SumAggState{}
+	if err := sa.Init("sum", age); err != nil {
+		t.Fatalf(err.Error())
+	}
+	filt, err := NewFilter(IntConst(500), OpLt, age, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	query := NewGroupedAggregator([]AggState{&sa}, []Expr{name}, filt)
+
+	view, err := NewMaterializedView(viewFile, query, hf, bp, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkView := func(sams ...int64) {
+		t.Helper()
+		var expected []*Tuple
+		for _, sum := range sams {
+			expected = append(expected, &Tuple{*view.Descriptor(), []DBValue{StringField{"sam"}, IntField{sum}}, nil})
+		}
+		iter, err := view.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := CheckIfOutputMatchesUnordered(iter, expected); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	checkView(25)
+	if view.Dirty() {
+		t.Fatalf("expected a fresh view to be clean")
+	}
+
+	t3 := Tuple{t1.Desc, []DBValue{StringField{"sam"}, IntField{30}}, nil}
+	insertTupleForTest(t, hf, &t3, tid)
+	if !view.Dirty() {
+		t.Fatalf("expected the view to be dirty after the base changed")
+	}
+	checkView(25)
+
+	if err := view.Refresh(tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if view.Dirty() {
+		t.Fatalf("expected the view to be clean after a refresh")
+	}
+	checkView(55)
+}
@@ -22,6 +22,11 @@ func (mp *MemPage) getFile() DBFile {
 	return mp.file
 }
 
+// A MemPage holds a single tuple, so it is always full
+func (mp *MemPage) NumFreeSlots() int {
+	return 0
+}
+
 func (mf *MemFile) NumPages() int {
 	return len(mf.pages)
 }
@@ -0,0 +1,17 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package godb
+
+import (
+	"os"
+)
+
+// Memory maps are not supported on this platform: heap files read their pages
+// from the file.
+func mmapFile(file *os.File, size int) ([]byte, error) {
+	return nil, GoDBError{IllegalOperationError, "memory maps are not supported on this platform"}
+}
+
+func munmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package godb
+
+import (
+	"os"
+	"syscall"
+)
+
+// Map the first size bytes of file into memory, read-only and shared, so that
+// writes to the file are seen through the map.
+func mmapFile(file *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// Release a map returned by mmapFile.
+func munmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
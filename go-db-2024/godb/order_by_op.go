@@ -1,13 +1,38 @@
 package godb
 
 import (
+	"container/heap"
+	"fmt"
+	"os"
+	"slices"
 	"sort"
+	"strings"
 )
 
+// sortRunPoolPages is the size of the buffer pool holding the pages of the
+// spilled runs of an external sort. Merging needs only the current page of
+// every run; the others are read back from disk as needed.
+const sortRunPoolPages = 8
+
 type OrderBy struct {
 	orderBy   []Expr // OrderBy should include these two fields (used by parser)
 	child     Operator
 	ascending []bool
+
+	// if positive, the most tuples sorted in memory at once; larger inputs
+	// are sorted in runs of runSize tuples spilled to temporary heap files in
+	// tempDir, which are then merged
+	runSize int
+	tempDir string
+	runs    []sortRun // the sorted runs of the last iteration
+}
+
+// A sorted run of an external sort: a temporary heap file, or, if some of its
+// tuples would not read back the same from a heap page, the tuples themselves.
+type sortRun struct {
+	file   string
+	heap   *HeapFile // the file opened to merge the run, until it is read
+	tuples []*Tuple
 }
 
 // NewOrderBy Construct an order by operator. Saves the list of field, child, and ascending
@@ -29,6 +54,72 @@ func NewOrderBy(orderByFields []Expr, child Operator, ascending []bool) (order *
 
 }
 
+// NewOrderByWithRunSize Construct an order by operator like [NewOrderBy], which
+// sorts at most runSize tuples in memory at once. A larger input is sorted
+// externally: it is split into sorted runs of runSize tuples, each written to a
+// temporary heap file, and the runs are merged with [MergeIterators]. The
+// temporary files are removed once the output has been read in full, or by
+// [OrderBy.Close]. Tuples read back from the runs have no record ids.
+//
+// A heap page stores strings padded to StringLength, so a run holding a string
+// longer than StringLength, or with leading or trailing spaces, is kept in
+// memory rather than spilled; the iterator fails if the runs kept in memory
+// would hold more than runSize tuples. NULLs are spilled, see [sortRunDesc].
+func NewOrderByWithRunSize(orderByFields []Expr, child Operator, ascending []bool, runSize int) (*OrderBy, error) {
+	if runSize <= 0 {
+		return nil, GoDBError{IllegalOperationError, "order by run size must be positive"}
+	}
+	order, err := NewOrderBy(orderByFields, child, ascending)
+	if err != nil {
+		return nil, err
+	}
+	order.runSize = runSize
+	order.tempDir = os.TempDir()
+	return order, nil
+}
+
+// Close Remove the temporary files of the runs of the last iteration, if its
+// output was not read in full.
+func (o *OrderBy) Close() error {
+	var firstErr error
+	for i, run := range o.runs {
+		if run.file == "" {
+			continue
+		}
+		if err := o.closeRunFile(i); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if err := os.Remove(run.file); err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	o.runs = nil
+	return firstErr
+}
+
+// Close the heap file of run i, if it is open.
+func (o *OrderBy) closeRunFile(i int) error {
+	run := o.runs[i].heap
+	if run == nil {
+		return nil
+	}
+	o.runs[i].heap = nil
+	if err := run.Close(); err != nil {
+		DPrintf("OrderBy run %s Close err: %v", o.runs[i].file, err)
+		return err
+	}
+	return nil
+}
+
+// Remove the runs of an iteration that failed with err, which is returned: a
+// failure to remove them is only logged.
+func (o *OrderBy) closeAfter(err error) error {
+	if closeErr := o.Close(); closeErr != nil {
+		DPrintf("OrderBy Close err: %v, after err: %v", closeErr, err)
+	}
+	return err
+}
+
 // Descriptor Return the tuple descriptor.
 //
 // Note that the order by just changes the order of the child tuples, not the
@@ -52,15 +143,25 @@ func (o *OrderBy) Descriptor() *TupleDesc {
 func (o *OrderBy) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error), err error) {
 	childIter, err := o.child.Iterator(tid)
 	if err != nil {
+		DPrintf("OrderBy Iterator get child iterator err: %v", err)
 		return
 	}
 
+	if o.runSize > 0 {
+		return o.externalSortIterator(childIter)
+	}
+
 	var tup *Tuple
 	var allTuples []*Tuple
 	for {
 		tup, err = childIter()
 		if err != nil {
-			return
+			// nothing will be sorted, so hand the tuples read so far back
+			DPrintf("OrderBy Iterator childIter() err after %d tuples: %v", len(allTuples), err)
+			for _, t := range allTuples {
+				ReleaseTuple(o.child, t)
+			}
+			return nil, err
 		}
 		if tup == nil {
 			break
@@ -69,7 +170,9 @@ func (o *OrderBy) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error),
 		allTuples = append(allTuples, tup)
 	}
 
-	sort.Sort(sortTuples{allTuples, o.orderBy, o.ascending})
+	// a stable sort keeps tuples with equal keys in the order the child returned
+	// them, so that the output is deterministic
+	sort.Stable(sortTuples{allTuples, o.orderBy, o.ascending})
 
 	var index int
 	iterFunc = func() (reply *Tuple, err error) {
@@ -95,9 +198,12 @@ func (s sortTuples) Len() int {
 }
 
 func (s sortTuples) Less(i, j int) bool {
-	iTup := s.allTuples[i]
-	jTup := s.allTuples[j]
-	for index, expr := range s.orderBy {
+	return tupleLess(s.allTuples[i], s.allTuples[j], s.orderBy, s.ascending)
+}
+
+// Report whether iTup sorts before jTup by the orderBy expressions.
+func tupleLess(iTup, jTup *Tuple, orderBy []Expr, ascending []bool) bool {
+	for index, expr := range orderBy {
 		iVal, err := expr.EvalExpr(iTup)
 		if err != nil {
 			return false
@@ -108,11 +214,20 @@ func (s sortTuples) Less(i, j int) bool {
 			return false
 		}
 
+		ascend := ascending[index]
+		if iInt, ok := iVal.(IntField); ok {
+			if jInt, ok := jVal.(IntField); ok {
+				if iInt.Value == jInt.Value {
+					continue
+				}
+				return (iInt.Value < jInt.Value) == ascend
+			}
+		}
+
 		if iVal.EvalPred(jVal, OpEq) {
 			continue
 		}
 
-		ascend := s.ascending[index]
 		less := iVal.EvalPred(jVal, OpLt)
 		if ascend && less || !ascend && !less {
 			return true
@@ -127,3 +242,352 @@ func (s sortTuples) Less(i, j int) bool {
 func (s sortTuples) Swap(i, j int) {
 	s.allTuples[i], s.allTuples[j] = s.allTuples[j], s.allTuples[i]
 }
+
+// Sort the tuples of childIter in runs of o.runSize tuples spilled to temporary
+// heap files, and return an iterator merging the runs. An input of at most
+// o.runSize tuples is sorted in memory without spilling.
+func (o *OrderBy) externalSortIterator(childIter func() (*Tuple, error)) (iterFunc func() (*Tuple, error), err error) {
+	// the runs of a previous iteration that was not read in full
+	if err = o.Close(); err != nil {
+		DPrintf("OrderBy Iterator Close err: %v", err)
+		return nil, err
+	}
+
+	// spilled pages go through a buffer pool of their own, so that sorting
+	// does not evict the pages of the tables
+	runPool, err := NewBufferPool(sortRunPoolPages)
+	if err != nil {
+		return
+	}
+	desc := o.Descriptor()
+
+	var batch []*Tuple
+	for {
+		var tup *Tuple
+		tup, err = childIter()
+		if err != nil {
+			DPrintf("OrderBy Iterator childIter() err after %d tuples: %v", len(batch), err)
+			for _, t := range batch {
+				ReleaseTuple(o.child, t)
+			}
+			return nil, o.closeAfter(err)
+		}
+		if tup != nil {
+			batch = append(batch, tup)
+			if len(batch) <= o.runSize {
+				continue
+			}
+		}
+		if tup == nil && len(o.runs) == 0 {
+			// the whole input fits in memory
+			sort.Stable(sortTuples{batch, o.orderBy, o.ascending})
+			return sliceIterator(batch), nil
+		}
+
+		// spill all but the tuple that overflowed the run
+		var spill []*Tuple
+		if tup != nil {
+			spill, batch = batch[:len(batch)-1], batch[len(batch)-1:]
+		} else {
+			spill, batch = batch, nil
+		}
+		if err = o.spillRun(spill, desc, runPool); err != nil {
+			return nil, o.closeAfter(err)
+		}
+		if tup == nil {
+			break
+		}
+	}
+
+	tid := NewTID()
+	runDesc := sortRunDesc(desc)
+	runIters := make([]func() (*Tuple, error), 0, len(o.runs))
+	for i, sr := range o.runs {
+		if sr.file == "" {
+			runIters = append(runIters, sliceIterator(sr.tuples))
+			continue
+		}
+		o.runs[i].heap, err = NewHeapFile(sr.file, runDesc, runPool)
+		if err != nil {
+			return nil, o.closeAfter(err)
+		}
+		var runIter func() (*Tuple, error)
+		runIter, err = o.runs[i].heap.Iterator(tid)
+		if err != nil {
+			return nil, o.closeAfter(err)
+		}
+		runIters = append(runIters, o.decodeRun(i, runIter, desc))
+	}
+
+	mergeIter := MergeIterators(runIters, o.orderBy, o.ascending)
+	return func() (*Tuple, error) {
+		tuple, err := mergeIter()
+		if err != nil {
+			return nil, o.closeAfter(err)
+		}
+		if tuple == nil {
+			return nil, o.Close()
+		}
+		tuple.Rid = nil
+		return tuple, nil
+	}, nil
+}
+
+// Return an iterator over the tuples of desc in run i, read by runIter, which
+// closes the heap file of the run once it is read in full.
+func (o *OrderBy) decodeRun(i int, runIter func() (*Tuple, error), desc *TupleDesc) func() (*Tuple, error) {
+	return func() (*Tuple, error) {
+		tuple, err := runIter()
+		if err != nil || tuple == nil {
+			if closeErr := o.closeRunFile(i); err == nil {
+				err = closeErr
+			}
+			return nil, err
+		}
+		return decodeRunTuple(tuple, desc), nil
+	}
+}
+
+// sortRunNullsField is the name of the field of the NULL bitmap of the tuples
+// of a spilled run, see [sortRunDesc].
+const sortRunNullsField = "nulls"
+
+// Return the descriptor of the spilled runs of tuples of desc: its fields,
+// then an int bitmap of the fields of the tuple that are NULL, which a heap page
+// can not store. A NULL field is written as the zero value of its type.
+func sortRunDesc(desc *TupleDesc) *TupleDesc {
+	fields := slices.Clip(slices.Clone(desc.Fields))
+	return &TupleDesc{append(fields, FieldType{sortRunNullsField, "", IntType})}
+}
+
+// Return t as a tuple of the spilled run descriptor of its descriptor desc.
+func encodeRunTuple(t *Tuple, desc *TupleDesc, runDesc *TupleDesc) *Tuple {
+	// the page keeps the fields, while the child may reuse t's
+	fields := make([]DBValue, len(t.Fields), len(t.Fields)+1)
+	var nulls int64
+	for i, field := range t.Fields {
+		if _, isNull := field.(NullField); isNull {
+			nulls |= 1 << i
+			field, _ = zeroValue(desc.Fields[i].Ftype)
+		}
+		fields[i] = field
+	}
+	return &Tuple{*runDesc, append(fields, IntField{nulls}), nil}
+}
+
+// Return t, a tuple read back from a spilled run, as a tuple of desc.
+func decodeRunTuple(t *Tuple, desc *TupleDesc) *Tuple {
+	n := len(desc.Fields)
+	nulls := t.Fields[n].(IntField).Value
+	fields := t.Fields[:n:n]
+	if nulls != 0 {
+		// the fields of t are those of the cached page
+		fields = slices.Clone(fields)
+		for i := range fields {
+			if nulls&(1<<i) != 0 {
+				fields[i] = NullField{}
+			}
+		}
+	}
+	return &Tuple{*desc, fields, nil}
+}
+
+// Return the zero value of a field of type t, and whether t has one.
+func zeroValue(t DBType) (DBValue, bool) {
+	switch t.kind() {
+	case IntType:
+		return IntField{0}, true
+	case StringType:
+		return StringField{""}, true
+	case BoolType:
+		return BoolField{false}, true
+	case DecimalType:
+		return DecimalField{0, t.Scale()}, true
+	}
+	return nil, false
+}
+
+// Sort tuples and write them to a new temporary heap file, recorded as a run.
+// The tuples are handed back to the child once written. If some tuple would
+// not read back the same from a heap page, the sorted tuples are recorded as
+// a run kept in memory instead, unless the runs kept in memory would then hold
+// more than o.runSize tuples, in which case an error is returned.
+func (o *OrderBy) spillRun(tuples []*Tuple, desc *TupleDesc, runPool *BufferPool) (err error) {
+	sort.Stable(sortTuples{tuples, o.orderBy, o.ascending})
+	if slices.ContainsFunc(tuples, func(t *Tuple) bool { return !roundTrips(t) }) {
+		resident := len(tuples)
+		for _, run := range o.runs {
+			resident += len(run.tuples)
+		}
+		if resident > o.runSize {
+			return GoDBError{IllegalOperationError, fmt.Sprintf("order by would keep %d tuples in memory, more than its run size of %d: strings longer than %d bytes or with leading or trailing spaces can not be spilled", resident, o.runSize, StringLength)}
+		}
+		o.runs = append(o.runs, sortRun{tuples: tuples})
+		return nil
+	}
+
+	file, err := os.CreateTemp(o.tempDir, "godb-sort-run-*.dat")
+	if err != nil {
+		DPrintf("OrderBy spillRun CreateTemp err: %v", err)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		DPrintf("OrderBy spillRun Close err: %v", err)
+		return err
+	}
+	o.runs = append(o.runs, sortRun{file: file.Name()})
+
+	runDesc := sortRunDesc(desc)
+	run, err := NewHeapFile(file.Name(), runDesc, runPool)
+	if err != nil {
+		return err
+	}
+	// the run is only read back once the input is spilled, through another
+	// HeapFile: close this one so that it does not keep the file open
+	defer func() {
+		if closeErr := run.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	tid := NewTID()
+	for _, t := range tuples {
+		if err := run.insertTuple(encodeRunTuple(t, desc, runDesc), tid); err != nil {
+			DPrintf("OrderBy spillRun insertTuple err: %v", err)
+			return err
+		}
+		ReleaseTuple(o.child, t)
+		// runs are appended to in order, so only the last page is ever dirty
+		if len(run.freeSpace) == 0 {
+			runPool.FlushAllPages()
+		}
+	}
+	runPool.FlushAllPages()
+	return nil
+}
+
+// Report whether t reads back the same after being written to a spilled run,
+// which pads strings to StringLength, trimming them when read, and stores
+// NULLs in a bitmap of at most 63 fields, see [sortRunDesc].
+func roundTrips(t *Tuple) bool {
+	for i, field := range t.Desc.Fields {
+		switch v := t.Fields[i].(type) {
+		case NullField:
+			if _, ok := zeroValue(field.Ftype); !ok || i >= 63 {
+				return false
+			}
+		case StringField:
+			if field.Ftype != StringType || len(v.Value) > StringLength || strings.TrimSpace(v.Value) != v.Value {
+				return false
+			}
+		case IntField:
+			if field.Ftype != IntType {
+				return false
+			}
+		case BoolField:
+			if field.Ftype != BoolType {
+				return false
+			}
+		case DecimalField:
+			if field.Ftype.kind() != DecimalType {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Return an iterator over the tuples of a slice.
+func sliceIterator(tuples []*Tuple) func() (*Tuple, error) {
+	var index int
+	return func() (*Tuple, error) {
+		if index >= len(tuples) {
+			return nil, nil
+		}
+		index++
+		return tuples[index-1], nil
+	}
+}
+
+// MergeIterators Merge iterators that each return tuples sorted by the orderBy
+// expressions (ascending or descending per ascending, as for [NewOrderBy]) into
+// one sorted iterator. Tuples that sort equal are returned in the order of the
+// iterators they come from, so merging the sorted runs of an input keeps the
+// merge stable.
+func MergeIterators(iters []func() (*Tuple, error), orderBy []Expr, ascending []bool) func() (*Tuple, error) {
+	h := &mergeHeap{orderBy: orderBy, ascending: ascending}
+	started := false
+	return func() (*Tuple, error) {
+		if !started {
+			started = true
+			for index, iter := range iters {
+				tuple, err := iter()
+				if err != nil {
+					return nil, err
+				}
+				if tuple != nil {
+					h.items = append(h.items, mergeItem{tuple, index})
+				}
+			}
+			heap.Init(h)
+		}
+
+		if h.Len() == 0 {
+			return nil, nil
+		}
+		reply := h.items[0]
+		next, err := iters[reply.iter]()
+		if err != nil {
+			return nil, err
+		}
+		if next != nil {
+			h.items[0].tuple = next
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+		return reply.tuple, nil
+	}
+}
+
+// the next tuple of one of the merged iterators
+type mergeItem struct {
+	tuple *Tuple
+	iter  int
+}
+
+// mergeHeap is a [heap.Interface] of the next tuples of merged iterators
+type mergeHeap struct {
+	items     []mergeItem
+	orderBy   []Expr
+	ascending []bool
+}
+
+func (h *mergeHeap) Len() int {
+	return len(h.items)
+}
+
+func (h *mergeHeap) Less(i, j int) bool {
+	if tupleLess(h.items[i].tuple, h.items[j].tuple, h.orderBy, h.ascending) {
+		return true
+	}
+	if tupleLess(h.items[j].tuple, h.items[i].tuple, h.orderBy, h.ascending) {
+		return false
+	}
+	return h.items[i].iter < h.items[j].iter
+}
+
+func (h *mergeHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+}
+
+func (h *mergeHeap) Push(x any) {
+	h.items = append(h.items, x.(mergeItem))
+}
+
+func (h *mergeHeap) Pop() any {
+	reply := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return reply
+}
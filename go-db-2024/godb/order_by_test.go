@@ -1,7 +1,12 @@
 package godb
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -232,3 +237,317 @@ func TestOrderByFieldsOrder(t *testing.T) {
 		t.Fatalf("Unexpected descriptor of ordered tuple")
 	}
 }
+
+func TestOrderByStableTies(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeTestVars(t)
+	var expected []string
+	for key := 0; key < 3; key++ {
+		for i := key; i < 60; i += 3 {
+			expected = append(expected, fmt.Sprintf("n%d", i))
+		}
+	}
+	for i := 0; i < 60; i++ {
+		tup := Tuple{t1.Desc, []DBValue{StringField{fmt.Sprintf("n%d", i)}, IntField{int64(i % 3)}}, nil}
+		insertTupleForTest(t, hf, &tup, tid)
+	}
+	bp.FlushAllPages()
+
+	oby, err := NewOrderBy([]Expr{&FieldExpr{t1.Desc.Fields[1]}}, hf, []bool{true})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for run := 0; run < 5; run++ {
+		iter, err := oby.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var names []string
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				break
+			}
+			names = append(names, tup.Fields[0].(StringField).Value)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(expected) {
+			t.Fatalf("run %d: expected tied tuples in scan order %v, got %v", run, expected, names)
+		}
+	}
+}
+
+// errAfterOp returns n tuples of its child and then fails, counting the tuples
+// released back to it
+type errAfterOp struct {
+	child    Operator
+	n        int
+	released int
+}
+
+var errChildFailed = errors.New("child failed")
+
+func (e *errAfterOp) Descriptor() *TupleDesc {
+	return e.child.Descriptor()
+}
+
+func (e *errAfterOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	iter, err := e.child.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	cnt := 0
+	return func() (*Tuple, error) {
+		if cnt >= e.n {
+			return nil, errChildFailed
+		}
+		cnt++
+		return iter()
+	}, nil
+}
+
+func (e *errAfterOp) ReleaseTuple(t *Tuple) {
+	e.released++
+}
+
+func TestOrderByChildError(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars(t)
+	for i := 0; i < 5; i++ {
+		insertTupleForTest(t, hf, &t1, tid)
+		insertTupleForTest(t, hf, &t2, tid)
+	}
+
+	child := &errAfterOp{child: hf, n: 4}
+	oby, err := NewOrderBy([]Expr{&FieldExpr{t1.Desc.Fields[1]}}, child, []bool{true})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := oby.Iterator(tid)
+	if !errors.Is(err, errChildFailed) || iter != nil {
+		t.Fatalf("expected the child error and no iterator, got %v", err)
+	}
+	if child.released != 4 {
+		t.Errorf("expected the 4 buffered tuples to be released, got %d", child.released)
+	}
+}
+
+func TestOrderByExternalSort(t *testing.T) {
+	const n = 200
+	var vals []int64
+	for i := int64(0); i < n; i++ {
+		vals = append(vals, (i*37)%n)
+	}
+	child := newIntsOp(vals...)
+	field := &FieldExpr{child.desc.Fields[0]}
+	tempDir := t.TempDir()
+	runFiles := func() []string {
+		files, err := filepath.Glob(filepath.Join(tempDir, "*"))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		return files
+	}
+
+	for _, ascending := range []bool{true, false} {
+		oby, err := NewOrderByWithRunSize([]Expr{field}, child, []bool{ascending}, 16)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		oby.tempDir = tempDir
+		iter, err := oby.Iterator(NewTID())
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if files := runFiles(); len(files) != (n+15)/16 {
+			t.Errorf("expected %d runs, got %d", (n+15)/16, len(files))
+		}
+
+		var expected []*Tuple
+		for i := int64(0); i < n; i++ {
+			v := i
+			if !ascending {
+				v = n - 1 - i
+			}
+			expected = append(expected, &Tuple{child.desc, []DBValue{IntField{v}}, nil})
+		}
+		if err := CheckIfOutputMatches(iter, expected); err != nil {
+			t.Fatalf("ascending=%v: %v", ascending, err)
+		}
+		if files := runFiles(); len(files) != 0 {
+			t.Errorf("expected the runs to be removed after the last tuple, found %v", files)
+		}
+	}
+
+	// an iteration that is abandoned leaves its runs to Close
+	oby, err := NewOrderByWithRunSize([]Expr{field}, child, []bool{true}, 16)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	oby.tempDir = tempDir
+	iter, err := oby.Iterator(NewTID())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup, err := iter(); err != nil || tup.Fields[0].(IntField).Value != 0 {
+		t.Fatalf("expected 0 first, got %v (%v)", tup, err)
+	}
+	if err := oby.Close(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if files := runFiles(); len(files) != 0 {
+		t.Errorf("expected Close to remove the runs, found %v", files)
+	}
+
+	// a small input is sorted in memory
+	oby, err = NewOrderByWithRunSize([]Expr{field}, newIntsOp(3, 1, 2), []bool{true}, 16)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	oby.tempDir = tempDir
+	if _, err := oby.Iterator(NewTID()); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if files := runFiles(); len(files) != 0 {
+		t.Errorf("expected no runs for a small input, found %v", files)
+	}
+}
+
+// stringsOp returns a tuple of one string field for every value
+type stringsOp struct {
+	desc TupleDesc
+	vals []string
+}
+
+func (o *stringsOp) Descriptor() *TupleDesc {
+	return &o.desc
+}
+
+func (o *stringsOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	index := 0
+	return func() (*Tuple, error) {
+		if index >= len(o.vals) {
+			return nil, nil
+		}
+		index++
+		return &Tuple{o.desc, []DBValue{StringField{o.vals[index-1]}}, nil}, nil
+	}, nil
+}
+
+func TestOrderByExternalSortLongStrings(t *testing.T) {
+	const n = 40
+	var vals []string
+	for i := 0; i < n; i++ {
+		val := fmt.Sprintf("%02d", (i*7)%n)
+		// only the first run holds strings a heap page would truncate or trim
+		if i < 8 {
+			val += strings.Repeat("x", StringLength) + " "
+		}
+		vals = append(vals, val)
+	}
+	child := &stringsOp{TupleDesc{[]FieldType{{Fname: "s", Ftype: StringType}}}, vals}
+	oby, err := NewOrderByWithRunSize([]Expr{&FieldExpr{child.desc.Fields[0]}}, child, []bool{true}, 8)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tempDir := t.TempDir()
+	oby.tempDir = tempDir
+	iter, err := oby.Iterator(NewTID())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	files, err := filepath.Glob(filepath.Join(tempDir, "*"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(files) != n/8-1 {
+		t.Errorf("expected %d spilled runs and one kept in memory, got %d files", n/8-1, len(files))
+	}
+
+	sorted := slices.Clone(vals)
+	slices.Sort(sorted)
+	var expected []*Tuple
+	for _, val := range sorted {
+		expected = append(expected, &Tuple{child.desc, []DBValue{StringField{val}}, nil})
+	}
+	if err := CheckIfOutputMatches(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := oby.Close(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// two runs kept in memory would hold more tuples than the run size
+	for i := 8; i < 16; i++ {
+		vals[i] += " "
+	}
+	if _, err := oby.Iterator(NewTID()); err == nil || err.(GoDBError).code != IllegalOperationError {
+		t.Errorf("expected an IllegalOperationError keeping 16 tuples in memory, got %v", err)
+	}
+	files, err = filepath.Glob(filepath.Join(tempDir, "*"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(files) != 0 {
+		t.Errorf("expected the runs to be removed after the error, found %v", files)
+	}
+}
+
+func TestOrderByExternalSortNulls(t *testing.T) {
+	const n = 40
+	var vals []int64
+	for i := int64(0); i < n; i++ {
+		// every run holds NULLs, from the zeros
+		vals = append(vals, (i*7)%n%5*(i%8))
+	}
+	ints := newIntsOp(vals...)
+	nullIf, err := NewNullIfExpr(&FieldExpr{ints.desc.Fields[0]}, IntConst(0))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	child, err := NewProjectOp([]Expr{nullIf, &FieldExpr{ints.desc.Fields[0]}}, []string{"v", "n"}, false, ints)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	orderBy := []Expr{&FieldExpr{child.Descriptor().Fields[0]}}
+
+	inMemory, err := NewOrderBy(orderBy, child, []bool{true})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := inMemory.Iterator(NewTID())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := drainIterator(t, iter)
+
+	oby, err := NewOrderByWithRunSize(orderBy, child, []bool{true}, 8)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tempDir := t.TempDir()
+	oby.tempDir = tempDir
+	iter, err = oby.Iterator(NewTID())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// no run is kept in memory
+	for _, run := range oby.runs {
+		if run.file == "" {
+			t.Fatalf("expected every run to be spilled, got %d tuples in memory", len(run.tuples))
+		}
+	}
+	if len(oby.runs) != n/8 {
+		t.Errorf("expected %d spilled runs, got %d", n/8, len(oby.runs))
+	}
+	if err := CheckIfOutputMatches(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+	files, err := filepath.Glob(filepath.Join(tempDir, "*"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(files) != 0 {
+		t.Errorf("expected the runs to be removed after the last tuple, found %v", files)
+	}
+}
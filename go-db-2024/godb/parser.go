@@ -374,7 +374,7 @@ func parseFrom(c *Catalog, t sqlparser.TableExpr) ([]*LogicalTableNode, []*Logic
 }
 
 func isAgg(f string) bool {
-	return f == "count" || f == "sum" || f == "avg" || f == "min" || f == "max"
+	return f == "count" || f == "sum" || f == "avg" || f == "min" || f == "max" || f == "bool_and" || f == "bool_or"
 }
 
 func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNode, error) {
@@ -1148,6 +1148,10 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 					as = &SumAggState{}
 				case "count":
 					as = &CountAggState{}
+				case "bool_and":
+					as = &BoolAndAggState{}
+				case "bool_or":
+					as = &BoolOrAggState{}
 				default:
 					return nil, GoDBError{IllegalOperationError, fmt.Sprintf("unknown aggregate function %s", *s.funcOp)}
 				}
@@ -1203,6 +1207,7 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 			fieldNames = append(fieldNames, field)
 		}
 	}
+	preProjOp := topOp
 	if !selectAll {
 		projOp, err := NewProjectOp(exprList, fieldNames, plan.distinct, topOp)
 		if err != nil {
@@ -1213,22 +1218,36 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 
 	if len(plan.orderByFields) > 0 {
 		var ascs []bool
+		for _, oby := range plan.orderByFields {
+			ascs = append(ascs, oby.ascending)
+		}
 
-		exprs := make([]Expr, len(plan.orderByFields))
-		for i, oby := range plan.orderByFields {
-			expr, _, err := oby.expr.generateExpr(c, topOp.Descriptor(), tableMap)
+		exprs, err := generateOrderByExprs(c, plan.orderByFields, topOp.Descriptor(), tableMap)
+		if err == nil {
+			orderOp, err := NewOrderBy(exprs, topOp, ascs)
 			if err != nil {
 				return nil, err
 			}
-			exprs[i] = expr
-			ascs = append(ascs, oby.ascending)
-
-		}
-		orderOp, err := NewOrderBy(exprs, topOp, ascs)
-		if err != nil {
+			topOp = NewOperatorCard(orderOp, topOp.Cardinality)
+		} else if !selectAll && !plan.distinct {
+			// the order-by refers to a column the projection drops, so sort
+			// the input of the projection instead; projecting keeps the order
+			exprs, err = generateOrderByExprs(c, plan.orderByFields, preProjOp.Descriptor(), tableMap)
+			if err != nil {
+				return nil, err
+			}
+			orderOp, err := NewOrderBy(exprs, preProjOp, ascs)
+			if err != nil {
+				return nil, err
+			}
+			projOp, err := NewProjectOp(exprList, fieldNames, plan.distinct, NewOperatorCard(orderOp, preProjOp.Cardinality))
+			if err != nil {
+				return nil, err
+			}
+			topOp = NewOperatorCard(projOp, preProjOp.Cardinality)
+		} else {
 			return nil, err
 		}
-		topOp = NewOperatorCard(orderOp, topOp.Cardinality)
 	}
 
 	if plan.limit != nil {
@@ -1246,6 +1265,19 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 	return topOp, nil
 }
 
+// Generate the expressions of the order-by fields against desc.
+func generateOrderByExprs(c *Catalog, orderByFields []*OrderByNode, desc *TupleDesc, tableMap map[string]*PlanNode) ([]Expr, error) {
+	exprs := make([]Expr, len(orderByFields))
+	for i, oby := range orderByFields {
+		expr, _, err := oby.expr.generateExpr(c, desc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		exprs[i] = expr
+	}
+	return exprs, nil
+}
+
 func parseInsert(c *Catalog, insStmt *sqlparser.Insert) (Operator, error) {
 	if insStmt.Columns != nil {
 		return nil, GoDBError{ParseError, "GoDB doesn't support inserts of incomplete tuples"}
@@ -1370,6 +1402,10 @@ const (
 func processDDL(c *Catalog, ddl *sqlparser.DDL) (QueryType, error) {
 	switch ddl.Action {
 	case "create":
+		if ddl.TableSpec == nil {
+			// the SQL parser gives up on column types it does not know
+			return UnknownQueryType, GoDBError{ParseError, "unsupported create table statement"}
+		}
 		fields := make([]FieldType, len(ddl.TableSpec.Columns))
 		tabName := sqlparser.String(ddl.NewName.Name)
 		t, _ := c.GetTable(tabName)
@@ -1388,6 +1424,14 @@ func processDDL(c *Catalog, ddl *sqlparser.DDL) (QueryType, error) {
 				fallthrough
 			case "varchar":
 				colType = StringType
+			case "bit":
+				// the SQL parser has no BOOL type, which MySQL spells TINYINT(1)
+				colType = BoolType
+			case "tinyint":
+				if col.Type.Length == nil || sqlparser.String(col.Type.Length) != "1" {
+					return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("unsupported column type %s", sqlparser.String(&col.Type))}
+				}
+				colType = BoolType
 			default:
 				return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("unsupported column type %s", col.Type.Type)}
 
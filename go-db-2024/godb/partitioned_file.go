@@ -0,0 +1,149 @@
+package godb
+
+import (
+	"fmt"
+)
+
+// PartitionFunc returns the index of the partition of a [PartitionedFile] that
+// holds tuple t, e.g., the month of a date field
+type PartitionFunc func(t *Tuple) (int, error)
+
+// A PartitionedFile is a single table made of several [HeapFile] partitions
+// with the same TupleDesc, e.g., one per month of time-partitioned data.
+// Inserts go to the partition chosen by a PartitionFunc, and scans return the
+// tuples of all partitions, partition by partition.
+//
+// The record ids of its tuples record their partition, so that deletes go to
+// the partition holding the tuple. The pages of the file are those of its
+// partitions, in order.
+type PartitionedFile struct {
+	partitions  []*HeapFile
+	partitionOf PartitionFunc
+}
+
+// the record id of a tuple of a PartitionedFile: the partition holding the
+// tuple, and its record id there
+type partitionRecordID struct {
+	partition int
+	rid       recordID
+}
+
+// NewPartitionedFile Construct a PartitionedFile over partitions, inserting
+// every tuple into the partition whose index partitionOf returns.
+//
+// Returns an IllegalOperationError if there are no partitions, and a
+// SchemaMismatchError if they do not all have the same TupleDesc.
+func NewPartitionedFile(partitions []*HeapFile, partitionOf PartitionFunc) (*PartitionedFile, error) {
+	if len(partitions) == 0 {
+		return nil, GoDBError{IllegalOperationError, "a partitioned file needs at least one partition"}
+	}
+	for _, partition := range partitions[1:] {
+		if !partition.desc.equals(partitions[0].desc) {
+			return nil, GoDBError{SchemaMismatchError, fmt.Sprintf("partition %s has a different descriptor", partition.fromFile)}
+		}
+	}
+	return &PartitionedFile{partitions: append([]*HeapFile(nil), partitions...), partitionOf: partitionOf}, nil
+}
+
+// Descriptor Return the TupleDesc of the partitions.
+func (p *PartitionedFile) Descriptor() *TupleDesc {
+	return p.partitions[0].Descriptor()
+}
+
+// NumPages Return the number of pages of all partitions.
+func (p *PartitionedFile) NumPages() int {
+	pages := 0
+	for _, partition := range p.partitions {
+		pages += partition.NumPages()
+	}
+	return pages
+}
+
+// Return the partition holding page pageNo of the file, and the number of the
+// page there.
+func (p *PartitionedFile) partitionPage(pageNo int) (*HeapFile, int, error) {
+	for _, partition := range p.partitions {
+		if pageNo < partition.NumPages() {
+			return partition, pageNo, nil
+		}
+		pageNo -= partition.NumPages()
+	}
+	return nil, 0, GoDBError{IllegalOperationError, fmt.Sprintf("page %d is past the end of the partitions", pageNo)}
+}
+
+// Add the tuple to the partition partitionOf chooses for it, and set its
+// record id. Returns an IllegalOperationError if there is no such partition.
+func (p *PartitionedFile) insertTuple(t *Tuple, tid TransactionID) error {
+	i, err := p.partitionOf(t)
+	if err != nil {
+		DPrintf("PartitionedFile insertTuple partitionOf err:%v", err)
+		return err
+	}
+	if i < 0 || i >= len(p.partitions) {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("partition %d out of range for a file of %d partitions", i, len(p.partitions))}
+	}
+	if err := p.partitions[i].insertTuple(t, tid); err != nil {
+		return err
+	}
+	t.Rid = partitionRecordID{i, t.Rid}
+	return nil
+}
+
+// Remove the tuple from the partition its record id names.
+func (p *PartitionedFile) deleteTuple(t *Tuple, tid TransactionID) error {
+	rid, ok := t.Rid.(partitionRecordID)
+	if !ok || rid.partition < 0 || rid.partition >= len(p.partitions) {
+		return GoDBError{TupleNotFoundError, "invalid record id"}
+	}
+	return p.partitions[rid.partition].deleteTuple(&Tuple{t.Desc, t.Fields, rid.rid}, tid)
+}
+
+func (p *PartitionedFile) readPage(pageNo int) (Page, error) {
+	partition, pageNo, err := p.partitionPage(pageNo)
+	if err != nil {
+		return nil, err
+	}
+	return partition.readPage(pageNo)
+}
+
+// The pages of the file belong to its partitions, which write them.
+func (p *PartitionedFile) flushPage(page Page) error {
+	return page.getFile().flushPage(page)
+}
+
+func (p *PartitionedFile) pageKey(pgNo int) any {
+	partition, pgNo, err := p.partitionPage(pgNo)
+	if err != nil {
+		return nil
+	}
+	return partition.pageKey(pgNo)
+}
+
+// Iterator Return the tuples of all partitions, those of partition 0 first.
+func (p *PartitionedFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	var (
+		i    int
+		iter func() (*Tuple, error)
+	)
+	return func() (*Tuple, error) {
+		for ; i < len(p.partitions); i++ {
+			if iter == nil {
+				var err error
+				if iter, err = p.partitions[i].Iterator(tid); err != nil {
+					DPrintf("PartitionedFile Iterator partition:%d err:%v", i, err)
+					return nil, err
+				}
+			}
+			tuple, err := iter()
+			if err != nil {
+				return nil, err
+			}
+			if tuple != nil {
+				// the tuple may be the one cached in the page
+				return &Tuple{tuple.Desc, tuple.Fields, partitionRecordID{i, tuple.Rid}}, nil
+			}
+			iter = nil
+		}
+		return nil, nil
+	}, nil
+}
@@ -0,0 +1,98 @@
+package godb
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestPartitionedFile(t *testing.T) {
+	td, _, _ := makeTupleTestVars()
+	dir := t.TempDir()
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var partitions []*HeapFile
+	for i := 0; i < 3; i++ {
+		hf, err := NewHeapFile(filepath.Join(dir, fmt.Sprintf("part%d.dat", i)), &td, bp)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		partitions = append(partitions, hf)
+	}
+	// one partition per decade of age
+	byDecade := func(t *Tuple) (int, error) {
+		return int(t.Fields[1].(IntField).Value / 10), nil
+	}
+	pf, err := NewPartitionedFile(partitions, byDecade)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	var expected []*Tuple
+	for age := 0; age < 30; age += 3 {
+		tup := &Tuple{td, []DBValue{StringField{fmt.Sprintf("age%d", age)}, IntField{int64(age)}}, nil}
+		if err := pf.insertTuple(tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+		expected = append(expected, tup)
+	}
+	for i, hf := range partitions {
+		if n, err := hf.LiveTupleCount(); err != nil || n == 0 {
+			t.Fatalf("expected tuples in partition %d, got %d (err %v)", i, n, err)
+		}
+	}
+	if pf.NumPages() != len(partitions) {
+		t.Errorf("expected a page per partition, got %d pages", pf.NumPages())
+	}
+
+	iter, err := pf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tuples := drainIterator(t, iter)
+	if err := CheckIfOutputMatches(sliceIterator(tuples), expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// a tuple scanned from partition 1 is deleted there
+	var victim *Tuple
+	for _, tup := range tuples {
+		if tup.Fields[1] == (IntField{15}) {
+			victim = tup
+		}
+	}
+	before, _ := partitions[1].LiveTupleCount()
+	if err := pf.deleteTuple(victim, tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if after, _ := partitions[1].LiveTupleCount(); after != before-1 {
+		t.Fatalf("expected %d tuples left in partition 1, got %d", before-1, after)
+	}
+	iter, err = pf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := len(drainIterator(t, iter)); n != len(expected)-1 {
+		t.Fatalf("expected %d tuples after the delete, got %d", len(expected)-1, n)
+	}
+
+	// a key without a partition is rejected
+	tup := &Tuple{td, []DBValue{StringField{"old"}, IntField{90}}, nil}
+	if err := pf.insertTuple(tup, tid); err == nil || err.(GoDBError).code != IllegalOperationError {
+		t.Fatalf("expected an IllegalOperationError, got %v", err)
+	}
+	bp.CommitTransaction(tid)
+
+	other := TupleDesc{Fields: []FieldType{{Fname: "name", Ftype: StringType}}}
+	mismatched, err := NewHeapFile(filepath.Join(dir, "other.dat"), &other, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := NewPartitionedFile([]*HeapFile{partitions[0], mismatched}, byDecade); err == nil || err.(GoDBError).code != SchemaMismatchError {
+		t.Fatalf("expected a SchemaMismatchError, got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package godb
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+)
+
+// percentileRunDesc is the TupleDesc of the runs spilled by a
+// [PercentileAggState]: one int value per tuple.
+var percentileRunDesc = TupleDesc{Fields: []FieldType{{"value", "", IntType}}}
+
+// PercentileAggState Implements the aggregation state for PERCENTILE over an int
+// expression with the nearest-rank method: the result is the smallest value
+// such that at least fraction of the values are less than or equal to it.
+// Like MIN and MAX, a group always has at least one value.
+//
+// The values of a group are buffered to be sorted on Finalize. With a positive
+// spill threshold, at most that many values are kept in memory: a full buffer is
+// sorted and written as a run to a temporary heap file, and Finalize merges the
+// runs with [MergeIterators], so that a single huge group needs bounded memory.
+// If a run cannot be written, the state stops spilling and keeps the values in
+// memory. Finalize removes the runs, so the result is computed only once.
+type PercentileAggState struct {
+	alias          string
+	expr           Expr
+	fraction       float64
+	spillThreshold int
+
+	values []int64   // the values buffered in memory
+	count  int       // the values added, including the spilled ones
+	runs   []string  // the temporary files of the spilled runs
+	result *IntField // the result, once finalized
+}
+
+// NewPercentileAggState Construct an aggregation state for the fraction
+// percentile (e.g., 0.5 for the median), which spills its values to disk above
+// spillThreshold values, or never if spillThreshold is not positive.
+func NewPercentileAggState(fraction float64, spillThreshold int) *PercentileAggState {
+	return &PercentileAggState{fraction: fraction, spillThreshold: spillThreshold}
+}
+
+func (a *PercentileAggState) Copy() AggState {
+	cp := &PercentileAggState{
+		alias:          a.alias,
+		expr:           a.expr,
+		fraction:       a.fraction,
+		spillThreshold: a.spillThreshold,
+		values:         slices.Clone(a.values),
+		count:          a.count,
+		result:         a.result,
+	}
+	// the copy removes its runs when finalized, so it needs runs of its own
+	for _, name := range a.runs {
+		runCopy, err := copyRun(name)
+		if err != nil {
+			DPrintf("PercentileAggState Copy copyRun err: %v", err)
+			continue
+		}
+		cp.runs = append(cp.runs, runCopy)
+	}
+	return cp
+}
+
+func (a *PercentileAggState) Init(alias string, expr Expr) error {
+	if expr.GetExprType().Ftype != IntType {
+		return GoDBError{TypeMismatchError, "percentile needs an int expression"}
+	}
+	if a.fraction < 0 || a.fraction > 1 {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("percentile fraction %v is not between 0 and 1", a.fraction)}
+	}
+	a.removeRuns()
+	a.alias = aggAlias(alias, "percentile", expr)
+	a.expr = expr
+	a.values = nil
+	a.count = 0
+	a.result = nil
+	return nil
+}
+
+func (a *PercentileAggState) AddTuple(t *Tuple) {
+	tmpVal, err := a.expr.EvalExpr(t)
+	if err != nil {
+		return
+	}
+
+	val, ok := tmpVal.(IntField)
+	if !ok {
+		return
+	}
+
+	a.values = append(a.values, val.Value)
+	a.count++
+	if a.spillThreshold > 0 && len(a.values) >= a.spillThreshold {
+		if err := a.spillRun(); err != nil {
+			DPrintf("PercentileAggState AddTuple spillRun err: %v", err)
+			a.spillThreshold = 0
+		}
+	}
+}
+
+func (a *PercentileAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{
+		Fields: []FieldType{{a.alias, "", IntType}},
+	}
+}
+
+// Finalize Return the percentile, or nil if the spilled runs cannot be read
+// back.
+func (a *PercentileAggState) Finalize() *Tuple {
+	td := a.GetTupleDesc()
+	if a.result == nil {
+		slices.Sort(a.values)
+		rank := int(math.Ceil(a.fraction * float64(a.count)))
+		rank = max(1, min(rank, a.count))
+
+		if len(a.runs) == 0 {
+			a.result = &IntField{a.values[rank-1]}
+		} else {
+			val, err := a.mergeRuns(rank)
+			a.removeRuns()
+			if err != nil {
+				DPrintf("PercentileAggState Finalize mergeRuns err: %v", err)
+				return nil
+			}
+			a.result = &val
+		}
+		a.values = nil
+	}
+	return &Tuple{*td, []DBValue{*a.result}, nil}
+}
+
+// Sort the buffered values and write them to a new temporary heap file,
+// recorded as a run.
+func (a *PercentileAggState) spillRun() error {
+	slices.Sort(a.values)
+
+	file, err := os.CreateTemp("", "godb-percentile-run-*.dat")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	a.runs = append(a.runs, file.Name())
+
+	runPool, err := NewBufferPool(sortRunPoolPages)
+	if err != nil {
+		return err
+	}
+	run, err := NewHeapFile(file.Name(), &percentileRunDesc, runPool)
+	if err != nil {
+		return err
+	}
+	tid := NewTID()
+	for _, v := range a.values {
+		if err := run.insertTuple(&Tuple{percentileRunDesc, []DBValue{IntField{v}}, nil}, tid); err != nil {
+			return err
+		}
+		// runs are appended to in order, so only the last page is ever dirty
+		if len(run.freeSpace) == 0 {
+			runPool.FlushAllPages()
+		}
+	}
+	runPool.FlushAllPages()
+	a.values = a.values[:0]
+	return nil
+}
+
+// Return the value of the given rank (from 1) among the sorted buffered
+// values and the spilled runs.
+func (a *PercentileAggState) mergeRuns(rank int) (IntField, error) {
+	runPool, err := NewBufferPool(sortRunPoolPages)
+	if err != nil {
+		return IntField{}, err
+	}
+	tid := NewTID()
+	iters := make([]func() (*Tuple, error), 0, len(a.runs)+1)
+	for _, name := range a.runs {
+		run, err := NewHeapFile(name, &percentileRunDesc, runPool)
+		if err != nil {
+			return IntField{}, err
+		}
+		iter, err := run.Iterator(tid)
+		if err != nil {
+			return IntField{}, err
+		}
+		iters = append(iters, iter)
+	}
+	var index int
+	iters = append(iters, func() (*Tuple, error) {
+		if index >= len(a.values) {
+			return nil, nil
+		}
+		index++
+		return &Tuple{percentileRunDesc, []DBValue{IntField{a.values[index-1]}}, nil}, nil
+	})
+
+	mergeIter := MergeIterators(iters, []Expr{&FieldExpr{percentileRunDesc.Fields[0]}}, []bool{true})
+	for i := 1; ; i++ {
+		tuple, err := mergeIter()
+		if err != nil {
+			return IntField{}, err
+		}
+		if tuple == nil {
+			return IntField{}, GoDBError{MalformedDataError, fmt.Sprintf("percentile runs end before rank %d", rank)}
+		}
+		if i == rank {
+			return tuple.Fields[0].(IntField), nil
+		}
+	}
+}
+
+// Remove the temporary files of the spilled runs.
+func (a *PercentileAggState) removeRuns() {
+	for _, name := range a.runs {
+		os.Remove(name)
+	}
+	a.runs = nil
+}
+
+// Copy the run in file name to a new temporary file, and return its name.
+func copyRun(name string) (string, error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dst, err := os.CreateTemp("", "godb-percentile-run-*.dat")
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+	if _, err := io.Copy(dst, src); err != nil {
+		os.Remove(dst.Name())
+		return "", err
+	}
+	return dst.Name(), nil
+}
@@ -81,13 +81,11 @@ func (p *Project) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error),
 			}
 
 			var tmpVal DBValue
-			newTup = &Tuple{
-				Desc:   desc,
-				Fields: make([]DBValue, 0, len(p.selectFields)),
-			}
+			newTup = newPooledTuple(desc, len(p.selectFields))
 			for _, field := range p.selectFields {
 				tmpVal, err = field.EvalExpr(tuple)
 				if err != nil {
+					releasePooledTuple(newTup)
 					return
 				}
 				newTup.Fields = append(newTup.Fields, tmpVal)
@@ -100,6 +98,7 @@ func (p *Project) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error),
 
 			tupleKey = newTup.tupleKey()
 			if _, isExist := allMap[tupleKey]; isExist {
+				releasePooledTuple(newTup)
 				continue
 			}
 
@@ -111,3 +110,9 @@ func (p *Project) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error),
 	}
 	return
 }
+
+// ReleaseTuple Return a tuple produced by this projection to the tuple pool.
+// Callers should only do so once they no longer hold any reference to it.
+func (p *Project) ReleaseTuple(t *Tuple) {
+	releasePooledTuple(t)
+}
@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"os"
 	"testing"
 )
 
@@ -207,3 +208,168 @@ func TestTupleProjectExtra(t *testing.T) {
 	}
 
 }
+
+func TestProjectReleaseTuple(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars(t)
+	for i := 0; i < 50; i++ {
+		insertTupleForTest(t, hf, &t1, tid)
+		insertTupleForTest(t, hf, &t2, tid)
+	}
+
+	outNames := []string{"name", "age"}
+	exprs := []Expr{&FieldExpr{t1.Desc.Fields[0]}, &FieldExpr{t1.Desc.Fields[1]}}
+	proj, err := NewProjectOp(exprs, outNames, false, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := proj.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	cnt := 0
+	var ageSum int64
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		name := tup.Fields[0].(StringField).Value
+		age := tup.Fields[1].(IntField).Value
+		if !(name == "sam" && age == 25) && !(name == "george jones" && age == 999) {
+			t.Fatalf("unexpected tuple after recycling: %s, %d", name, age)
+		}
+		ageSum += age
+		cnt++
+		ReleaseTuple(proj, tup)
+	}
+	if cnt != 100 {
+		t.Errorf("expected 100 tuples, got %d", cnt)
+	}
+	if ageSum != 50*(25+999) {
+		t.Errorf("unexpected age sum %d", ageSum)
+	}
+
+	// the heap file's tuples belong to its pages and must not be recycled
+	scan, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tup, err := scan()
+	if err != nil || tup == nil {
+		t.Fatalf("expected a tuple from the heap file, err = %v", err)
+	}
+	ReleaseTuple(hf, tup)
+	if len(tup.Fields) != 2 {
+		t.Fatalf("ReleaseTuple should not modify heap file tuples")
+	}
+}
+
+func benchmarkProjectScan(b *testing.B, release bool) {
+	os.Remove(TestingFile)
+	defer os.Remove(TestingFile)
+	bp, err := NewBufferPool(100)
+	if err != nil {
+		b.Fatalf(err.Error())
+	}
+	td, t1, t2 := makeTupleTestVars()
+	hf, err := NewHeapFile(TestingFile, &td, bp)
+	if err != nil {
+		b.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	for i := 0; i < 2000; i++ {
+		hf.insertTuple(&t1, tid)
+		hf.insertTuple(&t2, tid)
+	}
+	bp.FlushAllPages()
+
+	exprs := []Expr{&FieldExpr{td.Fields[1]}, &FieldExpr{td.Fields[0]}}
+	proj, err := NewProjectOp(exprs, []string{"age", "name"}, false, hf)
+	if err != nil {
+		b.Fatalf(err.Error())
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		iter, err := proj.Iterator(tid)
+		if err != nil {
+			b.Fatalf(err.Error())
+		}
+		for tup, err := iter(); tup != nil || err != nil; tup, err = iter() {
+			if err != nil {
+				b.Fatalf(err.Error())
+			}
+			if release {
+				ReleaseTuple(proj, tup)
+			}
+		}
+	}
+}
+
+func BenchmarkProjectScan(b *testing.B) {
+	benchmarkProjectScan(b, false)
+}
+
+func BenchmarkProjectScanRelease(b *testing.B) {
+	benchmarkProjectScan(b, true)
+}
+
+func TestProjectPositionalAfterJoin(t *testing.T) {
+	td, t1, t2, hf, bp, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+
+	os.Remove(JoinTestFile)
+	defer os.Remove(JoinTestFile)
+	hf2, err := NewHeapFile(JoinTestFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	insertTupleForTest(t, hf2, &Tuple{td, []DBValue{StringField{"bob"}, IntField{25}}, nil}, tid)
+	insertTupleForTest(t, hf2, &Tuple{td, []DBValue{StringField{"tom"}, IntField{999}}, nil}, tid)
+
+	ageExpr := &FieldExpr{td.Fields[1]}
+	join, err := NewJoin(hf, ageExpr, hf2, ageExpr, 100)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// both inputs have a name field, so it can't be selected by name
+	if _, err := (&FieldExpr{td.Fields[0]}).EvalExpr(joinTuples(&t1, &t1)); err == nil {
+		t.Fatalf("expected selecting name by name to be ambiguous")
+	}
+
+	leftName, err := NewPositionalExpr(join.Descriptor(), 0)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	rightName, err := NewPositionalExpr(join.Descriptor(), 2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := NewPositionalExpr(join.Descriptor(), 4); err == nil {
+		t.Errorf("expected an error for an index past the last field")
+	}
+
+	proj, err := NewProjectOp([]Expr{leftName, rightName}, []string{"left", "right"}, false, join)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := proj.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	outDesc := *proj.Descriptor()
+	expected := []*Tuple{
+		{outDesc, []DBValue{StringField{"sam"}, StringField{"bob"}}, nil},
+		{outDesc, []DBValue{StringField{"george jones"}, StringField{"tom"}}, nil},
+	}
+	if err := CheckIfOutputMatchesUnordered(iter, expected); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
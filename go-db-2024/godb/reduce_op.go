@@ -0,0 +1,72 @@
+package godb
+
+import "fmt"
+
+// ReduceFunc folds tuple t into the accumulated value acc, and returns the new
+// accumulated value
+type ReduceFunc func(acc DBValue, t *Tuple) DBValue
+
+type ReduceOp struct {
+	child Operator
+	init  DBValue
+	fn    ReduceFunc
+	desc  TupleDesc
+}
+
+// NewReduceOp Construct an operator folding all tuples of child into one value
+// with fn, starting from init, for aggregations the [AggState]s do not cover.
+// The result is returned as a one-field tuple named "reduce", of the type of
+// init.
+//
+// Returns an error if init is not an int, string or bool.
+func NewReduceOp(child Operator, init DBValue, fn ReduceFunc) (*ReduceOp, error) {
+	var ftype DBType
+	switch init.(type) {
+	case IntField:
+		ftype = IntType
+	case StringField:
+		ftype = StringType
+	case BoolField:
+		ftype = BoolType
+	default:
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot reduce into %v", init)}
+	}
+	return &ReduceOp{child, init, fn, TupleDesc{[]FieldType{{"reduce", "", ftype}}}}, nil
+}
+
+// Descriptor Return the one-field TupleDesc of the result.
+func (r *ReduceOp) Descriptor() *TupleDesc {
+	return &r.desc
+}
+
+// Iterator Return the fold of the child's tuples as a single tuple. The whole
+// child is read on the first call.
+func (r *ReduceOp) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error), err error) {
+	childIter, err := r.child.Iterator(tid)
+	if err != nil {
+		DPrintf("ReduceOp Iterator get child iterator err: %v", err)
+		return
+	}
+
+	var done bool
+	iterFunc = func() (*Tuple, error) {
+		if done {
+			return nil, nil
+		}
+		acc := r.init
+		for {
+			tuple, err := childIter()
+			if err != nil {
+				DPrintf("ReduceOp Iterator childIter() err: %v", err)
+				return nil, err
+			}
+			if tuple == nil {
+				break
+			}
+			acc = r.fn(acc, tuple)
+		}
+		done = true
+		return &Tuple{r.desc, []DBValue{acc}, nil}, nil
+	}
+	return
+}
@@ -0,0 +1,59 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestReduceSumOfSquares(t *testing.T) {
+	sumSquares := func(acc DBValue, t *Tuple) DBValue {
+		v := t.Fields[0].(IntField).Value
+		return IntField{acc.(IntField).Value + v*v}
+	}
+	for _, c := range []struct {
+		vals     []int64
+		expected int64
+	}{{[]int64{1, 2, 3, 4}, 30}, {[]int64{-5}, 25}, {nil, 0}} {
+		op, err := NewReduceOp(newIntsOp(c.vals...), IntField{0}, sumSquares)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		iter, err := op.Iterator(NewTID())
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		expected := &Tuple{*op.Descriptor(), []DBValue{IntField{c.expected}}, nil}
+		if err := CheckIfOutputMatches(iter, []*Tuple{expected}); err != nil {
+			t.Errorf("%v: %v", c.vals, err)
+		}
+	}
+
+	// the accumulator may have another type than the tuples
+	longest := func(acc DBValue, t *Tuple) DBValue {
+		if name := t.Fields[0].(StringField).Value; len(name) > len(acc.(StringField).Value) {
+			return StringField{name}
+		}
+		return acc
+	}
+	_, t1, t2, hf, _, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+	op, err := NewReduceOp(hf, StringField{""}, longest)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if op.Descriptor().Fields[0].Ftype != StringType {
+		t.Fatalf("expected a string result, got %v", op.Descriptor())
+	}
+	iter, err := op.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := &Tuple{*op.Descriptor(), []DBValue{StringField{"george jones"}}, nil}
+	if err := CheckIfOutputMatches(iter, []*Tuple{expected}); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if _, err := NewReduceOp(hf, NullField{}, longest); err == nil {
+		t.Errorf("expected an error for a NULL initial value")
+	}
+}
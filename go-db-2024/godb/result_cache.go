@@ -0,0 +1,93 @@
+package godb
+
+import (
+	"sync"
+	"time"
+)
+
+// the materialized results of the operators wrapped by [CachedResult], by key
+var resultCache = struct {
+	sync.Mutex
+	entries map[string]*resultCacheEntry
+}{entries: make(map[string]*resultCacheEntry)}
+
+type resultCacheEntry struct {
+	tuples  []*Tuple
+	expires time.Time
+}
+
+// CachedResultOp returns the cached result of its child while it is fresh,
+// see [CachedResult].
+type CachedResultOp struct {
+	child Operator
+	key   string
+	ttl   time.Duration
+}
+
+// CachedResult Wrap op so that its result is materialized and cached under key
+// for ttl. Iterating any CachedResultOp with the same key within ttl returns the
+// cached tuples without running its child. The key identifies the plan, e.g.,
+// the text of the query; plans with the same key must compute the same result.
+func CachedResult(op Operator, key string, ttl time.Duration) *CachedResultOp {
+	return &CachedResultOp{op, key, ttl}
+}
+
+// ClearResultCache Drop every cached result, e.g., after the tables the cached
+// plans read are modified.
+func ClearResultCache() {
+	resultCache.Lock()
+	defer resultCache.Unlock()
+	clear(resultCache.entries)
+}
+
+// Descriptor Return the TupleDesc of the child.
+func (c *CachedResultOp) Descriptor() *TupleDesc {
+	return c.child.Descriptor()
+}
+
+// Iterator Return the cached result for the key if it has not expired,
+// otherwise run the child to completion and cache its result first.
+func (c *CachedResultOp) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error), err error) {
+	resultCache.Lock()
+	entry, ok := resultCache.entries[c.key]
+	resultCache.Unlock()
+
+	if !ok || time.Now().After(entry.expires) {
+		var childIter func() (*Tuple, error)
+		childIter, err = c.child.Iterator(tid)
+		if err != nil {
+			DPrintf("CachedResultOp Iterator get child iterator err: %v", err)
+			return
+		}
+
+		entry = &resultCacheEntry{}
+		for {
+			var tuple *Tuple
+			tuple, err = childIter()
+			if err != nil {
+				DPrintf("CachedResultOp Iterator childIter() err: %v", err)
+				return
+			}
+			if tuple == nil {
+				break
+			}
+			entry.tuples = append(entry.tuples, tuple)
+		}
+		entry.expires = time.Now().Add(c.ttl)
+
+		resultCache.Lock()
+		resultCache.entries[c.key] = entry
+		resultCache.Unlock()
+	}
+
+	var index int
+	iterFunc = func() (*Tuple, error) {
+		if index >= len(entry.tuples) {
+			return nil, nil
+		}
+		reply := entry.tuples[index]
+		index++
+		return reply, nil
+	}
+	return
+}
@@ -0,0 +1,66 @@
+package godb
+
+import (
+	"testing"
+	"time"
+)
+
+// countingOp counts how many times its child is iterated
+type countingOp struct {
+	child Operator
+	runs  int
+}
+
+func (c *countingOp) Descriptor() *TupleDesc {
+	return c.child.Descriptor()
+}
+
+func (c *countingOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	c.runs++
+	return c.child.Iterator(tid)
+}
+
+func TestCachedResult(t *testing.T) {
+	ClearResultCache()
+	defer ClearResultCache()
+	_, t1, t2, hf, _, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+
+	child := &countingOp{child: hf}
+	filter, err := NewFilter(&ConstExpr{IntField{100}, IntType}, OpLt, &FieldExpr{t1.Desc.Fields[1]}, child)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	const query = "select * from t where age < 100"
+	for run := 0; run < 2; run++ {
+		iter, err := CachedResult(filter, query, time.Minute).Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := CheckIfOutputMatches(iter, []*Tuple{&t1}); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+	if child.runs != 1 {
+		t.Errorf("expected the child to run once, ran %d times", child.runs)
+	}
+
+	// a different key, or an expired entry, runs the child again
+	iter, err := CachedResult(filter, query+" ", time.Minute).Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatches(iter, []*Tuple{&t1}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	expiring := CachedResult(filter, "expiring", 0)
+	for run := 0; run < 2; run++ {
+		if _, err := expiring.Iterator(tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if child.runs != 4 {
+		t.Errorf("expected the child to run 4 times, ran %d times", child.runs)
+	}
+}
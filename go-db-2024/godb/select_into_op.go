@@ -0,0 +1,40 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+)
+
+// MaterializeInto Create a new HeapFile backed by newFileName whose TupleDesc
+// is the descriptor of op, and insert every tuple produced by op into it on
+// behalf of tid. This is the equivalent of SQL's CREATE TABLE ... AS SELECT
+// (or SELECT ... INTO).
+//
+// The table qualifiers of op's descriptor are dropped, since the fields now
+// belong to the new table. Returns an error if newFileName already holds data,
+// or if op or the insertion fails. Inserted pages are dirtied in bp like any
+// other insert, so they are forced to disk when tid commits.
+func MaterializeInto(op Operator, newFileName string, bp *BufferPool, tid TransactionID) (*HeapFile, error) {
+	if info, err := os.Stat(newFileName); err == nil && info.Size() > 0 {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("MaterializeInto: file %s already exists", newFileName)}
+	}
+
+	desc := op.Descriptor().copy()
+	desc.setTableAlias("")
+	hf, err := NewHeapFile(newFileName, desc, bp)
+	if err != nil {
+		DPrintf("MaterializeInto NewHeapFile err:%v", err)
+		return nil, err
+	}
+
+	iter, err := NewInsertOp(hf, op).Iterator(tid)
+	if err != nil {
+		DPrintf("MaterializeInto InsertOp Iterator err:%v", err)
+		return nil, err
+	}
+	if _, err = iter(); err != nil {
+		DPrintf("MaterializeInto insert err:%v", err)
+		return nil, err
+	}
+	return hf, nil
+}
@@ -0,0 +1,56 @@
+package godb
+
+import (
+	"os"
+	"testing"
+)
+
+const SelectIntoTestFile string = "SelectIntoTestFile.dat"
+
+func TestMaterializeInto(t *testing.T) {
+	_, t1, t2, hf, bp, tid := makeTestVars(t)
+	for i := 0; i < 3; i++ {
+		insertTupleForTest(t, hf, &t1, tid)
+		insertTupleForTest(t, hf, &t2, tid)
+	}
+
+	ageField := FieldExpr{t1.Desc.Fields[1]}
+	filt, err := NewFilter(&ConstExpr{IntField{25}, IntType}, OpGt, &ageField, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	proj, err := NewProjectOp([]Expr{&FieldExpr{t1.Desc.Fields[0]}}, []string{"old_name"}, false, filt)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	os.Remove(SelectIntoTestFile)
+	defer os.Remove(SelectIntoTestFile)
+	newHf, err := MaterializeInto(proj, SelectIntoTestFile, bp, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.FlushAllPages()
+	bp.CommitTransaction(tid)
+
+	expectedDesc := TupleDesc{Fields: []FieldType{{Fname: "old_name", Ftype: StringType}}}
+	if !newHf.Descriptor().equals(&expectedDesc) {
+		t.Fatalf("unexpected descriptor %v", newHf.Descriptor())
+	}
+
+	expected := Tuple{Desc: expectedDesc, Fields: []DBValue{StringField{"george jones"}}}
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	iter, err := newHf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatches(iter, []*Tuple{&expected, &expected, &expected}); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// the target must be a new table
+	if _, err := MaterializeInto(proj, SelectIntoTestFile, bp, tid); err == nil {
+		t.Fatalf("expected an error materializing into an existing file")
+	}
+}
@@ -0,0 +1,37 @@
+package godb
+
+type SeriesOp struct {
+	start, stop, step int64
+	desc              *TupleDesc
+}
+
+// NewSeriesOp Construct an operator returning a tuple with a single int field
+// named fieldName for every value from start to stop (inclusive) in increments
+// of step, like SQL's generate_series. A negative step counts down. Returns an
+// error if step is zero.
+func NewSeriesOp(start, stop, step int64, fieldName string) (*SeriesOp, error) {
+	if step == 0 {
+		return nil, GoDBError{IllegalOperationError, "series step must not be zero"}
+	}
+	desc := &TupleDesc{[]FieldType{{fieldName, "", IntType}}}
+	return &SeriesOp{start, stop, step, desc}, nil
+}
+
+// Descriptor Return the one int field TupleDesc of the series.
+func (s *SeriesOp) Descriptor() *TupleDesc {
+	return s.desc
+}
+
+// Iterator Return the values of the series, one per tuple.
+func (s *SeriesOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	next := s.start
+	return func() (*Tuple, error) {
+		if (s.step > 0 && next > s.stop) || (s.step < 0 && next < s.stop) {
+			return nil, nil
+		}
+
+		reply := &Tuple{*s.desc, []DBValue{IntField{next}}, nil}
+		next += s.step
+		return reply, nil
+	}, nil
+}
@@ -0,0 +1,38 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestSeriesOp(t *testing.T) {
+	cases := []struct {
+		start, stop, step int64
+		expected          []int64
+	}{
+		{1, 5, 1, []int64{1, 2, 3, 4, 5}},
+		{0, 10, 3, []int64{0, 3, 6, 9}},
+		{5, 1, -2, []int64{5, 3, 1}},
+		{3, 1, 1, nil},
+	}
+	for _, c := range cases {
+		series, err := NewSeriesOp(c.start, c.stop, c.step, "n")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		iter, err := series.Iterator(NewTID())
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var expected []*Tuple
+		for _, v := range c.expected {
+			expected = append(expected, &Tuple{*series.Descriptor(), []DBValue{IntField{v}}, nil})
+		}
+		if err := CheckIfOutputMatches(iter, expected); err != nil {
+			t.Fatalf("series(%d, %d, %d): %v", c.start, c.stop, c.step, err)
+		}
+	}
+
+	if _, err := NewSeriesOp(1, 5, 0, "n"); err == nil {
+		t.Errorf("expected an error for a zero step")
+	}
+}
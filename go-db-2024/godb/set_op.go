@@ -0,0 +1,221 @@
+package godb
+
+// SetOpKind selects the set operation a [SetOp] computes
+type SetOpKind int
+
+const (
+	// Intersect returns the distinct tuples of the left input that are also in
+	// the right input
+	Intersect SetOpKind = iota
+	// Except returns the distinct tuples of the left input that are not in the
+	// right input
+	Except SetOpKind = iota
+)
+
+type SetOp struct {
+	kind        SetOpKind
+	left, right Operator
+
+	// which input the last iteration hashed, and how many tuples it buffered,
+	// for inspecting set operation plans
+	builtOnLeft  bool
+	bufferedRows int
+}
+
+// NewIntersectOp Construct an operator computing left INTERSECT right.
+//
+// Returns an error if the field types of the inputs differ.
+func NewIntersectOp(left, right Operator) (*SetOp, error) {
+	return newSetOp(Intersect, left, right)
+}
+
+// NewExceptOp Construct an operator computing left EXCEPT right.
+//
+// Returns an error if the field types of the inputs differ.
+func NewExceptOp(left, right Operator) (*SetOp, error) {
+	return newSetOp(Except, left, right)
+}
+
+func newSetOp(kind SetOpKind, left, right Operator) (*SetOp, error) {
+	leftFields, rightFields := left.Descriptor().Fields, right.Descriptor().Fields
+	if len(leftFields) != len(rightFields) {
+		return nil, GoDBError{TypeMismatchError, "set operation inputs must have the same number of fields"}
+	}
+	for i := range leftFields {
+		if leftFields[i].Ftype != rightFields[i].Ftype {
+			return nil, GoDBError{TypeMismatchError, "set operation inputs must have the same field types"}
+		}
+	}
+	return &SetOp{kind: kind, left: left, right: right}, nil
+}
+
+// Descriptor Return the TupleDesc of the left input, as its tuples are the
+// ones returned.
+func (s *SetOp) Descriptor() *TupleDesc {
+	return s.left.Descriptor()
+}
+
+// BuiltOnLeft Report whether the last iteration hashed the left input.
+func (s *SetOp) BuiltOnLeft() bool {
+	return s.builtOnLeft
+}
+
+// BufferedRows Return the number of tuples the last iteration buffered.
+func (s *SetOp) BufferedRows() int {
+	return s.bufferedRows
+}
+
+// Iterator Return the result of the set operation. Only the smaller input is
+// hashed: both inputs are read in lockstep until one of them ends, which makes
+// that one the hashed side, and the other one is streamed past the hash, so
+// the tuples buffered are bounded by the size of the smaller input. The one
+// exception is an EXCEPT with the smaller input on the right, which also
+// remembers the tuples it returned to drop duplicates.
+func (s *SetOp) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error), err error) {
+	s.builtOnLeft = false
+	s.bufferedRows = 0
+
+	leftIter, err := s.left.Iterator(tid)
+	if err != nil {
+		DPrintf("SetOp Iterator get left iterator err: %v", err)
+		return
+	}
+	rightIter, err := s.right.Iterator(tid)
+	if err != nil {
+		DPrintf("SetOp Iterator get right iterator err: %v", err)
+		return
+	}
+
+	var (
+		leftBuf, rightBuf []*Tuple
+		leftEnd, rightEnd bool
+		leftTup, rightTup *Tuple
+	)
+	for !leftEnd && !rightEnd {
+		leftTup, err = leftIter()
+		if err != nil {
+			DPrintf("SetOp Iterator leftIter() err: %v", err)
+			return
+		}
+		rightTup, err = rightIter()
+		if err != nil {
+			DPrintf("SetOp Iterator rightIter() err: %v", err)
+			return
+		}
+		if leftTup == nil {
+			leftEnd = true
+		} else {
+			leftBuf = append(leftBuf, leftTup)
+		}
+		if rightTup == nil {
+			rightEnd = true
+		} else {
+			rightBuf = append(rightBuf, rightTup)
+		}
+	}
+	s.bufferedRows = len(leftBuf) + len(rightBuf)
+
+	if leftEnd {
+		s.builtOnLeft = true
+		return s.streamRightIterator(leftBuf, bufferedIterator(rightBuf, rightIter, rightEnd))
+	}
+	return s.streamLeftIterator(rightBuf, bufferedIterator(leftBuf, leftIter, leftEnd))
+}
+
+// Hash the whole left input in leftBuf and stream the right input past it.
+func (s *SetOp) streamRightIterator(leftBuf []*Tuple, rightIter func() (*Tuple, error)) (func() (*Tuple, error), error) {
+	var keys []any
+	hashed := make(map[any]*Tuple)
+	for _, tuple := range leftBuf {
+		key := tuple.tupleKey()
+		if _, isExist := hashed[key]; !isExist {
+			keys = append(keys, key)
+			hashed[key] = tuple
+		}
+	}
+
+	if s.kind == Intersect {
+		return func() (*Tuple, error) {
+			for {
+				tuple, err := rightIter()
+				if err != nil || tuple == nil {
+					return nil, err
+				}
+				key := tuple.tupleKey()
+				if reply, isExist := hashed[key]; isExist {
+					delete(hashed, key)
+					return reply, nil
+				}
+			}
+		}, nil
+	}
+
+	// Except: the result is only known once the right input is read
+	for {
+		tuple, err := rightIter()
+		if err != nil {
+			DPrintf("SetOp Iterator rightIter() err: %v", err)
+			return nil, err
+		}
+		if tuple == nil {
+			break
+		}
+		delete(hashed, tuple.tupleKey())
+	}
+	var index int
+	return func() (*Tuple, error) {
+		for index < len(keys) {
+			reply, isExist := hashed[keys[index]]
+			index++
+			if isExist {
+				return reply, nil
+			}
+		}
+		return nil, nil
+	}, nil
+}
+
+// Hash the whole right input in rightBuf and stream the left input past it.
+func (s *SetOp) streamLeftIterator(rightBuf []*Tuple, leftIter func() (*Tuple, error)) (func() (*Tuple, error), error) {
+	hashed := make(map[any]bool)
+	for _, tuple := range rightBuf {
+		hashed[tuple.tupleKey()] = true
+	}
+
+	return func() (*Tuple, error) {
+		for {
+			tuple, err := leftIter()
+			if err != nil || tuple == nil {
+				return nil, err
+			}
+			key := tuple.tupleKey()
+			inRight, isExist := hashed[key]
+			if s.kind == Intersect && inRight {
+				// drop the key so that duplicates of the tuple are skipped
+				hashed[key] = false
+				return tuple, nil
+			}
+			if s.kind == Except && !isExist {
+				hashed[key] = false
+				s.bufferedRows++
+				return tuple, nil
+			}
+		}
+	}, nil
+}
+
+// Return an iterator over the tuples in buf followed by the rest of iter,
+// unless iter already ended.
+func bufferedIterator(buf []*Tuple, iter func() (*Tuple, error), iterEnd bool) func() (*Tuple, error) {
+	return func() (*Tuple, error) {
+		if len(buf) > 0 {
+			reply := buf[0]
+			buf = buf[1:]
+			return reply, nil
+		}
+		if iterEnd {
+			return nil, nil
+		}
+		return iter()
+	}
+}
@@ -0,0 +1,106 @@
+package godb
+
+import (
+	"testing"
+)
+
+func makeSetOpSeries(t *testing.T, start, stop int64) *SeriesOp {
+	t.Helper()
+	series, err := NewSeriesOp(start, stop, 1, "n")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return series
+}
+
+// intsOp returns a tuple with a single int field for every value in vals
+type intsOp struct {
+	desc TupleDesc
+	vals []int64
+}
+
+func newIntsOp(vals ...int64) *intsOp {
+	return &intsOp{TupleDesc{[]FieldType{{Fname: "n", Ftype: IntType}}}, vals}
+}
+
+func (o *intsOp) Descriptor() *TupleDesc {
+	return &o.desc
+}
+
+func (o *intsOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	index := 0
+	return func() (*Tuple, error) {
+		if index >= len(o.vals) {
+			return nil, nil
+		}
+		index++
+		return &Tuple{o.desc, []DBValue{IntField{o.vals[index-1]}}, nil}, nil
+	}, nil
+}
+
+func checkSetOpOutput(t *testing.T, op *SetOp, expected []int64) {
+	t.Helper()
+	iter, err := op.Iterator(NewTID())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var tuples []*Tuple
+	for _, v := range expected {
+		tuples = append(tuples, &Tuple{*op.Descriptor(), []DBValue{IntField{v}}, nil})
+	}
+	if err := CheckIfOutputMatchesUnordered(iter, tuples); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func TestSetOpHashesSmallerSide(t *testing.T) {
+	const bigSize = 100000
+
+	// tiny left input, with a duplicate, against a huge right one
+	left := newIntsOp(-2, -1, 0, 1, 1, 2, 3)
+	// the lockstep read buffers at most one more tuple of the huge input
+	maxBuffered := 2*len(left.vals) + 1
+	intersect, err := NewIntersectOp(left, makeSetOpSeries(t, 1, bigSize))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkSetOpOutput(t, intersect, []int64{1, 2, 3})
+	if !intersect.BuiltOnLeft() {
+		t.Errorf("expected the tiny left input to be hashed")
+	}
+	if intersect.BufferedRows() > maxBuffered {
+		t.Errorf("expected buffered rows to track the left input, got %d", intersect.BufferedRows())
+	}
+
+	except, err := NewExceptOp(left, makeSetOpSeries(t, 1, bigSize))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkSetOpOutput(t, except, []int64{-2, -1, 0})
+	if !except.BuiltOnLeft() || except.BufferedRows() > maxBuffered {
+		t.Errorf("expected buffered rows to track the left input, got %d", except.BufferedRows())
+	}
+
+	// and the other way around
+	intersect, err = NewIntersectOp(makeSetOpSeries(t, 1, bigSize), left)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkSetOpOutput(t, intersect, []int64{1, 2, 3})
+	if intersect.BuiltOnLeft() || intersect.BufferedRows() > maxBuffered {
+		t.Errorf("expected buffered rows to track the right input, got %d", intersect.BufferedRows())
+	}
+
+	except, err = NewExceptOp(makeSetOpSeries(t, 1, 10), left)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkSetOpOutput(t, except, []int64{4, 5, 6, 7, 8, 9, 10})
+}
+
+func TestSetOpTypeMismatch(t *testing.T) {
+	td, _, _ := makeTupleTestVars()
+	if _, err := NewIntersectOp(newIntsOp(1, 2), &intsOp{desc: td}); err == nil {
+		t.Errorf("expected an error for inputs of different types")
+	}
+}
@@ -0,0 +1,57 @@
+package godb
+
+// StatefulFilterFunc decides whether a [StatefulFilter] keeps tuple t, given
+// the state left by the tuples before it, and returns the state for the tuples
+// after it
+type StatefulFilterFunc func(state DBValue, t *Tuple) (newState DBValue, keep bool)
+
+type StatefulFilter struct {
+	child Operator
+	init  DBValue
+	fn    StatefulFilterFunc
+}
+
+// NewStatefulFilter Construct a filter whose condition depends on the tuples
+// before the one it is applied to, e.g., keeping the tuples until a running
+// sum exceeds a threshold. fn is applied to the tuples of child in order,
+// carrying a state that starts as init.
+func NewStatefulFilter(child Operator, init DBValue, fn StatefulFilterFunc) *StatefulFilter {
+	return &StatefulFilter{child, init, fn}
+}
+
+// Descriptor Return the TupleDesc of the child, as tuples are returned whole.
+func (f *StatefulFilter) Descriptor() *TupleDesc {
+	return f.child.Descriptor()
+}
+
+// Iterator Return the tuples of the child that fn keeps, in order. Every
+// iteration starts again from the initial state.
+func (f *StatefulFilter) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error), err error) {
+	childIter, err := f.child.Iterator(tid)
+	if err != nil {
+		DPrintf("StatefulFilter Iterator get child iterator err: %v", err)
+		return
+	}
+
+	state := f.init
+	iterFunc = func() (*Tuple, error) {
+		for {
+			tuple, err := childIter()
+			if err != nil {
+				DPrintf("StatefulFilter Iterator childIter() err: %v", err)
+				return nil, err
+			}
+			if tuple == nil {
+				return nil, nil
+			}
+
+			var keep bool
+			state, keep = f.fn(state, tuple)
+			if keep {
+				return tuple, nil
+			}
+			ReleaseTuple(f.child, tuple)
+		}
+	}
+	return
+}
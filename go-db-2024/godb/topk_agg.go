@@ -0,0 +1,146 @@
+package godb
+
+import (
+	"fmt"
+	"slices"
+)
+
+// TopKFrequentAggState Implements an approximate aggregation of the k most
+// frequent values of an expression, with the Space-Saving sketch: it counts at
+// most k distinct values at once, and a value not counted yet takes the place
+// of the least counted one, starting from its count. Of n values added, every
+// value that occurs more than n/k times is reported, and the count of a
+// reported value exceeds its true count by at most the count it started from,
+// itself at most n/k. NULL values are not counted.
+//
+// As a [MultiRowAggState], it returns a tuple per value, with its approximate
+// count, from the most frequent down.
+type TopKFrequentAggState struct {
+	alias string
+	expr  Expr
+	k     int
+
+	n        int64                     // the values added
+	counters map[any]*frequencyCounter // by the [DBValue.HashKey] of their values
+}
+
+// the approximate count of a value of a TopKFrequentAggState, which includes
+// overestimate from the count of the value it replaced
+type frequencyCounter struct {
+	value        DBValue
+	count        int64
+	overestimate int64
+}
+
+// NewTopKFrequentAggState Construct an aggregation state for the k most
+// frequent values.
+func NewTopKFrequentAggState(k int) *TopKFrequentAggState {
+	return &TopKFrequentAggState{k: k}
+}
+
+func (a *TopKFrequentAggState) Copy() AggState {
+	cp := &TopKFrequentAggState{alias: a.alias, expr: a.expr, k: a.k, n: a.n}
+	if a.counters != nil {
+		cp.counters = make(map[any]*frequencyCounter, len(a.counters))
+		for key, c := range a.counters {
+			counter := *c
+			cp.counters[key] = &counter
+		}
+	}
+	return cp
+}
+
+func (a *TopKFrequentAggState) Init(alias string, expr Expr) error {
+	if a.k <= 0 {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("top k frequent needs a positive k, got %d", a.k)}
+	}
+	a.alias = aggAlias(alias, "top_k", expr)
+	a.expr = expr
+	a.n = 0
+	a.counters = make(map[any]*frequencyCounter, a.k)
+	return nil
+}
+
+func (a *TopKFrequentAggState) AddTuple(t *Tuple) {
+	val, err := a.expr.EvalExpr(t)
+	if err != nil {
+		return
+	}
+	if _, isNull := val.(NullField); isNull {
+		return
+	}
+
+	a.n++
+	key := val.HashKey()
+	if c, ok := a.counters[key]; ok {
+		c.count++
+		return
+	}
+	if len(a.counters) < a.k {
+		a.counters[key] = &frequencyCounter{value: val, count: 1}
+		return
+	}
+
+	// the value takes the place of the least counted one
+	var minKey any
+	var minCounter *frequencyCounter
+	for k, c := range a.counters {
+		if minCounter == nil || c.count < minCounter.count {
+			minKey, minCounter = k, c
+		}
+	}
+	delete(a.counters, minKey)
+	a.counters[key] = &frequencyCounter{value: val, count: minCounter.count + 1, overestimate: minCounter.count}
+}
+
+func (a *TopKFrequentAggState) GetTupleDesc() *TupleDesc {
+	exprType := a.expr.GetExprType()
+	return &TupleDesc{
+		Fields: []FieldType{
+			{a.alias, "", exprType.Ftype},
+			{a.alias + "_count", "", IntType},
+		},
+	}
+}
+
+// Return the counters from the largest count down, values of equal counts in
+// ascending order.
+func (a *TopKFrequentAggState) sortedCounters() []*frequencyCounter {
+	counters := make([]*frequencyCounter, 0, len(a.counters))
+	for _, c := range a.counters {
+		counters = append(counters, c)
+	}
+	slices.SortFunc(counters, func(c1, c2 *frequencyCounter) int {
+		switch {
+		case c1.count != c2.count:
+			return int(c2.count - c1.count)
+		case c1.value.EvalPred(c2.value, OpLt):
+			return -1
+		case c2.value.EvalPred(c1.value, OpLt):
+			return 1
+		}
+		return 0
+	})
+	return counters
+}
+
+// Finalize Return the most frequent value and its approximate count, or NULL
+// and 0 if no value was added.
+func (a *TopKFrequentAggState) Finalize() *Tuple {
+	if rows := a.FinalizeRows(); len(rows) > 0 {
+		return rows[0]
+	}
+	td := a.GetTupleDesc()
+	return &Tuple{*td, []DBValue{NullField{}, IntField{0}}, nil}
+}
+
+// FinalizeRows Return the (up to k) most frequent values with their
+// approximate counts, from the most frequent down.
+func (a *TopKFrequentAggState) FinalizeRows() []*Tuple {
+	td := a.GetTupleDesc()
+	rows := make([]*Tuple, 0, len(a.counters))
+	for _, c := range a.sortedCounters() {
+		rows = append(rows, &Tuple{*td, []DBValue{c.value, IntField{c.count}}, nil})
+	}
+	return rows
+}
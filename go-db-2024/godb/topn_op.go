@@ -0,0 +1,135 @@
+package godb
+
+import (
+	"container/heap"
+)
+
+type TopNOp struct {
+	orderBy   []Expr
+	child     Operator
+	ascending []bool
+	n         int64
+
+	// the most tuples the last iteration held at once
+	maxBuffered int
+}
+
+// NewTopNOp Construct an operator returning the first n tuples of child in the
+// order given by orderByFields and ascending, as for [NewOrderBy], like an
+// [OrderBy] under a [LimitOp] but holding at most n tuples at once.
+func NewTopNOp(orderByFields []Expr, child Operator, ascending []bool, n int64) (*TopNOp, error) {
+	if len(orderByFields) != len(ascending) {
+		return nil, GoDBError{IllegalOperationError, "args invalid"}
+	}
+	return &TopNOp{orderBy: orderByFields, child: child, ascending: ascending, n: n}, nil
+}
+
+// FuseOrderByLimit Return a [TopNOp] computing limit, if limit reads the output
+// of orderBy directly; otherwise limit is returned unchanged.
+func FuseOrderByLimit(orderBy *OrderBy, limit *LimitOp) Operator {
+	if limit.child != Operator(orderBy) {
+		return limit
+	}
+	topN, err := NewTopNOp(orderBy.orderBy, orderBy.child, orderBy.ascending, limit.limit)
+	if err != nil {
+		return limit
+	}
+	return topN
+}
+
+// Descriptor Return the TupleDesc of the child, as tuples are returned whole.
+func (t *TopNOp) Descriptor() *TupleDesc {
+	return t.child.Descriptor()
+}
+
+// MaxBuffered Return the most tuples the last iteration held at once.
+func (t *TopNOp) MaxBuffered() int {
+	return t.maxBuffered
+}
+
+// Iterator Return the first n tuples of the child in sorted order. The child is
+// read in full, keeping the n best tuples so far in a heap with the worst of
+// them on top, which a better tuple replaces. Tuples with equal keys are
+// returned in the order the child returned them, as a stable sort would.
+func (t *TopNOp) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error), err error) {
+	t.maxBuffered = 0
+	childIter, err := t.child.Iterator(tid)
+	if err != nil {
+		DPrintf("TopNOp Iterator get child iterator err: %v", err)
+		return
+	}
+
+	h := &topNHeap{orderBy: t.orderBy, ascending: t.ascending}
+	for seq := 0; ; seq++ {
+		var tuple *Tuple
+		tuple, err = childIter()
+		if err != nil {
+			DPrintf("TopNOp Iterator childIter() err: %v", err)
+			for _, item := range h.items {
+				ReleaseTuple(t.child, item.tuple)
+			}
+			return nil, err
+		}
+		if tuple == nil {
+			break
+		}
+
+		item := mergeItem{tuple, seq}
+		if int64(h.Len()) < t.n {
+			heap.Push(h, item)
+			t.maxBuffered = max(t.maxBuffered, h.Len())
+			continue
+		}
+		// a later tuple only replaces the worst one if it sorts strictly before
+		if h.Len() > 0 && tupleLess(tuple, h.items[0].tuple, t.orderBy, t.ascending) {
+			ReleaseTuple(t.child, h.items[0].tuple)
+			h.items[0] = item
+			heap.Fix(h, 0)
+		} else {
+			ReleaseTuple(t.child, tuple)
+		}
+	}
+
+	// popping returns the worst tuple first
+	sorted := make([]*Tuple, h.Len())
+	for i := len(sorted) - 1; i >= 0; i-- {
+		sorted[i] = heap.Pop(h).(mergeItem).tuple
+	}
+	return sliceIterator(sorted), nil
+}
+
+// topNHeap is a [heap.Interface] of the best tuples of a [TopNOp] so far, with
+// the worst one on top; the iter of an item is its position in the child
+type topNHeap struct {
+	items     []mergeItem
+	orderBy   []Expr
+	ascending []bool
+}
+
+func (h *topNHeap) Len() int {
+	return len(h.items)
+}
+
+func (h *topNHeap) Less(i, j int) bool {
+	if tupleLess(h.items[j].tuple, h.items[i].tuple, h.orderBy, h.ascending) {
+		return true
+	}
+	if tupleLess(h.items[i].tuple, h.items[j].tuple, h.orderBy, h.ascending) {
+		return false
+	}
+	return h.items[i].iter > h.items[j].iter
+}
+
+func (h *topNHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+}
+
+func (h *topNHeap) Push(x any) {
+	h.items = append(h.items, x.(mergeItem))
+}
+
+func (h *topNHeap) Pop() any {
+	reply := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return reply
+}
@@ -0,0 +1,68 @@
+package godb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTopNFuseOrderByLimit(t *testing.T) {
+	_, t1, _, hf, _, tid := makeTestVars(t)
+	const ntups, limit = 300, 20
+	for i := 0; i < ntups; i++ {
+		// many ties, told apart by name
+		tup := Tuple{t1.Desc, []DBValue{StringField{fmt.Sprintf("n%d", i)}, IntField{int64(i * 37 % 50)}}, nil}
+		insertTupleForTest(t, hf, &tup, tid)
+	}
+
+	age := &FieldExpr{t1.Desc.Fields[1]}
+	for _, asc := range []bool{true, false} {
+		orderBy, err := NewOrderBy([]Expr{age}, hf, []bool{asc})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		limitOp := NewLimitOp(IntConst(limit), orderBy)
+
+		fused := FuseOrderByLimit(orderBy, limitOp)
+		topN, ok := fused.(*TopNOp)
+		if !ok {
+			t.Fatalf("expected a TopNOp, got %T", fused)
+		}
+
+		iter, err := limitOp.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var expected []*Tuple
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				break
+			}
+			expected = append(expected, tup)
+		}
+
+		iter, err = topN.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := CheckIfOutputMatches(iter, expected); err != nil {
+			t.Errorf("ascending %v: %v", asc, err)
+		}
+		if topN.MaxBuffered() > limit {
+			t.Errorf("expected at most %d tuples buffered, got %d", limit, topN.MaxBuffered())
+		}
+	}
+
+	// a limit that does not read the order by directly is left alone
+	orderBy, err := NewOrderBy([]Expr{age}, hf, []bool{true})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	limitOp := NewLimitOp(IntConst(limit), hf)
+	if fused := FuseOrderByLimit(orderBy, limitOp); fused != Operator(limitOp) {
+		t.Errorf("expected the limit back, got %T", fused)
+	}
+}
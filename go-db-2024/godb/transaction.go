@@ -1,6 +1,10 @@
 package godb
 
-import "sync"
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
 
 type TransactionID int
 
@@ -16,3 +20,73 @@ func NewTID() TransactionID {
 }
 
 //var tid TransactionID = NewTID()
+
+// the sequence number of the last write to a tuple of any HeapFile, see
+// [HeapFile.tupleVersion]
+var writeSeq atomic.Int64
+
+// Return the sequence number of a new write, greater than those of the writes
+// before it.
+func nextWriteSeq() int64 {
+	return writeSeq.Add(1)
+}
+
+// the context of every transaction running an [IteratorCtx] query
+var tidContexts sync.Map
+
+// IteratorCtx Return an iterator over the results of op in transaction tid,
+// like op.Iterator, that can be cancelled through ctx. Once ctx is done, the
+// iterator returns ctx.Err(). The heap file scans of the transaction check ctx
+// for every tuple, so operators that consume their whole input before
+// returning anything (joins, sorts, aggregates) are interrupted as well.
+//
+// A transaction should run one IteratorCtx query at a time.
+func IteratorCtx(ctx context.Context, op Operator, tid TransactionID) (func() (*Tuple, error), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// the context stays registered until the query ends, so that the scans
+	// can see it being cancelled
+	tidContexts.Store(tid, ctx)
+	done := func() {
+		tidContexts.CompareAndDelete(tid, ctx)
+	}
+
+	iter, err := op.Iterator(tid)
+	if err != nil {
+		done()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+
+	return func() (*Tuple, error) {
+		if err := ctx.Err(); err != nil {
+			done()
+			return nil, err
+		}
+		tuple, err := iter()
+		if err != nil {
+			done()
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			return nil, err
+		}
+		if tuple == nil {
+			done()
+		}
+		return tuple, nil
+	}, nil
+}
+
+// Return the error of the context of transaction tid if it has been cancelled
+// (see [IteratorCtx]), or nil.
+func transactionCtxErr(tid TransactionID) error {
+	ctx, ok := tidContexts.Load(tid)
+	if !ok {
+		return nil
+	}
+	return ctx.(context.Context).Err()
+}
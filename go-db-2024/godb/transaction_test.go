@@ -0,0 +1,55 @@
+package godb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIteratorCtxCancel(t *testing.T) {
+	_, t1, t2, hf, bp, tid := makeTestVars(t)
+	for i := 0; i < 1000; i++ {
+		insertTupleForTest(t, hf, &t1, tid)
+		insertTupleForTest(t, hf, &t2, tid)
+		if i%50 == 0 {
+			bp.FlushAllPages()
+		}
+	}
+	bp.FlushAllPages()
+
+	// a nested loops join of the file with itself, sorted, takes far longer
+	// than the timeout
+	ageField := FieldExpr{t1.Desc.Fields[1]}
+	join, err := NewJoin(hf, &ageField, hf, &ageField, 1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	plan, err := NewOrderBy([]Expr{&ageField}, join, []bool{true})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	iter, err := IteratorCtx(ctx, plan, tid)
+	if err == nil {
+		_, err = iter()
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("cancelled query took %v to return", elapsed)
+	}
+
+	// the transaction can run uncancelled queries afterwards
+	iter, err = IteratorCtx(context.Background(), hf, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup, err := iter(); err != nil || tup == nil {
+		t.Fatalf("expected a tuple, got %v (err %v)", tup, err)
+	}
+}
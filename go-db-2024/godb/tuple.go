@@ -7,8 +7,11 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
+	"sync"
+	"unicode/utf8"
 )
 
 // DBType is the type of a tuple field, in GoDB, e.g., IntType or StringType
@@ -17,15 +20,49 @@ type DBType int
 const (
 	IntType     DBType = iota
 	StringType  DBType = iota
+	BoolType    DBType = iota
 	UnknownType DBType = iota //used internally, during parsing, because sometimes the type is unknown
+	DecimalType DBType = iota // a [DecimalField] of scale 0, see [DecimalTypeOf]
 )
 
+// decimalScaleShift is the shift of the scale in the DBType of a decimal, which
+// keeps the scale of a column in its type.
+const decimalScaleShift = 8
+
+// DecimalTypeOf Return the DBType of the decimals of the given scale, e.g.,
+// decimal(2) for amounts of money; DecimalTypeOf(0) is DecimalType.
+func DecimalTypeOf(scale uint8) DBType {
+	return DecimalType | DBType(scale)<<decimalScaleShift
+}
+
+// Scale Return the digits after the point of a decimal type, or 0 for another
+// type.
+func (t DBType) Scale() uint8 {
+	if t.kind() != DecimalType {
+		return 0
+	}
+	return uint8(t >> decimalScaleShift)
+}
+
+// Return t without the scale of a decimal type, e.g., DecimalType for any
+// decimal, so that it can be switched on.
+func (t DBType) kind() DBType {
+	return t & (1<<decimalScaleShift - 1)
+}
+
 func (t DBType) String() string {
-	switch t {
+	switch t.kind() {
 	case IntType:
 		return "int"
 	case StringType:
 		return "string"
+	case BoolType:
+		return "bool"
+	case DecimalType:
+		if t.Scale() > 0 {
+			return fmt.Sprintf("decimal(%d)", t.Scale())
+		}
+		return "decimal"
 	}
 	return "unknown"
 }
@@ -107,6 +144,15 @@ func (td *TupleDesc) setTableAlias(alias string) {
 	td.Fields = fields
 }
 
+// Return a TupleDesc of the fields at indexes cols of td, in that order.
+func (td *TupleDesc) projectCols(cols []int) (reply *TupleDesc) {
+	reply = &TupleDesc{make([]FieldType, 0, len(cols))}
+	for _, col := range cols {
+		reply.Fields = append(reply.Fields, td.Fields[col])
+	}
+	return
+}
+
 // Merge two TupleDescs together.  The resulting TupleDesc
 // should consist of the fields of desc2
 // appended onto the fields of desc.
@@ -122,6 +168,11 @@ func (td *TupleDesc) merge(desc2 *TupleDesc) (reply *TupleDesc) {
 // Interface for tuple field values
 type DBValue interface {
 	EvalPred(v DBValue, op BoolOp) bool
+	// HashKey Return a comparable key for the value, to key Go maps with:
+	// values equal by EvalPred have equal keys (e.g., the int 5 and the
+	// decimal 5.00), and so do NULLs, as DISTINCT and GROUP BY treat them as
+	// equal.
+	HashKey() any
 }
 
 // Integer field value
@@ -134,6 +185,25 @@ type StringField struct {
 	Value string
 }
 
+// Boolean field value
+type BoolField struct {
+	Value bool
+}
+
+// NullField is the SQL NULL value. It may appear in a column of any type, but
+// cannot be stored in a heap file.
+type NullField struct{}
+
+// EvalPred Following SQL's three valued logic, no comparison involving NULL is
+// true, not even NULL = NULL.
+func (n NullField) EvalPred(v DBValue, op BoolOp) bool {
+	return false
+}
+
+func (n NullField) HashKey() any {
+	return n
+}
+
 // Tuple represents the contents of a tuple read from a database
 // It includes the tuple descriptor, and the value of the fields
 type Tuple struct {
@@ -145,8 +215,91 @@ type Tuple struct {
 type recordID interface {
 }
 
+// tuplePool recycles the Tuples allocated by projections (see [Tuple.project]
+// and [Project]) and joins (see [EqualityJoin]), which otherwise create a fresh
+// Tuple and Fields slice for every row they produce. The tuples of scans are
+// not pooled: they are owned by the cached heap pages, which return the same
+// Tuple to every scan of the page.
+var tuplePool = sync.Pool{
+	New: func() any {
+		return new(Tuple)
+	},
+}
+
+// Get a Tuple with the given descriptor and an empty Fields slice with room
+// for numFields values from the tuple pool.
+func newPooledTuple(desc TupleDesc, numFields int) *Tuple {
+	t := tuplePool.Get().(*Tuple)
+	t.Desc = desc
+	if cap(t.Fields) < numFields {
+		t.Fields = make([]DBValue, 0, numFields)
+	}
+	t.Fields = t.Fields[:0]
+	t.Rid = nil
+	return t
+}
+
+// Return a Tuple obtained from [newPooledTuple] to the tuple pool. The caller
+// must not use t afterwards.
+func releasePooledTuple(t *Tuple) {
+	if t == nil {
+		return
+	}
+	clear(t.Fields)
+	t.Desc = TupleDesc{}
+	t.Rid = nil
+	tuplePool.Put(t)
+}
+
+// TupleReleaser is implemented by operators whose iterators return tuples that
+// may be recycled once the consumer is done with them.
+type TupleReleaser interface {
+	ReleaseTuple(t *Tuple)
+}
+
+// ReleaseTuple Hand a tuple returned by op's iterator back to op once the
+// caller no longer references it, so that op can reuse its memory. Operators
+// that do not implement [TupleReleaser] (e.g., [HeapFile], whose tuples are
+// owned by cached pages) are left untouched.
+func ReleaseTuple(op Operator, t *Tuple) {
+	if releaser, ok := op.(TupleReleaser); ok {
+		releaser.ReleaseTuple(t)
+	}
+}
+
 func getRecordID(pageNo, slot int) recordID {
-	return fmt.Sprintf("%d-%d", pageNo, slot)
+	var buf [41]byte
+	id := strconv.AppendInt(buf[:0], int64(pageNo), 10)
+	id = append(id, '-')
+	id = strconv.AppendInt(id, int64(slot), 10)
+	return string(id)
+}
+
+// Return the record ids of n tuples of page pageNo, like [getRecordID], with
+// the tuples at slots, or at slots 0 to n-1 if slots is nil. The ids share the
+// memory of one string, as the tuples of a page are read at once.
+func getRecordIDs(pageNo int, slots []int, n int) []recordID {
+	var buf []byte
+	ends := make([]int, n)
+	for i := range ends {
+		slot := i
+		if slots != nil {
+			slot = slots[i]
+		}
+		buf = strconv.AppendInt(buf, int64(pageNo), 10)
+		buf = append(buf, '-')
+		buf = strconv.AppendInt(buf, int64(slot), 10)
+		ends[i] = len(buf)
+	}
+
+	all := string(buf)
+	ids := make([]recordID, n)
+	start := 0
+	for i, end := range ends {
+		ids[i] = all[start:end]
+		start = end
+	}
+	return ids
 }
 
 func splitRecordID(id recordID) (pageNo, slot int) {
@@ -154,10 +307,9 @@ func splitRecordID(id recordID) (pageNo, slot int) {
 		return
 	}
 
-	str := id.(string)
-	strSlice := strings.Split(str, "-")
-	pageNo, _ = strconv.Atoi(strSlice[0])
-	slot, _ = strconv.Atoi(strSlice[1])
+	page, slotStr, _ := strings.Cut(id.(string), "-")
+	pageNo, _ = strconv.Atoi(page)
+	slot, _ = strconv.Atoi(slotStr)
 	return
 }
 
@@ -176,20 +328,45 @@ func splitRecordID(id recordID) (pageNo, slot int) {
 // May return an error if the buffer has insufficient capacity to store the
 // tuple.
 func (t *Tuple) writeTo(b *bytes.Buffer) (err error) {
+	return t.writeEncodedTo(b, nil)
+}
+
+// Serialize the tuple like [Tuple.writeTo], except that if dict is non-nil,
+// strings are written as their uint16 index in dict, which must hold them all,
+// as on a dictionary page.
+func (t *Tuple) writeEncodedTo(b *bytes.Buffer, dict map[string]uint16) (err error) {
 	for index, fieldType := range t.Desc.Fields {
-		switch fieldType.Ftype {
+		if _, isNull := t.Fields[index].(NullField); isNull {
+			return GoDBError{TypeMismatchError, fmt.Sprintf("can not serialize NULL in field %s", fieldType.Fname)}
+		}
+
+		switch fieldType.Ftype.kind() {
 		case IntType:
 			filed := t.Fields[index].(IntField)
 			err = binary.Write(b, binary.LittleEndian, filed.Value)
 
 		case StringType:
 			filed := t.Fields[index].(StringField)
-			tmpStr := filed.Value
+			tmpStr := truncateString(filed.Value, StringLength)
+			if dict != nil {
+				err = binary.Write(b, binary.LittleEndian, dict[tmpStr])
+				break
+			}
 			if len(tmpStr) < StringLength {
-				tmpStr += strings.Repeat(" ", StringLength-len(filed.Value))
+				tmpStr += strings.Repeat(" ", StringLength-len(tmpStr))
 			}
 			err = binary.Write(b, binary.LittleEndian, []byte(tmpStr))
 
+		case BoolType:
+			filed := t.Fields[index].(BoolField)
+			err = binary.Write(b, binary.LittleEndian, filed.Value)
+
+		case DecimalType:
+			filed := t.Fields[index].(DecimalField)
+			if err = binary.Write(b, binary.LittleEndian, filed.Value); err == nil {
+				err = b.WriteByte(filed.Scale)
+			}
+
 		default:
 			continue
 		}
@@ -203,6 +380,19 @@ func (t *Tuple) writeTo(b *bytes.Buffer) (err error) {
 	return
 }
 
+// Truncate str to at most maxBytes bytes, without splitting a multibyte UTF-8
+// character.
+func truncateString(str string, maxBytes int) string {
+	if len(str) <= maxBytes {
+		return str
+	}
+	end := maxBytes
+	for end > 0 && !utf8.RuneStart(str[end]) {
+		end--
+	}
+	return str[:end]
+}
+
 // Read the contents of a tuple with the specified [TupleDesc] from the
 // specified buffer, returning a Tuple.
 //
@@ -217,17 +407,32 @@ func (t *Tuple) writeTo(b *bytes.Buffer) (err error) {
 // May return an error if the buffer has insufficent tuples to deserialize the
 // tuple.
 func readTupleFrom(b *bytes.Buffer, desc *TupleDesc) (reply *Tuple, err error) {
+	return readEncodedTupleFrom(b, desc, nil)
+}
+
+// Read a tuple like [readTupleFrom], except that if dict is non-nil, strings
+// are read as uint16 indexes in dict, as written by [Tuple.writeEncodedTo].
+func readEncodedTupleFrom(b *bytes.Buffer, desc *TupleDesc, dict []string) (reply *Tuple, err error) {
 	replyTuple := &Tuple{
 		Desc:   *desc,
 		Fields: make([]DBValue, 0, len(desc.Fields)),
 		Rid:    nil,
 	}
+	if err = readEncodedFieldsInto(b, desc, dict, replyTuple); err != nil {
+		return
+	}
+	return replyTuple, nil
+}
 
+// Read the fields of a tuple like [readEncodedTupleFrom], appending them to
+// replyTuple.Fields, so that callers reading many tuples can allocate them at
+// once.
+func readEncodedFieldsInto(b *bytes.Buffer, desc *TupleDesc, dict []string, replyTuple *Tuple) (err error) {
 	for _, filedDesc := range desc.Fields {
-		switch filedDesc.Ftype {
+		switch filedDesc.Ftype.kind() {
 		case IntType:
 			var tmpInt64 int64
-			err = binary.Read(b, binary.LittleEndian, &tmpInt64)
+			tmpInt64, err = readInt64(b)
 			if err != nil {
 				DPrintf("readTupleFrom read int err:%v", err)
 				return
@@ -235,6 +440,16 @@ func readTupleFrom(b *bytes.Buffer, desc *TupleDesc) (reply *Tuple, err error) {
 
 			replyTuple.Fields = append(replyTuple.Fields, IntField{tmpInt64})
 		case StringType:
+			if dict != nil {
+				var str string
+				if str, err = readDictString(b, dict); err != nil {
+					DPrintf("readTupleFrom read string index err:%v", err)
+					return
+				}
+				replyTuple.Fields = append(replyTuple.Fields, StringField{str})
+				continue
+			}
+
 			tmpBytes := make([]byte, StringLength)
 			err = binary.Read(b, binary.LittleEndian, tmpBytes)
 			if err != nil {
@@ -243,13 +458,147 @@ func readTupleFrom(b *bytes.Buffer, desc *TupleDesc) (reply *Tuple, err error) {
 			}
 
 			replyTuple.Fields = append(replyTuple.Fields, StringField{strings.TrimSpace(string(tmpBytes))})
+		case BoolType:
+			var tmpBool bool
+			err = binary.Read(b, binary.LittleEndian, &tmpBool)
+			if err != nil {
+				DPrintf("readTupleFrom read bool err:%v", err)
+				return
+			}
+
+			replyTuple.Fields = append(replyTuple.Fields, BoolField{tmpBool})
+		case DecimalType:
+			var tmpDecimal DecimalField
+			err = binary.Read(b, binary.LittleEndian, &tmpDecimal)
+			if err != nil {
+				DPrintf("readTupleFrom read decimal err:%v", err)
+				return
+			}
+
+			replyTuple.Fields = append(replyTuple.Fields, tmpDecimal)
 		default:
 			continue
 		}
 
 	}
 
-	return replyTuple, nil
+	return nil
+}
+
+// Read a little endian int64 from b, like [binary.Read] does but without
+// allocating.
+func readInt64(b *bytes.Buffer) (int64, error) {
+	buf := b.Next(8)
+	if len(buf) == 0 {
+		return 0, io.EOF
+	}
+	if len(buf) < 8 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return int64(binary.LittleEndian.Uint64(buf)), nil
+}
+
+// Read a uint16 index in dict from b, and return the string at that index.
+func readDictString(b *bytes.Buffer, dict []string) (string, error) {
+	var index uint16
+	if err := binary.Read(b, binary.LittleEndian, &index); err != nil {
+		return "", err
+	}
+	if int(index) >= len(dict) {
+		return "", GoDBError{MalformedDataError, fmt.Sprintf("string index %d out of range for a dictionary of %d strings", index, len(dict))}
+	}
+	return dict[index], nil
+}
+
+// readProjectedTupleFrom Read the fields at indexes cols of a tuple with
+// descriptor desc from a bytes buffer, in the order given by cols. The other
+// fields are skipped over without being deserialized. The returned tuple's Desc
+// is left empty, as for [readTupleFrom] the caller is expected to set it. If
+// dict is non-nil, strings are dictionary encoded as for [readEncodedTupleFrom].
+func readProjectedTupleFrom(b *bytes.Buffer, desc *TupleDesc, cols []int, dict []string) (reply *Tuple, err error) {
+	wanted := make([]DBValue, len(desc.Fields))
+	needed := make([]bool, len(desc.Fields))
+	for _, col := range cols {
+		needed[col] = true
+	}
+
+	for index, filedDesc := range desc.Fields {
+		switch filedDesc.Ftype.kind() {
+		case IntType:
+			if !needed[index] {
+				b.Next(8)
+				continue
+			}
+
+			var tmpInt64 int64
+			tmpInt64, err = readInt64(b)
+			if err != nil {
+				DPrintf("readProjectedTupleFrom read int err:%v", err)
+				return
+			}
+			wanted[index] = IntField{tmpInt64}
+		case StringType:
+			if dict != nil {
+				if !needed[index] {
+					b.Next(2)
+					continue
+				}
+				var str string
+				if str, err = readDictString(b, dict); err != nil {
+					DPrintf("readProjectedTupleFrom read string index err:%v", err)
+					return
+				}
+				wanted[index] = StringField{str}
+				continue
+			}
+			if !needed[index] {
+				b.Next(StringLength)
+				continue
+			}
+
+			tmpBytes := make([]byte, StringLength)
+			err = binary.Read(b, binary.LittleEndian, tmpBytes)
+			if err != nil {
+				DPrintf("readProjectedTupleFrom read string err:%v", err)
+				return
+			}
+			wanted[index] = StringField{strings.TrimSpace(string(tmpBytes))}
+		case BoolType:
+			if !needed[index] {
+				b.Next(1)
+				continue
+			}
+
+			var tmpBool bool
+			err = binary.Read(b, binary.LittleEndian, &tmpBool)
+			if err != nil {
+				DPrintf("readProjectedTupleFrom read bool err:%v", err)
+				return
+			}
+			wanted[index] = BoolField{tmpBool}
+		case DecimalType:
+			if !needed[index] {
+				b.Next(decimalFieldSize)
+				continue
+			}
+
+			var tmpDecimal DecimalField
+			err = binary.Read(b, binary.LittleEndian, &tmpDecimal)
+			if err != nil {
+				DPrintf("readProjectedTupleFrom read decimal err:%v", err)
+				return
+			}
+			wanted[index] = tmpDecimal
+		default:
+			continue
+		}
+	}
+
+	reply = &Tuple{Fields: make([]DBValue, 0, len(cols))}
+	for _, col := range cols {
+		reply.Fields = append(reply.Fields, wanted[col])
+	}
+	return reply, nil
 }
 
 // Compare two tuples for equality.  Equality means that the TupleDescs are equal
@@ -274,6 +623,12 @@ func (t *Tuple) equals(t2 *Tuple) bool {
 	}
 
 	for index, field := range t.Fields {
+		// unlike in predicates, two NULLs are the same tuple field
+		if _, isNull := field.(NullField); isNull {
+			if _, isNull2 := t2.Fields[index].(NullField); isNull2 {
+				continue
+			}
+		}
 		if !field.EvalPred(t2.Fields[index], OpEq) {
 			return false
 		}
@@ -300,6 +655,15 @@ func joinTuples(t1 *Tuple, t2 *Tuple) *Tuple {
 	}
 }
 
+// Join two tuples like [joinTuples], into a Tuple taken from the tuple pool,
+// whose Fields do not share memory with those of t1 or t2.
+func joinPooledTuple(t1 *Tuple, t2 *Tuple) *Tuple {
+	reply := newPooledTuple(*t1.Desc.merge(&t2.Desc), len(t1.Fields)+len(t2.Fields))
+	reply.Fields = append(reply.Fields, t1.Fields...)
+	reply.Fields = append(reply.Fields, t2.Fields...)
+	return reply
+}
+
 type orderByState int
 
 const (
@@ -356,11 +720,8 @@ func (t *Tuple) compareField(t2 *Tuple, field Expr) (state orderByState, err err
 // entry t2.name in t, but only if there is not an entry t1.name in t)
 func (t *Tuple) project(fields []FieldType) (reply *Tuple, err error) {
 	var target int
-	reply = &Tuple{
-		Desc:   TupleDesc{Fields: fields},
-		Fields: make([]DBValue, 0, len(fields)),
-		Rid:    t.Rid,
-	}
+	reply = newPooledTuple(TupleDesc{Fields: fields}, len(fields))
+	reply.Rid = t.Rid
 	for _, field := range fields {
 		target, err = findFieldInTd(field, &t.Desc)
 		if err != nil {
@@ -373,11 +734,28 @@ func (t *Tuple) project(fields []FieldType) (reply *Tuple, err error) {
 	return
 }
 
-// Compute a key for the tuple to be used in a map structure
+// Compute a key for the tuple to be used in a map structure: tuples whose
+// fields have equal [DBValue.HashKey] keys have equal keys, whatever their
+// field names.
 func (t *Tuple) tupleKey() any {
-	var buf bytes.Buffer
-	t.writeTo(&buf)
-	return buf.String()
+	var key []byte
+	for _, field := range t.Fields {
+		switch k := field.HashKey().(type) {
+		case numericKey:
+			key = append(key, 'n')
+			key = binary.LittleEndian.AppendUint64(key, uint64(k.units))
+			key = append(key, k.scale)
+		case string:
+			key = append(key, 's')
+			key = binary.AppendUvarint(key, uint64(len(k)))
+			key = append(key, k...)
+		case bool:
+			key = append(key, 'b', byte(boolRank(k)))
+		default:
+			key = append(key, 'N')
+		}
+	}
+	return string(key)
 }
 
 var winWidth int = 120
@@ -425,13 +803,7 @@ func (td *TupleDesc) HeaderString(aligned bool) string {
 func (t *Tuple) PrettyPrintString(aligned bool) string {
 	outstr := ""
 	for i, f := range t.Fields {
-		str := ""
-		switch f := f.(type) {
-		case IntField:
-			str = strconv.FormatInt(f.Value, 10)
-		case StringField:
-			str = f.Value
-		}
+		str := valueString(f)
 		if aligned {
 			outstr = fmt.Sprintf("%s %s", outstr, fmtCol(str, len(t.Fields)))
 		} else {
@@ -444,3 +816,20 @@ func (t *Tuple) PrettyPrintString(aligned bool) string {
 	}
 	return outstr
 }
+
+// Return the text of a field value, as printed by [Tuple.PrettyPrintString].
+func valueString(f DBValue) string {
+	switch f := f.(type) {
+	case IntField:
+		return strconv.FormatInt(f.Value, 10)
+	case StringField:
+		return f.Value
+	case BoolField:
+		return strconv.FormatBool(f.Value)
+	case DecimalField:
+		return f.String()
+	case NullField:
+		return "NULL"
+	}
+	return ""
+}
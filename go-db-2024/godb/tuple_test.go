@@ -3,77 +3,93 @@ package godb
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 )
 
 func CheckIfOutputMatches(f func() (*Tuple, error), ts []*Tuple) error {
-	n := 0
-	for {
-		t1, err := f()
-		if err != nil {
-			return err
-		}
-		if t1 == nil {
-			break
-		}
-
-		if n >= len(ts) {
-			return fmt.Errorf("too many tuples returned. expected %d", len(ts))
-		}
-
-		t2 := ts[n]
-		if !t1.equals(t2) {
-			return fmt.Errorf("tuple %d did not match expected tuple. expected %v, got %v", n, t2, t1)
-		}
-		n++
-	}
-	if n < len(ts) {
-		return fmt.Errorf("too few tuples returned. expected %d, got %d", len(ts), n)
-	}
-	return nil
+	return CompareResultSets(f, ts, true)
 }
 
 func CheckIfOutputMatchesUnordered(f func() (*Tuple, error), ts []*Tuple) error {
-	n := len(ts)
-	found := make([]bool, n)
+	return CompareResultSets(f, ts, false)
+}
 
-	i := 0
-	for {
-		t1, err := f()
+// CompareResultSets Check that the tuples returned by iter are those of want:
+// in the same order if ordered, and otherwise as a multiset, so that duplicates
+// must appear as many times in both. On a mismatch, the error is a readable
+// diff that lists the expected tuples missing from the output with "-", and the
+// unexpected ones with "+". For ordered results holding the right tuples in
+// another order, it names the first position that differs instead. Reading
+// stops at the first tuple past the expected ones, so that an iterator that
+// never ends still fails the comparison.
+//
+// Like [CheckIfOutputMatches], it is a test helper, exported for the tests of
+// every package but only built with them.
+func CompareResultSets(iter func() (*Tuple, error), want []*Tuple, ordered bool) error {
+	var got []*Tuple
+	for len(got) <= len(want) {
+		t, err := iter()
 		if err != nil {
 			return err
 		}
-		if t1 == nil {
+		if t == nil {
 			break
 		}
-
-		if i >= n {
-			return fmt.Errorf("too many tuples returned. expected %d", n)
-		}
-
-		found_this := false
-		for j, t2 := range ts {
-			if !found[j] && t1.equals(t2) {
-				found[j] = true
-				found_this = true
+		got = append(got, t)
+	}
+	more := len(got) > len(want)
+
+	// match every expected tuple with an equal returned one
+	matched := make([]bool, len(got))
+	var missing, unexpected []*Tuple
+	for _, w := range want {
+		found := false
+		for j, g := range got {
+			if !matched[j] && g.equals(w) {
+				matched[j], found = true, true
 				break
 			}
 		}
-
-		if !found_this {
-			return fmt.Errorf("received unexpected tuple %v", t1)
+		if !found {
+			missing = append(missing, w)
 		}
-		i++
 	}
-	if i < n {
-		return fmt.Errorf("too few tuples returned. expected %d, got %d", n, i)
+	for j, g := range got {
+		if !matched[j] {
+			unexpected = append(unexpected, g)
+		}
 	}
-	for j, f := range found {
-		if !f {
-			return fmt.Errorf("missing tuple %v", ts[j])
+
+	if len(missing) == 0 && len(unexpected) == 0 {
+		if !ordered {
+			return nil
 		}
+		for i := range got {
+			if !got[i].equals(want[i]) {
+				return fmt.Errorf("result set has the expected %d tuples in another order; tuple %d: want (%s), got (%s)",
+					len(want), i, want[i].PrettyPrintString(false), got[i].PrettyPrintString(false))
+			}
+		}
+		return nil
+	}
+
+	var diff strings.Builder
+	if more {
+		fmt.Fprintf(&diff, "result set differs: want %d tuples, got more", len(want))
+	} else {
+		fmt.Fprintf(&diff, "result set differs: want %d tuples, got %d", len(want), len(got))
+	}
+	if len(want) > 0 && len(got) > 0 && !want[0].Desc.equals(&got[0].Desc) {
+		fmt.Fprintf(&diff, "\n  want columns (%s), got (%s)", want[0].Desc.HeaderString(false), got[0].Desc.HeaderString(false))
 	}
-	return nil
+	for _, t := range missing {
+		fmt.Fprintf(&diff, "\n- (%s)", t.PrettyPrintString(false))
+	}
+	for _, t := range unexpected {
+		fmt.Fprintf(&diff, "\n+ (%s)", t.PrettyPrintString(false))
+	}
+	return fmt.Errorf("%s", diff.String())
 }
 
 func makeTupleTestVars() (TupleDesc, Tuple, Tuple) {
@@ -508,3 +524,224 @@ func TestTupleJoinDesc2(t *testing.T) {
 		}
 	}
 }
+
+func TestTupleBoolSerialization(t *testing.T) {
+	td := TupleDesc{Fields: []FieldType{
+		{Fname: "name", Ftype: StringType},
+		{Fname: "valid", Ftype: BoolType},
+		{Fname: "age", Ftype: IntType},
+	}}
+	for _, valid := range []bool{true, false} {
+		t1 := Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, BoolField{valid}, IntField{25}}}
+		b := new(bytes.Buffer)
+		if err := t1.writeTo(b); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if b.Len() != StringLength+1+8 {
+			t.Errorf("expected a bool to take one byte, tuple took %d bytes", b.Len())
+		}
+		t2, err := readTupleFrom(b, &td)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if !t2.equals(&t1) {
+			t.Errorf("expected %v after a round trip, got %v", t1, t2)
+		}
+	}
+}
+
+func TestBoolFieldEvalPred(t *testing.T) {
+	f, tr := BoolField{false}, BoolField{true}
+	cases := []struct {
+		v1, v2   BoolField
+		op       BoolOp
+		expected bool
+	}{
+		{f, tr, OpLt, true},
+		{tr, f, OpLt, false},
+		{tr, f, OpGt, true},
+		{tr, tr, OpEq, true},
+		{f, tr, OpEq, false},
+		{f, tr, OpNeq, true},
+		{f, f, OpLe, true},
+		{tr, f, OpGe, true},
+	}
+	for _, c := range cases {
+		if got := c.v1.EvalPred(c.v2, c.op); got != c.expected {
+			t.Errorf("%v op %d %v: expected %v, got %v", c.v1.Value, c.op, c.v2.Value, c.expected, got)
+		}
+	}
+	if tr.EvalPred(IntField{1}, OpEq) {
+		t.Errorf("expected a bool not to equal an int")
+	}
+}
+
+func TestDBValueHashKey(t *testing.T) {
+	cases := []struct {
+		v1, v2 DBValue
+		equal  bool
+	}{
+		{IntField{5}, IntField{5}, true},
+		{IntField{5}, DecimalField{500, 2}, true},
+		{DecimalField{15, 1}, DecimalField{150, 2}, true},
+		{DecimalField{-20, 1}, IntField{-2}, true},
+		{StringField{"a"}, StringField{"a"}, true},
+		{BoolField{true}, BoolField{true}, true},
+		{NullField{}, NullField{}, true},
+		{IntField{5}, IntField{6}, false},
+		{IntField{15}, DecimalField{15, 1}, false},
+		{IntField{5}, StringField{"5"}, false},
+		{BoolField{true}, IntField{1}, false},
+		{StringField{"a"}, StringField{"A"}, false},
+		{NullField{}, IntField{0}, false},
+	}
+	for _, c := range cases {
+		if got := c.v1.HashKey() == c.v2.HashKey(); got != c.equal {
+			t.Errorf("%v and %v: expected equal keys %v, got %v", c.v1, c.v2, c.equal, got)
+		}
+		if _, isNull := c.v1.(NullField); !isNull && c.v1.EvalPred(c.v2, OpEq) != c.equal {
+			t.Errorf("%v = %v: expected %v to agree with the keys", c.v1, c.v2, c.equal)
+		}
+		t1 := Tuple{Fields: []DBValue{c.v1, StringField{"x"}}}
+		t2 := Tuple{Fields: []DBValue{c.v2, StringField{"x"}}}
+		if got := t1.tupleKey() == t2.tupleKey(); got != c.equal {
+			t.Errorf("(%v, x) and (%v, x): expected equal tuple keys %v, got %v", c.v1, c.v2, c.equal, got)
+		}
+	}
+
+	// the fields after a NULL are part of the key too
+	t1 := Tuple{Fields: []DBValue{NullField{}, IntField{1}}}
+	t2 := Tuple{Fields: []DBValue{NullField{}, IntField{2}}}
+	if t1.tupleKey() == t2.tupleKey() {
+		t.Errorf("expected (NULL, 1) and (NULL, 2) to have different keys")
+	}
+}
+
+func TestOperatorsAgreeOnHashKeys(t *testing.T) {
+	tid := NewTID()
+	prices := NewValueOp([][]Expr{
+		{DecimalConst(500, 2), IntConst(1)},
+		{DecimalConst(700, 2), IntConst(2)},
+		{DecimalConst(500, 2), IntConst(3)},
+	})
+	ints := newIntsOp(5, 6)
+
+	// the decimal 5.00 joins the int 5
+	price, _ := NewPositionalExpr(prices.Descriptor(), 0)
+	n, _ := NewPositionalExpr(ints.Descriptor(), 0)
+	join, err := NewJoin(prices, price, ints, n, 100)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := join.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if got := len(drainIterator(t, iter)); got != 2 {
+		t.Errorf("expected 2 join results, got %d", got)
+	}
+
+	// tuples with NULLs are distinct by their other fields, in projections and
+	// set operations alike
+	withNulls := func() *ValueOp {
+		return NewValueOp([][]Expr{
+			{NullConst(IntType), IntConst(1)},
+			{NullConst(IntType), IntConst(2)},
+			{NullConst(IntType), IntConst(1)},
+		})
+	}
+	child := withNulls()
+	var fields []Expr
+	for i := range child.Descriptor().Fields {
+		field, _ := NewPositionalExpr(child.Descriptor(), i)
+		fields = append(fields, field)
+	}
+	distinct, err := NewProjectOp(fields, []string{"a", "b"}, true, child)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err = distinct.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if got := len(drainIterator(t, iter)); got != 2 {
+		t.Errorf("expected 2 distinct tuples, got %d", got)
+	}
+
+	intersect, err := NewIntersectOp(withNulls(), NewValueOp([][]Expr{{NullConst(IntType), IntConst(2)}}))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err = intersect.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if got := drainIterator(t, iter); len(got) != 1 || got[0].Fields[1] != (IntField{2}) {
+		t.Errorf("expected the intersection (NULL, 2), got %v", got)
+	}
+}
+
+func TestCompareResultSets(t *testing.T) {
+	td, t1, t2 := makeTupleTestVars()
+	t3 := Tuple{td, []DBValue{StringField{"ann"}, IntField{7}}, nil}
+	want := []*Tuple{&t1, &t2, &t1}
+
+	for _, c := range []struct {
+		name     string
+		got      []*Tuple
+		ordered  bool
+		expected []string // lines of the error, none if the results match
+	}{
+		{"match", []*Tuple{&t1, &t2, &t1}, true, nil},
+		{"unordered match", []*Tuple{&t1, &t1, &t2}, false, nil},
+		{"reordered", []*Tuple{&t1, &t1, &t2}, true, []string{
+			"result set has the expected 3 tuples in another order; tuple 1: want (george jones,999), got (sam,25)",
+		}},
+		{"extra", []*Tuple{&t1, &t3, &t2, &t1}, false, []string{
+			"result set differs: want 3 tuples, got more",
+			"+ (ann,7)",
+		}},
+		{"missing duplicate", []*Tuple{&t2, &t1}, false, []string{
+			"result set differs: want 3 tuples, got 2",
+			"- (sam,25)",
+		}},
+		{"replaced", []*Tuple{&t1, &t3, &t1}, true, []string{
+			"result set differs: want 3 tuples, got 3",
+			"- (george jones,999)",
+			"+ (ann,7)",
+		}},
+	} {
+		err := CompareResultSets(sliceIterator(c.got), want, c.ordered)
+		if c.expected == nil {
+			if err != nil {
+				t.Errorf("%s: expected no error, got %v", c.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", c.name)
+		} else if msg := strings.Join(c.expected, "\n"); err.Error() != msg {
+			t.Errorf("%s: expected the error\n%s\ngot\n%s", c.name, msg, err)
+		}
+	}
+
+	// tuples of other columns do not match
+	other := Tuple{TupleDesc{[]FieldType{{Fname: "label", Ftype: StringType}, {Fname: "age", Ftype: IntType}}}, t3.Fields, nil}
+	err := CompareResultSets(sliceIterator([]*Tuple{&other}), []*Tuple{&t3}, false)
+	if err == nil || !strings.Contains(err.Error(), "want columns (name,age), got (label,age)") {
+		t.Errorf("expected the columns in the diff, got %v", err)
+	}
+
+	// an iterator that never ends is read one tuple past the expected ones
+	reads := 0
+	endless := func() (*Tuple, error) { reads++; return &t1, nil }
+	if err := CompareResultSets(endless, want, true); err == nil || reads != len(want)+1 {
+		t.Errorf("expected an error after %d reads, got %v after %d", len(want)+1, err, reads)
+	}
+
+	// errors of the iterator are returned
+	failing := func() (*Tuple, error) { return nil, GoDBError{IllegalOperationError, "scan failed"} }
+	if err := CompareResultSets(failing, want, false); err == nil || err.(GoDBError).code != IllegalOperationError {
+		t.Errorf("expected the iterator error, got %v", err)
+	}
+}
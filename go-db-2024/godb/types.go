@@ -2,6 +2,7 @@ package godb
 
 import (
 	"fmt"
+	"hash/fnv"
 	"regexp"
 	"strings"
 	"time"
@@ -19,19 +20,23 @@ func DPrintf(format string, a ...interface{}) {
 type GoDBErrorCode int
 
 const (
-	TupleNotFoundError      GoDBErrorCode = iota
-	PageFullError           GoDBErrorCode = iota
-	IncompatibleTypesError  GoDBErrorCode = iota
-	TypeMismatchError       GoDBErrorCode = iota
-	MalformedDataError      GoDBErrorCode = iota
-	BufferPoolFullError     GoDBErrorCode = iota
-	ParseError              GoDBErrorCode = iota
-	DuplicateTableError     GoDBErrorCode = iota
-	NoSuchTableError        GoDBErrorCode = iota
-	AmbiguousNameError      GoDBErrorCode = iota
-	IllegalOperationError   GoDBErrorCode = iota
-	DeadlockError           GoDBErrorCode = iota
-	IllegalTransactionError GoDBErrorCode = iota
+	TupleNotFoundError       GoDBErrorCode = iota
+	PageFullError            GoDBErrorCode = iota
+	IncompatibleTypesError   GoDBErrorCode = iota
+	TypeMismatchError        GoDBErrorCode = iota
+	MalformedDataError       GoDBErrorCode = iota
+	BufferPoolFullError      GoDBErrorCode = iota
+	ParseError               GoDBErrorCode = iota
+	DuplicateTableError      GoDBErrorCode = iota
+	NoSuchTableError         GoDBErrorCode = iota
+	AmbiguousNameError       GoDBErrorCode = iota
+	IllegalOperationError    GoDBErrorCode = iota
+	DeadlockError            GoDBErrorCode = iota
+	IllegalTransactionError  GoDBErrorCode = iota
+	ConflictError            GoDBErrorCode = iota
+	ConstraintViolationError GoDBErrorCode = iota
+	DuplicateKeyError        GoDBErrorCode = iota
+	SchemaMismatchError      GoDBErrorCode = iota
 )
 
 //go:generate stringer -type=GoDBErrorCode
@@ -55,6 +60,9 @@ type Page interface {
 	isDirty() bool
 	setDirty(tid TransactionID, dirty bool)
 	getFile() DBFile
+
+	// NumFreeSlots returns the number of tuples that can still be inserted
+	NumFreeSlots() int
 }
 
 type DBFile interface {
@@ -99,13 +107,53 @@ var BoolOpMap = map[string]BoolOp{
 	"like": OpLike,
 }
 
+// EvalPred Compare two ints, or an int and a decimal, by value.
 func (i1 IntField) EvalPred(v2 DBValue, op BoolOp) bool {
+	if d2, ok := v2.(DecimalField); ok {
+		return DecimalField{i1.Value, 0}.EvalPred(d2, op)
+	}
 	i2, ok := v2.(IntField)
 	if !ok {
 		return false
 	}
-	x1 := i1.Value
-	x2 := i2.Value
+	return evalIntPred(i1.Value, i2.Value, op)
+}
+
+// HashKey Return the key of the int as a decimal of scale 0.
+func (i1 IntField) HashKey() any {
+	return numericKey{i1.Value, 0}
+}
+
+// Compare two ints with op. This is the comparison of [IntField.EvalPred],
+// which operators call directly once they know both operands are ints, saving
+// the interface calls in tight loops.
+func evalIntPred(x1, x2 int64, op BoolOp) bool {
+	switch op {
+	case OpEq:
+		return x1 == x2
+	case OpNeq:
+		return x1 != x2
+	case OpGt:
+		return x1 > x2
+	case OpGe:
+		return x1 >= x2
+	case OpLt:
+		return x1 < x2
+	case OpLe:
+		return x1 <= x2
+	default:
+		return false
+	}
+}
+
+// EvalPred Compare two booleans, where false < true.
+func (i1 BoolField) EvalPred(v2 DBValue, op BoolOp) bool {
+	i2, ok := v2.(BoolField)
+	if !ok {
+		return false
+	}
+	x1 := boolRank(i1.Value)
+	x2 := boolRank(i2.Value)
 	switch op {
 	case OpEq:
 		return x1 == x2
@@ -124,6 +172,30 @@ func (i1 IntField) EvalPred(v2 DBValue, op BoolOp) bool {
 	}
 }
 
+func (i1 BoolField) HashKey() any {
+	return i1.Value
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (i1 StringField) HashKey() any {
+	return i1.Value
+}
+
+// Return a hash of key, a [DBValue.HashKey], that unlike the hashing of Go maps
+// is the same in every run of the program, e.g., to choose where to store a
+// value on disk.
+func stableHash(key any) uint64 {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%T:%v", key, key)
+	return hash.Sum64()
+}
+
 func (i1 StringField) EvalPred(v2 DBValue, op BoolOp) bool {
 	i2, ok := v2.(StringField)
 	if !ok {
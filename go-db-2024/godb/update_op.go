@@ -0,0 +1,96 @@
+package godb
+
+type UpdateOp struct {
+	updateFile  *HeapFile
+	updateExprs []Expr
+	child       Operator
+}
+
+// NewUpdateOp Construct an update operator. For every tuple of the child
+// Operator, the update operator replaces that tuple in updateFile with a tuple
+// whose ith field is the value of updateExprs[i] evaluated on the old tuple.
+// Returns an error if there is not one expression per field of updateFile.
+//
+// Updates are optimistic: no locks are taken, instead the version of each
+// tuple is recorded when it is read from the child and checked when it is
+// written back (see [HeapFile.updateTuple]).
+func NewUpdateOp(updateFile *HeapFile, updateExprs []Expr, child Operator) (*UpdateOp, error) {
+	if len(updateExprs) != len(updateFile.Descriptor().Fields) {
+		return nil, GoDBError{IllegalOperationError, "need one update expression per field"}
+	}
+
+	return &UpdateOp{
+		updateFile:  updateFile,
+		updateExprs: updateExprs,
+		child:       child,
+	}, nil
+}
+
+// Descriptor The update TupleDesc is a one column descriptor with an integer
+// field named "count".
+func (u *UpdateOp) Descriptor() *TupleDesc {
+	return &TupleDesc{[]FieldType{{"count", "", IntType}}}
+}
+
+// Iterator Return an iterator that updates all of the tuples from the child
+// iterator and then returns a one-field tuple with a "count" field indicating
+// the number of tuples that were updated. If another transaction modified one
+// of the tuples after tid began, even if before the tuple was read, the
+// iterator stops with a ConflictError and the transaction should be aborted
+// and retried. For a tid that was not begun with the buffer pool, only the
+// writes made after the tuple was read are detected.
+func (u *UpdateOp) Iterator(tid TransactionID) (iterFunc func() (*Tuple, error), err error) {
+	iterFunc = func() (reply *Tuple, err error) {
+		var (
+			tuple   *Tuple
+			version int64
+			tmpVal  DBValue
+			update  int64
+		)
+		childIter, err := u.child.Iterator(tid)
+		if err != nil {
+			return
+		}
+		for {
+			tuple, err = childIter()
+			if err != nil {
+				return
+			}
+			if tuple == nil {
+				break
+			}
+			// the child may have read the tuple well before returning it
+			if begin, ok := u.updateFile.bufPool.beginWriteSeq(tid); ok {
+				version = begin
+			} else {
+				version = u.updateFile.tupleVersion(tuple.Rid)
+			}
+
+			newTup := &Tuple{
+				Desc:   *u.updateFile.Descriptor(),
+				Fields: make([]DBValue, 0, len(u.updateExprs)),
+			}
+			for _, expr := range u.updateExprs {
+				tmpVal, err = expr.EvalExpr(tuple)
+				if err != nil {
+					DPrintf("UpdateOp EvalExpr err: %v", err)
+					return
+				}
+				newTup.Fields = append(newTup.Fields, tmpVal)
+			}
+
+			err = u.updateFile.updateTuple(tuple, newTup, version, tid)
+			if err != nil {
+				return
+			}
+			update++
+		}
+
+		reply = &Tuple{
+			Desc:   *u.Descriptor(),
+			Fields: []DBValue{IntField{update}},
+		}
+		return
+	}
+	return
+}
@@ -0,0 +1,253 @@
+package godb
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// barrierExpr evaluates to val once all of the goroutines sharing its wait
+// group have reached it, forcing their reads to happen before any write.
+type barrierExpr struct {
+	wg  *sync.WaitGroup
+	val DBValue
+}
+
+func (b *barrierExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	b.wg.Done()
+	b.wg.Wait()
+	return b.val, nil
+}
+
+func (b *barrierExpr) GetExprType() FieldType {
+	return FieldType{"age", "", IntType}
+}
+
+func TestUpdate(t *testing.T) {
+	_, t1, t2, hf, bp, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+
+	nameField := FieldExpr{t1.Desc.Fields[0]}
+	ageField := FieldExpr{t1.Desc.Fields[1]}
+	filt, err := NewFilter(&ConstExpr{StringField{"sam"}, StringType}, OpEq, &nameField, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	plusOne := &FuncExpr{"+", []*Expr{exprPtr(&ageField), exprPtr(&ConstExpr{IntField{1}, IntType})}}
+	upd, err := NewUpdateOp(hf, []Expr{&nameField, plusOne}, filt)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := upd.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tup, err := iter()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup.Fields[0].(IntField).Value != 1 {
+		t.Fatalf("expected 1 updated tuple, got %v", tup.Fields[0])
+	}
+	bp.FlushAllPages()
+
+	expected := Tuple{Desc: t1.Desc, Fields: []DBValue{StringField{"sam"}, IntField{26}}}
+	scan, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatchesUnordered(scan, []*Tuple{&expected, &t2}); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if _, err := NewUpdateOp(hf, []Expr{&nameField}, hf); err == nil {
+		t.Errorf("expected an error with too few update expressions")
+	}
+}
+
+func exprPtr(e Expr) *Expr {
+	return &e
+}
+
+func TestUpdateConcurrentConflict(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	bp.FlushAllPages()
+	bp.CommitTransaction(tid)
+
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+	errs := make([]error, 2)
+	var done sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		done.Add(1)
+		go func(i int) {
+			defer done.Done()
+			tid := NewTID()
+			age := &barrierExpr{&barrier, IntField{int64(100 + i)}}
+			upd, err := NewUpdateOp(hf, []Expr{&FieldExpr{t1.Desc.Fields[0]}, age}, hf)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			iter, err := upd.Iterator(tid)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			_, errs[i] = iter()
+		}(i)
+	}
+	done.Wait()
+
+	succeeded, conflicted := 0, 0
+	for _, err := range errs {
+		var gErr GoDBError
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.As(err, &gErr) && gErr.code == ConflictError:
+			conflicted++
+		default:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 || conflicted != 1 {
+		t.Fatalf("expected exactly one update to succeed and one to conflict, got %d and %d", succeeded, conflicted)
+	}
+
+	tid = NewTID()
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cnt := 0
+	for tup, err := iter(); tup != nil || err != nil; tup, err = iter() {
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		age := tup.Fields[1].(IntField).Value
+		if age != 100 && age != 101 {
+			t.Errorf("unexpected age %d after update", age)
+		}
+		cnt++
+	}
+	if cnt != 1 {
+		t.Errorf("expected 1 tuple after update, got %d", cnt)
+	}
+}
+
+func TestUpdateVersionsPruned(t *testing.T) {
+	td, t1, t2, hf, bp, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+	bp.CommitTransaction(tid)
+	if len(hf.versions) != 0 {
+		t.Fatalf("expected no versions once no transaction runs, got %d", len(hf.versions))
+	}
+
+	// the reader still needs the version of the tuple it read
+	reader := bp.NewTransaction()
+	readVersion := hf.tupleVersion(t1.Rid)
+	writer := bp.NewTransaction()
+	updated := &Tuple{td, []DBValue{StringField{"joe"}, IntField{30}}, nil}
+	if err := hf.updateTuple(&t1, updated, hf.tupleVersion(t1.Rid), writer); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(writer)
+	if len(hf.versions) != 1 {
+		t.Fatalf("expected the version of the updated tuple to be kept, got %d versions", len(hf.versions))
+	}
+	err := hf.updateTuple(&t1, &Tuple{td, []DBValue{StringField{"sam"}, IntField{26}}, nil}, readVersion, reader)
+	var gErr GoDBError
+	if !errors.As(err, &gErr) || gErr.code != ConflictError {
+		t.Fatalf("expected a ConflictError for a stale read, got %v", err)
+	}
+
+	insertTupleForTest(t, hf, &t1, reader)
+	bp.CommitTransaction(reader)
+	if len(hf.versions) != 0 {
+		t.Fatalf("expected no versions once no transaction runs, got %d", len(hf.versions))
+	}
+}
+
+// hookExpr evaluates to the value of expr, calling hook before the first
+// evaluation.
+type hookExpr struct {
+	expr Expr
+	hook func()
+}
+
+func (h *hookExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	if h.hook != nil {
+		hook := h.hook
+		h.hook = nil
+		hook()
+	}
+	return h.expr.EvalExpr(t)
+}
+
+func (h *hookExpr) GetExprType() FieldType {
+	return h.expr.GetExprType()
+}
+
+func TestUpdateInterleavedConflict(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	bp.CommitTransaction(tid)
+
+	nameField := &FieldExpr{t1.Desc.Fields[0]}
+	setAge := func(tid TransactionID, age int64, child Operator) error {
+		upd, err := NewUpdateOp(hf, []Expr{nameField, &ConstExpr{IntField{age}, IntType}}, child)
+		if err != nil {
+			return err
+		}
+		iter, err := upd.Iterator(tid)
+		if err != nil {
+			return err
+		}
+		_, err = iter()
+		return err
+	}
+
+	// the second update commits after the first read the tuple, before the
+	// first writes it back
+	first := bp.NewTransaction()
+	second := bp.NewTransaction()
+	var secondErr error
+	hook := &hookExpr{nameField, func() {
+		secondErr = setAge(second, 200, hf)
+		bp.CommitTransaction(second)
+	}}
+	filt, err := NewFilter(&ConstExpr{StringField{"sam"}, StringType}, OpEq, hook, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = setAge(first, 100, filt)
+	if secondErr != nil {
+		t.Fatalf(secondErr.Error())
+	}
+	var gErr GoDBError
+	if !errors.As(err, &gErr) || gErr.code != ConflictError {
+		t.Fatalf("expected a ConflictError for the update of a tuple changed after it was read, got %v", err)
+	}
+	bp.AbortTransaction(first)
+
+	// a transaction does not conflict with its own writes
+	third := bp.NewTransaction()
+	for _, age := range []int64{300, 301} {
+		if err := setAge(third, age, hf); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	expected := Tuple{Desc: t1.Desc, Fields: []DBValue{StringField{"sam"}, IntField{301}}}
+	scan, err := hf.Iterator(third)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CheckIfOutputMatches(scan, []*Tuple{&expected}); err != nil {
+		t.Errorf(err.Error())
+	}
+	bp.CommitTransaction(third)
+}
@@ -1,7 +1,11 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
 	rdb "main/ridership_db"
 	"main/utils"
@@ -9,15 +13,12 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
 )
 
-func HomeHandler(w http.ResponseWriter, r *http.Request) {
-	// Get the selected chart from the query parameter
-	selectedChart := r.URL.Query().Get("line")
-	if selectedChart == "" {
-		selectedChart = "red"
-	}
-
+// openRidershipDB opens the RidershipDB the handlers read. It is a variable so
+// that tests can count the opens.
+var openRidershipDB = func() (rdb.RidershipDB, error) {
 	// instantiate ridershipDB
 	//var db rdb.RidershipDB = &rdb.SqliteRidershipDB{} // Sqlite implementation
 	var db rdb.RidershipDB = &rdb.CsvRidershipDB{} // CSV implementation
@@ -26,22 +27,81 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 	//err := db.Open("../mbta.sqlite")
 	err := db.Open("../mbta.csv")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
+	return db, nil
+}
+
+// the RidershipDB shared by all requests, opened by the first one
+var (
+	dbOnce sync.Once
+	db     rdb.RidershipDB
+	dbErr  error
+)
 
-	values, err := db.GetRidership(selectedChart)
+// ridershipDB returns the RidershipDB shared by all requests, opening it on the
+// first call. It stays open for the life of the server, so the data is only
+// parsed once.
+func ridershipDB() (rdb.RidershipDB, error) {
+	dbOnce.Do(func() {
+		db, dbErr = openRidershipDB()
+	})
+	return db, dbErr
+}
+
+// getRidership returns the line selected by the query parameters of r, red by
+// default, the day type selected, and the ridership of the line on those days
+// in each of the time periods whose ids are periods. On an error, it also
+// returns the HTTP status to reply with: StatusNotFound if the line has no
+// data.
+func getRidership(r *http.Request) (lineId string, dayType rdb.DayType, periods []string, values []int64, status int, err error) {
+	// Get the selected line from the query parameter
+	lineId = r.URL.Query().Get("line")
+	if lineId == "" {
+		lineId = "red"
+	}
+	// and the days to sum the ridership of, all of them by default
+	dayType = rdb.DayType(r.URL.Query().Get("days"))
+	if dayType != rdb.AllDays && dayType != rdb.Weekdays && dayType != rdb.Weekends {
+		return lineId, dayType, nil, nil, http.StatusBadRequest, fmt.Errorf("unknown days %s", dayType)
+	}
+
+	db, err := ridershipDB()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return lineId, dayType, nil, nil, http.StatusInternalServerError, err
+	}
+
+	periods, values, err = db.GetRidershipByPeriod(lineId, dayType)
+	if errors.Is(err, rdb.ErrNoData) {
+		return lineId, dayType, nil, nil, http.StatusNotFound, err
+	}
+	if err != nil {
+		return lineId, dayType, nil, nil, http.StatusInternalServerError, err
+	}
+	return lineId, dayType, periods, values, http.StatusOK, nil
+}
+
+func HomeHandler(w http.ResponseWriter, r *http.Request) {
+	selectedChart, dayType, periods, values, status, err := getRidership(r)
+	// a line without data gets a message in place of the chart
+	noData := errors.Is(err, rdb.ErrNoData)
+	if err != nil && !noData {
+		http.Error(w, err.Error(), status)
 		return
 	}
 
 	// Plot the bar chart using utils.GenerateBarChart. The function will return the bar chart
 	// as PNG byte slice. Convert the bytes to a base64 string, which is used to embed images in HTML.
-	chartBytes, err := utils.GenerateBarChart(values)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	var chartBytes []byte
+	var message string
+	if noData {
+		message = fmt.Sprintf("No data for line %s", selectedChart)
+	} else {
+		chartBytes, err = utils.GenerateBarChart(selectedChart, periods, values)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
 
 	// Get path to the HTML template for our web app
@@ -62,21 +122,43 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 
 	// We now want to create a struct to hold the values we want to embed in the HTML
 	data := struct {
-		Image string
-		Chart string
+		Image   string
+		Chart   string
+		Days    string
+		Message string
 	}{
-		Image: base64.StdEncoding.EncodeToString(chartBytes),
-		Chart: selectedChart,
+		Image:   base64.StdEncoding.EncodeToString(chartBytes),
+		Chart:   selectedChart,
+		Days:    string(dayType),
+		Message: message,
 	}
 
 	// Use tmpl.Execute to generate the final HTML output and send it as a response
 	// to the client's request.
-	err = tmpl.Execute(w, data)
+	var page bytes.Buffer
+	err = tmpl.Execute(&page, data)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(200)
+	w.WriteHeader(status)
+	w.Write(page.Bytes())
 	return
 }
+
+// RidershipAPIHandler replies with the ridership of the line selected by the
+// line query parameter, on the days selected by the days one, as a JSON array
+// with one number per time period.
+func RidershipAPIHandler(w http.ResponseWriter, r *http.Request) {
+	_, _, _, values, status, err := getRidership(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(values); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"encoding/json"
+	"io"
+	rdb "main/ridership_db"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -26,3 +32,107 @@ func TestHomeHandler(t *testing.T) {
 		t.Errorf("Expected status %d; got %d", http.StatusOK, resp.StatusCode)
 	}
 }
+
+func TestRidershipAPIHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(RidershipAPIHandler))
+	defer srv.Close()
+
+	db := &rdb.CsvRidershipDB{}
+	if err := db.Open("../mbta.csv"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	expected, err := db.GetRidership("blue", rdb.AllDays)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(srv.URL + "/api/ridership?line=blue")
+	if err != nil {
+		t.Fatalf("Failed to send request: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d; got %d", http.StatusOK, resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected a JSON content type; got %s", ct)
+	}
+
+	var values []int64
+	if err := json.NewDecoder(resp.Body).Decode(&values); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v; got %v", expected, values)
+	}
+
+	resp, err = http.Get(srv.URL + "/api/ridership?line=blue&days=holiday")
+	if err != nil {
+		t.Fatalf("Failed to send request: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status %d for unknown days; got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestHomeHandlerNoData(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(HomeHandler))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/?line=purple")
+	if err != nil {
+		t.Fatalf("Failed to send request: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status %d; got %d", http.StatusNotFound, resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "No data for line purple") {
+		t.Errorf("Expected a no data message; got %s", body)
+	}
+	if strings.Contains(string(body), "<img") {
+		t.Errorf("Expected no chart for a line without data")
+	}
+}
+
+func TestHandlersOpenRidershipDBOnce(t *testing.T) {
+	open := openRidershipDB
+	opens := 0
+	openRidershipDB = func() (rdb.RidershipDB, error) {
+		opens++
+		return open()
+	}
+	dbOnce = sync.Once{}
+	defer func() {
+		openRidershipDB = open
+		dbOnce = sync.Once{}
+	}()
+
+	srv := httptest.NewServer(http.HandlerFunc(RidershipAPIHandler))
+	defer srv.Close()
+	var replies [2][]int64
+	for i := range replies {
+		resp, err := http.Get(srv.URL + "/api/ridership?line=red")
+		if err != nil {
+			t.Fatalf("Failed to send request: %s", err)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&replies[i])
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if opens != 1 {
+		t.Errorf("Expected the ridership data to be opened once; got %d", opens)
+	}
+	if len(replies[1]) == 0 || !reflect.DeepEqual(replies[0], replies[1]) {
+		t.Errorf("Expected the same ridership twice; got %v and %v", replies[0], replies[1])
+	}
+}
@@ -10,7 +10,10 @@ func main() {
 	// Fill out the HomeHandler function in handlers/handlers.go which handles the user's GET request.
 	// Start an http server using http.ListenAndServe that handles requests using HomeHandler.
 
-	err := http.ListenAndServe(":8080", http.HandlerFunc(handlers.HomeHandler))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handlers.HomeHandler)
+	mux.HandleFunc("/api/ridership", handlers.RidershipAPIHandler)
+	err := http.ListenAndServe(":8080", mux)
 	if err != nil {
 		fmt.Println("web listen failed err:", err)
 	}
@@ -4,26 +4,47 @@ import (
 	"encoding/csv"
 	"fmt"
 	"os"
+	"slices"
+	"sort"
 	"strconv"
+	"sync"
 )
 
+// CsvRidershipDB reads ridership from a CSV file whose header row names its
+// columns, which may come in any order; the line_id, time_period_id and
+// total_ons columns are required. A file without a header row is read in the
+// column order of defaultColumns. The file is parsed once, by the first call
+// to GetRidership, which may be called concurrently.
 type CsvRidershipDB struct {
-	idIdxMap      map[string]int
-	csvFile       *os.File
-	csvReader     *csv.Reader
-	num_intervals int
+	// Comma is the field separator, ',' if zero. Set it before Open.
+	Comma rune
+	// SkipRows is the number of lines before the header row, which are ignored.
+	// Set it before Open.
+	SkipRows int
+
+	csvFile   *os.File
+	csvReader *csv.Reader
+
+	// the parsed file, once parsed is set; parseErr is the error parsing it
+	parseLock sync.Mutex
+	parsed    bool
+	parseErr  error
+	header    []string
+	rows      [][]string
+	columns   []int // the indexes of the line id, time period and total ons
 }
 
-func (c *CsvRidershipDB) Open(filePath string) error {
-	c.num_intervals = 9
+// the columns of the ridership CSV file read by CsvRidershipDB
+const (
+	lineIdColumn     = "line_id"
+	timePeriodColumn = "time_period_id"
+	totalOnsColumn   = "total_ons"
+)
 
-	// Create a map that maps MBTA's time period ids to indexes in the slice
-	c.idIdxMap = make(map[string]int)
-	for i := 1; i <= c.num_intervals; i++ {
-		timePeriodID := fmt.Sprintf("time_period_%02d", i)
-		c.idIdxMap[timePeriodID] = i - 1
-	}
+// defaultColumns are the columns of a ridership CSV file without a header row
+var defaultColumns = []string{lineIdColumn, "direction", timePeriodColumn, "station_id", totalOnsColumn}
 
+func (c *CsvRidershipDB) Open(filePath string) error {
 	// create csv reader
 	csvFile, err := os.Open(filePath)
 	if err != nil {
@@ -31,34 +52,160 @@ func (c *CsvRidershipDB) Open(filePath string) error {
 	}
 	c.csvFile = csvFile
 	c.csvReader = csv.NewReader(c.csvFile)
+	if c.Comma != 0 {
+		c.csvReader.Comma = c.Comma
+	}
+	// the skipped lines need not have as many fields as the others
+	c.csvReader.FieldsPerRecord = -1
 
 	return nil
 }
 
 // Implement the remaining RidershipDB methods
 
-func (c *CsvRidershipDB) GetRidership(lineId string) (reply []int64, err error) {
-	// line_id,direction,time_period_id,station_id,total_ons
-	dataSlice, err := c.csvReader.ReadAll()
+// GetRidership returns the total ridership of lineId on the days of dayType for
+// every time period, ordered by time period id. The time periods are
+// discovered from the data, so every line gets one entry per time period
+// present in the file. A file without a day_type_name column is summed for
+// every day type. Returns ErrNoData if no row matches lineId and dayType.
+func (c *CsvRidershipDB) GetRidership(lineId string, dayType DayType) (reply []int64, err error) {
+	_, reply, err = c.GetRidershipByPeriod(lineId, dayType)
+	return
+}
+
+// GetRidershipByPeriod returns the time period ids of GetRidership, ordered by
+// id, and the ridership of lineId on the days of dayType in each.
+func (c *CsvRidershipDB) GetRidershipByPeriod(lineId string, dayType DayType) (periods []string, reply []int64, err error) {
+	header, dataSlice, columns, err := c.parse()
+	if err != nil {
+		return
+	}
+
+	dayTypeIdx := slices.Index(header, dayTypeColumn)
+	days := dayTypeNames(dayType)
+
+	matched := 0
+	periods, sums, err := groupSum(dataSlice, columns[1], columns[2], func(data []string) bool {
+		if days != nil && dayTypeIdx >= 0 && !slices.Contains(days, data[dayTypeIdx]) {
+			return false
+		}
+		if data[columns[0]] != lineId {
+			return false
+		}
+		matched++
+		return true
+	})
+	if err != nil {
+		return
+	}
+	if matched == 0 {
+		return nil, nil, fmt.Errorf("line %s: %w", lineId, ErrNoData)
+	}
+
+	reply = make([]int64, len(periods))
+	for i, period := range periods {
+		reply[i] = sums[period]
+	}
+	return
+}
+
+// parse returns the header of the CSV file, its rows of data and the indexes of
+// the line id, time period and total ons columns, reading the file on the
+// first call only.
+func (c *CsvRidershipDB) parse() (header []string, rows [][]string, columns []int, err error) {
+	c.parseLock.Lock()
+	defer c.parseLock.Unlock()
+	if !c.parsed {
+		c.parsed = true
+		c.header, c.rows, c.columns, c.parseErr = c.readRows()
+	}
+	return c.header, c.rows, c.columns, c.parseErr
+}
+
+// readRows reads the whole CSV file for parse.
+func (c *CsvRidershipDB) readRows() (header []string, rows [][]string, columns []int, err error) {
+	rows, err = c.csvReader.ReadAll()
 	if err != nil {
 		return
 	}
+	header = defaultColumns
+	if len(rows) <= c.SkipRows {
+		rows = nil
+	} else {
+		rows = rows[c.SkipRows:]
+		if isHeaderRow(rows[0]) {
+			header = rows[0]
+			rows = rows[1:]
+		}
+	}
+	columns, err = columnIndexes(header, lineIdColumn, timePeriodColumn, totalOnsColumn)
+	if err != nil {
+		return
+	}
+	for i, row := range rows {
+		if len(row) != len(header) {
+			return nil, nil, nil, fmt.Errorf("csv row %d has %d fields, the header has %d", i+1, len(row), len(header))
+		}
+	}
+	return
+}
 
-	var total int
-	reply = make([]int64, c.num_intervals)
-	for _, data := range dataSlice {
-		if data[0] != lineId {
-			// not the line
+// isHeaderRow reports whether row, the first row of a ridership CSV file, is a
+// header row rather than a row of data in the defaultColumns order, whose
+// total_ons is a number.
+func isHeaderRow(row []string) bool {
+	if len(row) != len(defaultColumns) {
+		return true
+	}
+	_, err := strconv.Atoi(row[len(defaultColumns)-1])
+	return err != nil
+}
+
+// columnIndexes returns the index in header of each of the named columns, or an
+// error naming a column the header lacks.
+func columnIndexes(header []string, names ...string) ([]int, error) {
+	indexes := make([]int, len(names))
+	for i, name := range names {
+		indexes[i] = -1
+		for j, column := range header {
+			if column == name {
+				indexes[i] = j
+				break
+			}
+		}
+		if indexes[i] < 0 {
+			return nil, fmt.Errorf("csv header has no %s column", name)
+		}
+	}
+	return indexes, nil
+}
+
+// groupSum groups rows by the value in column keyIdx and sums the integer
+// column valIdx of the rows accepted by include. All keys seen in rows are
+// returned in sorted order, including those of groups that include rejected
+// entirely. A value that is not an integer is an error naming its row.
+func groupSum(rows [][]string, keyIdx, valIdx int, include func([]string) bool) (keys []string, sums map[string]int64, err error) {
+	var val int
+	sums = make(map[string]int64)
+	for i, row := range rows {
+		key := row[keyIdx]
+		if _, ok := sums[key]; !ok {
+			sums[key] = 0
+			keys = append(keys, key)
+		}
+
+		if !include(row) {
 			continue
 		}
 
-		total, err = strconv.Atoi(data[4])
+		val, err = strconv.Atoi(row[valIdx])
 		if err != nil {
-			return
+			return nil, nil, fmt.Errorf("csv row %d: %w", i+1, err)
 		}
-
-		reply[c.idIdxMap[data[2]]] += int64(total)
+		sums[key] += int64(val)
 	}
+
+	sort.Strings(keys)
 	return
 }
 
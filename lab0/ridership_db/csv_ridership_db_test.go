@@ -0,0 +1,263 @@
+package ridershipDB
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeTestCsv(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ridership.csv")
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCsvRidershipDBDynamicPeriods(t *testing.T) {
+	path := writeTestCsv(t, `line_id,direction,time_period_id,station_id,total_ons
+red,0,time_period_02,place-a,10
+red,1,time_period_01,place-b,5
+blue,0,time_period_03,place-c,7
+red,0,time_period_01,place-c,3
+`)
+
+	db := &CsvRidershipDB{}
+	if err := db.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	values, err := db.GetRidership("red", AllDays)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// time_period_03 has no red rows but is still reported as a period
+	expected := []int64{8, 10, 0}
+	if len(values) != len(expected) {
+		t.Fatalf("expected %d time periods, got %d (%v)", len(expected), len(values), values)
+	}
+	for i := range expected {
+		if values[i] != expected[i] {
+			t.Errorf("period %d: expected %d, got %d", i, expected[i], values[i])
+		}
+	}
+
+	// the ids of the periods come with the ridership, in the same order
+	periods, byPeriod, err := db.GetRidershipByPeriod("red", AllDays)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedPeriods := []string{"time_period_01", "time_period_02", "time_period_03"}
+	if !slices.Equal(periods, expectedPeriods) || !slices.Equal(byPeriod, values) {
+		t.Errorf("expected periods %v with %v, got %v with %v", expectedPeriods, values, periods, byPeriod)
+	}
+}
+
+func TestCsvRidershipDBReorderedColumns(t *testing.T) {
+	path := writeTestCsv(t, `exported by the MBTA;2024
+total_ons;station_id;time_period_id;direction;line_id
+10;place-a;time_period_02;0;red
+5;place-b;time_period_01;1;red
+7;place-c;time_period_01;0;blue
+`)
+
+	db := &CsvRidershipDB{Comma: ';', SkipRows: 1}
+	if err := db.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	values, err := db.GetRidership("red", AllDays)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []int64{5, 10}
+	if len(values) != len(expected) {
+		t.Fatalf("expected %d time periods, got %d (%v)", len(expected), len(values), values)
+	}
+	for i := range expected {
+		if values[i] != expected[i] {
+			t.Errorf("period %d: expected %d, got %d", i, expected[i], values[i])
+		}
+	}
+}
+
+func TestCsvRidershipDBMissingColumn(t *testing.T) {
+	path := writeTestCsv(t, `line_id,direction,time_period_id,station_id
+red,0,time_period_01,place-a
+`)
+
+	db := &CsvRidershipDB{}
+	if err := db.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.GetRidership("red", AllDays); err == nil {
+		t.Fatal("expected an error for a header without total_ons")
+	}
+}
+
+func TestCsvRidershipDBHeaderDetection(t *testing.T) {
+	rows := `red,0,time_period_01,place-a,10
+red,1,time_period_02,place-b,5
+red,0,time_period_01,place-c,3
+`
+	for _, tc := range []struct {
+		name     string
+		contents string
+	}{
+		{"header", "line_id,direction,time_period_id,station_id,total_ons\n" + rows},
+		{"no header", rows},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &CsvRidershipDB{}
+			if err := db.Open(writeTestCsv(t, tc.contents)); err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			values, err := db.GetRidership("red", AllDays)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := []int64{13, 5}
+			if len(values) != len(expected) || values[0] != expected[0] || values[1] != expected[1] {
+				t.Errorf("expected %v, got %v", expected, values)
+			}
+		})
+	}
+}
+
+func TestCsvRidershipDBMalformedRows(t *testing.T) {
+	header := "line_id,direction,time_period_id,station_id,total_ons\n"
+	for _, tc := range []struct {
+		name     string
+		contents string
+		errText  string
+	}{
+		{"short row", header + "red,0,time_period_01,place-a,10\nred,1,time_period_02\n", "csv row 2 has 3 fields"},
+		{"bad count", header + "red,0,time_period_01,place-a,ten\n", "csv row 1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &CsvRidershipDB{}
+			if err := db.Open(writeTestCsv(t, tc.contents)); err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			_, err := db.GetRidership("red", AllDays)
+			if err == nil || !strings.Contains(err.Error(), tc.errText) {
+				t.Errorf("expected an error containing %q, got %v", tc.errText, err)
+			}
+		})
+	}
+}
+
+func TestCsvRidershipDBDayTypes(t *testing.T) {
+	withDays := writeTestCsv(t, `line_id,day_type_name,time_period_id,total_ons
+red,weekday,time_period_01,10
+red,saturday,time_period_01,4
+red,sunday,time_period_02,2
+red,weekday,time_period_02,7
+blue,sunday,time_period_01,100
+`)
+	withoutDays := writeTestCsv(t, `line_id,time_period_id,total_ons
+red,time_period_01,10
+red,time_period_02,7
+`)
+
+	for _, tc := range []struct {
+		name     string
+		path     string
+		dayType  DayType
+		expected []int64
+	}{
+		{"all days", withDays, AllDays, []int64{14, 9}},
+		{"weekdays", withDays, Weekdays, []int64{10, 7}},
+		{"weekends", withDays, Weekends, []int64{4, 2}},
+		{"no day type column", withoutDays, Weekends, []int64{10, 7}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &CsvRidershipDB{}
+			if err := db.Open(tc.path); err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			values, err := db.GetRidership("red", tc.dayType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(values) != len(tc.expected) || values[0] != tc.expected[0] || values[1] != tc.expected[1] {
+				t.Errorf("expected %v, got %v", tc.expected, values)
+			}
+		})
+	}
+}
+
+func TestCsvRidershipDBNoData(t *testing.T) {
+	path := writeTestCsv(t, `line_id,day_type_name,time_period_id,total_ons
+red,weekday,time_period_01,0
+blue,sunday,time_period_01,5
+`)
+
+	for _, tc := range []struct {
+		lineId  string
+		dayType DayType
+		noData  bool
+	}{
+		{"red", AllDays, false}, // rows summing to zero are data
+		{"purple", AllDays, true},
+		{"red", Weekends, true},
+	} {
+		db := &CsvRidershipDB{}
+		if err := db.Open(path); err != nil {
+			t.Fatal(err)
+		}
+		_, err := db.GetRidership(tc.lineId, tc.dayType)
+		db.Close()
+		if errors.Is(err, ErrNoData) != tc.noData {
+			t.Errorf("%s on %q: expected no data %v, got err %v", tc.lineId, tc.dayType, tc.noData, err)
+		}
+	}
+}
+
+func TestCsvRidershipDBParsesOnce(t *testing.T) {
+	path := writeTestCsv(t, `line_id,time_period_id,total_ons
+red,time_period_01,10
+blue,time_period_01,4
+`)
+
+	db := &CsvRidershipDB{}
+	if err := db.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.GetRidership("red", AllDays); err != nil {
+		t.Fatal(err)
+	}
+
+	// later calls answer from the parsed rows, whatever the file holds now
+	if err := os.WriteFile(path, []byte("garbage\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		lineId   string
+		expected int64
+	}{{"red", 10}, {"blue", 4}} {
+		values, err := db.GetRidership(tc.lineId, AllDays)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(values) != 1 || values[0] != tc.expected {
+			t.Errorf("%s: expected [%d], got %v", tc.lineId, tc.expected, values)
+		}
+	}
+}
@@ -1,7 +1,42 @@
 package ridershipDB
 
+import "errors"
+
+// ErrNoData is returned by GetRidership when no rows of the data match the line
+// and day type asked for, unlike rows whose ridership sums to zero.
+var ErrNoData = errors.New("no ridership data")
+
 type RidershipDB interface {
 	Open(filePath string) error
-	GetRidership(lineId string) ([]int64, error)
+	GetRidership(lineId string, dayType DayType) ([]int64, error)
+	// GetRidershipByPeriod returns the time period ids GetRidership reports the
+	// ridership of, in the same order, along with the ridership.
+	GetRidershipByPeriod(lineId string, dayType DayType) (periods []string, values []int64, err error)
 	Close() error
 }
+
+// DayType selects the days whose ridership GetRidership sums. Data without a
+// day type is summed whatever the day type selected.
+type DayType string
+
+const (
+	AllDays  DayType = ""
+	Weekdays DayType = "weekday"
+	Weekends DayType = "weekend"
+)
+
+// dayTypeColumn is the column of the ridership data naming the day type of a
+// row: weekday, saturday or sunday
+const dayTypeColumn = "day_type_name"
+
+// dayTypeNames returns the values of dayTypeColumn selected by dayType, or nil
+// for all of them
+func dayTypeNames(dayType DayType) []string {
+	switch dayType {
+	case Weekdays:
+		return []string{"weekday"}
+	case Weekends:
+		return []string{"saturday", "sunday"}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package ridershipDB
 
 import (
 	// rdb "main/ridership_db"
+	"slices"
 	"testing"
 )
 
@@ -28,12 +29,12 @@ func TestRidershipDBsMatch(t *testing.T) {
 			defer sqliteDB.Close()
 
 			// Retrieve data from both implementations
-			csvData, err := csvDB.GetRidership(lineId)
+			csvData, err := csvDB.GetRidership(lineId, AllDays)
 			if err != nil {
 				t.Fatal(err)
 			}
 
-			sqliteData, err := sqliteDB.GetRidership(lineId)
+			sqliteData, err := sqliteDB.GetRidership(lineId, AllDays)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -48,6 +49,19 @@ func TestRidershipDBsMatch(t *testing.T) {
 					t.Errorf("Mismatched data at index %d: Csv: %d, SQLite: %d", i, csvData[i], sqliteData[i])
 				}
 			}
+
+			// and the time periods the data is for
+			csvPeriods, _, err := csvDB.GetRidershipByPeriod(lineId, AllDays)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sqlitePeriods, _, err := sqliteDB.GetRidershipByPeriod(lineId, AllDays)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(csvPeriods, sqlitePeriods) {
+				t.Errorf("Mismatched time periods: Csv: %v, SQLite: %v", csvPeriods, sqlitePeriods)
+			}
 		})
 	}
 }
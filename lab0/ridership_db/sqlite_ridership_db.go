@@ -2,6 +2,8 @@ package ridershipDB
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -19,38 +21,81 @@ func (s *SqliteRidershipDB) Open(filePath string) error {
 	return nil
 }
 
-func (s *SqliteRidershipDB) GetRidership(lineId string) ([]int64, error) {
+// GetRidership returns the total ridership of lineId on the days of dayType for
+// every time period, ordered by time period id. A table without a
+// day_type_name column is summed for every day type. Returns ErrNoData if no
+// row matches lineId and dayType.
+func (s *SqliteRidershipDB) GetRidership(lineId string, dayType DayType) ([]int64, error) {
+	_, values, err := s.GetRidershipByPeriod(lineId, dayType)
+	return values, err
+}
+
+// GetRidershipByPeriod returns the time period ids of GetRidership, ordered by
+// id, and the ridership of lineId on the days of dayType in each.
+func (s *SqliteRidershipDB) GetRidershipByPeriod(lineId string, dayType DayType) ([]string, []int64, error) {
+	args := []any{lineId}
+	dayFilter := ""
+	if days := dayTypeNames(dayType); days != nil {
+		hasDayType, err := s.hasColumn("rail_ridership", dayTypeColumn)
+		if err != nil {
+			return nil, nil, err
+		}
+		if hasDayType {
+			dayFilter = "AND " + dayTypeColumn + " IN (?" + strings.Repeat(", ?", len(days)-1) + ")"
+			for _, day := range days {
+				args = append(args, day)
+			}
+		}
+	}
+
 	query := `
-		SELECT SUM(total_ons)
+		SELECT time_period_id, SUM(total_ons)
 		FROM rail_ridership
 		WHERE season = 'Fall 2017'
 			AND time_period_id NOT IN ('time_period_10', 'time_period_11')
 			AND line_id = ?
+			` + dayFilter + `
 		GROUP BY time_period_id
 		ORDER BY time_period_id;
 	`
 
-	rows, err := s.db.Query(query, lineId)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
+	var periods []string
 	var values []int64
 	for rows.Next() {
+		var period string
 		var value int64
-		err := rows.Scan(&value)
+		err := rows.Scan(&period, &value)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+		periods = append(periods, period)
 		values = append(values, value)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if len(values) == 0 {
+		return nil, nil, fmt.Errorf("line %s: %w", lineId, ErrNoData)
 	}
 
-	return values, nil
+	return periods, values, nil
+}
+
+// hasColumn reports whether table has the named column
+func (s *SqliteRidershipDB) hasColumn(table, column string) (bool, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
 }
 
 func (s *SqliteRidershipDB) Close() error {
@@ -8,24 +8,69 @@ import (
 	"github.com/wcharczuk/go-chart/drawing"
 )
 
-// Generates a bar chart and returns the PNG image bytes
-func GenerateBarChart(values []int64) ([]byte, error) {
-	// times corresponding to time_periods
-	labels := []string{
-		"3:00 - 05:59",
-		"6:00 - 06:59",
-		"7:00 - 08:59",
-		"9:00 - 13:29",
-		"13:30 - 15:59",
-		"16:00 - 18:29",
-		"18:30 - 21:59",
-		"22:00 - 23:59",
-		"0:00 - 02:59",
+// the official colors of the MBTA subway lines, by line id
+var lineColors = map[string]drawing.Color{
+	"red":    drawing.ColorFromHex("DA291C"),
+	"orange": drawing.ColorFromHex("ED8B00"),
+	"blue":   drawing.ColorFromHex("003DA5"),
+	"green":  drawing.ColorFromHex("00843D"),
+}
+
+// LineColor returns the official color of the MBTA line lineId, or blue for
+// other lines
+func LineColor(lineId string) drawing.Color {
+	if color, ok := lineColors[lineId]; ok {
+		return color
 	}
+	return drawing.ColorBlue
+}
+
+// the names of the MBTA time periods, by time period id
+var timePeriodNames = map[string]string{
+	"time_period_01": "Very early morning", // 3:00 - 05:59
+	"time_period_02": "Early AM",           // 6:00 - 06:59
+	"time_period_03": "AM peak",            // 7:00 - 08:59
+	"time_period_04": "Midday base",        // 9:00 - 13:29
+	"time_period_05": "Midday school",      // 13:30 - 15:59
+	"time_period_06": "PM peak",            // 16:00 - 18:29
+	"time_period_07": "Evening",            // 18:30 - 21:59
+	"time_period_08": "Late evening",       // 22:00 - 23:59
+	"time_period_09": "Night",              // 0:00 - 02:59
+}
 
-	if len(labels) != len(values) {
-		fmt.Println(len(values))
-		return nil, fmt.Errorf("number of labels and values must be the same")
+// TimePeriodName returns the name of the MBTA time period periodId, or
+// periodId itself for an unknown time period
+func TimePeriodName(periodId string) string {
+	if name, ok := timePeriodNames[periodId]; ok {
+		return name
+	}
+	return periodId
+}
+
+// Generates a bar chart of the ridership of line lineId, in the color of the
+// line, and returns the PNG image bytes. values are the ridership of the time
+// periods whose ids are periods, as returned by the RidershipDB.
+func GenerateBarChart(lineId string, periods []string, values []int64) ([]byte, error) {
+	graph, err := barChart(lineId, periods, values)
+	if err != nil {
+		return nil, err
+	}
+
+	// Render the chart as PNG image bytes
+	buffer := bytes.NewBuffer([]byte{})
+	err = graph.Render(chart.PNG, buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// barChart builds the bar chart of the ridership values of line lineId, one bar
+// per time period, labelled with the name of the period
+func barChart(lineId string, periods []string, values []int64) (*chart.BarChart, error) {
+	if len(periods) != len(values) {
+		return nil, fmt.Errorf("got %d values for %d time periods", len(values), len(periods))
 	}
 
 	graph := chart.BarChart{
@@ -58,24 +103,17 @@ func GenerateBarChart(values []int64) ([]byte, error) {
 		Bars: []chart.Value{},
 	}
 
-	for i, label := range labels {
+	color := LineColor(lineId)
+	for i, period := range periods {
 		graph.Bars = append(graph.Bars, chart.Value{
-			Label: label,
+			Label: TimePeriodName(period),
 			Value: float64(values[i]),
 			Style: chart.Style{
 				Show:        true,
-				FillColor:   drawing.ColorBlue,
-				StrokeColor: drawing.ColorBlue,
+				FillColor:   color,
+				StrokeColor: color,
 			},
 		})
 	}
-
-	// Render the chart as PNG image bytes
-	buffer := bytes.NewBuffer([]byte{})
-	err := graph.Render(chart.PNG, buffer)
-	if err != nil {
-		return nil, err
-	}
-
-	return buffer.Bytes(), nil
+	return &graph, nil
 }
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestLineColors(t *testing.T) {
+	seen := make(map[string]string)
+	for _, line := range []string{"red", "orange", "blue", "green"} {
+		color := LineColor(line).String()
+		if other, ok := seen[color]; ok {
+			t.Errorf("lines %s and %s have the same color %s", other, line, color)
+		}
+		seen[color] = line
+
+		chart, err := GenerateBarChart(line, []string{"time_period_01", "time_period_02"}, make([]int64, 2))
+		if err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		if len(chart) == 0 {
+			t.Errorf("%s: empty chart", line)
+		}
+	}
+
+	if LineColor("silver") != LineColor("mattapan") {
+		t.Errorf("expected other lines to share the default color")
+	}
+}
+
+func TestTimePeriodLabels(t *testing.T) {
+	graph, err := barChart("red", []string{"time_period_01", "time_period_03", "time_period_10"}, []int64{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"Very early morning", "AM peak", "time_period_10"}
+	if len(graph.Bars) != len(expected) {
+		t.Fatalf("expected %d bars, got %d", len(expected), len(graph.Bars))
+	}
+	for i, bar := range graph.Bars {
+		if bar.Label != expected[i] {
+			t.Errorf("bar %d: expected label %q, got %q", i, expected[i], bar.Label)
+		}
+	}
+
+	if _, err := GenerateBarChart("red", []string{"time_period_01", "time_period_02"}, make([]int64, 3)); err == nil {
+		t.Errorf("expected an error for more values than time periods")
+	}
+}